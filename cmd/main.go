@@ -1,8 +1,13 @@
 package main
 
 import (
+	"car-bond/internals/config"
 	"car-bond/internals/database"
+	"car-bond/internals/middleware"
+	"car-bond/internals/notifier"
 	"car-bond/internals/routes"
+	"car-bond/internals/scheduler"
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -11,6 +16,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/fiber/v2/middleware/session"
 )
 
@@ -45,14 +51,27 @@ func main() {
 		c.Locals("session", sess)
 		return c.Next()
 	})
+	app.Use(requestid.New())
+	app.Use(middleware.Audit())
+	app.Use(middleware.Tenant())
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*", // Allow all origins
 		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
 	}))
 
+	// The scheduler and POST /notifications/run share one reminder runner
+	reminders := scheduler.NewPaymentReminders(db.GetDB(), notifier.NewFromConfig())
+
 	// Setup routes
-	routes.SetupRoute(app, db.GetDB())
+	routes.SetupRoute(app, db.GetDB(), reminders)
+
+	// Start the daily payment reminders (set REMINDERS_ENABLED=false to turn off)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if config.Config("REMINDERS_ENABLED") != "false" {
+		reminders.Start(ctx)
+	}
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -60,6 +79,7 @@ func main() {
 	go func() {
 		<-quit
 		log.Println("Shutting down server...")
+		cancel()
 		if err := app.Shutdown(); err != nil {
 			log.Fatalf("Error during shutdown: %v", err)
 		}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Actor is who made a write and in which request, with the company and group of their token
+type Actor struct {
+	UserID    uint
+	Username  string
+	CompanyID uint
+	Group     string
+	RequestID string
+}
+
+// Authenticated reports whether the actor comes from a valid token
+func (a Actor) Authenticated() bool {
+	return a.UserID != 0 || a.Username != ""
+}
+
+type actorKey struct{}
+
+// WithActor attaches an actor to a context; writes made with db.WithContext(ctx) are attributed to it
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromCtx reads the user from the JWT claims Protected leaves in c.Locals("user") and the request
+// ID from the requestid middleware
+func ActorFromCtx(c *fiber.Ctx) Actor {
+	var actor Actor
+	if id, ok := c.Locals("requestid").(string); ok {
+		actor.RequestID = id
+	}
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return actor
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return actor
+	}
+	if id, ok := claims["user_id"].(float64); ok {
+		actor.UserID = uint(id)
+	}
+	if name, ok := claims["username"].(string); ok {
+		actor.Username = name
+	}
+	if id, ok := claims["company_id"].(float64); ok {
+		actor.CompanyID = uint(id)
+	}
+	if group, ok := claims["group"].(string); ok {
+		actor.Group = group
+	}
+	return actor
+}
+
+// CurrentActor is the actor the context carries. Requests get theirs from the Audit and Protected
+// middleware in c.UserContext(), which the repositories pass on with db.WithContext.
+func CurrentActor(ctx context.Context) (Actor, bool) {
+	if ctx == nil {
+		return Actor{}, false
+	}
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
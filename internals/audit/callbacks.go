@@ -0,0 +1,316 @@
+package audit
+
+import (
+	"car-bond/internals/models/alertRegistration"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// snapshotLimit caps how many rows of one bulk update or delete are recorded
+const snapshotLimit = 1000
+
+const beforeKey = "audit:before"
+
+// auditTable is not audited itself
+var auditTable = "audit_logs"
+
+// secretColumns are recorded as changed but never with their values
+var secretColumns = map[string]bool{
+	"password":   true,
+	"token_hash": true,
+}
+
+const redacted = "[redacted]"
+
+// Register installs the callbacks that fill CreatedBy/UpdatedBy from the authenticated user and record
+// every create, update and delete made through GORM in the audit log. Raw SQL (Exec) is not recorded,
+// and secret columns such as passwords are recorded without their values.
+func Register(db *gorm.DB) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&alertRegistration.AuditLog{}); err != nil {
+		return err
+	}
+	auditTable = stmt.Schema.Table
+
+	create := db.Callback().Create()
+	if err := create.Before("gorm:create").After("gorm:before_create").Register("audit:fill_create", fillCreate); err != nil {
+		return err
+	}
+	if err := create.After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("audit:record_create", recordCreate); err != nil {
+		return err
+	}
+
+	update := db.Callback().Update()
+	if err := update.Before("gorm:update").After("gorm:before_update").Register("audit:before_update", beforeUpdate); err != nil {
+		return err
+	}
+	if err := update.After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("audit:record_update", recordUpdate); err != nil {
+		return err
+	}
+
+	remove := db.Callback().Delete()
+	if err := remove.Before("gorm:delete").After("gorm:before_delete").Register("audit:before_delete", takeSnapshot); err != nil {
+		return err
+	}
+	return remove.After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("audit:record_delete", recordDelete)
+}
+
+func audited(db *gorm.DB) bool {
+	stmt := db.Statement
+	return db.Error == nil && !stmt.DryRun && stmt.Schema != nil && stmt.Table != auditTable &&
+		stmt.Schema.PrioritizedPrimaryField != nil
+}
+
+// ====================
+
+// fillUser sets the user columns to the authenticated user, whatever the payload said
+func fillUser(db *gorm.DB, names ...string) {
+	if db.Statement.SkipHooks {
+		return
+	}
+	actor, ok := CurrentActor(db.Statement.Context)
+	if !ok || actor.Username == "" {
+		return
+	}
+	for _, name := range names {
+		if field := db.Statement.Schema.LookUpField(name); field != nil {
+			db.Statement.SetColumn(field.DBName, actor.Username, true)
+		}
+	}
+}
+
+func fillCreate(db *gorm.DB) {
+	if audited(db) {
+		fillUser(db, "CreatedBy", "UpdatedBy")
+	}
+}
+
+func beforeUpdate(db *gorm.DB) {
+	if audited(db) {
+		fillUser(db, "UpdatedBy")
+		takeSnapshot(db)
+	}
+}
+
+// ====================
+
+// primaryKeys lists the primary keys set on the model the statement works on
+func primaryKeys(stmt *gorm.Statement) []interface{} {
+	field := stmt.Schema.PrioritizedPrimaryField
+	var ids []interface{}
+	add := func(value reflect.Value) {
+		if id, zero := field.ValueOf(stmt.Context, reflect.Indirect(value)); !zero {
+			ids = append(ids, id)
+		}
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			add(stmt.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		add(stmt.ReflectValue)
+	}
+	return ids
+}
+
+// takeSnapshot reads the rows an update or delete is about to change, with the statement's conditions
+func takeSnapshot(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	stmt := db.Statement
+	// The model lets inline conditions such as Delete(&Car{}, id) name the primary key; deleted rows are
+	// filtered below rather than by GORM
+	query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table(stmt.Table).Model(stmt.Model).Unscoped()
+
+	conditions := false
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+		query = query.Clauses(clause.Where{Exprs: append([]clause.Expression(nil), where.Exprs...)})
+		conditions = true
+	}
+	if ids := primaryKeys(stmt); len(ids) > 0 {
+		query = query.Where(clause.IN{Column: clause.Column{Name: stmt.Schema.PrioritizedPrimaryField.DBName}, Values: ids})
+		conditions = true
+	}
+	if !conditions {
+		return // GORM refuses global updates and deletes anyway
+	}
+	if !stmt.Unscoped && stmt.Schema.LookUpField("DeletedAt") != nil {
+		query = query.Where(clause.Eq{Column: clause.Column{Name: "deleted_at"}, Value: nil})
+	}
+
+	var rows []map[string]interface{}
+	if err := query.Limit(snapshotLimit).Find(&rows).Error; err != nil {
+		db.AddError(fmt.Errorf("audit: failed to read %s before writing: %w", stmt.Table, err))
+		return
+	}
+	db.InstanceSet(beforeKey, rows)
+}
+
+func snapshot(db *gorm.DB) []map[string]interface{} {
+	rows, _ := db.InstanceGet(beforeKey)
+	before, _ := rows.([]map[string]interface{})
+	return before
+}
+
+// ====================
+
+func recordCreate(db *gorm.DB) {
+	if !audited(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+	stmt := db.Statement
+
+	var logs []alertRegistration.AuditLog
+	add := func(value reflect.Value) {
+		value = reflect.Indirect(value)
+		values := make(map[string]interface{})
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if v, zero := field.ValueOf(stmt.Context, value); !zero {
+				values[field.DBName] = redact(field.DBName, v)
+			}
+		}
+		id, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, value)
+		logs = append(logs, newLog(db, alertRegistration.AuditCreate, id, values))
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			add(stmt.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		add(stmt.ReflectValue)
+	}
+	save(db, logs)
+}
+
+type change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+func recordUpdate(db *gorm.DB) {
+	before := snapshot(db)
+	if !audited(db) || len(before) == 0 {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row[pk])
+	}
+	var after []map[string]interface{}
+	if err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table(db.Statement.Table).
+		Where(clause.IN{Column: clause.Column{Name: pk}, Values: ids}).Find(&after).Error; err != nil {
+		db.AddError(fmt.Errorf("audit: failed to read %s after writing: %w", db.Statement.Table, err))
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[fmt.Sprint(row[pk])] = row
+	}
+
+	var logs []alertRegistration.AuditLog
+	for _, old := range before {
+		current, ok := afterByID[fmt.Sprint(old[pk])]
+		if !ok {
+			continue
+		}
+		changes := make(map[string]change)
+		for column, value := range current {
+			if column == "updated_at" || sameValue(old[column], value) {
+				continue
+			}
+			changes[column] = change{From: redact(column, plain(old[column])), To: redact(column, plain(value))}
+		}
+		if len(changes) > 0 {
+			logs = append(logs, newLog(db, alertRegistration.AuditUpdate, old[pk], changes))
+		}
+	}
+	save(db, logs)
+}
+
+func recordDelete(db *gorm.DB) {
+	before := snapshot(db)
+	if !audited(db) || len(before) == 0 {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+
+	logs := make([]alertRegistration.AuditLog, 0, len(before))
+	for _, row := range before {
+		values := make(map[string]interface{}, len(row))
+		for column, value := range row {
+			if value != nil {
+				values[column] = redact(column, plain(value))
+			}
+		}
+		logs = append(logs, newLog(db, alertRegistration.AuditDelete, row[pk], values))
+	}
+	save(db, logs)
+}
+
+// ====================
+
+// redact hides the value of a secret column
+func redact(column string, value interface{}) interface{} {
+	if secretColumns[column] && value != nil {
+		return redacted
+	}
+	return value
+}
+
+// plain turns driver values JSON does not print well into text
+func plain(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
+
+func sameValue(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(plain(a))
+	encodedB, errB := json.Marshal(plain(b))
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+func newLog(db *gorm.DB, operation string, recordID interface{}, changes interface{}) alertRegistration.AuditLog {
+	actor, _ := CurrentActor(db.Statement.Context)
+	username := actor.Username
+	if username == "" {
+		username = "system"
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		encoded = json.RawMessage(fmt.Sprintf(`{"error": %q}`, err.Error()))
+	}
+	return alertRegistration.AuditLog{
+		Table:     db.Statement.Table,
+		RecordID:  fmt.Sprint(recordID),
+		Operation: operation,
+		Changes:   encoded,
+		UserID:    actor.UserID,
+		Username:  username,
+		RequestID: actor.RequestID,
+	}
+}
+
+// save writes the audit rows in the same transaction as the write they describe
+func save(db *gorm.DB, logs []alertRegistration.AuditLog) {
+	if len(logs) == 0 {
+		return
+	}
+	if err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		CreateInBatches(&logs, 200).Error; err != nil {
+		db.AddError(fmt.Errorf("audit: failed to record %s of %s: %w", logs[0].Operation, db.Statement.Table, err))
+	}
+}
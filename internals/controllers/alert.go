@@ -36,7 +36,7 @@ func (h *AlertController) CreateAlert(c *fiber.Ctx) error {
 	}
 
 	// Attempt to create the alert record using the repository
-	if err := h.repo.CreateAlert(alert); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateAlert(alert); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create alert",
@@ -56,7 +56,7 @@ func (h *AlertController) CreateAlert(c *fiber.Ctx) error {
 
 func (h *AlertController) SearchAlerts(c *fiber.Ctx) error {
 	// Call the repository function to get paginated search results
-	pagination, alerts, err := h.repo.SearchPaginatedAlerts(c)
+	pagination, alerts, err := h.repo.WithContext(c.UserContext()).SearchPaginatedAlerts(c)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -65,7 +65,7 @@ func (h *AlertController) SearchAlerts(c *fiber.Ctx) error {
 		})
 	}
 
-	companyNotifications, err := h.saleRepo.CheckPaymentNotifications(c)
+	companyNotifications, err := h.saleRepo.WithContext(c.UserContext()).CheckPaymentNotifications(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -98,7 +98,7 @@ func (h *AlertController) UpdateAlert(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the alert in the database
-	alert, err := h.repo.GetAlertByID(id)
+	alert, err := h.repo.WithContext(c.UserContext()).GetAlertByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -127,7 +127,7 @@ func (h *AlertController) UpdateAlert(c *fiber.Ctx) error {
 	updateAlertFields(&alert, payload) // Pass the parsed payload
 
 	// Save the changes to the database
-	if err := h.repo.UpdateAlert(&alert); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateAlert(&alert); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update alert",
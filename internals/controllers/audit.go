@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"car-bond/internals/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditController struct {
+	repo repository.AuditLogRepository
+}
+
+func NewAuditController(repo repository.AuditLogRepository) *AuditController {
+	return &AuditController{repo: repo}
+}
+
+// ============================================
+
+// GetAuditLogs lists the audit trail; filter with ?table=&record_id=&user=&operation=&request_id=&from=&to=
+func (h *AuditController) GetAuditLogs(c *fiber.Ctx) error {
+	pagination, logs, err := h.repo.WithContext(c.UserContext()).GetPaginatedAuditLogs(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve audit logs",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Audit logs retrieved successfully",
+		"data":    logs,
+		"pagination": fiber.Map{
+			"total_items":  pagination.TotalItems,
+			"total_pages":  pagination.TotalPages,
+			"current_page": pagination.CurrentPage,
+			"limit":        pagination.ItemsPerPage,
+		},
+	})
+}
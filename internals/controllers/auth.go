@@ -8,10 +8,13 @@ import (
 	"car-bond/internals/config"
 	"car-bond/internals/models/companyRegistration"
 	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -51,6 +54,8 @@ func CheckPasswordHash(password, hash string) bool {
 }
 
 func Login(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
 	type LoginInput struct {
 		Identity string `json:"identity"`
 		Password string `json:"password"`
@@ -63,6 +68,8 @@ func Login(c *fiber.Ctx, db *gorm.DB) error {
 		Group     string `json:"group"`
 		Location  string `json:"location"`
 		CompanyID uint   `json:"company_id"`
+		// MustChangePassword tells the client to ask for a new password before anything else
+		MustChangePassword bool `json:"must_change_password"`
 	}
 
 	// Parse the request body
@@ -230,30 +237,8 @@ func Login(c *fiber.Ctx, db *gorm.DB) error {
 		})
 	}
 
-	// Create JWT token
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = user.Username
-	claims["user_id"] = user.ID
-	claims["roles"] = roleCodes
-	claims["company_id"] = user.CompanyID
-	claims["exp"] = time.Now().Add(72 * time.Hour).Unix()
-
-	// Create JWT token for refresh
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	rtClaims := refreshToken.Claims.(jwt.MapClaims)
-	rtClaims["user_id"] = user.ID
-	rtClaims["exp"] = time.Now().Add(72 * 7 * time.Hour).Unix() // Refresh token expires in 72 hours
-
-	secretKey := config.Config("SECRET")
-	if secretKey == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Server configuration error",
-		})
-	}
-
-	t, err := token.SignedString([]byte(secretKey))
+	// Create the access token and the first refresh token of a new family
+	t, rt, err := issueSession(db, user, roleCodes, group_code, "")
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -262,15 +247,6 @@ func Login(c *fiber.Ctx, db *gorm.DB) error {
 		})
 	}
 
-	rt, err := refreshToken.SignedString([]byte(secretKey))
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to generate refresh token",
-			"data":    err.Error(),
-		})
-	}
-
 	// Populate UserData
 	userData := UserData{
 		ID:        user.ID,
@@ -279,6 +255,8 @@ func Login(c *fiber.Ctx, db *gorm.DB) error {
 		Group:     group_code,
 		Location:  country,
 		CompanyID: user.CompanyID,
+
+		MustChangePassword: user.MustChangePassword,
 	}
 
 	// Return the token and user data
@@ -293,6 +271,8 @@ func Login(c *fiber.Ctx, db *gorm.DB) error {
 
 // ======================= LOGIN =======================
 func Login_(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
 	type LoginInput struct {
 		Identity string `json:"identity"`
 		Password string `json:"password"`
@@ -344,53 +324,315 @@ func Login_(c *fiber.Ctx, db *gorm.DB) error {
 		roleCodes = append(roleCodes, r.Code)
 	}
 
-	// Create JWT access + refresh tokens
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = user.Username
-	claims["user_id"] = user.ID
-	claims["roles"] = roleCodes
-	claims["company_id"] = user.CompanyID
-	claims["exp"] = time.Now().Add(72 * time.Hour).Unix()
+	// Fetch the group, whose code the token carries
+	var group userRegistration.Group
+	if err := db.Where("id = ?", user.GroupID).Find(&group).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error retrieving group",
+			"data":    err.Error(),
+		})
+	}
 
-	// Create JWT token for refresh
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	rtClaims := refreshToken.Claims.(jwt.MapClaims)
-	rtClaims["user_id"] = user.ID
-	rtClaims["exp"] = time.Now().Add(72 * 7 * time.Hour).Unix()
+	// Create the access token and the first refresh token of a new family
+	t, rt, err := issueSession(db, user, roleCodes, group.Code, "")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to generate token",
+			"data":    err.Error(),
+		})
+	}
 
+	return c.JSON(fiber.Map{
+		"status":               "success",
+		"message":              "Login successful",
+		"token":                t,
+		"refresh_token":        rt,
+		"must_change_password": user.MustChangePassword,
+	})
+}
+
+// issueSession signs an access token for the user and hands out a refresh token of the family, or of a
+// new family when familyID is empty. The access token carries a jti so it can be revoked on its own, and
+// must_change_password while the user has to change their password before doing anything else.
+func issueSession(db *gorm.DB, user *userRegistration.User, roleCodes []string, groupCode, familyID string) (string, string, error) {
 	secretKey := config.Config("SECRET")
 	if secretKey == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return "", "", errors.New("server configuration error: SECRET is not set")
+	}
+
+	now := time.Now()
+	jti := uuid.NewString()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username":             user.Username,
+		"user_id":              user.ID,
+		"roles":                roleCodes,
+		"company_id":           user.CompanyID,
+		"group":                groupCode,
+		"must_change_password": user.MustChangePassword,
+		"jti":                  jti,
+		"iat":                  now.Unix(),
+		"exp":                  now.Add(repository.AccessTokenTTL).Unix(),
+	})
+	t, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		return "", "", err
+	}
+
+	rt, err := repository.NewTokenRepository(db).IssueRefreshToken(user.ID, familyID, jti)
+	if err != nil {
+		return "", "", err
+	}
+	return t, rt, nil
+}
+
+// tokenClaims are the claims of the access token Protected verified
+func tokenClaims(c *fiber.Ctx) (jwt.MapClaims, bool) {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+// ======================= REFRESH =======================
+
+// Refresh trades a refresh token for a new access token and the next refresh token of its family. Each
+// refresh token works once; presenting one again revokes every token of its family.
+func Refresh(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
+	type RefreshInput struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	var input RefreshInput
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Server configuration error",
+			"message": "refresh_token is required",
 		})
 	}
-	t, err := token.SignedString([]byte(secretKey))
+
+	used, err := repository.NewTokenRepository(db).RotateRefreshToken(input.RefreshToken)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidRefreshToken) || errors.Is(err, repository.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to generate token",
+			"message": "Failed to refresh token",
+			"data":    err.Error(),
+		})
+	}
+
+	// Roles and group are read again, so changes made since login take effect
+	var user userRegistration.User
+	if err := db.First(&user, used.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "User no longer exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error retrieving user",
+			"data":    err.Error(),
 		})
 	}
-	rt, err := refreshToken.SignedString([]byte(secretKey))
+	var group userRegistration.Group
+	if err := db.Where("id = ?", user.GroupID).Find(&group).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error retrieving group",
+			"data":    err.Error(),
+		})
+	}
+	var roles []userRegistration.Role
+	if err := db.Where("group_id = ?", user.GroupID).Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error retrieving roles",
+			"data":    err.Error(),
+		})
+	}
+	roleCodes := []string{}
+	for _, r := range roles {
+		roleCodes = append(roleCodes, r.Code)
+	}
+
+	t, rt, err := issueSession(db, &user, roleCodes, group.Code, used.FamilyID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to generate refresh token",
+			"message": "Failed to generate token",
+			"data":    err.Error(),
 		})
 	}
 
 	return c.JSON(fiber.Map{
 		"status":        "success",
-		"message":       "Login successful",
+		"message":       "Token refreshed",
 		"token":         t,
 		"refresh_token": rt,
 	})
 }
 
+// ======================= LOGOUT =======================
+
+// Logout revokes the access token of the request and, when given, the refresh token family it came with
+func Logout(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
+	type LogoutInput struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	claims, ok := tokenClaims(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid or expired JWT",
+		})
+	}
+	userID := uint(0)
+	if id, ok := claims["user_id"].(float64); ok {
+		userID = uint(id)
+	}
+
+	var input LogoutInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid logout request format",
+				"data":    err.Error(),
+			})
+		}
+	}
+
+	tokens := repository.NewTokenRepository(db)
+	if input.RefreshToken != "" {
+		// An unknown refresh token is no reason to keep the access token alive
+		if err := tokens.RevokeRefreshToken(input.RefreshToken, userID); err != nil && !errors.Is(err, repository.ErrInvalidRefreshToken) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to revoke refresh token",
+				"data":    err.Error(),
+			})
+		}
+	}
+
+	jti, _ := claims["jti"].(string)
+	expiresAt := time.Now().Add(repository.AccessTokenTTL)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+	if err := tokens.RevokeAccessToken(jti, userID, expiresAt, "logout"); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to revoke token",
+			"data":    err.Error(),
+		})
+	}
+
+	if sess, ok := c.Locals("session").(*session.Session); ok {
+		_ = sess.Destroy()
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Logged out",
+	})
+}
+
+// RevokeMySessions signs the caller out of every session, this one included
+func RevokeMySessions(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
+	claims, ok := tokenClaims(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid or expired JWT",
+		})
+	}
+	id, ok := claims["user_id"].(float64)
+	if !ok || id == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The token carries no user",
+		})
+	}
+
+	if err := repository.NewTokenRepository(db).RevokeAllSessions(uint(id), "revoked by user"); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to revoke sessions",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "All sessions revoked",
+	})
+}
+
+// RevokeUserSessions signs a user out of every session, e.g. when they leave the company
+func RevokeUserSessions(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
+	id := utils.StrToUint(c.Params("id"))
+	if id == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid user ID",
+		})
+	}
+
+	// The lookup is scoped to the caller's company like any other
+	var user userRegistration.User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "User not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to find user",
+			"data":    err.Error(),
+		})
+	}
+
+	by := getUsernameOrDefault(c, "system")
+	if err := repository.NewTokenRepository(db).RevokeAllSessions(user.ID, "revoked by "+by); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to revoke sessions",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "All sessions of the user revoked",
+		"data":    fiber.Map{"user_id": user.ID, "username": user.Username},
+	})
+}
+
 // ======================= PROFILE =======================
 func Profile(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
 	// Extract token and claims
 	userToken := c.Locals("user").(*jwt.Token)
 	claims := userToken.Claims.(jwt.MapClaims)
@@ -0,0 +1,477 @@
+package controllers
+
+import (
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/money"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+)
+
+// carImportAliases maps common auction/export sheet titles (lower case, letters and digits only)
+// to the car form fields. A title equal to the field name itself always matches.
+var carImportAliases = map[string]string{
+	"chassis":           "chasis_number",
+	"chassisno":         "chasis_number",
+	"chassisnumber":     "chasis_number",
+	"chasis":            "chasis_number",
+	"chasisno":          "chasis_number",
+	"vin":               "chasis_number",
+	"engineno":          "engine_number",
+	"engine":            "engine_capacity",
+	"cc":                "engine_capacity",
+	"frameno":           "frame_number",
+	"maker":             "make",
+	"brand":             "make",
+	"model":             "car_model",
+	"year":              "manufacture_year",
+	"yearofmanufacture": "manufacture_year",
+	"registrationyear":  "first_registration_year",
+	"color":             "colour",
+	"mileage":           "car_millage",
+	"millage":           "car_millage",
+	"auctionhouse":      "auction",
+	"bid":               "bid_price",
+	"price":             "bid_price",
+	"hammerprice":       "bid_price",
+	"vat":               "vat_tax",
+	"auctiondate":       "purchase_date",
+	"date":              "purchase_date",
+}
+
+var (
+	carImportNonAlnum    = regexp.MustCompile(`[^a-z0-9]`)
+	carImportColumnLabel = regexp.MustCompile(`^[A-Za-z]{1,3}$`)
+)
+
+func normalizeImportHeader(value string) string {
+	return carImportNonAlnum.ReplaceAllString(strings.ToLower(value), "")
+}
+
+// carFormFields lists the form tags of CarFormPayload
+func carFormFields() map[string]bool {
+	fields := make(map[string]bool)
+	typ := reflect.TypeOf(CarFormPayload{})
+	for i := 0; i < typ.NumField(); i++ {
+		fields[typ.Field(i).Tag.Get("form")] = true
+	}
+	return fields
+}
+
+// carPayloadFromValues fills a CarFormPayload from values keyed by form tag
+func carPayloadFromValues(values map[string]string) CarFormPayload {
+	payload := CarFormPayload{}
+	val := reflect.ValueOf(&payload).Elem()
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		if value, ok := values[typ.Field(i).Tag.Get("form")]; ok {
+			val.Field(i).SetString(value)
+		}
+	}
+	return payload
+}
+
+// resolveCarImportColumns works out which column feeds which car field. The mapping (field -> header
+// title or column letter) wins over the titles recognised from the header row.
+func resolveCarImportColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	fields := carFormFields()
+	columns := make(map[string]int)
+
+	for i, title := range header {
+		key := normalizeImportHeader(title)
+		if key == "" {
+			continue
+		}
+		field, ok := carImportAliases[key]
+		if !ok {
+			for name := range fields {
+				if normalizeImportHeader(name) == key {
+					field, ok = name, true
+					break
+				}
+			}
+		}
+		if ok {
+			if _, taken := columns[field]; !taken {
+				columns[field] = i
+			}
+		}
+	}
+
+	for field, source := range mapping {
+		if !fields[field] {
+			return nil, fmt.Errorf("unknown car field %q in mapping", field)
+		}
+		source = strings.TrimSpace(source)
+		index := -1
+		for i, title := range header {
+			if strings.EqualFold(strings.TrimSpace(title), source) {
+				index = i
+				break
+			}
+		}
+		if index < 0 && carImportColumnLabel.MatchString(source) {
+			number, err := excelize.ColumnNameToNumber(strings.ToUpper(source))
+			if err == nil {
+				index = number - 1
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("column %q mapped to %s was not found", source, field)
+		}
+		columns[field] = index
+	}
+
+	if _, ok := columns["chasis_number"]; !ok {
+		return nil, fmt.Errorf("no chassis number column found; map chasis_number to a column")
+	}
+	return columns, nil
+}
+
+type CarImportRowResult struct {
+	Row          int      `json:"row"`
+	ChasisNumber string   `json:"chasis_number"`
+	Status       string   `json:"status"` // valid (dry run), imported or invalid
+	CarID        *uint    `json:"car_id"`
+	Errors       []string `json:"errors"`
+}
+
+type CarImportReport struct {
+	Sheet     string               `json:"sheet"`
+	HeaderRow int                  `json:"header_row"`
+	Columns   map[string]int       `json:"columns"` // car field -> 0-based column
+	TotalRows int                  `json:"total_rows"`
+	ValidRows int                  `json:"valid_rows"`
+	ErrorRows int                  `json:"error_rows"`
+	DryRun    bool                 `json:"dry_run"`
+	Rows      []CarImportRowResult `json:"rows"`
+}
+
+// normalizeCarImportValues checks the typed fields of a row and rewrites them the way the car form
+// expects them, so carFromFormPayload never falls back to a zero value for a bad cell
+func normalizeCarImportValues(values map[string]string) []string {
+	errs := []string{}
+
+	if values["chasis_number"] == "" {
+		errs = append(errs, "chassis number is empty")
+	}
+
+	// Registration derives the Japan status from to_company_id, so an imported one would be dropped
+	if values["car_status_japan"] != "" {
+		errs = append(errs, "car_status_japan cannot be imported: it is InStock, or Exported when to_company_id is set")
+	}
+
+	for _, field := range []string{"car_millage", "manufacture_year", "first_registration_year"} {
+		if value := strings.ReplaceAll(values[field], ",", ""); value != "" {
+			if _, err := strconv.Atoi(value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q is not a whole number", field, values[field]))
+			}
+			values[field] = value
+		}
+	}
+
+	for _, field := range []string{"maxim_carry", "weight", "gross_weight", "length", "width", "height"} {
+		if value := strings.ReplaceAll(values[field], ",", ""); value != "" {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q is not a number", field, values[field]))
+			}
+			values[field] = value
+		}
+	}
+
+	for _, field := range []string{"bid_price", "vat_tax"} {
+		if value := values[field]; value != "" {
+			amount, err := money.Parse(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q is not an amount", field, value))
+			} else if amount.IsNegative() {
+				errs = append(errs, fmt.Sprintf("%s must not be negative", field))
+			}
+		}
+	}
+
+	for _, field := range []string{"power_steering", "power_window", "abs", "ads", "air_brake", "oil_brake", "alloy_wheel", "simple_wheel", "navigation", "ac", "car_tracker"} {
+		switch strings.ToLower(values[field]) {
+		case "":
+		case "yes", "y", "1", "true":
+			values[field] = "true"
+		case "no", "n", "0", "false":
+			values[field] = "false"
+		default:
+			errs = append(errs, fmt.Sprintf("%s %q is not yes or no", field, values[field]))
+		}
+	}
+
+	for _, field := range []string{"from_company_id", "to_company_id", "car_shipping_invoice_id", "customer_id"} {
+		if value := values[field]; value != "" {
+			if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q is not an ID", field, value))
+			}
+		}
+	}
+
+	switch date := values["purchase_date"]; {
+	case date == "":
+		errs = append(errs, "purchase date is empty")
+	default:
+		parsed, err := time.Parse("2006-01-02", strings.ReplaceAll(date, "/", "-"))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("purchase date %q is not YYYY-MM-DD", date))
+		} else {
+			values["purchase_date"] = parsed.Format("2006-01-02")
+		}
+	}
+
+	return errs
+}
+
+// ImportCars registers cars in bulk from an auction or export sheet (XLSX or CSV, form field "file").
+// Optional form fields: mapping (JSON car field -> header title or column letter), defaults (JSON car
+// field -> value used when the cell is empty), header_row (row number, or none; default 1), dry_run
+// and updated_by. Valid rows are saved in one transaction with their transaction records; invalid
+// rows are reported and skipped.
+func (h *CarController) ImportCars(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve file",
+			"data":    err.Error(),
+		})
+	}
+
+	mapping := map[string]string{}
+	if value := c.FormValue("mapping"); value != "" {
+		if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid mapping JSON",
+				"data":    err.Error(),
+			})
+		}
+	}
+	defaults := map[string]string{}
+	if value := c.FormValue("defaults"); value != "" {
+		if err := json.Unmarshal([]byte(value), &defaults); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid defaults JSON",
+				"data":    err.Error(),
+			})
+		}
+	}
+	fields := carFormFields()
+	for field := range defaults {
+		if !fields[field] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Unknown car field %q in defaults", field),
+			})
+		}
+	}
+
+	dryRun, _ := strconv.ParseBool(c.FormValue("dry_run", c.Query("dry_run")))
+	updatedBy := c.FormValue("updated_by")
+	if updatedBy == "" {
+		updatedBy = getUsernameOrDefault(c, "system")
+	}
+
+	tempDir := "./uploads"
+	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create upload directory",
+			"data":    err.Error(),
+		})
+	}
+	tempFilePath := filepath.Join(tempDir, uuid.New().String()+"_"+filepath.Base(file.Filename))
+	if err := c.SaveFile(file, tempFilePath); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to save uploaded file",
+			"data":    err.Error(),
+		})
+	}
+	defer func() {
+		if removeErr := os.Remove(tempFilePath); removeErr != nil {
+			log.Printf("Warning: Failed to remove temporary file: %v", removeErr)
+		}
+	}()
+
+	sheet, rows, err := extractTable(tempFilePath)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to read the spreadsheet",
+			"data":    err.Error(),
+		})
+	}
+
+	if strings.EqualFold(filepath.Ext(file.Filename), ".csv") {
+		sheet = file.Filename
+	}
+
+	headerRow := 1
+	if setting := strings.ToLower(strings.TrimSpace(c.FormValue("header_row"))); setting == "none" {
+		headerRow = 0
+	} else if setting != "" {
+		headerRow, err = strconv.Atoi(setting)
+		if err != nil || headerRow < 0 || headerRow > len(rows) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid header_row %q (expected none or a row number up to %d)", setting, len(rows)),
+			})
+		}
+	}
+
+	var header []string
+	for _, row := range rows {
+		if row.Number == headerRow {
+			header = row.Values
+		}
+	}
+	columns, err := resolveCarImportColumns(header, mapping)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid column mapping",
+			"data":    err.Error(),
+		})
+	}
+
+	report := CarImportReport{Sheet: sheet, HeaderRow: headerRow, Columns: columns, DryRun: dryRun, Rows: []CarImportRowResult{}}
+	rowValues := make([]map[string]string, 0, len(rows))
+	seenChasis := make(map[string]int)
+	var chasisNumbers []string
+	companyIDs := make(map[uint]bool)
+
+	for _, row := range rows {
+		if row.Number <= headerRow || len(row.Values) == 0 {
+			continue
+		}
+
+		values := make(map[string]string, len(columns)+len(defaults))
+		for field, index := range columns {
+			if index < len(row.Values) {
+				values[field] = strings.TrimSpace(row.Values[index])
+			}
+		}
+		for field, value := range defaults {
+			if values[field] == "" {
+				values[field] = value
+			}
+		}
+		if values["created_by"] == "" {
+			values["created_by"] = updatedBy
+		}
+		if values["updated_by"] == "" {
+			values["updated_by"] = updatedBy
+		}
+
+		result := CarImportRowResult{Row: row.Number, ChasisNumber: values["chasis_number"], Errors: normalizeCarImportValues(values)}
+		if chasis := values["chasis_number"]; chasis != "" {
+			if first, ok := seenChasis[chasis]; ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("chassis number repeats row %d", first))
+			} else {
+				seenChasis[chasis] = row.Number
+				chasisNumbers = append(chasisNumbers, chasis)
+			}
+		}
+		for _, field := range []string{"from_company_id", "to_company_id"} {
+			if id, err := strconv.ParseUint(values[field], 10, 64); err == nil {
+				companyIDs[uint(id)] = true
+			}
+		}
+
+		report.Rows = append(report.Rows, result)
+		rowValues = append(rowValues, values)
+	}
+
+	existingChasis, err := h.repo.WithContext(c.UserContext()).FindExistingChasisNumbers(chasisNumbers)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to check chassis numbers",
+			"data":    err.Error(),
+		})
+	}
+	ids := make([]uint, 0, len(companyIDs))
+	for id := range companyIDs {
+		ids = append(ids, id)
+	}
+	existingCompanies, err := h.repo.WithContext(c.UserContext()).FindExistingCompanyIDs(ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to check companies",
+			"data":    err.Error(),
+		})
+	}
+
+	var cars []carRegistration.Car
+	var carRows []int // index in report.Rows of each car
+	for i := range report.Rows {
+		result := &report.Rows[i]
+		values := rowValues[i]
+
+		if existingChasis[values["chasis_number"]] {
+			result.Errors = append(result.Errors, "chassis number is already registered")
+		}
+		for _, field := range []string{"from_company_id", "to_company_id"} {
+			if id, err := strconv.ParseUint(values[field], 10, 64); err == nil && !existingCompanies[uint(id)] {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s %d is not a known company", field, id))
+			}
+		}
+
+		if len(result.Errors) > 0 {
+			result.Status = "invalid"
+			report.ErrorRows++
+			continue
+		}
+		result.Status = "valid"
+		report.ValidRows++
+
+		car := carFromFormPayload(carPayloadFromValues(values))
+		cars = append(cars, car)
+		carRows = append(carRows, i)
+	}
+	report.TotalRows = len(report.Rows)
+
+	if dryRun || len(cars) == 0 {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Car import validated",
+			"data":    report,
+		})
+	}
+
+	// Transactions are built from the cars as stored, once registration has set their status
+	if err := h.repo.WithContext(c.UserContext()).ImportCars(cars, ConvertCarToTransaction); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to import cars",
+			"data":    err.Error(),
+		})
+	}
+	for i, index := range carRows {
+		report.Rows[index].Status = "imported"
+		report.Rows[index].CarID = &cars[i].ID
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": fmt.Sprintf("Imported %d of %d cars", report.ValidRows, report.TotalRows),
+		"data":    report,
+	})
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"car-bond/internals/config"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultReportingCurrency is used when neither ?currency= nor REPORTING_CURRENCY is set
+const defaultReportingCurrency = "UGX"
+
+type CarProfitabilityController struct {
+	repo repository.CarProfitabilityRepository
+}
+
+func NewCarProfitabilityController(repo repository.CarProfitabilityRepository) *CarProfitabilityController {
+	return &CarProfitabilityController{repo: repo}
+}
+
+// reportingCurrency picks the currency profitability is reported in
+func reportingCurrency(c *fiber.Ctx) string {
+	if currency := c.Query("currency"); currency != "" {
+		return currency
+	}
+	if currency := config.Config("REPORTING_CURRENCY"); currency != "" {
+		return currency
+	}
+	return defaultReportingCurrency
+}
+
+// ============================================
+
+func (h *CarProfitabilityController) GetCarProfitability(c *fiber.Ctx) error {
+	carID := utils.StrToUint(c.Params("id"))
+
+	profitability, err := h.repo.WithContext(c.UserContext()).GetCarProfitability(carID, reportingCurrency(c))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Car not found",
+			})
+		}
+		if errors.Is(err, repository.ErrUnknownCurrency) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid currency",
+				"data":    err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to compute car profitability",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Car profitability computed successfully",
+		"data":    profitability,
+	})
+}
+
+// =====================
+
+// GetCompanyProfitability lists the cars of a company with their margins.
+// Query: currency, sort (margin, margin_percent, landed_cost, sale_price), order (asc, desc), sold=true
+func (h *CarProfitabilityController) GetCompanyProfitability(c *fiber.Ctx) error {
+	companyID := utils.StrToUint(c.Params("companyId"))
+	if companyID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid company ID",
+		})
+	}
+
+	sortBy := c.Query("sort", repository.ProfitSortMarginPercent)
+	switch sortBy {
+	case repository.ProfitSortMargin, repository.ProfitSortMarginPercent,
+		repository.ProfitSortLandedCost, repository.ProfitSortSalePrice:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid sort (expected margin, margin_percent, landed_cost or sale_price)",
+		})
+	}
+	ascending := strings.EqualFold(c.Query("order"), "asc")
+	soldOnly := c.QueryBool("sold", false)
+
+	report, err := h.repo.WithContext(c.UserContext()).GetCompanyProfitability(companyID, reportingCurrency(c), sortBy, ascending, soldOnly)
+	if err != nil {
+		if errors.Is(err, repository.ErrUnknownCurrency) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid currency",
+				"data":    err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to compute company profitability",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Company profitability computed successfully",
+		"data":    report,
+	})
+}
@@ -5,13 +5,13 @@ import (
 	"car-bond/internals/middleware"
 	"car-bond/internals/models/alertRegistration"
 	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/money"
 	"car-bond/internals/repository"
 	"car-bond/internals/utils"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -28,12 +28,14 @@ import (
 type CarController struct {
 	repo     repository.CarRepository
 	saleRepo repository.SaleRepository
+	rates    repository.ExchangeRateRepository
 }
 
-func NewCarController(repo repository.CarRepository, saleRepo repository.SaleRepository) *CarController {
+func NewCarController(repo repository.CarRepository, saleRepo repository.SaleRepository, rates repository.ExchangeRateRepository) *CarController {
 	return &CarController{
 		repo:     repo,
 		saleRepo: saleRepo,
+		rates:    rates,
 	}
 }
 
@@ -115,7 +117,7 @@ func getToCompanyID(car *carRegistration.Car) uint {
 
 func (h *CarController) GetAllCars(c *fiber.Ctx) error {
 	// Fetch paginated cars using the repository
-	pagination, cars, err := h.repo.GetPaginatedCars(c)
+	pagination, cars, err := h.repo.WithContext(c.UserContext()).GetPaginatedCars(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -130,7 +132,7 @@ func (h *CarController) GetAllCars(c *fiber.Ctx) error {
 	// Iterate over all cars to fetch associated car ports and expenses
 	for _, car := range cars {
 
-		expenses, err := h.repo.GetCarExpenses(car.ID, c)
+		expenses, err := h.repo.WithContext(c.UserContext()).GetCarExpenses(car.ID, c)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -168,7 +170,7 @@ func (h *CarController) GetSingleCar(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the car by ID
-	car, err := h.repo.GetCarByID(id)
+	car, err := h.repo.WithContext(c.UserContext()).GetCarByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -184,7 +186,7 @@ func (h *CarController) GetSingleCar(c *fiber.Ctx) error {
 	}
 
 	// Fetch expenses associated with the car
-	expenses, err := h.repo.GetCarExpenses(car.ID, c)
+	expenses, err := h.repo.WithContext(c.UserContext()).GetCarExpenses(car.ID, c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -214,7 +216,7 @@ func (h *CarController) GetSingleCarByChasisNumber(c *fiber.Ctx) error {
 	ChasisNumber := c.Params("ChasisNumber")
 
 	// Fetch the car by ID
-	car, err := h.repo.GetCarByVin(ChasisNumber)
+	car, err := h.repo.WithContext(c.UserContext()).GetCarByVin(ChasisNumber)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -230,7 +232,7 @@ func (h *CarController) GetSingleCarByChasisNumber(c *fiber.Ctx) error {
 	}
 
 	// Fetch expenses associated with the car
-	expenses, err := h.repo.GetCarExpenses(car.ID, c)
+	expenses, err := h.repo.WithContext(c.UserContext()).GetCarExpenses(car.ID, c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -262,8 +264,8 @@ type UpdateCarPayload2 struct {
 	BrokerNumber     string `json:"broker_number"`
 	NumberPlate      string `json:"number_plate"`
 	CarTracker       bool   `json:"car_tracker"`
-	CarStatus        string `json:"car_status"`
-	CarPaymentStatus string `json:"car_payment_status"`
+	CarStatus        string `json:"car_status"`         // unchanged when empty
+	CarPaymentStatus string `json:"car_payment_status"` // unchanged when empty
 	CustomerID       int    `json:"customer_id"`
 	UpdatedBy        string `json:"updated_by"`
 }
@@ -274,7 +276,7 @@ func (h *CarController) UpdateCar2(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the car in the database
-	car, err := h.repo.GetCarByID(id)
+	car, err := h.repo.WithContext(c.UserContext()).GetCarByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -299,11 +301,20 @@ func (h *CarController) UpdateCar2(c *fiber.Ctx) error {
 		})
 	}
 
+	// Status changes are checked before anything is saved
+	changes, err := carStatusChanges(car, payload)
+	if err != nil {
+		return statusChangeError(c, err)
+	}
+
 	// Update the car fields using the payload
 	updateCar2Fields(&car, payload) // Pass the parsed payload
 
 	// Save the changes to the database
-	if err := h.repo.UpdateCar(&car); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCarWithStatus(&car, changes); err != nil {
+		if errors.Is(err, carRegistration.ErrIllegalTransition) {
+			return statusChangeError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update car",
@@ -326,8 +337,6 @@ func updateCar2Fields(car *carRegistration.Car, updateCarData UpdateCarPayload2)
 	car.BrokerNumber = updateCarData.BrokerNumber
 	car.NumberPlate = updateCarData.NumberPlate
 	car.CarTracker = updateCarData.CarTracker
-	car.CarStatus = updateCarData.CarStatus
-	car.CarPaymentStatus = updateCarData.CarPaymentStatus
 	// Assign foreign keys if provided
 	if updateCarData.CustomerID != 0 {
 		car.CustomerID = &updateCarData.CustomerID
@@ -337,6 +346,43 @@ func updateCar2Fields(car *carRegistration.Car, updateCarData UpdateCarPayload2)
 	car.UpdatedBy = updateCarData.UpdatedBy
 }
 
+// carStatusChanges lists the status changes a payload asks for, failing on the first illegal one
+func carStatusChanges(car carRegistration.Car, payload UpdateCarPayload2) ([]carRegistration.StatusChange, error) {
+	var changes []carRegistration.StatusChange
+	requested := []struct{ field, from, to string }{
+		{carRegistration.StatusFieldCar, car.CarStatus, payload.CarStatus},
+		{carRegistration.StatusFieldPayment, car.CarPaymentStatus, payload.CarPaymentStatus},
+	}
+	for _, r := range requested {
+		if r.to == "" || r.to == r.from {
+			continue
+		}
+		if err := carRegistration.CheckTransition(r.field, r.from, r.to, false); err != nil {
+			return nil, err
+		}
+		changes = append(changes, carRegistration.StatusChange{Field: r.field, To: r.to, Reason: "Car updated", By: payload.UpdatedBy})
+	}
+	return changes, nil
+}
+
+// statusChangeError answers a rejected status change
+func statusChangeError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, carRegistration.ErrUnknownStatus), errors.Is(err, carRegistration.ErrUnknownStatusField):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, carRegistration.ErrIllegalTransition):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Failed to change car status",
+		"data":    err.Error(),
+	})
+}
+
 // ====================
 
 type UpdateCarPayload3 struct {
@@ -348,7 +394,7 @@ type UpdateCarPayload3 struct {
 func (h *CarController) UpdateCar3(c *fiber.Ctx) error {
 	id := c.Params("id")
 
-	car, err := h.repo.GetCarByID(id)
+	car, err := h.repo.WithContext(c.UserContext()).GetCarByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -376,7 +422,7 @@ func (h *CarController) UpdateCar3(c *fiber.Ctx) error {
 
 	if targetInvoiceID != 0 {
 		// Check if the invoice exists and is not locked
-		invoice, err := h.repo.GetInvoiceByID(targetInvoiceID)
+		invoice, err := h.repo.WithContext(c.UserContext()).GetInvoiceByID(targetInvoiceID)
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return c.Status(404).JSON(fiber.Map{
@@ -411,7 +457,7 @@ func (h *CarController) UpdateCar3(c *fiber.Ctx) error {
 	updateCar3Fields(&car, payloadInv)
 
 	// Save the changes
-	if err := h.repo.UpdateCar(&car); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCar(&car); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update car",
@@ -445,7 +491,7 @@ func (h *CarController) DeleteCarByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the car in the database
-	car, err := h.repo.GetCarByID(id)
+	car, err := h.repo.WithContext(c.UserContext()).GetCarByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -461,7 +507,7 @@ func (h *CarController) DeleteCarByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the car
-	if err := h.repo.DeleteByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete car",
@@ -493,8 +539,12 @@ func (h *CarController) CreateCarExpense(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := normalizeCurrencies(c, h.rates, &carExpense.Currency); err != nil {
+		return currencyError(c, err)
+	}
+
 	// Create the car expense in the database
-	if err := h.repo.CreateCarExpense(carExpense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateCarExpense(carExpense); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create car expense",
@@ -532,9 +582,15 @@ func (h *CarController) CreateCarExpenses(c *fiber.Ctx) error {
 		})
 	}
 
+	for i := range carExpenses {
+		if err := normalizeCurrencies(c, h.rates, &carExpenses[i].Currency); err != nil {
+			return currencyError(c, err)
+		}
+	}
+
 	// Insert each car expense into the database
 	for _, expense := range carExpenses {
-		if err := h.repo.CreateCarExpense(&expense); err != nil {
+		if err := h.repo.WithContext(c.UserContext()).CreateCarExpense(&expense); err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"status":  "error",
 				"message": "Failed to create car expense",
@@ -555,7 +611,7 @@ func (h *CarController) CreateCarExpenses(c *fiber.Ctx) error {
 
 func (h *CarController) GetAllCarExpenses(c *fiber.Ctx) error {
 	// Fetch paginated expenses using the repository
-	pagination, expenses, err := h.repo.GetPaginatedExpenses(c)
+	pagination, expenses, err := h.repo.WithContext(c.UserContext()).GetPaginatedExpenses(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -588,7 +644,7 @@ func (h *CarController) GetCarExpenseById(c *fiber.Ctx) error {
 	carId := c.Params("carId")
 
 	// Fetch the car expense from the repository
-	expense, err := h.repo.FindCarExpenseByIdAndCarId(id, carId)
+	expense, err := h.repo.WithContext(c.UserContext()).FindCarExpenseByIdAndCarId(id, carId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -626,7 +682,7 @@ func (h *CarController) GetCarExpensesByCarId(c *fiber.Ctx) error {
 	fmt.Printf("Extracted CompanyID: %d\n", companyID)
 
 	// Fetch paginated car expenses using the repository
-	pagination, expenses, err := h.repo.GetPaginatedExpensesByCarId(c, carId, companyID)
+	pagination, expenses, err := h.repo.WithContext(c.UserContext()).GetPaginatedExpensesByCarId(c, carId, companyID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -662,16 +718,16 @@ func (h *CarController) GetCarExpensesByCarId(c *fiber.Ctx) error {
 func (h *CarController) UpdateCarExpense(c *fiber.Ctx) error {
 	// Define a struct for input validation
 	type UpdateCarExpenseInput struct {
-		Description   string  `json:"description" validate:"required"`
-		Currency      string  `json:"currency" validate:"required"`
-		Amount        float64 `json:"amount" validate:"required,gt=0"`
-		DollarRate    float64 `json:"dollar_rate"`
-		ExpenseDate   string  `json:"expense_date" validate:"required"`
-		CompanyName   string  `json:"company_name"`
-		Destination   string  `json:"destination"`
-		ExpenseVAT    float64 `json:"expense_vat"`
-		ExpenseRemark string  `json:"expense_remark"`
-		UpdatedBy     string  `json:"updated_by" validate:"required"`
+		Description   string      `json:"description" validate:"required"`
+		Currency      string      `json:"currency" validate:"required"`
+		Amount        money.Money `json:"amount"`
+		DollarRate    money.Money `json:"dollar_rate"`
+		ExpenseDate   string      `json:"expense_date" validate:"required"`
+		CompanyName   string      `json:"company_name"`
+		Destination   string      `json:"destination"`
+		ExpenseVAT    money.Money `json:"expense_vat"`
+		ExpenseRemark string      `json:"expense_remark"`
+		UpdatedBy     string      `json:"updated_by" validate:"required"`
 	}
 
 	// Parse the expense ID from the request parameters
@@ -695,9 +751,19 @@ func (h *CarController) UpdateCarExpense(c *fiber.Ctx) error {
 			"errors":  validationErr,
 		})
 	}
+	if !input.Amount.IsPositive() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Validation failed",
+			"errors":  "amount must be greater than 0",
+		})
+	}
+	if err := normalizeCurrencies(c, h.rates, &input.Currency); err != nil {
+		return currencyError(c, err)
+	}
 
 	// Fetch the expense record using the repository
-	expense, err := h.repo.FindCarExpenseById(expenseID)
+	expense, err := h.repo.WithContext(c.UserContext()).FindCarExpenseById(expenseID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -725,7 +791,7 @@ func (h *CarController) UpdateCarExpense(c *fiber.Ctx) error {
 	expense.UpdatedBy = input.UpdatedBy
 
 	// Save the updated expense using the repository
-	if err := h.repo.UpdateCarExpense(expense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCarExpense(expense); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update expense",
@@ -751,7 +817,7 @@ func (h *CarController) DeleteCarExpenseById(c *fiber.Ctx) error {
 	expenseId := c.Params("id")
 
 	// Check if the expense exists and belongs to the specified car
-	expense, err := h.repo.FindCarExpenseByCarAndId(carId, expenseId)
+	expense, err := h.repo.WithContext(c.UserContext()).FindCarExpenseByCarAndId(carId, expenseId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -767,7 +833,7 @@ func (h *CarController) DeleteCarExpenseById(c *fiber.Ctx) error {
 	}
 
 	// Delete the expense using the repository
-	if err := h.repo.DeleteCarExpense(expense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteCarExpense(expense); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete car expense",
@@ -791,7 +857,7 @@ func (h *CarController) GetCarExpensesByCarIdAndExpenseDate(c *fiber.Ctx) error
 	expenseDate := c.Params("expense_date")
 
 	// Fetch expenses using the repository
-	expenses, err := h.repo.FindCarExpensesByCarIdAndExpenseDate(carId, expenseDate)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCarExpensesByCarIdAndExpenseDate(carId, expenseDate)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -823,7 +889,7 @@ func (h *CarController) GetCarExpensesByCarIdAndExpenseDescription(c *fiber.Ctx)
 	expenseDescription := c.Params("expense_description")
 
 	// Fetch expenses using the repository
-	expenses, err := h.repo.FindCarExpensesByCarIdAndExpenseDescription(carId, expenseDescription)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCarExpensesByCarIdAndExpenseDescription(carId, expenseDescription)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -855,7 +921,7 @@ func (h *CarController) GetCarExpensesByCarIdAndCurrency(c *fiber.Ctx) error {
 	currency := c.Params("currency")
 
 	// Fetch expenses using the repository
-	expenses, err := h.repo.FindCarExpensesByCarIdAndCurrency(carId, currency)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCarExpensesByCarIdAndCurrency(carId, currency)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -888,7 +954,7 @@ func (h *CarController) GetCarExpensesByThree(c *fiber.Ctx) error {
 	currency := c.Params("currency")
 
 	// Fetch car expenses using the repository
-	expenses, err := h.repo.FindCarExpensesByThree(carId, expenseDate, currency)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCarExpensesByThree(carId, expenseDate, currency)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -922,7 +988,7 @@ func (h *CarController) GetCarExpensesFilters(c *fiber.Ctx) error {
 	currency := c.Params("currency")
 
 	// Fetch car expenses using the service layer
-	expenses, err := h.repo.GetCarExpensesByFour(carId, expenseDate, expenseDescription, currency)
+	expenses, err := h.repo.WithContext(c.UserContext()).GetCarExpensesByFour(carId, expenseDate, expenseDescription, currency)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -959,7 +1025,7 @@ func (h *CarController) GetTotalCarExpenses(c *fiber.Ctx) error {
 	carID := utils.StrToUint(carIDStr)
 
 	// Fetch total car expenses using the repository
-	totalExpenses, err := h.repo.GetTotalCarExpenses(carID)
+	totalExpenses, err := h.repo.WithContext(c.UserContext()).GetTotalCarExpenses(carID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -980,7 +1046,7 @@ func (h *CarController) GetTotalCarExpenses(c *fiber.Ctx) error {
 
 func (h *CarController) SearchCars(c *fiber.Ctx) error {
 	// Call the repository function to get paginated search results
-	pagination, cars, err := h.repo.SearchPaginatedCars(c)
+	pagination, cars, err := h.repo.WithContext(c.UserContext()).SearchPaginatedCars(c)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -995,7 +1061,7 @@ func (h *CarController) SearchCars(c *fiber.Ctx) error {
 	// Iterate over all cars to fetch associated car ports and expenses
 	for _, car := range cars {
 
-		expenses, err := h.repo.GetCarExpenses(car.ID, c)
+		expenses, err := h.repo.WithContext(c.UserContext()).GetCarExpenses(car.ID, c)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -1032,7 +1098,7 @@ func (h *CarController) FetchCarUploads(c *fiber.Ctx) error {
 	id := c.Query("id")
 
 	// Find the car in the database
-	car, err := h.repo.GetCarByID(id)
+	car, err := h.repo.WithContext(c.UserContext()).GetCarByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -1048,7 +1114,7 @@ func (h *CarController) FetchCarUploads(c *fiber.Ctx) error {
 	}
 
 	// Retrieve photos of the car
-	photos, err := h.repo.GetCarPhotosBycarID(car.ID)
+	photos, err := h.repo.WithContext(c.UserContext()).GetCarPhotosBycarID(car.ID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -1127,7 +1193,7 @@ func addFileToZip(zipWriter *zip.Writer, filePath string) error {
 func (h *CarController) FetchCarUploads64(c *fiber.Ctx) error {
 	id := c.Query("id")
 
-	car, err := h.repo.GetCarByID(id)
+	car, err := h.repo.WithContext(c.UserContext()).GetCarByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{"status": "error", "message": "Car not found"})
@@ -1135,7 +1201,7 @@ func (h *CarController) FetchCarUploads64(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to retrieve car", "data": err.Error()})
 	}
 
-	photos, err := h.repo.GetCarPhotosBycarID(car.ID)
+	photos, err := h.repo.WithContext(c.UserContext()).GetCarPhotosBycarID(car.ID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to retrieve photos", "data": err.Error()})
 	}
@@ -1166,28 +1232,9 @@ func (h *CarController) FetchCarUploads64(c *fiber.Ctx) error {
 
 // ==========================================
 
-func safeFloatMap(input map[string]float64) map[string]float64 {
-	safe := make(map[string]float64)
-	for k, v := range input {
-		if math.IsInf(v, 0) || math.IsNaN(v) {
-			safe[k] = 0
-		} else {
-			safe[k] = v
-		}
-	}
-	return safe
-}
-
-func safeFloat(val float64) float64 {
-	if math.IsInf(val, 0) || math.IsNaN(val) {
-		return 0
-	}
-	return val
-}
-
 // GetDashboardData returns aggregated statistics for the dashboard
 func (h *CarController) GetDashboardData(c *fiber.Ctx) error {
-	totalCars, err := h.repo.GetTotalCars()
+	totalCars, err := h.repo.WithContext(c.UserContext()).GetTotalCars()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1196,7 +1243,7 @@ func (h *CarController) GetDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	disbandedCars, err := h.repo.GetDisbandedCars()
+	disbandedCars, err := h.repo.WithContext(c.UserContext()).GetDisbandedCars()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1205,7 +1252,7 @@ func (h *CarController) GetDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	carsInStock, err := h.repo.GetCarsInStock()
+	carsInStock, err := h.repo.WithContext(c.UserContext()).GetCarsInStock()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1214,7 +1261,7 @@ func (h *CarController) GetDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	totalMoneySpent, err := h.repo.GetTotalMoneySpent()
+	totalMoneySpent, err := h.repo.WithContext(c.UserContext()).GetTotalMoneySpent()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1223,7 +1270,7 @@ func (h *CarController) GetDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	totalCarExpenses, err := h.repo.GetTotalCarsExpenses()
+	totalCarExpenses, err := h.repo.WithContext(c.UserContext()).GetTotalCarsExpenses()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1239,8 +1286,8 @@ func (h *CarController) GetDashboardData(c *fiber.Ctx) error {
 			"total_cars":         totalCars,
 			"disbanded_cars":     disbandedCars,
 			"cars_in_stock":      carsInStock,
-			"total_money_spent":  safeFloat(totalMoneySpent),
-			"total_car_expenses": safeFloatMap(totalCarExpenses),
+			"total_money_spent":  totalMoneySpent,
+			"total_car_expenses": totalCarExpenses,
 		},
 	})
 }
@@ -1255,7 +1302,7 @@ func (h *CarController) GetCompanyDashboardData(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid company ID")
 	}
 
-	totalCars, err := h.repo.GetComTotalCars(companyId)
+	totalCars, err := h.repo.WithContext(c.UserContext()).GetComTotalCars(companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1264,7 +1311,7 @@ func (h *CarController) GetCompanyDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	carsSold, err := h.repo.GetComCarsSold(companyId)
+	carsSold, err := h.repo.WithContext(c.UserContext()).GetComCarsSold(companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1273,7 +1320,7 @@ func (h *CarController) GetCompanyDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	carsInStock, err := h.repo.GetComCarsInStock(companyId)
+	carsInStock, err := h.repo.WithContext(c.UserContext()).GetComCarsInStock(companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1282,7 +1329,7 @@ func (h *CarController) GetCompanyDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	totalMoneySpent, err := h.repo.GetComTotalMoneySpent(companyId)
+	totalMoneySpent, err := h.repo.WithContext(c.UserContext()).GetComTotalMoneySpent(companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1291,7 +1338,7 @@ func (h *CarController) GetCompanyDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	totalCarExpenses, err := h.repo.GetComTotalCarsExpenses(companyId)
+	totalCarExpenses, err := h.repo.WithContext(c.UserContext()).GetComTotalCarsExpenses(companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1300,7 +1347,7 @@ func (h *CarController) GetCompanyDashboardData(c *fiber.Ctx) error {
 		})
 	}
 
-	saleSummary, err := h.saleRepo.GetSalesSummary(companyId)
+	saleSummary, err := h.saleRepo.WithContext(c.UserContext()).GetSalesSummary(companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -1316,8 +1363,8 @@ func (h *CarController) GetCompanyDashboardData(c *fiber.Ctx) error {
 			"total_cars":         totalCars,
 			"cars_in_stock":      carsInStock,
 			"cars_sold":          carsSold,
-			"total_money_spent":  safeFloat(totalMoneySpent),
-			"total_car_expenses": safeFloatMap(totalCarExpenses),
+			"total_money_spent":  totalMoneySpent,
+			"total_car_expenses": totalCarExpenses,
 			"sales_summary":      saleSummary,
 		},
 	})
@@ -1385,15 +1432,8 @@ type CreateCarInput struct {
 	CarExpenses []carRegistration.CarExpense `json:"car_expenses"`
 }
 
-func (h *CarController) CreateCarWithDetails(c *fiber.Ctx) error {
-	// Parse form fields
-	carPayload := CarFormPayload{}
-	if err := c.BodyParser(&carPayload); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"status": "error", "message": "Invalid form input", "data": err.Error(),
-		})
-	}
-
+// carFromFormPayload converts the string form fields into a car
+func carFromFormPayload(carPayload CarFormPayload) carRegistration.Car {
 	car := carRegistration.Car{}
 	val := reflect.ValueOf(carPayload)
 	typ := reflect.TypeOf(carPayload)
@@ -1407,9 +1447,12 @@ func (h *CarController) CreateCarWithDetails(c *fiber.Ctx) error {
 		case "car_millage", "manufacture_year", "first_registration_year":
 			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).SetInt(int64(utils.StrToInt(fieldValue)))
 
-		case "maxim_carry", "weight", "gross_weight", "length", "width", "height", "bid_price", "vat_tax":
+		case "maxim_carry", "weight", "gross_weight", "length", "width", "height":
 			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).SetFloat(utils.StrToFloat(fieldValue))
 
+		case "bid_price", "vat_tax":
+			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).Set(reflect.ValueOf(utils.StrToMoney(fieldValue)))
+
 		case "power_steering", "power_window", "abs", "ads", "air_brake", "oil_brake", "alloy_wheel", "simple_wheel", "navigation", "ac", "car_tracker":
 			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).SetBool(utils.StrToBool(fieldValue))
 
@@ -1429,16 +1472,37 @@ func (h *CarController) CreateCarWithDetails(c *fiber.Ctx) error {
 		}
 	}
 
-	// Save the car
-	if err := h.repo.CreateCar(&car); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to save car",
-			"data":    err.Error(),
+	return car
+}
+
+// normalizeCarCurrencies normalises the currency of a car form and of its expenses; a car may leave its
+// currency empty, an expense may not
+func (h *CarController) normalizeCarCurrencies(c *fiber.Ctx, car *carRegistration.Car, expenses []carRegistration.CarExpense) error {
+	if car.Currency != "" {
+		if err := normalizeCurrencies(c, h.rates, &car.Currency); err != nil {
+			return err
+		}
+	}
+	for i := range expenses {
+		if err := normalizeCurrencies(c, h.rates, &expenses[i].Currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *CarController) CreateCarWithDetails(c *fiber.Ctx) error {
+	// Parse form fields
+	carPayload := CarFormPayload{}
+	if err := c.BodyParser(&carPayload); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status": "error", "message": "Invalid form input", "data": err.Error(),
 		})
 	}
 
-	// Parse car expenses JSON
+	car := carFromFormPayload(carPayload)
+
+	// Parse car expenses JSON before saving anything, so a bad expense leaves no car behind
 	expenseJSON := c.FormValue("car_expenses")
 	var expenses []carRegistration.CarExpense
 	if expenseJSON != "" {
@@ -1449,10 +1513,26 @@ func (h *CarController) CreateCarWithDetails(c *fiber.Ctx) error {
 				"data":    err.Error(),
 			})
 		}
+	}
+	if err := h.normalizeCarCurrencies(c, &car, expenses); err != nil {
+		return currencyError(c, err)
+	}
+
+	// Save the car
+	if err := h.repo.WithContext(c.UserContext()).CreateCar(&car); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to save car",
+			"data":    err.Error(),
+		})
+	}
+
+	// Save car expenses
+	if len(expenses) > 0 {
 		for i := range expenses {
 			expenses[i].CarID = car.ID
 		}
-		if err := h.repo.CreateCarExpenses(expenses); err != nil {
+		if err := h.repo.WithContext(c.UserContext()).CreateCarExpenses(expenses); err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"status":  "error",
 				"message": "Failed to save expenses",
@@ -1506,7 +1586,7 @@ func (h *CarController) CreateCarWithDetails(c *fiber.Ctx) error {
 
 	// Save photo metadata to DB
 	if len(savedPhotos) > 0 {
-		if err := h.repo.CreateCarPhotos(savedPhotos); err != nil {
+		if err := h.repo.WithContext(c.UserContext()).CreateCarPhotos(savedPhotos); err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"status":  "error",
 				"message": "Failed to save photo metadata",
@@ -1519,7 +1599,7 @@ func (h *CarController) CreateCarWithDetails(c *fiber.Ctx) error {
 	transaction := ConvertCarToTransaction(&car)
 
 	// Save to database
-	if err := h.repo.CreateAlert(transaction); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateAlert(transaction); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create transaction"})
 	}
 
@@ -1566,9 +1646,12 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 		case "car_millage", "manufacture_year", "first_registration_year":
 			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).SetInt(int64(utils.StrToInt(fieldValue)))
 
-		case "maxim_carry", "weight", "gross_weight", "length", "width", "height", "bid_price", "vat_tax":
+		case "maxim_carry", "weight", "gross_weight", "length", "width", "height":
 			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).SetFloat(utils.StrToFloat(fieldValue))
 
+		case "bid_price", "vat_tax":
+			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).Set(reflect.ValueOf(utils.StrToMoney(fieldValue)))
+
 		case "power_steering", "power_window", "abs", "ads", "air_brake", "oil_brake", "alloy_wheel", "simple_wheel", "navigation", "ac", "car_tracker":
 			reflect.ValueOf(&car).Elem().FieldByName(typ.Field(i).Name).SetBool(utils.StrToBool(fieldValue))
 
@@ -1591,7 +1674,7 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 	// Optional logic for export
 	if car.ToCompanyID != nil && *car.ToCompanyID != 0 {
 		car.CarStatusJapan = "Exported"
-		companyName, err := h.repo.GetCompanyNameByID(*car.ToCompanyID)
+		companyName, err := h.repo.WithContext(c.UserContext()).GetCompanyNameByID(*car.ToCompanyID)
 		if err != nil && err != gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -1617,9 +1700,15 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 			expenses[i].CarID = car.ID
 		}
 	}
+	if err := h.normalizeCarCurrencies(c, &car, expenses); err != nil {
+		return currencyError(c, err)
+	}
 
 	// Update car and its expenses
-	if err := h.repo.UpdateCarWithExpenses(&car, expenses); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCarWithExpenses(&car, expenses); err != nil {
+		if errors.Is(err, carRegistration.ErrIllegalTransition) || errors.Is(err, carRegistration.ErrUnknownStatus) {
+			return statusChangeError(c, err)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update car and expenses",
@@ -1640,7 +1729,7 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 		}
 
 		// Remove old photos (optional)
-		if err := h.repo.DeleteCarPhotos(car.ID); err != nil {
+		if err := h.repo.WithContext(c.UserContext()).DeleteCarPhotos(car.ID); err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"status":  "error",
 				"message": "Failed to delete old photos",
@@ -1669,7 +1758,7 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 			})
 		}
 
-		if err := h.repo.CreateCarPhotos(newPhotos); err != nil {
+		if err := h.repo.WithContext(c.UserContext()).CreateCarPhotos(newPhotos); err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"status":  "error",
 				"message": "Failed to save new photo metadata",
@@ -1686,7 +1775,7 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 		car.CarStatusJapan = "Exported"
 
 		// 2) fetch company name & add to car
-		if name, err := h.repo.GetCompanyNameByID(*car.ToCompanyID); err == nil {
+		if name, err := h.repo.WithContext(c.UserContext()).GetCompanyNameByID(*car.ToCompanyID); err == nil {
 			car.OtherEntity = name
 		} else if err != gorm.ErrRecordNotFound {
 			return c.Status(500).JSON(fiber.Map{
@@ -1698,7 +1787,7 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 	}
 
 	// Save to database
-	if err := h.repo.CreateAlert(transaction); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateAlert(transaction); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create transaction"})
 	}
 
@@ -1710,6 +1799,7 @@ func (h *CarController) UpdateCarWithDetails(c *fiber.Ctx) error {
 	})
 }
 
+// UpdateCarStatus moves one status of a car (car_status unless field says otherwise) to a new state
 func (h *CarController) UpdateCarStatus(c *fiber.Ctx) error {
 	carIDStr := c.Params("id")
 	if carIDStr == "" {
@@ -1728,30 +1818,84 @@ func (h *CarController) UpdateCarStatus(c *fiber.Ctx) error {
 	}
 
 	var payload struct {
-		CarStatus string `json:"car_status"`
+		Field              string `json:"field"` // car_status (default), car_status_japan or car_payment_status
+		CarStatus          string `json:"car_status"`
+		Reason             string `json:"reason"`
+		UpdatedBy          string `json:"updated_by"`
+		AllowInTransitSale bool   `json:"allow_in_transit_sale"`
 	}
 
-	if err := c.BodyParser(&payload); err != nil || payload.CarStatus == "" {
+	if err := c.BodyParser(&payload); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Invalid request payload",
 			"data":    err.Error(),
 		})
 	}
-
-	// Perform update
-	if err := h.repo.UpdateCarStatusByID(carID, payload.CarStatus); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	if payload.Field == "" {
+		payload.Field = carRegistration.StatusFieldCar
+	}
+	if payload.CarStatus == "" && payload.Field != carRegistration.StatusFieldPayment {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to update car status",
-			"data":    err.Error(),
+			"message": "car_status is required",
 		})
 	}
+	if payload.UpdatedBy == "" {
+		payload.UpdatedBy = getUsernameOrDefault(c, "system")
+	}
+
+	// Perform update
+	car, err := h.repo.WithContext(c.UserContext()).ChangeCarStatus(carID, carRegistration.StatusChange{
+		Field:              payload.Field,
+		To:                 payload.CarStatus,
+		Reason:             payload.Reason,
+		By:                 payload.UpdatedBy,
+		AllowInTransitSale: payload.AllowInTransitSale,
+	})
+	if err != nil {
+		return statusChangeError(c, err)
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status":     "success",
 		"message":    "Car status updated successfully",
 		"car_id":     carID,
+		"field":      payload.Field,
 		"new_status": payload.CarStatus,
+		"data":       car,
+	})
+}
+
+// GetCarStatusHistory lists every status change of a car; ?field= narrows it to one status column
+func (h *CarController) GetCarStatusHistory(c *fiber.Ctx) error {
+	history, err := h.repo.WithContext(c.UserContext()).GetCarStatusHistory(utils.StrToUint(c.Params("id")), c.Query("field"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Car not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve car status history",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Car status history retrieved successfully",
+		"data":    history,
+	})
+}
+
+// GetCarStatusTransitions lists the allowed moves of every car status
+func (h *CarController) GetCarStatusTransitions(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Car status transitions retrieved successfully",
+		"data":    carRegistration.StatusTransitions(),
 	})
 }
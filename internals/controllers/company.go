@@ -3,6 +3,7 @@ package controllers
 import (
 	"car-bond/internals/middleware"
 	"car-bond/internals/models/companyRegistration"
+	"car-bond/internals/money"
 	"car-bond/internals/utils"
 	"strconv"
 
@@ -14,11 +15,12 @@ import (
 )
 
 type CompanyController struct {
-	repo repository.CompanyRepository
+	repo  repository.CompanyRepository
+	rates repository.ExchangeRateRepository
 }
 
-func NewCompanyController(repo repository.CompanyRepository) *CompanyController {
-	return &CompanyController{repo: repo}
+func NewCompanyController(repo repository.CompanyRepository, rates repository.ExchangeRateRepository) *CompanyController {
+	return &CompanyController{repo: repo, rates: rates}
 }
 
 // ============================================
@@ -37,7 +39,7 @@ func (h *CompanyController) CreateCompany(c *fiber.Ctx) error {
 	}
 
 	// Attempt to create the company record using the repository
-	if err := h.repo.CreateCompany(company); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateCompany(company); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create company",
@@ -57,7 +59,7 @@ func (h *CompanyController) CreateCompany(c *fiber.Ctx) error {
 
 func (h *CompanyController) GetAllCompanies(c *fiber.Ctx) error {
 	// Fetch paginated Companies using the repository
-	pagination, companies, err := h.repo.GetPaginatedCompanies(c)
+	pagination, companies, err := h.repo.WithContext(c.UserContext()).GetPaginatedCompanies(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -88,7 +90,7 @@ func (h *CompanyController) GetSingleCompany(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the company by ID
-	company, err := h.repo.GetCompanyByID(id)
+	company, err := h.repo.WithContext(c.UserContext()).GetCompanyByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -104,7 +106,7 @@ func (h *CompanyController) GetSingleCompany(c *fiber.Ctx) error {
 	}
 
 	// Fetch company locations associated with the company
-	companyLocations, err := h.repo.GetCompanyLocations(company.ID)
+	companyLocations, err := h.repo.WithContext(c.UserContext()).GetCompanyLocations(company.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -142,7 +144,7 @@ func (h *CompanyController) UpdateCompany(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the company in the database
-	company, err := h.repo.GetCompanyByID(id)
+	company, err := h.repo.WithContext(c.UserContext()).GetCompanyByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -171,7 +173,7 @@ func (h *CompanyController) UpdateCompany(c *fiber.Ctx) error {
 	updateCompanyFields(&company, payload) // Pass the parsed payload
 
 	// Save the changes to the database
-	if err := h.repo.UpdateCompany(&company); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCompany(&company); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update company",
@@ -202,7 +204,7 @@ func (h *CompanyController) DeleteCompanyByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the Company in the database
-	company, err := h.repo.GetCompanyByID(id)
+	company, err := h.repo.WithContext(c.UserContext()).GetCompanyByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -218,7 +220,7 @@ func (h *CompanyController) DeleteCompanyByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the Company
-	if err := h.repo.DeleteByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete Company",
@@ -249,8 +251,12 @@ func (h *CompanyController) CreateCompanyExpense(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := normalizeCurrencies(c, h.rates, &companyExpense.Currency); err != nil {
+		return currencyError(c, err)
+	}
+
 	// Create the company expense in the database
-	if err := h.repo.CreateCompanyExpense(companyExpense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateCompanyExpense(companyExpense); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create company expense",
@@ -272,7 +278,7 @@ func (h *CompanyController) GetCompanyExpensesByCompanyId(c *fiber.Ctx) error {
 	companyId := c.Params("companyId")
 
 	// Fetch paginated expenses using the repository
-	pagination, expenses, err := h.repo.GetPaginatedExpenses(c, companyId)
+	pagination, expenses, err := h.repo.WithContext(c.UserContext()).GetPaginatedExpenses(c, companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -303,7 +309,7 @@ func (h *CompanyController) GetCompanyExpenseById(c *fiber.Ctx) error {
 	companyId := c.Params("companyId")
 
 	// Fetch the company expense from the repository
-	expense, err := h.repo.FindCompanyExpenseByIdAndCompanyId(id, companyId)
+	expense, err := h.repo.WithContext(c.UserContext()).FindCompanyExpenseByIdAndCompanyId(id, companyId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -331,11 +337,11 @@ func (h *CompanyController) GetCompanyExpenseById(c *fiber.Ctx) error {
 func (h *CompanyController) UpdateCompanyExpense(c *fiber.Ctx) error {
 	// Define a struct for input validation
 	type UpdateCompanyExpenseInput struct {
-		Description string  `json:"description" validate:"required"`
-		Currency    string  `json:"currency" validate:"required"`
-		Amount      float64 `json:"amount" validate:"required,gt=0"`
-		ExpenseDate string  `json:"expense_date" validate:"required"`
-		UpdatedBy   string  `json:"updated_by" validate:"required"`
+		Description string      `json:"description" validate:"required"`
+		Currency    string      `json:"currency" validate:"required"`
+		Amount      money.Money `json:"amount"`
+		ExpenseDate string      `json:"expense_date" validate:"required"`
+		UpdatedBy   string      `json:"updated_by" validate:"required"`
 	}
 
 	// Parse the expense ID from the request parameters
@@ -359,9 +365,19 @@ func (h *CompanyController) UpdateCompanyExpense(c *fiber.Ctx) error {
 			"errors":  validationErr,
 		})
 	}
+	if !input.Amount.IsPositive() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Validation failed",
+			"errors":  "amount must be greater than 0",
+		})
+	}
+	if err := normalizeCurrencies(c, h.rates, &input.Currency); err != nil {
+		return currencyError(c, err)
+	}
 
 	// Fetch the expense record using the repository
-	expense, err := h.repo.FindCompanyExpenseById(expenseID)
+	expense, err := h.repo.WithContext(c.UserContext()).FindCompanyExpenseById(expenseID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -384,7 +400,7 @@ func (h *CompanyController) UpdateCompanyExpense(c *fiber.Ctx) error {
 	expense.UpdatedBy = input.UpdatedBy
 
 	// Save the updated expense using the repository
-	if err := h.repo.UpdateCompanyExpense(expense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCompanyExpense(expense); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update expense",
@@ -408,7 +424,7 @@ func (h *CompanyController) DeleteCompanyExpenseById(c *fiber.Ctx) error {
 	expenseId := c.Params("id")
 
 	// Check if the expense exists and belongs to the specified company
-	expense, err := h.repo.FindCompanyExpenseByCompanyAndId(strconv.FormatUint(uint64(companyId), 10), expenseId)
+	expense, err := h.repo.WithContext(c.UserContext()).FindCompanyExpenseByCompanyAndId(strconv.FormatUint(uint64(companyId), 10), expenseId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -424,7 +440,7 @@ func (h *CompanyController) DeleteCompanyExpenseById(c *fiber.Ctx) error {
 	}
 
 	// Delete the expense using the repository
-	if err := h.repo.DeleteCompanyExpense(expense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteCompanyExpense(expense); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete company expense",
@@ -449,7 +465,7 @@ func (h *CompanyController) GetCompanyExpensesByCompanyIdAndExpenseDate(c *fiber
 	expenseDate := c.Params("expense_date")
 
 	// Fetch expenses using the repository
-	expenses, err := h.repo.FindCompanyExpensesByCompanyIdAndExpenseDate(companyId, expenseDate)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCompanyExpensesByCompanyIdAndExpenseDate(companyId, expenseDate)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -482,7 +498,7 @@ func (h *CompanyController) GetCompanyExpensesByCompanyIdAndExpenseDescription(c
 	expenseDescription := c.Params("expense_description")
 
 	// Fetch expenses using the repository
-	expenses, err := h.repo.FindCompanyExpensesByCompanyIdAndExpenseDescription(companyId, expenseDescription)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCompanyExpensesByCompanyIdAndExpenseDescription(companyId, expenseDescription)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -515,7 +531,7 @@ func (h *CompanyController) GetCompanyExpensesByCompanyIdAndCurrency(c *fiber.Ct
 	currency := c.Params("currency")
 
 	// Fetch expenses using the repository
-	expenses, err := h.repo.FindCompanyExpensesByCompanyIdAndCurrency(companyId, currency)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCompanyExpensesByCompanyIdAndCurrency(companyId, currency)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -549,7 +565,7 @@ func (h *CompanyController) GetCompanyExpensesByThree(c *fiber.Ctx) error {
 	currency := c.Params("currency")
 
 	// Fetch company expenses using the repository
-	expenses, err := h.repo.FindCompanyExpensesByThree(companyId, expenseDate, currency)
+	expenses, err := h.repo.WithContext(c.UserContext()).FindCompanyExpensesByThree(companyId, expenseDate, currency)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -584,7 +600,7 @@ func (h *CompanyController) GetCompanyExpensesFilters(c *fiber.Ctx) error {
 	currency := c.Params("currency")
 
 	// Fetch company expenses using the service layer
-	expenses, err := h.repo.GetCompanyExpensesByFour(companyId, expenseDate, expenseDescription, currency)
+	expenses, err := h.repo.WithContext(c.UserContext()).GetCompanyExpensesByFour(companyId, expenseDate, expenseDescription, currency)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -613,7 +629,7 @@ func (h *CompanyController) GetCompanyExpensesFilters(c *fiber.Ctx) error {
 
 func (h *CompanyController) GetAllExpenses(c *fiber.Ctx) error {
 	// Fetch paginated Companies using the repository
-	pagination, companies, err := h.repo.GetPaginatedAllExpenses(c)
+	pagination, companies, err := h.repo.WithContext(c.UserContext()).GetPaginatedAllExpenses(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -653,7 +669,7 @@ func (h *CompanyController) CreateCompanyLocation(c *fiber.Ctx) error {
 	}
 
 	// Create the company location in the database
-	if err := h.repo.CreateCompanyLocation(CompanyLocation); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateCompanyLocation(CompanyLocation); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create location",
@@ -678,7 +694,7 @@ func (h *CompanyController) GetAllCompanyLocations(c *fiber.Ctx) error {
 	companyId := c.Params("id")
 
 	// Fetch company expenses using the service layer
-	expenses, err := h.repo.GetAllCompanyLocations(companyId)
+	expenses, err := h.repo.WithContext(c.UserContext()).GetAllCompanyLocations(companyId)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -710,7 +726,7 @@ func (h *CompanyController) GetLocationByCompanyId(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the company expense from the repository
-	expense, err := h.repo.GetLocationByCompanyId(id, companyId)
+	expense, err := h.repo.WithContext(c.UserContext()).GetLocationByCompanyId(id, companyId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -767,7 +783,7 @@ func (h *CompanyController) UpdateCompanyLocation(c *fiber.Ctx) error {
 	}
 
 	// Fetch the location record using the repository
-	location, err := h.repo.FindLocationById(locationID)
+	location, err := h.repo.WithContext(c.UserContext()).FindLocationById(locationID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -789,7 +805,7 @@ func (h *CompanyController) UpdateCompanyLocation(c *fiber.Ctx) error {
 	location.UpdatedBy = input.UpdatedBy
 
 	// Save the updated location using the repository
-	if err := h.repo.UpdateCompanyLocation(location); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCompanyLocation(location); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update location",
@@ -813,7 +829,7 @@ func (h *CompanyController) DeleteLocationByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the location in the database
-	location, err := h.repo.FindLocationById(id)
+	location, err := h.repo.WithContext(c.UserContext()).FindLocationById(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -829,7 +845,7 @@ func (h *CompanyController) DeleteLocationByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the location
-	if err := h.repo.DeleteLocationByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteLocationByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete port",
@@ -113,7 +113,7 @@ func (h *CustomerController) CreateCustomer(c *fiber.Ctx) error {
 	}
 
 	// Attempt to create the customer record using the repository
-	if err := h.repo.CreateCustomer(customer); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateCustomer(customer); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create customer",
@@ -132,7 +132,7 @@ func (h *CustomerController) CreateCustomer(c *fiber.Ctx) error {
 // =====================
 
 func (h *CustomerController) GetAllCustomers(c *fiber.Ctx) error {
-	pagination, customers, err := h.repo.GetPaginatedCustomers(c)
+	pagination, customers, err := h.repo.WithContext(c.UserContext()).GetPaginatedCustomers(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -147,7 +147,7 @@ func (h *CustomerController) GetAllCustomers(c *fiber.Ctx) error {
 	// Iterate over all customers to fetch associated customer addresses and contacts
 	for _, customer := range customers {
 		// Fetch customer addresses and contacts
-		addresses, err := h.repo.GetCustomerAddresses(customer.ID)
+		addresses, err := h.repo.WithContext(c.UserContext()).GetCustomerAddresses(customer.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -156,7 +156,7 @@ func (h *CustomerController) GetAllCustomers(c *fiber.Ctx) error {
 			})
 		}
 
-		contacts, err := h.repo.GetCustomerContacts(customer.ID)
+		contacts, err := h.repo.WithContext(c.UserContext()).GetCustomerContacts(customer.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -195,7 +195,7 @@ func (h *CustomerController) GetSingleCustomer(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the customer by ID
-	customer, err := h.repo.GetCustomerByID(id)
+	customer, err := h.repo.WithContext(c.UserContext()).GetCustomerByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -211,7 +211,7 @@ func (h *CustomerController) GetSingleCustomer(c *fiber.Ctx) error {
 	}
 
 	// Fetch customer addresses associated with the customer
-	addresses, err := h.repo.GetCustomerAddresses(customer.ID)
+	addresses, err := h.repo.WithContext(c.UserContext()).GetCustomerAddresses(customer.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -221,7 +221,7 @@ func (h *CustomerController) GetSingleCustomer(c *fiber.Ctx) error {
 	}
 
 	// Fetch customer contacts associated with the customer
-	contacts, err := h.repo.GetCustomerContacts(customer.ID)
+	contacts, err := h.repo.WithContext(c.UserContext()).GetCustomerContacts(customer.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -268,7 +268,7 @@ func (h *CustomerController) UpdateCustomer(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the customer in the database
-	customer, err := h.repo.GetCustomerByID(id)
+	customer, err := h.repo.WithContext(c.UserContext()).GetCustomerByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -408,7 +408,7 @@ func (h *CustomerController) UpdateCustomer(c *fiber.Ctx) error {
 	}
 
 	// Update the customer in the database
-	if err := h.repo.UpdateCustomer(id, updates); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCustomer(id, updates); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update customer",
@@ -432,7 +432,7 @@ func (h *CustomerController) DeleteCustomerByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the Customer in the database
-	customer, err := h.repo.GetCustomerByID(id)
+	customer, err := h.repo.WithContext(c.UserContext()).GetCustomerByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -448,7 +448,7 @@ func (h *CustomerController) DeleteCustomerByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the Customer
-	if err := h.repo.DeleteByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete Customer",
@@ -471,7 +471,7 @@ func (h *CustomerController) FetchCustomerUpload(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the customer in the database
-	customer, err := h.repo.GetCustomerByID(id)
+	customer, err := h.repo.WithContext(c.UserContext()).GetCustomerByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -514,7 +514,7 @@ func (h *CustomerController) CreateCustomerContact(c *fiber.Ctx) error {
 	}
 
 	// Create the customer address in the database
-	if err := h.repo.CreateCustomerContact(customerContact); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateCustomerContact(customerContact); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create customer contact",
@@ -537,7 +537,7 @@ func (h *CustomerController) GetCustomerContactsByCustomerId(c *fiber.Ctx) error
 	customerId := c.Params("id")
 
 	// Fetch contacts using the repository
-	contacts, err := h.repo.GetCustomerContactsByCustomerId(customerId)
+	contacts, err := h.repo.WithContext(c.UserContext()).GetCustomerContactsByCustomerId(customerId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -566,7 +566,7 @@ func (h *CustomerController) GetCustomerContactsByCompanyId(c *fiber.Ctx) error
 	companyId := c.Params("companyId")
 
 	// Fetch paginated contacts using the repository
-	pagination, contacts, err := h.repo.GetPaginatedContacts(c, companyId)
+	pagination, contacts, err := h.repo.WithContext(c.UserContext()).GetPaginatedContacts(c, companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -599,7 +599,7 @@ func (h *CustomerController) GetCustomerContactById(c *fiber.Ctx) error {
 	customerId := c.Params("customerId")
 
 	// Fetch the company contact from the repository
-	contact, err := h.repo.GetCustomerContactByIdAndCustomerId(id, customerId)
+	contact, err := h.repo.WithContext(c.UserContext()).GetCustomerContactByIdAndCustomerId(id, customerId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -656,7 +656,7 @@ func (h *CustomerController) UpdateCustomerContact(c *fiber.Ctx) error {
 	}
 
 	// Fetch the expense record using the repository
-	expense, err := h.repo.GetCustomerContactById(expenseID)
+	expense, err := h.repo.WithContext(c.UserContext()).GetCustomerContactById(expenseID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -678,7 +678,7 @@ func (h *CustomerController) UpdateCustomerContact(c *fiber.Ctx) error {
 	expense.UpdatedBy = input.UpdatedBy
 
 	// Save the updated expense using the repository
-	if err := h.repo.UpdateCustomerContact(expense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCustomerContact(expense); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update expense",
@@ -703,7 +703,7 @@ func (h *CustomerController) DeleteCustomerContactById(c *fiber.Ctx) error {
 	customerId := c.Params("customerId")
 
 	// Find the contact in the database
-	contact, err := h.repo.GetCustomerContactById(id)
+	contact, err := h.repo.WithContext(c.UserContext()).GetCustomerContactById(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -719,7 +719,7 @@ func (h *CustomerController) DeleteCustomerContactById(c *fiber.Ctx) error {
 	}
 
 	// Delete the contact
-	if err := h.repo.DeleteCustomerContactById(id, customerId); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteCustomerContactById(id, customerId); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete contact",
@@ -741,7 +741,7 @@ func (h *CustomerController) GetCustomerAddressesByCompanyId(c *fiber.Ctx) error
 	companyId := c.Params("companyId")
 
 	// Fetch paginated contacts using the repository
-	pagination, contacts, err := h.repo.GetPaginatedAddresses(c, companyId)
+	pagination, contacts, err := h.repo.WithContext(c.UserContext()).GetPaginatedAddresses(c, companyId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -779,7 +779,7 @@ func (h *CustomerController) CreateCustomerAddress(c *fiber.Ctx) error {
 	}
 
 	// Create the customer address in the database
-	if err := h.repo.CreateCustomerAddress(customerAddress); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateCustomerAddress(customerAddress); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create customer address",
@@ -801,7 +801,7 @@ func (h *CustomerController) GetCustomerAddressesByCustomerId(c *fiber.Ctx) erro
 	customerId := c.Params("id")
 
 	// Fetch company expenses using the service layer
-	expenses, err := h.repo.GetCustomerAddressesByCustomerId(customerId)
+	expenses, err := h.repo.WithContext(c.UserContext()).GetCustomerAddressesByCustomerId(customerId)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -836,7 +836,7 @@ func (h *CustomerController) GetCustomerAddressById(c *fiber.Ctx) error {
 	customerId := c.Params("customerId")
 
 	// Fetch the company contact from the repository
-	contact, err := h.repo.GetCustomerAddressByIdAndCustomerId(id, customerId)
+	contact, err := h.repo.WithContext(c.UserContext()).GetCustomerAddressByIdAndCustomerId(id, customerId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -895,7 +895,7 @@ func (h *CustomerController) UpdateCustomerAddress(c *fiber.Ctx) error {
 	}
 
 	// Fetch the expense record using the repository
-	expense, err := h.repo.GetCustomerAddressById(expenseID)
+	expense, err := h.repo.WithContext(c.UserContext()).GetCustomerAddressById(expenseID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -919,7 +919,7 @@ func (h *CustomerController) UpdateCustomerAddress(c *fiber.Ctx) error {
 	expense.UpdatedBy = input.UpdatedBy
 
 	// Save the updated expense using the repository
-	if err := h.repo.UpdateCustomerAddress(expense); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateCustomerAddress(expense); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update expense",
@@ -944,7 +944,7 @@ func (h *CustomerController) DeleteCustomerAddressById(c *fiber.Ctx) error {
 	customerId := c.Params("customerId")
 
 	// Find the contact in the database
-	contact, err := h.repo.GetCustomerAddressById(id)
+	contact, err := h.repo.WithContext(c.UserContext()).GetCustomerAddressById(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -960,7 +960,7 @@ func (h *CustomerController) DeleteCustomerAddressById(c *fiber.Ctx) error {
 	}
 
 	// Delete the contact
-	if err := h.repo.DeleteCustomerAddressById(id, customerId); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteCustomerAddressById(id, customerId); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete contact",
@@ -982,7 +982,7 @@ func (h *CustomerController) DeleteCustomerAddressById(c *fiber.Ctx) error {
 
 func (h *CustomerController) SearchCustomers(c *fiber.Ctx) error {
 	// Call the repository function to get paginated search results
-	pagination, customers, err := h.repo.SearchPaginatedCustomers(c)
+	pagination, customers, err := h.repo.WithContext(c.UserContext()).SearchPaginatedCustomers(c)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"car-bond/internals/config"
+	"car-bond/internals/models/metaData"
+	"car-bond/internals/money"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultValuationCurrency is the currency of the URA valuation sheet unless VALUATION_CURRENCY is set
+const defaultValuationCurrency = "USD"
+
+type DutyEstimateController struct {
+	repo repository.DutyEstimateRepository
+}
+
+func NewDutyEstimateController(repo repository.DutyEstimateRepository) *DutyEstimateController {
+	return &DutyEstimateController{repo: repo}
+}
+
+func valuationCurrency() string {
+	if currency := config.Config("VALUATION_CURRENCY"); currency != "" {
+		return currency
+	}
+	return defaultValuationCurrency
+}
+
+// ============================================
+
+type DutyRatePayload struct {
+	Tax         string      `json:"tax" validate:"required"`
+	Description string      `json:"description" validate:"required"`
+	Basis       string      `json:"basis"`
+	Rate        money.Money `json:"rate"`
+	Amount      money.Money `json:"amount"`
+	MinAge      int         `json:"min_age" validate:"gte=0"`
+	MaxAge      int         `json:"max_age" validate:"gte=0"`
+	CreatedBy   string      `json:"created_by"`
+	UpdatedBy   string      `json:"updated_by"`
+}
+
+func validateDutyRatePayload(payload *DutyRatePayload) fiber.Map {
+	if validationErr := utils.ValidateStruct(payload); validationErr != nil {
+		return fiber.Map{"status": "error", "message": "Validation failed", "errors": validationErr}
+	}
+	if payload.Rate.IsNegative() || payload.Amount.IsNegative() {
+		return fiber.Map{"status": "error", "message": "Validation failed", "errors": "rate and amount must not be negative"}
+	}
+	if payload.Rate.IsZero() == payload.Amount.IsZero() {
+		return fiber.Map{"status": "error", "message": "Validation failed", "errors": "set either a rate or a fixed amount"}
+	}
+	if payload.Rate.IsPositive() && payload.Basis != metaData.DutyBasisCIF && payload.Basis != metaData.DutyBasisCIFDuty {
+		return fiber.Map{"status": "error", "message": "Validation failed", "errors": "basis must be cif or cif_duty for a rate"}
+	}
+	if payload.MaxAge != 0 && payload.MaxAge < payload.MinAge {
+		return fiber.Map{"status": "error", "message": "Validation failed", "errors": "max_age must not be below min_age"}
+	}
+	return nil
+}
+
+func (h *DutyEstimateController) GetAllDutyRates(c *fiber.Ctx) error {
+	rates, err := h.repo.WithContext(c.UserContext()).GetDutyRates()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve duty rates",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Duty rates retrieved successfully",
+		"data":    rates,
+	})
+}
+
+func (h *DutyEstimateController) CreateDutyRate(c *fiber.Ctx) error {
+	var payload DutyRatePayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input provided",
+			"data":    err.Error(),
+		})
+	}
+	if response := validateDutyRatePayload(&payload); response != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	rate := metaData.DutyRate{
+		Tax:         payload.Tax,
+		Description: payload.Description,
+		Basis:       payload.Basis,
+		Rate:        payload.Rate,
+		Amount:      payload.Amount,
+		MinAge:      payload.MinAge,
+		MaxAge:      payload.MaxAge,
+		CreatedBy:   payload.CreatedBy,
+		UpdatedBy:   payload.UpdatedBy,
+	}
+	if err := h.repo.WithContext(c.UserContext()).CreateDutyRate(&rate); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create duty rate",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Duty rate created successfully",
+		"data":    rate,
+	})
+}
+
+func (h *DutyEstimateController) UpdateDutyRate(c *fiber.Ctx) error {
+	rate, err := h.repo.WithContext(c.UserContext()).GetDutyRateByID(c.Params("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Duty rate not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve duty rate",
+			"data":    err.Error(),
+		})
+	}
+
+	var payload DutyRatePayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    err.Error(),
+		})
+	}
+	if response := validateDutyRatePayload(&payload); response != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	rate.Tax = payload.Tax
+	rate.Description = payload.Description
+	rate.Basis = payload.Basis
+	rate.Rate = payload.Rate
+	rate.Amount = payload.Amount
+	rate.MinAge = payload.MinAge
+	rate.MaxAge = payload.MaxAge
+	rate.UpdatedBy = payload.UpdatedBy
+
+	if err := h.repo.WithContext(c.UserContext()).UpdateDutyRate(&rate); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update duty rate",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Duty rate updated successfully",
+		"data":    rate,
+	})
+}
+
+func (h *DutyEstimateController) DeleteDutyRateByID(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	rate, err := h.repo.WithContext(c.UserContext()).GetDutyRateByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Duty rate not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to find duty rate",
+			"data":    err.Error(),
+		})
+	}
+
+	if err := h.repo.WithContext(c.UserContext()).DeleteDutyRateByID(id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete duty rate",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Duty rate deleted successfully",
+		"data":    rate,
+	})
+}
+
+// =====================
+
+type DutyEstimatePayload struct {
+	repository.DutyEstimateRequest
+	Save      bool   `json:"save"` // record the breakdown as expenses on the car
+	UpdatedBy string `json:"updated_by"`
+}
+
+// estimateDuty runs the estimate and, when asked, saves it on the car
+func (h *DutyEstimateController) estimateDuty(c *fiber.Ctx, payload *DutyEstimatePayload) error {
+	payload.ValuationCurrency = valuationCurrency()
+
+	estimate, err := h.repo.WithContext(c.UserContext()).EstimateDuty(payload.DutyEstimateRequest)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Car not found",
+			})
+		case errors.Is(err, repository.ErrDutyVehicleDetails), errors.Is(err, repository.ErrInvalidAsOfDate):
+			status = fiber.StatusBadRequest
+		case errors.Is(err, repository.ErrNoEvaluationMatch), errors.Is(err, repository.ErrNoEvaluationVersion),
+			errors.Is(err, repository.ErrRateNotFound):
+			status = fiber.StatusNotFound
+		case errors.Is(err, repository.ErrUnknownCurrency):
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to estimate duty",
+			"data":    err.Error(),
+		})
+	}
+
+	if payload.Save {
+		if estimate.CarID == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "car_id is required to save the estimate",
+			})
+		}
+		expenses, err := h.repo.WithContext(c.UserContext()).SaveDutyEstimate(estimate, payload.UpdatedBy)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to save duty estimate as car expenses",
+				"data":    err.Error(),
+			})
+		}
+		estimate.Expenses = expenses
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Duty estimated successfully",
+		"data":    estimate,
+	})
+}
+
+// EstimateDuty estimates the duty of a car (car_id) or of a make/model/cc/year from the request body
+func (h *DutyEstimateController) EstimateDuty(c *fiber.Ctx) error {
+	var payload DutyEstimatePayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input provided",
+			"data":    err.Error(),
+		})
+	}
+	return h.estimateDuty(c, &payload)
+}
+
+// GetCarDutyEstimate estimates the duty of a car from its own details without saving anything.
+// ?as_of=YYYY-MM-DD uses the valuation and exchange rate of that date.
+func (h *DutyEstimateController) GetCarDutyEstimate(c *fiber.Ctx) error {
+	carID := utils.StrToUint(c.Params("id"))
+	payload := DutyEstimatePayload{DutyEstimateRequest: repository.DutyEstimateRequest{CarID: &carID, AsOf: c.Query("as_of")}}
+	return h.estimateDuty(c, &payload)
+}
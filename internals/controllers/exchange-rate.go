@@ -0,0 +1,374 @@
+package controllers
+
+import (
+	"car-bond/internals/models/metaData"
+	"car-bond/internals/money"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type ExchangeRateController struct {
+	repo repository.ExchangeRateRepository
+}
+
+func NewExchangeRateController(repo repository.ExchangeRateRepository) *ExchangeRateController {
+	return &ExchangeRateController{repo: repo}
+}
+
+// ============================================
+
+type ExchangeRatePayload struct {
+	BaseCurrency  string      `json:"base_currency" validate:"required"`
+	QuoteCurrency string      `json:"quote_currency" validate:"required"`
+	RateDate      string      `json:"rate_date" validate:"required"`
+	Rate          money.Money `json:"rate"`
+	Source        string      `json:"source"`
+	CreatedBy     string      `json:"created_by"`
+	UpdatedBy     string      `json:"updated_by"`
+}
+
+// validateExchangeRatePayload checks the payload and normalises both currencies against the currency list
+func (h *ExchangeRateController) validateExchangeRatePayload(c *fiber.Ctx, payload *ExchangeRatePayload) (fiber.Map, error) {
+	if validationErr := utils.ValidateStruct(payload); validationErr != nil {
+		return fiber.Map{"status": "error", "message": "Validation failed", "errors": validationErr}, errors.New("validation failed")
+	}
+	if !payload.Rate.IsPositive() {
+		return fiber.Map{"status": "error", "message": "Validation failed", "errors": "rate must be greater than 0"}, errors.New("validation failed")
+	}
+
+	rateDate, err := time.Parse("2006-01-02", payload.RateDate)
+	if err != nil {
+		return fiber.Map{"status": "error", "message": "Invalid rate_date format (expected YYYY-MM-DD)", "data": err.Error()}, err
+	}
+	payload.RateDate = rateDate.Format("2006-01-02")
+
+	if payload.BaseCurrency, err = h.repo.WithContext(c.UserContext()).NormalizeCurrency(payload.BaseCurrency); err != nil {
+		return fiber.Map{"status": "error", "message": "Invalid base_currency", "data": err.Error()}, err
+	}
+	if payload.QuoteCurrency, err = h.repo.WithContext(c.UserContext()).NormalizeCurrency(payload.QuoteCurrency); err != nil {
+		return fiber.Map{"status": "error", "message": "Invalid quote_currency", "data": err.Error()}, err
+	}
+	if payload.BaseCurrency == payload.QuoteCurrency {
+		return fiber.Map{"status": "error", "message": "base_currency and quote_currency must differ"}, errors.New("same currency")
+	}
+	return nil, nil
+}
+
+// normalizeCurrencies replaces each currency with its ISO code from the currency list
+func normalizeCurrencies(c *fiber.Ctx, rates repository.ExchangeRateRepository, currencies ...*string) error {
+	for _, currency := range currencies {
+		code, err := rates.WithContext(c.UserContext()).NormalizeCurrency(*currency)
+		if err != nil {
+			return err
+		}
+		*currency = code
+	}
+	return nil
+}
+
+// currencyError answers 400 for a currency missing from the currency list
+func currencyError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, repository.ErrUnknownCurrency) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid currency",
+			"data":    err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Failed to check currency",
+		"data":    err.Error(),
+	})
+}
+
+func (h *ExchangeRateController) CreateExchangeRate(c *fiber.Ctx) error {
+	var payload ExchangeRatePayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input provided",
+			"data":    err.Error(),
+		})
+	}
+
+	if response, err := h.validateExchangeRatePayload(c, &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	rate := metaData.ExchangeRate{
+		BaseCurrency:  payload.BaseCurrency,
+		QuoteCurrency: payload.QuoteCurrency,
+		RateDate:      payload.RateDate,
+		Rate:          payload.Rate,
+		Source:        payload.Source,
+		CreatedBy:     payload.CreatedBy,
+		UpdatedBy:     payload.UpdatedBy,
+	}
+	if err := h.repo.WithContext(c.UserContext()).CreateExchangeRate(&rate); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create exchange rate (a rate for this pair and date may already exist)",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Exchange rate created successfully",
+		"data":    rate,
+	})
+}
+
+// =====================
+
+func (h *ExchangeRateController) GetAllExchangeRates(c *fiber.Ctx) error {
+	pagination, rates, err := h.repo.WithContext(c.UserContext()).GetPaginatedExchangeRates(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve exchange rates",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Exchange rates retrieved successfully",
+		"data":    rates,
+		"pagination": fiber.Map{
+			"total_items":  pagination.TotalItems,
+			"total_pages":  pagination.TotalPages,
+			"current_page": pagination.CurrentPage,
+			"limit":        pagination.ItemsPerPage,
+		},
+	})
+}
+
+// =====================
+
+func (h *ExchangeRateController) GetExchangeRate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	rate, err := h.repo.WithContext(c.UserContext()).GetExchangeRateByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Exchange rate not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve exchange rate",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Exchange rate retrieved successfully",
+		"data":    rate,
+	})
+}
+
+// =====================
+
+func (h *ExchangeRateController) UpdateExchangeRate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	rate, err := h.repo.WithContext(c.UserContext()).GetExchangeRateByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Exchange rate not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve exchange rate",
+			"data":    err.Error(),
+		})
+	}
+
+	var payload ExchangeRatePayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    err.Error(),
+		})
+	}
+
+	if response, err := h.validateExchangeRatePayload(c, &payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	rate.BaseCurrency = payload.BaseCurrency
+	rate.QuoteCurrency = payload.QuoteCurrency
+	rate.RateDate = payload.RateDate
+	rate.Rate = payload.Rate
+	rate.Source = payload.Source
+	rate.UpdatedBy = payload.UpdatedBy
+
+	if err := h.repo.WithContext(c.UserContext()).UpdateExchangeRate(&rate); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update exchange rate",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Exchange rate updated successfully",
+		"data":    rate,
+	})
+}
+
+// =====================
+
+func (h *ExchangeRateController) DeleteExchangeRateByID(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	rate, err := h.repo.WithContext(c.UserContext()).GetExchangeRateByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Exchange rate not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to find exchange rate",
+			"data":    err.Error(),
+		})
+	}
+
+	if err := h.repo.WithContext(c.UserContext()).DeleteExchangeRateByID(id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete exchange rate",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Exchange rate deleted successfully",
+		"data":    rate,
+	})
+}
+
+// =====================
+
+// ConvertAmount converts ?amount=&from=&to=&date= using the stored rates (date defaults to today)
+func (h *ExchangeRateController) ConvertAmount(c *fiber.Ctx) error {
+	amount, err := money.Parse(c.Query("amount"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid amount",
+			"data":    err.Error(),
+		})
+	}
+
+	on := time.Now()
+	if date := c.Query("date"); date != "" {
+		if on, err = time.Parse("2006-01-02", date); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid date format (expected YYYY-MM-DD)",
+				"data":    err.Error(),
+			})
+		}
+	}
+
+	from, to := c.Query("from"), c.Query("to")
+	rate, err := h.repo.WithContext(c.UserContext()).FindRate(from, to, on)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, repository.ErrUnknownCurrency) {
+			status = fiber.StatusBadRequest
+		} else if errors.Is(err, repository.ErrRateNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to convert amount",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Amount converted successfully",
+		"data": fiber.Map{
+			"amount":    amount,
+			"from":      from,
+			"to":        to,
+			"date":      on.Format("2006-01-02"),
+			"rate":      rate,
+			"converted": amount.Mul(rate).Round(),
+		},
+	})
+}
+
+// =====================
+
+func (h *ExchangeRateController) GetCarCurrencyTotals(c *fiber.Ctx) error {
+	carID := utils.StrToUint(c.Params("id"))
+
+	totals, err := h.repo.WithContext(c.UserContext()).GetCarCurrencyTotals(carID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Car not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to compute car totals",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Car totals computed successfully",
+		"data":    totals,
+	})
+}
+
+func (h *ExchangeRateController) GetSaleCurrencyTotals(c *fiber.Ctx) error {
+	saleID := utils.StrToUint(c.Params("id"))
+
+	totals, err := h.repo.WithContext(c.UserContext()).GetSaleCurrencyTotals(saleID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Sale not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to compute sale totals",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Sale totals computed successfully",
+		"data":    totals,
+	})
+}
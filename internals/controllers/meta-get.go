@@ -3,6 +3,7 @@ package controllers
 import (
 	"car-bond/internals/repository"
 	"errors"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
@@ -28,9 +29,28 @@ func (h *MetaGetController) FetchVehicleEvaluationsByDescription(c *fiber.Ctx) e
 		})
 	}
 
+	// Search the valuation in effect on ?as_of= (default today)
+	asOf := time.Now()
+	if value := c.Query("as_of"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid as_of date format (expected YYYY-MM-DD)",
+			})
+		}
+		asOf = parsed
+	}
+
 	// Fetch evaluations using the repository
-	evaluations, err := h.repo.FindEvaluationsByDescription(description)
+	evaluations, err := h.repo.WithContext(c.UserContext()).FindEvaluationsByDescription(description, asOf)
 	if err != nil {
+		if errors.Is(err, repository.ErrNoEvaluationVersion) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "No vehicle evaluation in effect on that date",
+			})
+		}
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"status":  "error",
@@ -58,7 +78,7 @@ func (h *MetaGetController) FetchVehicleEvaluationsByDescription(c *fiber.Ctx) e
 
 func (h *MetaGetController) GetAllWeightUnits(c *fiber.Ctx) error {
 	// Fetch evaluations using the repository
-	weights, err := h.repo.GetAllWeightUnits(c)
+	weights, err := h.repo.WithContext(c.UserContext()).GetAllWeightUnits(c)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -82,7 +102,7 @@ func (h *MetaGetController) GetAllWeightUnits(c *fiber.Ctx) error {
 }
 
 func (h *MetaGetController) GetAllLeightUnits(c *fiber.Ctx) error {
-	lengths, err := h.repo.GetAllLeightUnits(c)
+	lengths, err := h.repo.WithContext(c.UserContext()).GetAllLeightUnits(c)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -105,7 +125,7 @@ func (h *MetaGetController) GetAllLeightUnits(c *fiber.Ctx) error {
 	})
 }
 func (h *MetaGetController) GetAllCurrencies(c *fiber.Ctx) error {
-	currencies, err := h.repo.GetAllCurrencies(c)
+	currencies, err := h.repo.WithContext(c.UserContext()).GetAllCurrencies(c)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -131,7 +151,7 @@ func (h *MetaGetController) GetAllCurrencies(c *fiber.Ctx) error {
 // =================
 
 func (h *MetaGetController) GetAllExpenseCategories(c *fiber.Ctx) error {
-	currencies, err := h.repo.GetAllExpenseCategories(c)
+	currencies, err := h.repo.WithContext(c.UserContext()).GetAllExpenseCategories(c)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -160,7 +180,7 @@ func (h *MetaGetController) FindPorts(c *fiber.Ctx) error {
 	// Retrieve companyId and expenseDate from the request parameter
 
 	// Fetch ports using the repository
-	ports, err := h.repo.FindPorts(c)
+	ports, err := h.repo.WithContext(c.UserContext()).FindPorts(c)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -196,7 +216,7 @@ func (h *MetaGetController) FindPaymentModeBymode(c *fiber.Ctx) error {
 	}
 
 	// Fetch ports using the repository
-	ports, err := h.repo.FindPaymentModeBymode(mode)
+	ports, err := h.repo.WithContext(c.UserContext()).FindPaymentModeBymode(mode)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"car-bond/internals/config"
+	"car-bond/internals/models/metaData"
+	"car-bond/internals/money"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// evaluationColumns are the columns of the URA valuation sheet: HSC code, COO, description, CC, CIF
+const evaluationColumns = 5
+
+// defaultMaxErrorPercent is the share of bad rows a real import accepts unless
+// EVALUATION_MAX_ERROR_PERCENT or the max_error_percent form field says otherwise
+const defaultMaxErrorPercent = 5.0
+
+// headerScanRows is how far down the sheet the header row is looked for
+const headerScanRows = 20
+
+type EvaluationRowReport struct {
+	Row    int                         `json:"row"`
+	Raw    []string                    `json:"raw"`
+	Parsed *metaData.VehicleEvaluation `json:"parsed"`
+	Errors []string                    `json:"errors"`
+}
+
+type EvaluationImportReport struct {
+	Sheet           string                `json:"sheet"`
+	HeaderRow       int                   `json:"header_row"` // 0 when the sheet has no header row
+	TotalRows       int                   `json:"total_rows"`
+	ValidRows       int                   `json:"valid_rows"`
+	ErrorRows       int                   `json:"error_rows"`
+	BlankRows       int                   `json:"blank_rows"`
+	ErrorPercent    float64               `json:"error_percent"`
+	MaxErrorPercent float64               `json:"max_error_percent"`
+	Rows            []EvaluationRowReport `json:"rows"`
+}
+
+// Passed reports whether the share of bad rows is within the threshold
+func (r *EvaluationImportReport) Passed() bool {
+	return r.ValidRows > 0 && r.ErrorPercent <= r.MaxErrorPercent
+}
+
+// OnlyErrors drops the valid rows from the report, to keep the response of a large import small
+func (r *EvaluationImportReport) OnlyErrors() {
+	rows := make([]EvaluationRowReport, 0, r.ErrorRows)
+	for _, row := range r.Rows {
+		if len(row.Errors) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	r.Rows = rows
+}
+
+// maxErrorPercent reads the import threshold from the request, then the config
+func maxErrorPercent(c *fiber.Ctx) (float64, error) {
+	value := c.FormValue("max_error_percent", c.Query("max_error_percent"))
+	if value == "" {
+		value = config.Config("EVALUATION_MAX_ERROR_PERCENT")
+	}
+	if value == "" {
+		return defaultMaxErrorPercent, nil
+	}
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid max_error_percent %q (expected 0 to 100)", value)
+	}
+	return percent, nil
+}
+
+// isEvaluationHeader recognises the header of the valuation sheet by its HSC/description and CIF titles
+func isEvaluationHeader(values []string) bool {
+	hasCIF, hasKey := false, false
+	for _, value := range values {
+		value = strings.ToUpper(value)
+		if strings.Contains(value, "CIF") {
+			hasCIF = true
+		}
+		if strings.Contains(value, "HSC") || strings.Contains(value, "DESCRIPTION") {
+			hasKey = true
+		}
+	}
+	return hasCIF && hasKey
+}
+
+// detectHeaderRow resolves the header_row setting: a row number, "none" (or 0) for a sheet without
+// a header, or "auto" (the default) to look for the header in the first rows
+func detectHeaderRow(rows []sheetRow, setting string) (int, error) {
+	setting = strings.ToLower(strings.TrimSpace(setting))
+	switch setting {
+	case "none", "0":
+		return 0, nil
+	case "", "auto":
+		for i := 0; i < len(rows) && i < headerScanRows; i++ {
+			if isEvaluationHeader(rows[i].Values) {
+				return rows[i].Number, nil
+			}
+		}
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(setting)
+	if err != nil || number < 0 || number > len(rows) {
+		return 0, fmt.Errorf("invalid header_row %q (expected auto, none or a row number up to %d)", setting, len(rows))
+	}
+	return number, nil
+}
+
+// validateEvaluationRow parses one sheet row and lists everything wrong with it
+func validateEvaluationRow(row sheetRow, uploadedBy string) EvaluationRowReport {
+	report := EvaluationRowReport{Row: row.Number, Raw: row.Values, Errors: []string{}}
+
+	values := make([]string, evaluationColumns)
+	for i := 0; i < evaluationColumns && i < len(row.Values); i++ {
+		values[i] = strings.TrimSpace(row.Values[i])
+	}
+	if len(row.Values) < evaluationColumns {
+		report.Errors = append(report.Errors,
+			fmt.Sprintf("expected %d columns (HSC code, COO, description, CC, CIF), found %d", evaluationColumns, len(row.Values)))
+	}
+
+	parsed := &metaData.VehicleEvaluation{
+		HSCCode:     values[0],
+		COO:         values[1],
+		Description: values[2],
+		CC:          values[3],
+		CreatedBy:   uploadedBy,
+		UpdatedBy:   uploadedBy,
+	}
+	report.Parsed = parsed
+
+	if parsed.HSCCode == "" {
+		report.Errors = append(report.Errors, "HSC code is empty")
+	}
+	if parsed.Description == "" {
+		report.Errors = append(report.Errors, "description is empty")
+	} else if len(parsed.Description) > 100 {
+		report.Errors = append(report.Errors, "description is longer than 100 characters")
+	}
+	if len(parsed.CC) > 50 {
+		report.Errors = append(report.Errors, "CC is longer than 50 characters")
+	}
+
+	cifValue := strings.NewReplacer(" ", "", ",", "").Replace(values[4])
+	switch cif, err := money.Parse(cifValue); {
+	case values[4] == "":
+		report.Errors = append(report.Errors, "CIF is empty")
+	case err != nil:
+		report.Errors = append(report.Errors, fmt.Sprintf("CIF %q is not a number", values[4]))
+	case !cif.IsPositive():
+		report.Errors = append(report.Errors, "CIF must be greater than 0")
+	default:
+		parsed.CIF = cif
+	}
+
+	return report
+}
+
+// buildEvaluationImportReport validates every data row below the header
+func buildEvaluationImportReport(sheet string, rows []sheetRow, headerRow int, maxPercent float64, uploadedBy string) *EvaluationImportReport {
+	report := &EvaluationImportReport{
+		Sheet:           sheet,
+		HeaderRow:       headerRow,
+		MaxErrorPercent: maxPercent,
+		Rows:            []EvaluationRowReport{},
+	}
+
+	for _, row := range rows {
+		if row.Number <= headerRow {
+			continue
+		}
+		if len(row.Values) == 0 {
+			report.BlankRows++
+			continue
+		}
+
+		rowReport := validateEvaluationRow(row, uploadedBy)
+		report.TotalRows++
+		if len(rowReport.Errors) > 0 {
+			report.ErrorRows++
+		} else {
+			report.ValidRows++
+		}
+		report.Rows = append(report.Rows, rowReport)
+	}
+
+	if report.TotalRows > 0 {
+		report.ErrorPercent = float64(report.ErrorRows) * 100 / float64(report.TotalRows)
+	}
+	return report
+}
+
+// validEvaluations returns the rows of the report that can be imported
+func (r *EvaluationImportReport) validEvaluations() []metaData.VehicleEvaluation {
+	rows := make([]metaData.VehicleEvaluation, 0, r.ValidRows)
+	for _, row := range r.Rows {
+		if len(row.Errors) == 0 {
+			rows = append(rows, *row.Parsed)
+		}
+	}
+	return rows
+}
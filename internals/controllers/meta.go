@@ -3,48 +3,87 @@ package controllers
 import (
 	"car-bond/internals/models/metaData"
 	"car-bond/internals/repository"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 )
 
 type MetaController struct {
-	repo repository.Excecute
+	repo repository.VehicleEvaluationRepository
 }
 
-func NewMetaController(repo repository.Excecute) *MetaController {
+func NewMetaController(repo repository.VehicleEvaluationRepository) *MetaController {
 	return &MetaController{repo: repo}
 }
 
 // ===============
 
-func (m *MetaController) ProcessExcelAndUpload(c *fiber.Ctx, db repository.Excecute) error {
-	// Begin transaction
-	db = db.Begin()
+// fileChecksum returns the hex SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
 
+// ProcessExcelAndUpload stores the uploaded valuation sheet as a new version. The form may carry an
+// effective_date (YYYY-MM-DD, default today), uploaded_by, header_row (auto, none or a row number),
+// max_error_percent and dry_run. A dry run returns the row by row validation report without importing;
+// a real import rejects the whole file when the share of bad rows is above max_error_percent.
+func (m *MetaController) ProcessExcelAndUpload(c *fiber.Ctx) error {
 	// Retrieve the uploaded file
 	file, err := c.FormFile("excel")
 	if err != nil {
-		db.Rollback()
 		return fiber.NewError(fiber.StatusBadRequest, "Failed to retrieve uploaded file: "+err.Error())
 	}
 
+	effectiveDate := time.Now().Format("2006-01-02")
+	if value := c.FormValue("effective_date"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid effective_date format (expected YYYY-MM-DD)")
+		}
+		effectiveDate = parsed.Format("2006-01-02")
+	}
+	uploadedBy := c.FormValue("uploaded_by")
+	if uploadedBy == "" {
+		uploadedBy = getUsernameOrDefault(c, "system")
+	}
+
+	dryRun, err := strconv.ParseBool(c.FormValue("dry_run", c.Query("dry_run", "false")))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid dry_run value (expected true or false)")
+	}
+	maxPercent, err := maxErrorPercent(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
 	// Save the uploaded file to a temporary location
 	tempDir := "./uploads"
 	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
-		db.Rollback()
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create upload directory: "+err.Error())
 	}
 
 	tempFilePath := filepath.Join(tempDir, file.Filename)
 	if err := c.SaveFile(file, tempFilePath); err != nil {
-		db.Rollback()
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save uploaded file: "+err.Error())
 	}
 	defer func() {
@@ -53,105 +92,140 @@ func (m *MetaController) ProcessExcelAndUpload(c *fiber.Ctx, db repository.Excec
 		}
 	}()
 
+	checksum, err := fileChecksum(tempFilePath)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to read uploaded file: "+err.Error())
+	}
+
 	// Extract table data from the Excel file
-	data, extractErr := extractTableFromExcel(tempFilePath)
+	sheet, data, extractErr := extractTableFromExcel(tempFilePath)
 	if extractErr != nil {
-		db.Rollback()
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to extract table data from Excel: "+extractErr.Error())
 	}
 
-	// Clear old data
-	if err := m.repo.Exec("DELETE FROM vehicle_evaluations").Error; err != nil {
-		db.Rollback()
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to clear old data: "+err.Error())
+	headerRow, err := detectHeaderRow(data, c.FormValue("header_row", c.Query("header_row")))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
-	// Insert new data
-	for _, record := range data {
-		// Parse CIF as a float64
-		cif, parseErr := strconv.ParseFloat(strings.ReplaceAll(record[4], " ", ""), 64)
-		if parseErr != nil {
-			log.Printf("Failed to parse CIF for record: %v, error: %v", record, parseErr)
-			continue
-		}
+	report := buildEvaluationImportReport(sheet, data, headerRow, maxPercent, uploadedBy)
 
-		vehicle := &metaData.VehicleEvaluation{
-			HSCCode:     record[0],
-			COO:         record[1],
-			Description: record[2],
-			CC:          record[3],
-			CIF:         cif,
-			CreatedBy:   "system", // Replace with actual user ID
-			UpdatedBy:   "system",
-		}
+	// A dry run only reports what would be imported
+	if dryRun {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Dry run completed, nothing was imported",
+			"data":    report,
+		})
+	}
 
-		if err := m.repo.Create(vehicle).Error; err != nil {
-			db.Rollback()
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to insert new data: "+err.Error())
-		}
+	// The rows to store are taken before the report is trimmed to its errors
+	rows := report.validEvaluations()
+	report.OnlyErrors()
+	if !report.Passed() {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"status": "error",
+			"message": fmt.Sprintf("File rejected: %d of %d rows have errors (%.2f%%, limit %.2f%%)",
+				report.ErrorRows, report.TotalRows, report.ErrorPercent, report.MaxErrorPercent),
+			"data": report,
+		})
 	}
 
-	// Commit the transaction
-	if err := db.Commit(); err != nil {
-		db.Rollback()
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+	// Earlier versions are kept so lookups for older dates still find the valuation of the time
+	version := metaData.VehicleEvaluationVersion{
+		FileName:      file.Filename,
+		Checksum:      checksum,
+		EffectiveDate: effectiveDate,
+		UploadedBy:    uploadedBy,
+		CreatedBy:     uploadedBy,
+		UpdatedBy:     uploadedBy,
+	}
+	if err := m.repo.WithContext(c.UserContext()).ImportEvaluationVersion(&version, rows); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEvaluationUpload) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "This valuation file was already uploaded",
+			})
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to insert new data: "+err.Error())
 	}
 
 	return c.JSON(fiber.Map{
 		"message": "Excel processed and data uploaded successfully",
+		"data":    version,
+		"report":  report,
 	})
 }
 
-func extractTableFromExcel(filePath string) ([][]string, error) {
-	f, err := excelize.OpenFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open Excel file: %w", err)
-	}
-	defer func() {
-		if closeErr := f.Close(); closeErr != nil {
-			log.Printf("Warning: Failed to close Excel file: %v", closeErr)
-		}
-	}()
-
-	// Fetch the list of all sheet names
-	sheetList := f.GetSheetList()
-	if len(sheetList) == 0 {
-		return nil, fmt.Errorf("no sheets found in the Excel file")
-	}
+func (m *MetaController) ProcessExcelAndUploadHandler(c *fiber.Ctx) error {
+	return m.ProcessExcelAndUpload(c)
+}
 
-	// Use the first sheet as default
-	sheetName := sheetList[0]
-	log.Printf("Using sheet: %s", sheetName)
+// ===============
 
-	// Read all rows from the sheet
-	rows, err := f.GetRows(sheetName)
+func (m *MetaController) GetEvaluationVersions(c *fiber.Ctx) error {
+	versions, err := m.repo.WithContext(c.UserContext()).GetEvaluationVersions()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read rows from sheet %s: %w", sheetName, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve evaluation versions",
+			"data":    err.Error(),
+		})
 	}
 
-	var records [][]string
-	for _, row := range rows {
-		// Skip rows with fewer columns than the minimum required
-		if len(row) < 5 {
-			continue
-		}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Evaluation versions retrieved successfully",
+		"data":    versions,
+	})
+}
 
-		// Trim trailing empty cells (optional)
-		for len(row) > 0 && row[len(row)-1] == "" {
-			row = row[:len(row)-1]
+// DiffEvaluationVersions compares ?from= and ?to= version numbers. to defaults to the latest
+// version and from to the one before it.
+func (m *MetaController) DiffEvaluationVersions(c *fiber.Ctx) error {
+	toNo := c.QueryInt("to")
+	if toNo == 0 {
+		latest, err := m.repo.WithContext(c.UserContext()).GetLatestEvaluationVersion()
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"status":  "error",
+					"message": "No evaluation versions uploaded yet",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to retrieve latest version",
+				"data":    err.Error(),
+			})
 		}
-
-		records = append(records, row)
+		toNo = latest.VersionNo
 	}
+	fromNo := c.QueryInt("from", toNo-1)
 
-	if len(records) == 0 {
-		return nil, fmt.Errorf("no valid data found in sheet %s", sheetName)
+	diff, err := m.repo.WithContext(c.UserContext()).DiffEvaluationVersions(fromNo, toNo)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Evaluation version %d or %d not found", fromNo, toNo),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to compare evaluation versions",
+			"data":    err.Error(),
+		})
 	}
 
-	return records, nil
-}
-
-func (m *MetaController) ProcessExcelAndUploadHandler(c *fiber.Ctx) error {
-	// Pass the db service to the original method
-	return m.ProcessExcelAndUpload(c, m.repo)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Evaluation versions compared successfully",
+		"data":    diff,
+		"summary": fiber.Map{
+			"added":   len(diff.Added),
+			"removed": len(diff.Removed),
+			"changed": len(diff.Changed),
+		},
+	})
 }
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"car-bond/internals/repository"
+	"car-bond/internals/scheduler"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type NotificationController struct {
+	repo      repository.NotificationLogRepository
+	reminders *scheduler.PaymentReminders
+}
+
+func NewNotificationController(repo repository.NotificationLogRepository, reminders *scheduler.PaymentReminders) *NotificationController {
+	return &NotificationController{
+		repo:      repo,
+		reminders: reminders,
+	}
+}
+
+// ============================================
+
+func (h *NotificationController) GetNotificationLogs(c *fiber.Ctx) error {
+	pagination, logs, err := h.repo.WithContext(c.UserContext()).GetPaginatedNotificationLogs(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve notification logs",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Notification logs retrieved successfully",
+		"data":    logs,
+		"pagination": fiber.Map{
+			"total_items":  pagination.TotalItems,
+			"total_pages":  pagination.TotalPages,
+			"current_page": pagination.CurrentPage,
+			"limit":        pagination.ItemsPerPage,
+		},
+	})
+}
+
+// =====================
+
+// RunPaymentReminders sends the due reminders right away instead of waiting for the daily run
+func (h *NotificationController) RunPaymentReminders(c *fiber.Ctx) error {
+	sent, err := h.reminders.Run(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to send payment reminders",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Payment reminders sent successfully",
+		"data":    fiber.Map{"sent": sent},
+	})
+}
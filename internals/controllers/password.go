@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"car-bond/internals/config"
+	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/notifier"
+	"car-bond/internals/password"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// mailTimeout bounds how long a request waits for the reset email to go out
+const mailTimeout = 30 * time.Second
+
+// ======================= CHANGE PASSWORD =======================
+
+// ChangeMyPassword sets a new password for the caller, who must give the current one. Every session of
+// the caller is revoked, this one included, so the new password is needed to sign in again.
+func ChangeMyPassword(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
+	type ChangePasswordInput struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	claims, ok := tokenClaims(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid or expired JWT",
+		})
+	}
+	id, ok := claims["user_id"].(float64)
+	if !ok || id == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The token carries no user",
+		})
+	}
+
+	var input ChangePasswordInput
+	if err := c.BodyParser(&input); err != nil || input.CurrentPassword == "" || input.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "current_password and new_password are required",
+		})
+	}
+
+	var user userRegistration.User
+	if err := db.First(&user, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "User no longer exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error retrieving user",
+			"data":    err.Error(),
+		})
+	}
+
+	if !password.Matches(input.CurrentPassword, user.Password) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The current password is wrong",
+		})
+	}
+	if input.NewPassword == input.CurrentPassword {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The new password must differ from the current one",
+		})
+	}
+	if err := password.PolicyFromConfig().Validate(input.NewPassword, user.Username); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The password does not meet the policy",
+			"data":    err.Error(),
+		})
+	}
+
+	hash, err := password.Hash(input.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Couldn't hash password",
+			"data":    err.Error(),
+		})
+	}
+	if err := repository.NewPasswordRepository(db).ChangePassword(user.ID, hash); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to change password",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Password changed; sign in again with the new password",
+	})
+}
+
+// ======================= RESET PASSWORD =======================
+
+// ForgotPassword emails a reset token to the user with the given email or username. The answer is the
+// same whether or not the user exists, and the token is issued and sent in the background so the answer
+// does not wait on the mail server either.
+func ForgotPassword(c *fiber.Ctx, db *gorm.DB, mailer notifier.Notifier) error {
+	db = db.WithContext(c.UserContext())
+
+	type ForgotPasswordInput struct {
+		Identity string `json:"identity"`
+	}
+
+	var input ForgotPasswordInput
+	if err := c.BodyParser(&input); err != nil || input.Identity == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "identity is required",
+		})
+	}
+
+	var user *userRegistration.User
+	var err error
+	if isEmail(input.Identity) {
+		user, err = getUserByEmail(input.Identity, db)
+	} else {
+		user, err = getUserByUsername(input.Identity, db)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error retrieving user",
+			"data":    err.Error(),
+		})
+	}
+
+	if user != nil && user.Email != "" {
+		go func() {
+			if err := sendResetToken(db, mailer, user, "self"); err != nil {
+				log.Printf("Password reset for user %d failed: %v", user.ID, err)
+			}
+		}()
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "If the account exists, a password reset email has been sent",
+	})
+}
+
+// RequestPasswordReset emails a reset token to a user on an administrator's behalf. The token itself is
+// only ever sent to the user.
+func RequestPasswordReset(c *fiber.Ctx, db *gorm.DB, mailer notifier.Notifier) error {
+	db = db.WithContext(c.UserContext())
+
+	id := utils.StrToUint(c.Params("id"))
+	if id == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid user ID",
+		})
+	}
+
+	// The lookup is scoped to the caller's company like any other
+	var user userRegistration.User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "User not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to find user",
+			"data":    err.Error(),
+		})
+	}
+	if user.Email == "" {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The user has no email address",
+		})
+	}
+
+	if err := sendResetToken(db, mailer, &user, getUsernameOrDefault(c, "system")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to send the password reset email",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Password reset email sent",
+		"data":    fiber.Map{"user_id": user.ID, "email": user.Email},
+	})
+}
+
+// ResetPassword sets a new password with a reset token. The token works once, and every session of the
+// user is revoked.
+func ResetPassword(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
+
+	type ResetPasswordInput struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	var input ResetPasswordInput
+	if err := c.BodyParser(&input); err != nil || input.Token == "" || input.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "token and new_password are required",
+		})
+	}
+
+	// The policy is checked before the token is used up, so a refused password can be retried
+	passwords := repository.NewPasswordRepository(db)
+	user, err := passwords.FindResetTokenUser(input.Token)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidResetToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to check the reset token",
+			"data":    err.Error(),
+		})
+	}
+	if err := password.PolicyFromConfig().Validate(input.NewPassword, user.Username); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The password does not meet the policy",
+			"data":    err.Error(),
+		})
+	}
+
+	hash, err := password.Hash(input.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Couldn't hash password",
+			"data":    err.Error(),
+		})
+	}
+	if err := passwords.ResetPassword(input.Token, hash); err != nil {
+		if errors.Is(err, repository.ErrInvalidResetToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to reset password",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Password reset; sign in with the new password",
+	})
+}
+
+// sendResetToken issues a reset token for the user and emails it, with a link when PASSWORD_RESET_URL
+// names the page of the front end that takes it
+func sendResetToken(db *gorm.DB, mailer notifier.Notifier, user *userRegistration.User, requestedBy string) error {
+	raw, expiresAt, err := repository.NewPasswordRepository(db).CreateResetToken(user.ID, requestedBy)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account. Use this token to choose a new password:\n\n%s\n\n",
+		user.Username, raw)
+	if page := config.Config("PASSWORD_RESET_URL"); page != "" {
+		body += fmt.Sprintf("Or open %s?token=%s\n\n", page, url.QueryEscape(raw))
+	}
+	body += fmt.Sprintf("The token works once, until %s. If you did not ask for it, ignore this email.",
+		expiresAt.Format("2006-01-02 15:04 MST"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+	return mailer.Send(ctx, notifier.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body:    body,
+	})
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"car-bond/internals/config"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultRetentionDays is how long deleted records stay restorable when RECYCLE_BIN_RETENTION_DAYS is not set
+const defaultRetentionDays = 30
+
+type RecycleBinController struct {
+	repo repository.RecycleBinRepository
+}
+
+func NewRecycleBinController(repo repository.RecycleBinRepository) *RecycleBinController {
+	return &RecycleBinController{repo: repo}
+}
+
+// recycleBinError answers a failed recycle bin request
+func recycleBinError(c *fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, repository.ErrUnknownBinEntity):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, repository.ErrNotDeleted):
+		status = fiber.StatusNotFound
+	case errors.Is(err, repository.ErrRestoreConflict):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    err.Error(),
+	})
+}
+
+// ============================================
+
+// GetRecycleBin counts the deleted records of every entity
+func (h *RecycleBinController) GetRecycleBin(c *fiber.Ctx) error {
+	counts, err := h.repo.WithContext(c.UserContext()).CountDeleted()
+	if err != nil {
+		return recycleBinError(c, err, "Failed to retrieve recycle bin")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Recycle bin retrieved successfully",
+		"data":    counts,
+	})
+}
+
+// GetDeletedRecords lists the deleted records of one entity with who deleted them and when
+func (h *RecycleBinController) GetDeletedRecords(c *fiber.Ctx) error {
+	pagination, items, err := h.repo.WithContext(c.UserContext()).GetPaginatedDeleted(c, c.Params("entity"))
+	if err != nil {
+		return recycleBinError(c, err, "Failed to retrieve deleted records")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Deleted records retrieved successfully",
+		"data":    items,
+		"pagination": fiber.Map{
+			"total_items":  pagination.TotalItems,
+			"total_pages":  pagination.TotalPages,
+			"current_page": pagination.CurrentPage,
+			"limit":        pagination.ItemsPerPage,
+		},
+	})
+}
+
+// RestoreRecord undeletes a record and the dependants deleted with it
+func (h *RecycleBinController) RestoreRecord(c *fiber.Ctx) error {
+	id := utils.StrToUint(c.Params("id"))
+	if id == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid record ID",
+		})
+	}
+
+	result, err := h.repo.WithContext(c.UserContext()).Restore(c.Params("entity"), id, getUsernameOrDefault(c, "system"))
+	if err != nil {
+		return recycleBinError(c, err, "Failed to restore record")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Record restored successfully",
+		"data":    result,
+	})
+}
+
+// PurgeRecycleBin hard-deletes what was deleted more than ?days= (default RECYCLE_BIN_RETENTION_DAYS)
+// ago and removes the uploaded files nothing refers to any more. days cannot be shorter than the
+// retention, so records still promised to be restorable are never purged.
+func (h *RecycleBinController) PurgeRecycleBin(c *fiber.Ctx) error {
+	days := defaultRetentionDays
+	if value := config.Config("RECYCLE_BIN_RETENTION_DAYS"); value != "" {
+		if configured, err := strconv.Atoi(value); err == nil && configured >= 0 {
+			days = configured
+		}
+	}
+	if value := c.Query("days"); value != "" {
+		requested, err := strconv.Atoi(value)
+		if err != nil || requested < days {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("days must be a whole number of days, %d or more", days),
+			})
+		}
+		days = requested
+	}
+
+	result, err := h.repo.WithContext(c.UserContext()).Purge(time.Duration(days) * 24 * time.Hour)
+	if err != nil {
+		return recycleBinError(c, err, "Failed to purge recycle bin")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Recycle bin purged successfully",
+		"data":    result,
+	})
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"car-bond/internals/middleware"
 	"car-bond/internals/models/userRegistration"
 	"car-bond/internals/repository"
 	"fmt"
@@ -30,7 +31,7 @@ func (gc *GroupController) CreateGroup(c *fiber.Ctx) error {
 			"data":    err.Error(),
 		})
 	}
-	if err := gc.service.CreateGroup(&group); err != nil {
+	if err := gc.service.WithContext(c.UserContext()).CreateGroup(&group); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create group",
@@ -43,7 +44,7 @@ func (gc *GroupController) CreateGroup(c *fiber.Ctx) error {
 // GetGroup handles the HTTP request to retrieve a group by its code
 func (gc *GroupController) GetGroup(c *fiber.Ctx) error {
 	code := c.Params("code")
-	group, err := gc.service.GetGroupByCode(code)
+	group, err := gc.service.WithContext(c.UserContext()).GetGroupByCode(code)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
 	}
@@ -52,7 +53,7 @@ func (gc *GroupController) GetGroup(c *fiber.Ctx) error {
 
 // GetAllGroups handles the HTTP request to retrieve all groups
 func (gc *GroupController) GetAllGroups(c *fiber.Ctx) error {
-	groups, err := gc.service.GetAllGroups()
+	groups, err := gc.service.WithContext(c.UserContext()).GetAllGroups()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot retrieve groups"})
 	}
@@ -66,7 +67,7 @@ func (gc *GroupController) UpdateGroup(c *fiber.Ctx) error {
 	if err := c.BodyParser(&group); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
-	if err := gc.service.UpdateGroup(code, &group); err != nil {
+	if err := gc.service.WithContext(c.UserContext()).UpdateGroup(code, &group); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found or cannot update"})
 	}
 	return c.JSON(fiber.Map{"success": "Group updated"})
@@ -75,7 +76,7 @@ func (gc *GroupController) UpdateGroup(c *fiber.Ctx) error {
 // DeleteGroup handles the HTTP request to delete a group by its code
 func (gc *GroupController) DeleteGroup(c *fiber.Ctx) error {
 	code := c.Params("code")
-	if err := gc.service.DeleteGroup(code); err != nil {
+	if err := gc.service.WithContext(c.UserContext()).DeleteGroup(code); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot delete group"})
 	}
 	return c.SendStatus(fiber.StatusNoContent)
@@ -99,7 +100,7 @@ func (rc *RoleController) CreateRole(c *fiber.Ctx) error {
 	if err := c.BodyParser(&role); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
-	if err := rc.service.CreateRole(&role); err != nil {
+	if err := rc.service.WithContext(c.UserContext()).CreateRole(&role); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot create role"})
 	}
 	return c.Status(fiber.StatusCreated).JSON(role)
@@ -108,7 +109,7 @@ func (rc *RoleController) CreateRole(c *fiber.Ctx) error {
 // GetGroup handles the HTTP request to retrieve a group by its code
 func (rc *RoleController) GetRole(c *fiber.Ctx) error {
 	code := c.Params("code")
-	role, err := rc.service.GetRoleByCode(code)
+	role, err := rc.service.WithContext(c.UserContext()).GetRoleByCode(code)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Role not found"})
 	}
@@ -117,7 +118,7 @@ func (rc *RoleController) GetRole(c *fiber.Ctx) error {
 
 // GetAllRoles handles the HTTP request to retrieve all groups
 func (rc *RoleController) GetAllRoles(c *fiber.Ctx) error {
-	roles, err := rc.service.GetAllRoles()
+	roles, err := rc.service.WithContext(c.UserContext()).GetAllRoles()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot retrieve roles"})
 	}
@@ -138,7 +139,7 @@ func (rc *RoleController) GetRolesForGroups(c *fiber.Ctx) error {
 	groupCodeList := strings.Split(groupCodes, ",")
 
 	// Call the service to get roles for the groups
-	roles, err := rc.service.GetRolesForGroups(groupCodeList)
+	roles, err := rc.service.WithContext(c.UserContext()).GetRolesForGroups(groupCodeList)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve roles for the specified groups",
@@ -170,7 +171,7 @@ func (rc *ResourceController) CreateResource(c *fiber.Ctx) error {
 	if err := c.BodyParser(&resource); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
-	if err := rc.service.CreateResource(&resource); err != nil {
+	if err := rc.service.WithContext(c.UserContext()).CreateResource(&resource); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot create resource"})
 	}
 	return c.Status(fiber.StatusCreated).JSON(resource)
@@ -179,7 +180,7 @@ func (rc *ResourceController) CreateResource(c *fiber.Ctx) error {
 // GetResource handles the HTTP request to get a resource by code
 func (rc *ResourceController) GetResource(c *fiber.Ctx) error {
 	code := c.Params("code")
-	resource, err := rc.service.GetResourceByCode(code)
+	resource, err := rc.service.WithContext(c.UserContext()).GetResourceByCode(code)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Resource not found"})
 	}
@@ -188,7 +189,7 @@ func (rc *ResourceController) GetResource(c *fiber.Ctx) error {
 
 // GetAllResources handles the HTTP request to get all non-deleted resources
 func (rc *ResourceController) GetAllResources(c *fiber.Ctx) error {
-	resources, err := rc.service.GetAllResources()
+	resources, err := rc.service.WithContext(c.UserContext()).GetAllResources()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot retrieve resources"})
 	}
@@ -214,7 +215,7 @@ func (pc *PermissionController) CreatePermission(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
 
-	createdPermission, err := pc.service.CreatePermission(&permission)
+	createdPermission, err := pc.service.WithContext(c.UserContext()).CreatePermission(&permission)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot create permission"})
 	}
@@ -229,7 +230,7 @@ func (pc *PermissionController) CreateWildCardPermission(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
 
-	createdPermission, err := pc.service.CreateWildCardPermission(&permission)
+	createdPermission, err := pc.service.WithContext(c.UserContext()).CreateWildCardPermission(&permission)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot create wildcard permission"})
 	}
@@ -250,7 +251,7 @@ func (pc *PermissionController) GetGrantedPermissions(c *fiber.Ctx) error {
 	}
 
 	// Get granted permissions using the service
-	permissions, err := pc.service.GetGrantedPermissions(roleCode, resourceCode)
+	permissions, err := pc.service.WithContext(c.UserContext()).GetGrantedPermissions(roleCode, resourceCode)
 	log.Printf("Permissions: %+v\n", permissions)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -275,7 +276,7 @@ func (pc *PermissionController) CheckPermissions(c *fiber.Ctx) error {
 	}
 
 	// Get the granted permissions
-	permissions, err := pc.service.CheckPermissions(roleCode, resourceCode, requestedPerms)
+	permissions, err := pc.service.WithContext(c.UserContext()).CheckPermissions(roleCode, resourceCode, requestedPerms)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Cannot check permissions",
@@ -308,7 +309,7 @@ func (pc *PermissionController) GetExplicitPermissions(c *fiber.Ctx) error {
 	roleCode := c.Query("role_code")
 	resourceCode := c.Query("resource_code")
 
-	permissions, err := pc.service.GetExplicitPermissions(roleCode, resourceCode)
+	permissions, err := pc.service.WithContext(c.UserContext()).GetExplicitPermissions(roleCode, resourceCode)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot retrieve explicit permissions"})
 	}
@@ -321,7 +322,7 @@ func (pc *PermissionController) GetWildCardPermissions(c *fiber.Ctx) error {
 	roleCode := c.Query("role_code")
 	resourceCode := c.Query("resource_code")
 
-	permissions, err := pc.service.GetWildCardPermissions(roleCode, resourceCode)
+	permissions, err := pc.service.WithContext(c.UserContext()).GetWildCardPermissions(roleCode, resourceCode)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot retrieve wildcard permissions"})
 	}
@@ -333,7 +334,7 @@ func (pc *PermissionController) GetWildCardPermissions(c *fiber.Ctx) error {
 func (pc *PermissionController) ResourceExplicitPermissionsExists(c *fiber.Ctx) error {
 	resourceCode := c.Query("resource_code")
 
-	exists, err := pc.service.ResourceExplicitPermissionsExists(resourceCode)
+	exists, err := pc.service.WithContext(c.UserContext()).ResourceExplicitPermissionsExists(resourceCode)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error checking explicit permissions"})
 	}
@@ -345,7 +346,7 @@ func (pc *PermissionController) ResourceExplicitPermissionsExists(c *fiber.Ctx)
 func (pc *PermissionController) GroupsWithRoleExists(c *fiber.Ctx) error {
 	groupCode := c.Query("group_code")
 
-	exists, err := pc.service.GroupsWithRoleExists(groupCode)
+	exists, err := pc.service.WithContext(c.UserContext()).GroupsWithRoleExists(groupCode)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error checking if groups with role exist"})
 	}
@@ -363,7 +364,7 @@ func (pc *PermissionController) GetPermissions(c *fiber.Ctx) error {
 	roleCodes := strings.Split(roleCodesStr, ",")
 
 	// Call the service method to retrieve permissions
-	permissions, err := pc.service.GetPermissions(roleCodes, resourceCode)
+	permissions, err := pc.service.WithContext(c.UserContext()).GetPermissions(roleCodes, resourceCode)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving permissions"})
 	}
@@ -371,3 +372,70 @@ func (pc *PermissionController) GetPermissions(c *fiber.Ctx) error {
 	// Return the retrieved permissions as a JSON response
 	return c.JSON(permissions)
 }
+
+// ExplainPermissions shows what roles may do on a resource and which rule granted or denied each
+// permission. The roles default to those of the caller's token; ?perm= narrows the answer to one
+// permission.
+func (pc *PermissionController) ExplainPermissions(c *fiber.Ctx) error {
+	resourceCode := c.Query("resource_code")
+	if resourceCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "resource_code is required",
+		})
+	}
+
+	var roleCodes []string
+	if value := c.Query("role_codes"); value != "" {
+		for _, code := range strings.Split(value, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				roleCodes = append(roleCodes, code)
+			}
+		}
+	} else {
+		roleCodes = middleware.RolesFromRequest(c)
+	}
+	if len(roleCodes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No roles to explain: pass role_codes or use a token that carries roles",
+		})
+	}
+
+	perm := strings.ToUpper(c.Query("perm"))
+	if perm != "" && (len(perm) != 1 || !strings.Contains("RWXD", perm)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "perm must be one of R, W, X or D",
+		})
+	}
+
+	decision, err := pc.service.WithContext(c.UserContext()).ExplainPermissions(roleCodes, resourceCode)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Cannot explain permissions",
+			"data":    err.Error(),
+		})
+	}
+
+	if perm != "" {
+		verdict, _ := decision.Verdict(perm)
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Permission explained successfully",
+			"data": fiber.Map{
+				"resource": decision.Resource,
+				"roles":    decision.Roles,
+				"verdict":  verdict,
+				"rules":    decision.Rules,
+			},
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Permissions explained successfully",
+		"data":    decision,
+	})
+}
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"car-bond/internals/models/carRegistration"
 	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
 	"car-bond/internals/repository"
 	"errors"
 
@@ -33,7 +35,14 @@ func (h *SaleAuctionController) CreateCarSale(c *fiber.Ctx) error {
 	}
 
 	// Attempt to create the sale record using the repository
-	if err := h.repo.CreateSale(sale); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateSale(sale); err != nil {
+		if errors.Is(err, carRegistration.ErrIllegalTransition) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "The car cannot be sold at auction",
+				"data":    err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create sale",
@@ -52,7 +61,7 @@ func (h *SaleAuctionController) CreateCarSale(c *fiber.Ctx) error {
 // =====================
 
 func (h *SaleAuctionController) GetAllCarSales(c *fiber.Ctx) error {
-	pagination, sales, err := h.repo.GetPaginatedSales(c)
+	pagination, sales, err := h.repo.WithContext(c.UserContext()).GetPaginatedSales(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -85,7 +94,7 @@ func (h *SaleAuctionController) GetCarSale(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the sale by ID
-	sale, err := h.repo.GetSaleByID(id)
+	sale, err := h.repo.WithContext(c.UserContext()).GetSaleByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -112,14 +121,14 @@ func (h *SaleAuctionController) GetCarSale(c *fiber.Ctx) error {
 
 // Define the UpdateSale struct
 type UpdateSaleAuctionPayload struct {
-	CarID              int     `json:"car_id"`
-	CompanyID          int     `json:"company_id"`
-	AuctionUserCompany string  `json:"auction_user_company"`
-	SaleDate           string  `json:"sale_date"`
-	Price              float64 `json:"price"`
-	VATTax             float64 `json:"vat_tax"`
-	RecycleFee         float64 `json:"recycle_fee"`
-	UpdatedBy          string  `json:"updated_by"`
+	CarID              int         `json:"car_id"`
+	CompanyID          int         `json:"company_id"`
+	AuctionUserCompany string      `json:"auction_user_company"`
+	SaleDate           string      `json:"sale_date"`
+	Price              money.Money `json:"price"`
+	VATTax             money.Money `json:"vat_tax"`
+	RecycleFee         money.Money `json:"recycle_fee"`
+	UpdatedBy          string      `json:"updated_by"`
 }
 
 // UpdateSale handler function
@@ -128,7 +137,7 @@ func (h *SaleAuctionController) UpdateSale(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the sale in the database
-	sale, err := h.repo.GetSaleByID(id)
+	sale, err := h.repo.WithContext(c.UserContext()).GetSaleByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -157,7 +166,7 @@ func (h *SaleAuctionController) UpdateSale(c *fiber.Ctx) error {
 	updateSaleAuctionFields(&sale, payload) // Pass the parsed payload
 
 	// Save the changes to the database
-	if err := h.repo.UpdateSale(&sale); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateSale(&sale); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update sale",
@@ -193,7 +202,7 @@ func (h *SaleAuctionController) DeleteSaleByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the Sale in the database
-	sale, err := h.repo.GetSaleByID(id)
+	sale, err := h.repo.WithContext(c.UserContext()).GetSaleByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -209,7 +218,7 @@ func (h *SaleAuctionController) DeleteSaleByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the Sale
-	if err := h.repo.DeleteByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete Sale",
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"bytes"
+	"car-bond/internals/money"
+	"car-bond/internals/repository"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// formatAmount prints a money value with thousands separators, e.g. 1,234,567.50
+func formatAmount(v money.Money) string {
+	sign := ""
+	if v.IsNegative() {
+		sign = "-"
+		v = v.Abs()
+	}
+	s := v.StringFixed()
+	intPart, decPart := s[:len(s)-3], s[len(s)-3:]
+
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String() + decPart
+}
+
+// renderCustomerStatementPDF prints a customer statement on A4 with the company letterhead,
+// the ledger of the period with its running balance and the position of each sale
+func renderCustomerStatementPDF(statement *repository.CustomerStatement) (*bytes.Buffer, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Arial", "I", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AliasNbPages("")
+	pdf.AddPage()
+
+	// Letterhead
+	companyName := "Statement of Account"
+	var companyLines []string
+	if statement.Company != nil {
+		if statement.Company.Name != "" {
+			companyName = statement.Company.Name
+		}
+		for _, line := range []string{statement.Company.Address, statement.Company.Country} {
+			if line != "" {
+				companyLines = append(companyLines, line)
+			}
+		}
+		if statement.Company.Telephone != "" {
+			companyLines = append(companyLines, "Tel: "+statement.Company.Telephone)
+		}
+	}
+
+	pdf.SetFont("Arial", "B", 18)
+	pdf.SetTextColor(20, 50, 100)
+	pdf.CellFormat(0, 9, tr(companyName), "", 1, "L", false, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	pdf.SetTextColor(60, 60, 60)
+	for _, line := range companyLines {
+		pdf.CellFormat(0, 5, tr(line), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(2)
+	pdf.SetDrawColor(20, 50, 100)
+	pdf.SetLineWidth(0.6)
+	pdf.Line(15, pdf.GetY(), 195, pdf.GetY())
+	pdf.Ln(5)
+
+	// Statement details
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Arial", "B", 14)
+	pdf.CellFormat(0, 8, "CUSTOMER STATEMENT", "", 1, "L", false, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	pdf.CellFormat(100, 5, tr("Customer: "+strings.TrimSpace(statement.CustomerName)), "", 0, "L", false, 0, "")
+	pdf.CellFormat(0, 5, "Date: "+time.Now().Format("02 Jan 2006"), "", 1, "R", false, 0, "")
+	pdf.CellFormat(100, 5, fmt.Sprintf("Customer No: %d", statement.CustomerID), "", 0, "L", false, 0, "")
+	if statement.CustomerPhone != "" {
+		pdf.CellFormat(0, 5, tr("Tel: "+statement.CustomerPhone), "", 0, "R", false, 0, "")
+	}
+	pdf.Ln(5)
+
+	period := "All activity"
+	switch {
+	case statement.From != "" && statement.To != "":
+		period = statement.From + " to " + statement.To
+	case statement.From != "":
+		period = "From " + statement.From
+	case statement.To != "":
+		period = "Up to " + statement.To
+	}
+	pdf.CellFormat(0, 5, "Period: "+period, "", 1, "L", false, 0, "")
+	pdf.Ln(5)
+
+	widths := []float64{26, 74, 25, 25, 30}
+	headers := []string{"Date", "Description", "Debit", "Credit", "Balance"}
+
+	pdf.SetFont("Arial", "B", 9)
+	pdf.SetFillColor(20, 50, 100)
+	pdf.SetTextColor(255, 255, 255)
+	for i, h := range headers {
+		align := "L"
+		if i >= 2 {
+			align = "R"
+		}
+		pdf.CellFormat(widths[i], 7, h, "1", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetTextColor(0, 0, 0)
+
+	amountOrBlank := func(v money.Money) string {
+		if v.IsZero() {
+			return ""
+		}
+		return formatAmount(v)
+	}
+
+	// Ledger with running balance, starting from the opening balance
+	for _, entry := range statement.Entries {
+		style := ""
+		if entry.Type == repository.StatementEntryOpening {
+			style = "B"
+		}
+		pdf.SetFont("Arial", style, 9)
+		pdf.CellFormat(widths[0], 6, entry.Date, "LR", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 6, tr(entry.Description), "LR", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[2], 6, amountOrBlank(entry.Debit), "LR", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, amountOrBlank(entry.Credit), "LR", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], 6, formatAmount(entry.Balance), "LR", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Arial", "B", 9)
+	pdf.CellFormat(widths[0]+widths[1]+widths[2]+widths[3], 7, "Closing balance", "1", 0, "L", false, 0, "")
+	pdf.CellFormat(widths[4], 7, formatAmount(statement.ClosingBalance), "1", 1, "R", false, 0, "")
+	pdf.Ln(8)
+
+	// Position of each sale at the end of the period
+	if len(statement.Sales) > 0 {
+		pdf.SetFont("Arial", "B", 10)
+		pdf.CellFormat(0, 7, "Sales summary", "", 1, "L", false, 0, "")
+		summaryWidths := []float64{18, 82, 25, 25, 30}
+		pdf.SetFont("Arial", "B", 9)
+		pdf.SetFillColor(235, 240, 248)
+		for i, h := range []string{"Sale", "Vehicle", "Price", "Paid", "Outstanding"} {
+			align := "L"
+			if i >= 2 {
+				align = "R"
+			}
+			pdf.CellFormat(summaryWidths[i], 7, h, "1", 0, align, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Arial", "", 9)
+		for _, sale := range statement.Sales {
+			vehicle := sale.CarModel
+			if sale.ChasisNumber != "" {
+				vehicle += " (" + sale.ChasisNumber + ")"
+			}
+			pdf.CellFormat(summaryWidths[0], 6, fmt.Sprintf("#%d", sale.SaleID), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(summaryWidths[1], 6, tr(vehicle), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(summaryWidths[2], 6, formatAmount(sale.TotalSaleAmount), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(summaryWidths[3], 6, formatAmount(sale.TotalPaid), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(summaryWidths[4], 6, formatAmount(sale.OutstandingAmount), "1", 1, "R", false, 0, "")
+		}
+		pdf.Ln(6)
+	}
+
+	// Summary
+	pdf.SetFont("Arial", "B", 10)
+	pdf.SetFillColor(235, 240, 248)
+	summary := [][2]string{
+		{"Opening balance", formatAmount(statement.OpeningBalance)},
+		{"Total sales", formatAmount(statement.TotalSales)},
+		{"Total paid", formatAmount(statement.TotalPaid)},
+		{"Closing balance", formatAmount(statement.ClosingBalance)},
+	}
+	for _, line := range summary {
+		pdf.CellFormat(110, 7, "", "", 0, "L", false, 0, "")
+		pdf.CellFormat(40, 7, line[0], "1", 0, "L", true, 0, "")
+		pdf.CellFormat(30, 7, line[1], "1", 1, "R", true, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
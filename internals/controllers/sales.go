@@ -1,8 +1,10 @@
 package controllers
 
 import (
+	"bytes"
 	"car-bond/internals/models/carRegistration"
 	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
 	"car-bond/internals/repository"
 	"car-bond/internals/utils"
 	"errors"
@@ -15,6 +17,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -22,13 +25,15 @@ import (
 type SaleController struct {
 	repo  repository.SaleRepository
 	cRepo repository.CarRepository
+	rates repository.ExchangeRateRepository
 	db    *gorm.DB
 }
 
-func NewSaleController(repo repository.SaleRepository, cRepo repository.CarRepository, db *gorm.DB) *SaleController {
+func NewSaleController(repo repository.SaleRepository, cRepo repository.CarRepository, rates repository.ExchangeRateRepository, db *gorm.DB) *SaleController {
 	return &SaleController{
 		repo:  repo,
 		cRepo: cRepo,
+		rates: rates,
 		db:    db}
 }
 
@@ -47,19 +52,35 @@ func (h *SaleController) CreateCarSale(c *fiber.Ctx) error {
 		})
 	}
 
-	// Attempt to create the sale record using the repository
-	if err := h.repo.CreateSale(sale); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to create sale",
-			"data":    err.Error(),
-		})
+	if sale.CreatedBy == "" {
+		sale.CreatedBy = getUsernameOrDefault(c, "system")
+	}
+	// An empty currency keeps the column default
+	if sale.Currency != "" {
+		if err := normalizeCurrencies(c, h.rates, &sale.Currency); err != nil {
+			return currencyError(c, err)
+		}
 	}
 
-	if err := h.cRepo.UpdateCarStatus(sale.CarID, "Sold"); err != nil {
+	// Attempt to create the sale record using the repository; this also marks the car as Sold
+	if err := h.repo.WithContext(c.UserContext()).CreateSale(sale); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Car not found",
+				"data":    err.Error(),
+			})
+		case errors.Is(err, repository.ErrCarAlreadySold), errors.Is(err, carRegistration.ErrIllegalTransition):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "The car cannot be sold",
+				"data":    err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to update car status to Sold",
+			"message": "Failed to create sale",
 			"data":    err.Error(),
 		})
 	}
@@ -75,7 +96,7 @@ func (h *SaleController) CreateCarSale(c *fiber.Ctx) error {
 // =====================
 
 func (h *SaleController) GetAllCarSales(c *fiber.Ctx) error {
-	pagination, sales, err := h.repo.GetPaginatedSales(c)
+	pagination, sales, err := h.repo.WithContext(c.UserContext()).GetPaginatedSales(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -90,7 +111,7 @@ func (h *SaleController) GetAllCarSales(c *fiber.Ctx) error {
 	// Iterate over all sales to fetch associated payments and payment modes
 	for _, sale := range sales {
 		// Fetch sale payments associated with the sale
-		payments, err := h.repo.GetSalePayments(sale.ID)
+		payments, err := h.repo.WithContext(c.UserContext()).GetSalePayments(sale.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -102,7 +123,7 @@ func (h *SaleController) GetAllCarSales(c *fiber.Ctx) error {
 		// Iterate over payments to fetch associated payment modes
 		var allPaymentModes []fiber.Map
 		for _, payment := range payments {
-			paymentModes, err := h.repo.GetSalePaymentModes(payment.ID)
+			paymentModes, err := h.repo.WithContext(c.UserContext()).GetSalePaymentModes(payment.ID)
 			if err != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"status":  "error",
@@ -148,7 +169,7 @@ func (h *SaleController) GetCarSale(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the sale by ID
-	sale, err := h.repo.GetSaleByID(id)
+	sale, err := h.repo.WithContext(c.UserContext()).GetSaleByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -164,7 +185,7 @@ func (h *SaleController) GetCarSale(c *fiber.Ctx) error {
 	}
 
 	// Fetch Sale addresses associated with the Sale
-	payments, err := h.repo.GetSalePayments(sale.ID)
+	payments, err := h.repo.WithContext(c.UserContext()).GetSalePayments(sale.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -175,7 +196,7 @@ func (h *SaleController) GetCarSale(c *fiber.Ctx) error {
 
 	var allPaymentModes []fiber.Map
 	for _, payment := range payments {
-		paymentModes, err := h.repo.GetSalePaymentModes(payment.ID)
+		paymentModes, err := h.repo.WithContext(c.UserContext()).GetSalePaymentModes(payment.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -208,15 +229,16 @@ func (h *SaleController) GetCarSale(c *fiber.Ctx) error {
 
 // Define the UpdateSale struct
 type UpdateSalePayload struct {
-	TotalPrice    float64 `json:"total_price"`
-	DollarRate    float64 `json:"dollar_rate"`
-	SaleDate      string  `json:"sale_date"`
-	CarID         uint    `json:"car_id"`
-	CompanyID     int     `json:"company_id"`
-	IsFullPayment bool    `json:"is_full_payment"`
-	InitalPayment float64 `json:"initial_payment"`
-	PaymentPeriod int     `json:"payment_period"`
-	UpdatedBy     string  `json:"updated_by"`
+	TotalPrice    money.Money `json:"total_price"`
+	Currency      string      `json:"currency"`
+	DollarRate    money.Money `json:"dollar_rate"`
+	SaleDate      string      `json:"sale_date"`
+	CarID         uint        `json:"car_id"`
+	CompanyID     int         `json:"company_id"`
+	IsFullPayment bool        `json:"is_full_payment"`
+	InitalPayment money.Money `json:"initial_payment"`
+	PaymentPeriod int         `json:"payment_period"`
+	UpdatedBy     string      `json:"updated_by"`
 }
 
 // UpdateSale handler function
@@ -225,7 +247,7 @@ func (h *SaleController) UpdateSale(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the sale in the database
-	sale, err := h.repo.GetSaleByID(id)
+	sale, err := h.repo.WithContext(c.UserContext()).GetSaleByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -250,11 +272,17 @@ func (h *SaleController) UpdateSale(c *fiber.Ctx) error {
 		})
 	}
 
+	if payload.Currency != "" {
+		if err := normalizeCurrencies(c, h.rates, &payload.Currency); err != nil {
+			return currencyError(c, err)
+		}
+	}
+
 	// Update the sale fields using the payload
 	updateSaleFields(&sale, payload) // Pass the parsed payload
 
 	// Save the changes to the database
-	if err := h.repo.UpdateSale(&sale); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateSale(&sale); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update sale",
@@ -273,6 +301,9 @@ func (h *SaleController) UpdateSale(c *fiber.Ctx) error {
 // UpdateSaleFields updates the fields of a Sale using the UpdateSale struct
 func updateSaleFields(sale *saleRegistration.Sale, updateSaleData UpdateSalePayload) {
 	sale.TotalPrice = updateSaleData.TotalPrice
+	if updateSaleData.Currency != "" {
+		sale.Currency = updateSaleData.Currency
+	}
 	sale.DollarRate = updateSaleData.DollarRate
 	sale.SaleDate = updateSaleData.SaleDate
 	sale.CarID = updateSaleData.CarID
@@ -291,7 +322,7 @@ func (h *SaleController) DeleteSaleByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the Sale in the database
-	sale, err := h.repo.GetSaleByID(id)
+	sale, err := h.repo.WithContext(c.UserContext()).GetSaleByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -307,7 +338,7 @@ func (h *SaleController) DeleteSaleByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the Sale
-	if err := h.repo.DeleteByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete Sale",
@@ -340,7 +371,7 @@ func (h *SaleController) CreateInvoice(c *fiber.Ctx) error {
 	}
 
 	// Create the customer address in the database
-	if err := h.repo.CreateInvoice(salePayment); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateInvoice(salePayment); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create payment",
@@ -363,7 +394,7 @@ func (h *SaleController) CreateInvoice(c *fiber.Ctx) error {
 func (h *SaleController) GetSalePayments(c *fiber.Ctx) error {
 
 	// Fetch paginated payments using the repository
-	pagination, invoices, err := h.repo.GetPaginatedInvoices(c)
+	pagination, invoices, err := h.repo.WithContext(c.UserContext()).GetPaginatedInvoices(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -394,7 +425,7 @@ func (h *SaleController) FindSalePaymentByIdAndSaleId(c *fiber.Ctx) error {
 	saleId := c.Params("saleId")
 
 	// Fetch the company payment from the repository
-	payment, err := h.repo.FindSalePaymentByIdAndSaleId(id, saleId)
+	payment, err := h.repo.WithContext(c.UserContext()).FindSalePaymentByIdAndSaleId(id, saleId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -424,10 +455,10 @@ func (h *SaleController) FindSalePaymentByIdAndSaleId(c *fiber.Ctx) error {
 func (h *SaleController) UpdateSalePayment(c *fiber.Ctx) error {
 	// Define a struct for input validation
 	type UpdateSalePaymentInput struct {
-		AmountPayed float64 `json:"amount_payed" validate:"required"`
-		PaymentDate string  `json:"payment_date" validate:"required"`
-		SaleID      uint    `json:"sale_id" validate:"required"`
-		UpdatedBy   string  `json:"updated_by" validate:"required"`
+		AmountPayed money.Money `json:"amount_payed"`
+		PaymentDate string      `json:"payment_date" validate:"required"`
+		SaleID      uint        `json:"sale_id" validate:"required"`
+		UpdatedBy   string      `json:"updated_by" validate:"required"`
 	}
 
 	// Parse the payment ID from the request parameters
@@ -451,9 +482,16 @@ func (h *SaleController) UpdateSalePayment(c *fiber.Ctx) error {
 			"errors":  validationErr,
 		})
 	}
+	if !input.AmountPayed.IsPositive() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Validation failed",
+			"errors":  "amount_payed must be greater than 0",
+		})
+	}
 
 	// Fetch the payment record using the repository
-	payment, err := h.repo.FindSalePaymentById(paymentID)
+	payment, err := h.repo.WithContext(c.UserContext()).FindSalePaymentById(paymentID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -475,7 +513,7 @@ func (h *SaleController) UpdateSalePayment(c *fiber.Ctx) error {
 	payment.UpdatedBy = input.UpdatedBy
 
 	// Save the updated payment using the repository
-	if err := h.repo.UpdateSalePayment(payment); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateSalePayment(payment); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update payment",
@@ -499,7 +537,7 @@ func (h *SaleController) DeleteSalePaymentByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the SalePayment in the database
-	salePayment, err := h.repo.FindSalePaymentById(id)
+	salePayment, err := h.repo.WithContext(c.UserContext()).FindSalePaymentById(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -515,7 +553,7 @@ func (h *SaleController) DeleteSalePaymentByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the salePayment
-	if err := h.repo.DeleteSalePaymentByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteSalePaymentByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete port",
@@ -548,7 +586,7 @@ func (h *SaleController) CreatePaymentMode(c *fiber.Ctx) error {
 	}
 
 	// Create the customer address in the database
-	if err := h.repo.CreatePaymentMode(salePayment); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreatePaymentMode(salePayment); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create Payment mode",
@@ -569,7 +607,7 @@ func (h *SaleController) CreatePaymentMode(c *fiber.Ctx) error {
 func (h *SaleController) GetSalePaymentModes(c *fiber.Ctx) error {
 
 	// Fetch paginated payments using the repository
-	pagination, paymentModes, err := h.repo.GetPaginatedPaymentModes(c)
+	pagination, paymentModes, err := h.repo.WithContext(c.UserContext()).GetPaginatedPaymentModes(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -600,7 +638,7 @@ func (h *SaleController) FindSalePaymentModeByIdAndSalePaymentId(c *fiber.Ctx) e
 	salePaymentId := c.Params("salePaymentId")
 
 	// Fetch the company payment from the repository
-	payment, err := h.repo.FindSalePaymentModeByIdAndSalePaymentId(id, salePaymentId)
+	payment, err := h.repo.WithContext(c.UserContext()).FindSalePaymentModeByIdAndSalePaymentId(id, salePaymentId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -629,7 +667,7 @@ func (h *SaleController) GetPaymentModesByMode(c *fiber.Ctx) error {
 	mode := c.Params("mode")
 
 	// Fetch paginated contacts using the repository
-	pagination, modes, err := h.repo.GetPaginatedModes(c, mode)
+	pagination, modes, err := h.repo.WithContext(c.UserContext()).GetPaginatedModes(c, mode)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -686,7 +724,7 @@ func (h *SaleController) UpdateSalePaymentMode(c *fiber.Ctx) error {
 	}
 
 	// Fetch the payment record using the repository
-	payment, err := h.repo.FindSalePaymentModeById(paymentID)
+	payment, err := h.repo.WithContext(c.UserContext()).FindSalePaymentModeById(paymentID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -708,7 +746,7 @@ func (h *SaleController) UpdateSalePaymentMode(c *fiber.Ctx) error {
 	payment.UpdatedBy = input.UpdatedBy
 
 	// Save the updated payment using the repository
-	if err := h.repo.UpdateSalePaymentMode(payment); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateSalePaymentMode(payment); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update payment",
@@ -732,7 +770,7 @@ func (h *SaleController) DeleteSalePaymentModeByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the SalePayment in the database
-	salePayment, err := h.repo.FindSalePaymentModeById(id)
+	salePayment, err := h.repo.WithContext(c.UserContext()).FindSalePaymentModeById(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -748,7 +786,7 @@ func (h *SaleController) DeleteSalePaymentModeByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the salePayment
-	if err := h.repo.DeleteSalePaymentModeByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteSalePaymentModeByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete payment mode",
@@ -779,8 +817,8 @@ func (h *SaleController) CreatePaymentDeposit(c *fiber.Ctx) error {
 	saleDeposit.CreatedBy = c.FormValue("created_by")
 	saleDeposit.UpdatedBy = c.FormValue("updated_by")
 
-	// Parse float
-	amount, err := strconv.ParseFloat(c.FormValue("amount_deposited"), 64)
+	// Parse amount
+	amount, err := money.Parse(c.FormValue("amount_deposited"))
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"status":  "error",
@@ -834,7 +872,7 @@ func (h *SaleController) CreatePaymentDeposit(c *fiber.Ctx) error {
 	}
 
 	// Save deposit to DB
-	if err := h.repo.CreatePaymentDeposit(saleDeposit); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreatePaymentDeposit(saleDeposit); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create payment deposit",
@@ -854,7 +892,7 @@ func (h *SaleController) CreatePaymentDeposit(c *fiber.Ctx) error {
 func (h *SaleController) GetSalePaymentDeposits(c *fiber.Ctx) error {
 
 	// Fetch paginated payments using the repository
-	pagination, paymentDeposits, err := h.repo.GetPaginatedPaymentDeposits(c)
+	pagination, paymentDeposits, err := h.repo.WithContext(c.UserContext()).GetPaginatedPaymentDeposits(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -885,7 +923,7 @@ func (h *SaleController) FindSalePaymentDepositByIdAndSalePaymentId(c *fiber.Ctx
 	salePaymentId := c.Params("salePaymentId")
 
 	// Fetch the company deposit from the repository
-	deposit, err := h.repo.FindSalePaymentDepositByIdAndSalePaymentId(id, salePaymentId)
+	deposit, err := h.repo.WithContext(c.UserContext()).FindSalePaymentDepositByIdAndSalePaymentId(id, salePaymentId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -914,7 +952,7 @@ func (h *SaleController) GetPaymentDepositsByName(c *fiber.Ctx) error {
 	name := c.Params("name")
 
 	// Fetch paginated contacts using the repository
-	pagination, deposits, err := h.repo.GetPaymentDeposits(c, name)
+	pagination, deposits, err := h.repo.WithContext(c.UserContext()).GetPaymentDeposits(c, name)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -943,7 +981,7 @@ func (h *SaleController) UpdateSalePaymentDeposit(c *fiber.Ctx) error {
 	idParam := c.Params("id")
 
 	// Find existing deposit (you must implement this in your repo)
-	existingDeposit, err := h.repo.FindSalePaymentDepositById(idParam)
+	existingDeposit, err := h.repo.WithContext(c.UserContext()).FindSalePaymentDepositById(idParam)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"status":  "error",
@@ -961,7 +999,7 @@ func (h *SaleController) UpdateSalePaymentDeposit(c *fiber.Ctx) error {
 
 	// Optional: update amount deposited
 	if amtStr := c.FormValue("amount_deposited"); amtStr != "" {
-		if amt, err := strconv.ParseFloat(amtStr, 64); err == nil {
+		if amt, err := money.Parse(amtStr); err == nil {
 			existingDeposit.AmountDeposited = amt
 		}
 	}
@@ -1002,7 +1040,7 @@ func (h *SaleController) UpdateSalePaymentDeposit(c *fiber.Ctx) error {
 	}
 
 	// Save updated deposit (you must implement this in your repo)
-	if err := h.repo.UpdateSalePaymentDeposit(existingDeposit); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateSalePaymentDeposit(existingDeposit); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update payment deposit",
@@ -1025,7 +1063,7 @@ func (h *SaleController) DeleteSalePaymentDepositByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the SalePaymentDeposit in the database
-	deposit, err := h.repo.FindSalePaymentDepositById(id)
+	deposit, err := h.repo.WithContext(c.UserContext()).FindSalePaymentDepositById(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -1041,7 +1079,7 @@ func (h *SaleController) DeleteSalePaymentDepositByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the salePayment deposit
-	if err := h.repo.DeleteSalePaymentDepositByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteSalePaymentDepositByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete payment mode",
@@ -1063,8 +1101,32 @@ func (h *SaleController) GenerateCustomerStatement(c *fiber.Ctx) error {
 	customerIdstr := c.Params("customerId")
 	customerID := utils.StrToUint(customerIdstr)
 
+	// Optional statement window
+	from, err := parseOptionalDate(c.Query("from"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid from format (expected YYYY-MM-DD)",
+			"error":   err.Error(),
+		})
+	}
+	to, err := parseOptionalDate(c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid to format (expected YYYY-MM-DD)",
+			"error":   err.Error(),
+		})
+	}
+	if from != nil && to != nil && from.After(*to) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "from must be on or before to",
+		})
+	}
+
 	// Fetch the customer statement from the repository
-	statement, err := h.repo.GenerateCustomerStatement(customerID)
+	statement, err := h.repo.WithContext(c.UserContext()).GenerateCustomerStatement(customerID, from, to)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -1079,6 +1141,20 @@ func (h *SaleController) GenerateCustomerStatement(c *fiber.Ctx) error {
 		})
 	}
 
+	if strings.EqualFold(c.Query("format"), "pdf") {
+		buf, err := renderCustomerStatementPDF(statement)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to render the statement",
+				"error":   err.Error(),
+			})
+		}
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="statement_%d.pdf"`, customerID))
+		return c.Send(buf.Bytes())
+	}
+
 	// Return the fetched payment
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status":  "success",
@@ -1087,6 +1163,18 @@ func (h *SaleController) GenerateCustomerStatement(c *fiber.Ctx) error {
 	})
 }
 
+// parseOptionalDate parses a YYYY-MM-DD query value, returning nil when it is empty
+func parseOptionalDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
 // ==========================
 
 type SaleWithPaymentsInput struct {
@@ -1095,7 +1183,7 @@ type SaleWithPaymentsInput struct {
 }
 
 type SalePaymentWithModeInput struct {
-	AmountPayed float64                          `json:"amount_payed"`
+	AmountPayed money.Money                      `json:"amount_payed"`
 	PaymentDate string                           `json:"payment_date"`
 	CreatedBy   string                           `json:"created_by"`
 	UpdatedBy   string                           `json:"updated_by"`
@@ -1123,8 +1211,13 @@ func (h *SaleController) CreateSaleWithPayments(c *fiber.Ctx) error {
 		})
 	}
 	input.Sale.SaleDate = saleDate.Format("2006-01-02")
+	if input.Sale.Currency != "" {
+		if err := normalizeCurrencies(c, h.rates, &input.Sale.Currency); err != nil {
+			return currencyError(c, err)
+		}
+	}
 
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c.UserContext()).Begin()
 	if tx.Error != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to start transaction"})
 	}
@@ -1161,6 +1254,13 @@ func (h *SaleController) CreateSaleWithPayments(c *fiber.Ctx) error {
 		tx.Rollback()
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "Car already sold"})
 	}
+	if err := carRegistration.CheckTransition(carRegistration.StatusFieldCar, car.CarStatus, repository.CarStatusSold, input.Sale.AllowInTransitSale); err != nil {
+		tx.Rollback()
+		return c.Status(409).JSON(fiber.Map{"status": "error", "message": "The car cannot be sold", "data": err.Error()})
+	}
+	if input.Sale.CreatedBy == "" {
+		input.Sale.CreatedBy = getUsernameOrDefault(c, "system")
+	}
 
 	// ✅ Save Sale (after locking car)
 	if err := tx.Create(&input.Sale).Error; err != nil {
@@ -1169,16 +1269,22 @@ func (h *SaleController) CreateSaleWithPayments(c *fiber.Ctx) error {
 	}
 
 	// ✅ Update car (status + optional customer)
-	updateData := map[string]interface{}{
-		"car_status": "Sold",
-	}
-	if input.Sale.CustomerID != nil && *input.Sale.CustomerID != 0 {
-		updateData["customer_id"] = input.Sale.CustomerID
-	}
-	if err := tx.Model(&carRegistration.Car{}).Where("id = ?", input.Sale.CarID).Updates(updateData).Error; err != nil {
+	if _, err := carRegistration.ChangeCarStatus(tx, input.Sale.CarID, carRegistration.StatusChange{
+		Field:              carRegistration.StatusFieldCar,
+		To:                 repository.CarStatusSold,
+		Reason:             fmt.Sprintf("Sale %d created", input.Sale.ID),
+		By:                 input.Sale.CreatedBy,
+		AllowInTransitSale: input.Sale.AllowInTransitSale,
+	}); err != nil {
 		tx.Rollback()
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to update car status", "data": err.Error()})
 	}
+	if input.Sale.CustomerID != nil && *input.Sale.CustomerID != 0 {
+		if err := tx.Model(&carRegistration.Car{}).Where("id = ?", input.Sale.CarID).Update("customer_id", input.Sale.CustomerID).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to update car customer", "data": err.Error()})
+		}
+	}
 
 	var savedPayments []saleRegistration.SalePayment
 	var savedModes []saleRegistration.SalePaymentMode
@@ -1221,6 +1327,18 @@ func (h *SaleController) CreateSaleWithPayments(c *fiber.Ctx) error {
 		savedModes = append(savedModes, paymentMode)
 	}
 
+	// Generate the installment schedule and allocate the payments to it
+	if err := repository.RegenerateSaleInstallments(tx, &input.Sale); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to generate installments", "data": err.Error()})
+	}
+
+	// Derive the car's payment status from the payments
+	if err := repository.SyncCarPaymentStatus(tx, input.Sale.ID, input.Sale.CreatedBy); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to update car payment status", "data": err.Error()})
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Transaction commit failed", "data": err.Error()})
 	}
@@ -1273,12 +1391,24 @@ func (h *SaleController) UpdateSaleWithPayments(c *fiber.Ctx) error {
 		})
 	}
 	input.Sale.SaleDate = saleDate.Format("2006-01-02")
+	if input.Sale.Currency != "" {
+		if err := normalizeCurrencies(c, h.rates, &input.Sale.Currency); err != nil {
+			return currencyError(c, err)
+		}
+	}
 
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c.UserContext()).Begin()
 	if tx.Error != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to start transaction"})
 	}
 
+	// Keep the current terms to know whether the schedule must be rebuilt
+	var previous saleRegistration.Sale
+	if err := tx.First(&previous, saleID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "Sale not found"})
+	}
+
 	// Update Sale
 	if err := tx.Model(&saleRegistration.Sale{}).
 		Where("id = ?", saleID).
@@ -1350,6 +1480,29 @@ func (h *SaleController) UpdateSaleWithPayments(c *fiber.Ctx) error {
 		savedModes = append(savedModes, paymentMode)
 	}
 
+	var updated saleRegistration.Sale
+	if err := tx.First(&updated, saleID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to reload sale", "data": err.Error()})
+	}
+
+	// Rebuild the schedule when the terms changed, otherwise only re-apply the payments
+	if repository.SaleTermsChanged(&previous, &updated) {
+		err = repository.RegenerateSaleInstallments(tx, &updated)
+	} else {
+		err = repository.AllocateSalePayments(tx, saleID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to update installments", "data": err.Error()})
+	}
+
+	// Derive the car's payment status from the payments
+	if err := repository.SyncCarPaymentStatus(tx, saleID, updated.UpdatedBy); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to update car payment status", "data": err.Error()})
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Transaction commit failed", "data": err.Error()})
 	}
@@ -1362,3 +1515,174 @@ func (h *SaleController) UpdateSaleWithPayments(c *fiber.Ctx) error {
 		"payment_modes": savedModes,
 	})
 }
+
+// ==========================
+
+func (h *SaleController) GetSaleInstallments(c *fiber.Ctx) error {
+	saleID := utils.StrToUint(c.Params("id"))
+	if saleID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid sale ID",
+		})
+	}
+
+	installments, err := h.repo.WithContext(c.UserContext()).GetSaleInstallments(saleID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve installments",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Installments retrieved successfully",
+		"data":    installments,
+	})
+}
+
+func (h *SaleController) RebuildSaleInstallments(c *fiber.Ctx) error {
+	saleID := utils.StrToUint(c.Params("id"))
+	if saleID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid sale ID",
+		})
+	}
+
+	if err := h.repo.WithContext(c.UserContext()).RebuildSaleInstallments(saleID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Sale not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to rebuild installments",
+			"data":    err.Error(),
+		})
+	}
+
+	installments, err := h.repo.WithContext(c.UserContext()).GetSaleInstallments(saleID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve installments",
+			"data":    err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Installments rebuilt successfully",
+		"data":    installments,
+	})
+}
+
+// ==========================
+
+// GetSalesAging returns outstanding receivables bucketed by days overdue, as JSON or as an XLSX download (?format=xlsx)
+func (h *SaleController) GetSalesAging(c *fiber.Ctx) error {
+	companyID := uint(c.QueryInt("company_id", 0))
+	customerID := uint(c.QueryInt("customer_id", 0))
+
+	asOf := time.Now()
+	if asOfStr := c.Query("as_of"); asOfStr != "" {
+		parsed, err := time.Parse("2006-01-02", asOfStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid as_of format (expected YYYY-MM-DD)",
+				"data":    err.Error(),
+			})
+		}
+		asOf = parsed
+	}
+
+	report, err := h.repo.WithContext(c.UserContext()).GetReceivablesAging(companyID, customerID, asOf)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to generate aging report",
+			"data":    err.Error(),
+		})
+	}
+
+	if strings.EqualFold(c.Query("format"), "xlsx") {
+		buf, err := writeAgingWorkbook(report)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to export aging report",
+				"data":    err.Error(),
+			})
+		}
+		c.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="aging_%s.xlsx"`, report.AsOf))
+		return c.Send(buf.Bytes())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Aging report generated successfully",
+		"data":    report,
+	})
+}
+
+// writeAgingWorkbook lays the aging report out as one row per sale with company subtotals
+func writeAgingWorkbook(report *repository.AgingReport) (*bytes.Buffer, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Aging"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+
+	header := []interface{}{
+		"Company", "Sale ID", "Sale Date", "Customer", "Telephone", "Chasis Number", "Car Model",
+		"Total Price", "Total Paid", "Outstanding", "Oldest Due Date", "Days Overdue",
+		"Current", "1-30", "31-60", "61-90", "90+",
+	}
+	rows := [][]interface{}{
+		{"Receivables aging as of " + report.AsOf},
+		header,
+	}
+
+	for _, company := range report.Companies {
+		for _, sale := range company.Sales {
+			rows = append(rows, []interface{}{
+				company.CompanyName, sale.SaleID, sale.SaleDate, sale.CustomerName, sale.Telephone,
+				sale.ChasisNumber, sale.CarModel, sale.TotalPrice.Float64(), sale.TotalPaid.Float64(),
+				sale.Outstanding.Float64(), sale.OldestDueDate, sale.DaysOverdue,
+				sale.Buckets.Current.Float64(), sale.Buckets.Days1To30.Float64(), sale.Buckets.Days31To60.Float64(),
+				sale.Buckets.Days61To90.Float64(), sale.Buckets.Days90Plus.Float64(),
+			})
+		}
+		rows = append(rows, agingTotalsRow(company.CompanyName+" total", company.Totals))
+	}
+	rows = append(rows, agingTotalsRow("Grand total", report.Totals))
+
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.WriteToBuffer()
+}
+
+func agingTotalsRow(label string, totals repository.AgingBuckets) []interface{} {
+	return []interface{}{
+		label, "", "", "", "", "", "", "", "", totals.Total.Float64(), "", "",
+		totals.Current.Float64(), totals.Days1To30.Float64(), totals.Days31To60.Float64(),
+		totals.Days61To90.Float64(), totals.Days90Plus.Float64(),
+	}
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"bytes"
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// formatQuantity prints a weight or dimension without trailing zeros, blank when unknown
+func formatQuantity(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// carDimensions prints L x W x H, blank when none is recorded
+func carDimensions(car carRegistration.Car) string {
+	if car.Length == 0 && car.Width == 0 && car.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s x %s x %s", formatQuantity(car.Length), formatQuantity(car.Width), formatQuantity(car.Height))
+}
+
+// carYear prints the manufacture year, blank when unknown
+func carYear(car carRegistration.Car) string {
+	if car.ManufactureYear == 0 {
+		return ""
+	}
+	return strconv.Itoa(car.ManufactureYear)
+}
+
+// renderShippingManifestPDF prints the manifest on landscape A4: the shipment details, then one table
+// per consignee with its subtotal and the shipment totals at the end
+func renderShippingManifestPDF(manifest *repository.ShippingManifest) (*bytes.Buffer, error) {
+	invoice := manifest.Invoice
+
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Arial", "I", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Manifest %s - Page %d/{nb}", invoice.InvoiceNo, pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AliasNbPages("")
+	pdf.AddPage()
+
+	pdf.SetFont("Arial", "B", 16)
+	pdf.SetTextColor(20, 50, 100)
+	pdf.CellFormat(0, 9, "SHIPPING MANIFEST / PACKING LIST", "", 1, "L", false, 0, "")
+	pdf.SetDrawColor(20, 50, 100)
+	pdf.SetLineWidth(0.6)
+	pdf.Line(15, pdf.GetY(), 282, pdf.GetY())
+	pdf.Ln(4)
+
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Arial", "", 10)
+	details := [][2]string{
+		{"Invoice No: " + invoice.InvoiceNo, "Date: " + time.Now().Format("02 Jan 2006")},
+		{"Vessel: " + invoice.VesselName, "Ship date: " + invoice.ShipDate},
+		{"From: " + invoice.FromLocation, "To: " + invoice.ToLocation},
+	}
+	for _, line := range details {
+		pdf.CellFormat(135, 5, tr(line[0]), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, tr(line[1]), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	widths := []float64{10, 42, 28, 32, 14, 24, 20, 22, 22, 53}
+	headers := []string{"#", "Chassis No", "Make", "Model", "Year", "Colour", "CC", "Weight", "Gross Wt", "L x W x H"}
+	tableHeader := func() {
+		pdf.SetFont("Arial", "B", 9)
+		pdf.SetFillColor(20, 50, 100)
+		pdf.SetTextColor(255, 255, 255)
+		for i, h := range headers {
+			align := "L"
+			if i == 7 || i == 8 {
+				align = "R"
+			}
+			pdf.CellFormat(widths[i], 7, h, "1", 0, align, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetTextColor(0, 0, 0)
+	}
+
+	number := 0
+	for _, group := range manifest.Groups {
+		// Keep the consignee title with at least a few of its rows
+		if pdf.GetY() > 160 {
+			pdf.AddPage()
+		}
+		pdf.SetFont("Arial", "B", 11)
+		pdf.CellFormat(0, 8, tr(fmt.Sprintf("Consignee: %s (%d units)", group.Consignee, group.Units)), "", 1, "L", false, 0, "")
+		tableHeader()
+
+		pdf.SetFont("Arial", "", 9)
+		for _, car := range group.Cars {
+			number++
+			cells := []string{
+				strconv.Itoa(number), car.ChasisNumber, car.Make, car.CarModel, carYear(car), car.Colour,
+				car.EngineCapacity, formatQuantity(car.Weight), formatQuantity(car.GrossWeight), carDimensions(car),
+			}
+			for i, value := range cells {
+				align := "L"
+				if i == 7 || i == 8 {
+					align = "R"
+				}
+				ln := 0
+				if i == len(cells)-1 {
+					ln = 1
+				}
+				pdf.CellFormat(widths[i], 6, tr(value), "1", ln, align, false, 0, "")
+			}
+		}
+
+		pdf.SetFont("Arial", "B", 9)
+		pdf.SetFillColor(235, 240, 248)
+		pdf.CellFormat(widths[0]+widths[1]+widths[2]+widths[3]+widths[4]+widths[5]+widths[6], 7,
+			tr(fmt.Sprintf("Subtotal %s: %d units", group.Consignee, group.Units)), "1", 0, "L", true, 0, "")
+		pdf.CellFormat(widths[7], 7, formatQuantity(group.Weight), "1", 0, "R", true, 0, "")
+		pdf.CellFormat(widths[8], 7, formatQuantity(group.GrossWeight), "1", 0, "R", true, 0, "")
+		pdf.CellFormat(widths[9], 7, "", "1", 1, "L", true, 0, "")
+		pdf.Ln(5)
+	}
+
+	// Shipment totals
+	pdf.SetFont("Arial", "B", 10)
+	pdf.SetFillColor(235, 240, 248)
+	totals := [][2]string{
+		{"Consignees", strconv.Itoa(len(manifest.Groups))},
+		{"Total units", strconv.Itoa(manifest.TotalUnits)},
+		{"Total weight", formatQuantity(manifest.TotalWeight)},
+		{"Total gross weight", formatQuantity(manifest.TotalGrossWeight)},
+	}
+	for _, line := range totals {
+		pdf.CellFormat(187, 7, "", "", 0, "L", false, 0, "")
+		pdf.CellFormat(45, 7, line[0], "1", 0, "L", true, 0, "")
+		pdf.CellFormat(35, 7, line[1], "1", 1, "R", true, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// writeShippingManifestWorkbook lays the manifest out as one row per car with consignee subtotals
+func writeShippingManifestWorkbook(manifest *repository.ShippingManifest) (*bytes.Buffer, error) {
+	invoice := manifest.Invoice
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Manifest"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+
+	rows := [][]interface{}{
+		{"Shipping manifest", invoice.InvoiceNo},
+		{"Vessel", invoice.VesselName, "", "Ship date", invoice.ShipDate},
+		{"From", invoice.FromLocation, "", "To", invoice.ToLocation},
+		{},
+		{"Consignee", "#", "Chassis No", "Make", "Model", "Year", "Colour", "CC", "Weight", "Gross Weight", "Length", "Width", "Height"},
+	}
+
+	number := 0
+	for _, group := range manifest.Groups {
+		for _, car := range group.Cars {
+			number++
+			rows = append(rows, []interface{}{
+				group.Consignee, number, car.ChasisNumber, car.Make, car.CarModel, car.ManufactureYear, car.Colour,
+				car.EngineCapacity, car.Weight, car.GrossWeight, car.Length, car.Width, car.Height,
+			})
+		}
+		rows = append(rows, []interface{}{
+			group.Consignee + " total", group.Units, "", "", "", "", "", "", group.Weight, group.GrossWeight,
+		})
+	}
+	rows = append(rows, []interface{}{
+		"Grand total", manifest.TotalUnits, "", "", "", "", "", "", manifest.TotalWeight, manifest.TotalGrossWeight,
+	})
+
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.WriteToBuffer()
+}
+
+// GetShippingManifest returns the manifest of a shipping invoice as JSON, or as a download with
+// ?format=pdf or ?format=xlsx
+func (h *ShippingController) GetShippingManifest(c *fiber.Ctx) error {
+	id := utils.StrToUint(c.Params("id"))
+
+	manifest, err := h.repo.WithContext(c.UserContext()).GetShippingManifest(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invoice not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to build manifest",
+			"data":    err.Error(),
+		})
+	}
+
+	fileName := "manifest_" + strings.ReplaceAll(manifest.Invoice.InvoiceNo, `"`, "")
+	switch strings.ToLower(c.Query("format")) {
+	case "pdf":
+		buf, err := renderShippingManifestPDF(manifest)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to render the manifest",
+				"data":    err.Error(),
+			})
+		}
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s.pdf"`, fileName))
+		return c.Send(buf.Bytes())
+
+	case "xlsx":
+		buf, err := writeShippingManifestWorkbook(manifest)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to export the manifest",
+				"data":    err.Error(),
+			})
+		}
+		c.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.xlsx"`, fileName))
+		return c.Send(buf.Bytes())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Manifest generated successfully",
+		"data":    manifest,
+	})
+}
@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/repository"
+	"car-bond/internals/utils"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// trackingError answers a failed container or milestone change
+func trackingError(c *fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, repository.ErrDuplicateContainer):
+		status = fiber.StatusConflict
+	case errors.Is(err, repository.ErrUnknownMilestone), errors.Is(err, repository.ErrUnknownContainerType),
+		errors.Is(err, repository.ErrContainerNotOnInvoice), errors.Is(err, repository.ErrCarNotOnInvoice):
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    err.Error(),
+	})
+}
+
+// ================
+
+type ContainerPayload struct {
+	ContainerNo string `json:"container_no" validate:"required,max=20"`
+	SealNo      string `json:"seal_no"`
+	Type        string `json:"type" validate:"required"` // 20GP, 40GP, 40HC or RoRo
+	CarIDs      []uint `json:"car_ids"`
+	CreatedBy   string `json:"created_by"`
+	UpdatedBy   string `json:"updated_by"`
+}
+
+// CreateContainer adds a container to an invoice, optionally with the cars packed in it
+func (h *ShippingController) CreateContainer(c *fiber.Ctx) error {
+	var payload ContainerPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input provided",
+			"data":    err.Error(),
+		})
+	}
+	if validationErr := utils.ValidateStruct(payload); validationErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Validation failed",
+			"errors":  validationErr,
+		})
+	}
+
+	createdBy := payload.CreatedBy
+	if createdBy == "" {
+		createdBy = getUsernameOrDefault(c, "system")
+	}
+	container := carRegistration.ShippingContainer{
+		CarShippingInvoiceID: utils.StrToUint(c.Params("id")),
+		ContainerNo:          strings.ToUpper(strings.TrimSpace(payload.ContainerNo)),
+		SealNo:               payload.SealNo,
+		Type:                 payload.Type,
+		CreatedBy:            createdBy,
+		UpdatedBy:            createdBy,
+	}
+	if err := h.repo.WithContext(c.UserContext()).CreateContainer(&container, payload.CarIDs); err != nil {
+		return trackingError(c, err, "Failed to create container")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Container created successfully",
+		"data":    container,
+	})
+}
+
+// UpdateContainer changes the number, seal or type of a container
+func (h *ShippingController) UpdateContainer(c *fiber.Ctx) error {
+	container, err := h.repo.WithContext(c.UserContext()).GetContainerByID(utils.StrToUint(c.Params("id")))
+	if err != nil {
+		return trackingError(c, err, "Failed to retrieve container")
+	}
+
+	var payload ContainerPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    err.Error(),
+		})
+	}
+	if validationErr := utils.ValidateStruct(payload); validationErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Validation failed",
+			"errors":  validationErr,
+		})
+	}
+
+	container.ContainerNo = strings.ToUpper(strings.TrimSpace(payload.ContainerNo))
+	container.SealNo = payload.SealNo
+	container.Type = payload.Type
+	container.UpdatedBy = payload.UpdatedBy
+	if container.UpdatedBy == "" {
+		container.UpdatedBy = getUsernameOrDefault(c, "system")
+	}
+	if err := h.repo.WithContext(c.UserContext()).UpdateContainer(&container); err != nil {
+		return trackingError(c, err, "Failed to update container")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Container updated successfully",
+		"data":    container,
+	})
+}
+
+type AssignContainerCarsPayload struct {
+	CarIDs []uint `json:"car_ids"` // the full list of cars in the container
+}
+
+// AssignContainerCars sets which cars of the invoice are packed in a container
+func (h *ShippingController) AssignContainerCars(c *fiber.Ctx) error {
+	var payload AssignContainerCarsPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    err.Error(),
+		})
+	}
+
+	container, err := h.repo.WithContext(c.UserContext()).AssignContainerCars(utils.StrToUint(c.Params("id")), payload.CarIDs)
+	if err != nil {
+		return trackingError(c, err, "Failed to assign cars to container")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Container cars updated successfully",
+		"data":    container,
+	})
+}
+
+func (h *ShippingController) DeleteContainer(c *fiber.Ctx) error {
+	id := utils.StrToUint(c.Params("id"))
+	container, err := h.repo.WithContext(c.UserContext()).GetContainerByID(id)
+	if err != nil {
+		return trackingError(c, err, "Failed to retrieve container")
+	}
+
+	if err := h.repo.WithContext(c.UserContext()).DeleteContainer(id); err != nil {
+		return trackingError(c, err, "Failed to delete container")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Container deleted successfully",
+		"data":    container,
+	})
+}
+
+// ================
+
+type MilestonePayload struct {
+	Milestone   string `json:"milestone" validate:"required"` // loaded, departed, transshipment, arrived_port, released, arrived_yard
+	ContainerID *uint  `json:"container_id"`                  // only the cars of this container; the whole shipment when empty
+	Location    string `json:"location"`
+	OccurredAt  string `json:"occurred_at"` // RFC 3339, "YYYY-MM-DD HH:MM" or "YYYY-MM-DD"; now when empty
+	ETA         string `json:"eta"`         // YYYY-MM-DD
+	Remarks     string `json:"remarks"`
+	CreatedBy   string `json:"created_by"`
+}
+
+// parseMilestoneTime accepts a full timestamp, a date and time, or a date
+func parseMilestoneTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	var err error
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		var parsed time.Time
+		if parsed, err = time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// RecordMilestone records a voyage milestone of an invoice. The cars concerned move forward to
+// InTransit (or InStock once at the yard) and each gets a transaction alert with the position and ETA.
+func (h *ShippingController) RecordMilestone(c *fiber.Ctx) error {
+	var payload MilestonePayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input provided",
+			"data":    err.Error(),
+		})
+	}
+	if validationErr := utils.ValidateStruct(payload); validationErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Validation failed",
+			"errors":  validationErr,
+		})
+	}
+	if !repository.IsMilestone(payload.Milestone) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "milestone must be one of " + strings.Join(repository.MilestoneOrder, ", "),
+		})
+	}
+	if payload.Milestone == carRegistration.MilestoneArrivedPort && strings.TrimSpace(payload.Location) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "location (e.g. Mombasa or Dar es Salaam) is required for arrived_port",
+		})
+	}
+
+	occurredAt, err := parseMilestoneTime(payload.OccurredAt)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid occurred_at format (expected RFC 3339, YYYY-MM-DD HH:MM or YYYY-MM-DD)",
+			"data":    err.Error(),
+		})
+	}
+
+	var eta *string
+	if payload.ETA != "" {
+		if _, err := time.Parse("2006-01-02", payload.ETA); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid eta format (expected YYYY-MM-DD)",
+				"data":    err.Error(),
+			})
+		}
+		eta = &payload.ETA
+	}
+
+	createdBy := payload.CreatedBy
+	if createdBy == "" {
+		createdBy = getUsernameOrDefault(c, "system")
+	}
+	milestone := carRegistration.VoyageMilestone{
+		CarShippingInvoiceID: utils.StrToUint(c.Params("id")),
+		ContainerID:          payload.ContainerID,
+		Milestone:            payload.Milestone,
+		Location:             strings.TrimSpace(payload.Location),
+		OccurredAt:           occurredAt,
+		ETA:                  eta,
+		Remarks:              payload.Remarks,
+		CreatedBy:            createdBy,
+		UpdatedBy:            createdBy,
+	}
+
+	result, err := h.repo.WithContext(c.UserContext()).RecordMilestone(&milestone)
+	if err != nil {
+		return trackingError(c, err, "Failed to record milestone")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Milestone recorded successfully",
+		"data":    result,
+	})
+}
+
+// GetShipmentTracking returns the position, ETA, containers and milestone timeline of an invoice
+func (h *ShippingController) GetShipmentTracking(c *fiber.Ctx) error {
+	tracking, err := h.repo.WithContext(c.UserContext()).GetShipmentTracking(utils.StrToUint(c.Params("id")))
+	if err != nil {
+		return trackingError(c, err, "Failed to retrieve shipment tracking")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Shipment tracking retrieved successfully",
+		"data":    tracking,
+	})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/money"
 	"car-bond/internals/repository"
 	"car-bond/internals/utils"
 	"errors"
@@ -37,7 +38,7 @@ func (h *ShippingController) CreateShippingInvoice(c *fiber.Ctx) error {
 	}
 
 	// Attempt to create the invoice record using the repository
-	if err := h.repo.CreateShippingInvoice(invoice); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateShippingInvoice(invoice); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create shipping invoice",
@@ -57,7 +58,7 @@ func (h *ShippingController) CreateShippingInvoice(c *fiber.Ctx) error {
 
 func (h *ShippingController) GetAllShippingInvoices(c *fiber.Ctx) error {
 	// Fetch paginated invoices using the repository
-	pagination, invoices, err := h.repo.GetPaginatedShippingInvoices(c)
+	pagination, invoices, err := h.repo.WithContext(c.UserContext()).GetPaginatedShippingInvoices(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -71,7 +72,7 @@ func (h *ShippingController) GetAllShippingInvoices(c *fiber.Ctx) error {
 	// Iterate over all invoices to fetch associated invoice cars
 	for _, invoice := range invoices {
 		// Fetch invoice cars
-		cars, err := h.repo.GetCarsByInvoiceId(invoice.ID)
+		cars, err := h.repo.WithContext(c.UserContext()).GetCarsByInvoiceId(invoice.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -108,7 +109,7 @@ func (h *ShippingController) GetSingleInvoice(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the invoice by ID
-	invoice, err := h.repo.GetShippingInvoiceByID(id)
+	invoice, err := h.repo.WithContext(c.UserContext()).GetShippingInvoiceByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -124,7 +125,7 @@ func (h *ShippingController) GetSingleInvoice(c *fiber.Ctx) error {
 	}
 
 	// Fetch invoice locations associated with the invoice
-	invoiceCars, err := h.repo.GetCarsByInvoiceId(invoice.ID)
+	invoiceCars, err := h.repo.WithContext(c.UserContext()).GetCarsByInvoiceId(invoice.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -133,10 +134,21 @@ func (h *ShippingController) GetSingleInvoice(c *fiber.Ctx) error {
 		})
 	}
 
+	// Fetch the car expenses generated from the invoice costs
+	allocations, err := h.repo.WithContext(c.UserContext()).GetInvoiceAllocations(invoice.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve cost allocations",
+			"data":    err.Error(),
+		})
+	}
+
 	// Prepare the response
 	response := fiber.Map{
-		"invoice": invoice,
-		"cars":    invoiceCars,
+		"invoice":     invoice,
+		"cars":        invoiceCars,
+		"allocations": allocations,
 	}
 
 	// Return the response
@@ -155,7 +167,7 @@ func (h *ShippingController) GetShippingInvoiceByInvoiceNum(c *fiber.Ctx) error
 	no := c.Params("no")
 
 	// Fetch the invoice by ID
-	invoice, err := h.repo.GetShippingInvoiceByInvoiceNum(no)
+	invoice, err := h.repo.WithContext(c.UserContext()).GetShippingInvoiceByInvoiceNum(no)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -171,7 +183,7 @@ func (h *ShippingController) GetShippingInvoiceByInvoiceNum(c *fiber.Ctx) error
 	}
 
 	// Fetch invoice cars associated with the invoice
-	invoiceCars, err := h.repo.GetCarsByInvoiceId(invoice.ID)
+	invoiceCars, err := h.repo.WithContext(c.UserContext()).GetCarsByInvoiceId(invoice.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -205,13 +217,34 @@ type UpdateShippingInvoicePayload struct {
 	ToLocation   string `json:"to_location"`
 	UpdatedBy    string `json:"updated_by"`
 	CarIDs       []uint `json:"car_ids,omitempty"` // ← new: full list of IDs you want linked
+
+	// Costs are only changed when sent
+	Currency      string       `json:"currency,omitempty"`
+	FreightCost   *money.Money `json:"freight_cost,omitempty"`
+	InsuranceCost *money.Money `json:"insurance_cost,omitempty"`
+	PortCharges   *money.Money `json:"port_charges,omitempty"`
+}
+
+// changesCosts reports whether the payload touches anything the cost allocation depends on
+func (p *UpdateShippingInvoicePayload) changesCosts() bool {
+	return p.CarIDs != nil || p.Currency != "" || p.FreightCost != nil || p.InsuranceCost != nil || p.PortCharges != nil
 }
 
 func (h *ShippingController) UpdateShippingInvoice(c *fiber.Ctx) error {
 	// … load existing invoice as before …
-	invoice, err := h.repo.GetShippingInvoiceByID(c.Params("id"))
+	invoice, err := h.repo.WithContext(c.UserContext()).GetShippingInvoiceByID(c.Params("id"))
 	if err != nil {
-		// handle 404 or 500
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invoice not found",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve invoice",
+			"data":    err.Error(),
+		})
 	}
 
 	// 2a️⃣ parse payload
@@ -224,6 +257,14 @@ func (h *ShippingController) UpdateShippingInvoice(c *fiber.Ctx) error {
 		})
 	}
 
+	// A locked invoice keeps its costs and cars, so the allocated expenses stay final
+	if invoice.Locked && payload.changesCosts() {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invoice is locked and cannot be modified",
+		})
+	}
+
 	// 2b️⃣ update scalar fields
 	invoice.InvoiceNo = payload.InvoiceNo
 	invoice.ShipDate = payload.ShipDate
@@ -231,9 +272,21 @@ func (h *ShippingController) UpdateShippingInvoice(c *fiber.Ctx) error {
 	invoice.FromLocation = payload.FromLocation
 	invoice.ToLocation = payload.ToLocation
 	invoice.UpdatedBy = payload.UpdatedBy
+	if payload.Currency != "" {
+		invoice.Currency = payload.Currency
+	}
+	if payload.FreightCost != nil {
+		invoice.FreightCost = *payload.FreightCost
+	}
+	if payload.InsuranceCost != nil {
+		invoice.InsuranceCost = *payload.InsuranceCost
+	}
+	if payload.PortCharges != nil {
+		invoice.PortCharges = *payload.PortCharges
+	}
 
 	// 2c️⃣ persist the scalar fields first
-	if err := h.repo.UpdateShippingInvoice(&invoice); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateShippingInvoice(&invoice); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update invoice",
@@ -274,6 +327,17 @@ func (h *ShippingController) UpdateShippingInvoice(c *fiber.Ctx) error {
 		invoice.Cars = carsToAssign
 	}
 
+	// Keep the allocated expenses in line with the new costs and cars
+	if invoice.AllocationMethod != "" && payload.changesCosts() {
+		if _, err := h.repo.WithContext(c.UserContext()).AllocateShippingCosts(invoice.ID, invoice.AllocationMethod, payload.UpdatedBy); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invoice updated but shipping costs could not be reallocated",
+				"data":    err.Error(),
+			})
+		}
+	}
+
 	// 2e️⃣ return the updated invoice (with Cars)
 	return c.Status(200).JSON(fiber.Map{
 		"status":  "success",
@@ -290,7 +354,7 @@ func (h *ShippingController) DeleteShippingInvoiceByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the Invoice in the database
-	invoice, err := h.repo.GetShippingInvoiceByID(id)
+	invoice, err := h.repo.WithContext(c.UserContext()).GetShippingInvoiceByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -306,7 +370,7 @@ func (h *ShippingController) DeleteShippingInvoiceByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the invoice
-	if err := h.repo.DeleteShippingInvoiceByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteShippingInvoiceByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete invoice",
@@ -339,13 +403,16 @@ func (ic *ShippingController) LockInvoice(c *fiber.Ctx) error {
 	id := utils.StrToUint(c.Params("id"))
 	updatedBy := getUsernameOrDefault(c, "system")
 
-	if err := ic.repo.LockInvoice(id, updatedBy); err != nil {
+	if err := ic.repo.WithContext(c.UserContext()).LockInvoice(id, updatedBy); err != nil {
 		switch err {
 		case gorm.ErrRecordNotFound:
 			return c.Status(404).JSON(fiber.Map{"status": "error", "message": "Invoice not found"})
 		case repository.ErrAlreadyLocked:
 			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "Invoice is already locked"})
 		default:
+			if errors.Is(err, repository.ErrMissingAllocationMeasures) || errors.Is(err, repository.ErrNoCarsOnInvoice) {
+				return c.Status(400).JSON(fiber.Map{"status": "error", "message": "Shipping costs could not be reallocated", "data": err.Error()})
+			}
 			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to lock invoice", "data": err.Error()})
 		}
 	}
@@ -355,3 +422,53 @@ func (ic *ShippingController) LockInvoice(c *fiber.Ctx) error {
 		"message": "Invoice locked successfully",
 	})
 }
+
+// ====================
+
+type AllocateShippingCostsPayload struct {
+	Method    string `json:"method"` // equal, weight or volume
+	UpdatedBy string `json:"updated_by"`
+}
+
+// AllocateShippingCosts splits the freight, insurance and port charges of an invoice across its
+// cars and records each share as a car expense
+func (h *ShippingController) AllocateShippingCosts(c *fiber.Ctx) error {
+	id := utils.StrToUint(c.Params("id"))
+
+	var payload AllocateShippingCostsPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    err.Error(),
+		})
+	}
+	if payload.Method == "" {
+		payload.Method = carRegistration.AllocationEqual
+	}
+	if payload.UpdatedBy == "" {
+		payload.UpdatedBy = getUsernameOrDefault(c, "system")
+	}
+
+	expenses, err := h.repo.WithContext(c.UserContext()).AllocateShippingCosts(id, payload.Method, payload.UpdatedBy)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(404).JSON(fiber.Map{"status": "error", "message": "Invoice not found"})
+		case errors.Is(err, repository.ErrInvoiceLocked):
+			return c.Status(409).JSON(fiber.Map{"status": "error", "message": "Invoice is locked and cannot be reallocated"})
+		case errors.Is(err, repository.ErrInvalidAllocationMethod),
+			errors.Is(err, repository.ErrNoCarsOnInvoice),
+			errors.Is(err, repository.ErrMissingAllocationMeasures):
+			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "Failed to allocate shipping costs", "data": err.Error()})
+		default:
+			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to allocate shipping costs", "data": err.Error()})
+		}
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Shipping costs allocated successfully",
+		"data":    expenses,
+	})
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sheetRow is one row of an uploaded spreadsheet with its 1-based row number
+type sheetRow struct {
+	Number int
+	Values []string
+}
+
+// trimRow drops trailing empty cells
+func trimRow(row []string) []string {
+	for len(row) > 0 && strings.TrimSpace(row[len(row)-1]) == "" {
+		row = row[:len(row)-1]
+	}
+	return row
+}
+
+// extractTable reads an uploaded XLSX or CSV file, picking the reader from the file extension
+func extractTable(filePath string) (string, []sheetRow, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".xlsx", ".xlsm":
+		return extractTableFromExcel(filePath)
+	case ".csv":
+		return extractTableFromCSV(filePath)
+	default:
+		return "", nil, fmt.Errorf("unsupported file type %q (expected .xlsx or .csv)", filepath.Ext(filePath))
+	}
+}
+
+// extractTableFromExcel reads every row of the first sheet, keeping the sheet row numbers
+func extractTableFromExcel(filePath string) (string, []sheetRow, error) {
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open Excel file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			log.Printf("Warning: Failed to close Excel file: %v", closeErr)
+		}
+	}()
+
+	// Fetch the list of all sheet names
+	sheetList := f.GetSheetList()
+	if len(sheetList) == 0 {
+		return "", nil, fmt.Errorf("no sheets found in the Excel file")
+	}
+
+	// Use the first sheet as default
+	sheetName := sheetList[0]
+
+	// Read all rows from the sheet
+	rows, err := f.GetRows(sheetName)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read rows from sheet %s: %w", sheetName, err)
+	}
+
+	records := make([]sheetRow, 0, len(rows))
+	for i, row := range rows {
+		records = append(records, sheetRow{Number: i + 1, Values: trimRow(row)})
+	}
+
+	if len(records) == 0 {
+		return "", nil, fmt.Errorf("no data found in sheet %s", sheetName)
+	}
+	return sheetName, records, nil
+}
+
+// extractTableFromCSV reads a CSV file; the sheet name is the file name
+func extractTableFromCSV(filePath string) (string, []sheetRow, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1 // rows may have different lengths
+	reader.TrimLeadingSpace = true
+
+	var records []sheetRow
+	for number := 1; ; number++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read CSV row %d: %w", number, err)
+		}
+		if number == 1 && len(row) > 0 {
+			row[0] = strings.TrimPrefix(row[0], "\ufeff") // Excel writes a BOM in front of CSV exports
+		}
+		records = append(records, sheetRow{Number: number, Values: trimRow(row)})
+	}
+
+	name := filepath.Base(filePath)
+	if len(records) == 0 {
+		return "", nil, fmt.Errorf("no data found in %s", name)
+	}
+	return name, records, nil
+}
@@ -15,6 +15,7 @@ import (
 
 // Upload CarFile handles uploading either a photo or a PDF for a Car
 func UploadCarFile(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
 
 	// Get the Car ID from the request form
 	CarID := c.FormValue("car_id")
@@ -116,6 +117,7 @@ func contains(slice []string, item string) bool {
 
 // UploadCarFiles handles uploading multiple files for a Car
 func UploadCarFiles(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
 
 	// Get the Car ID from the request form
 	CarID := c.FormValue("car_id")
@@ -216,6 +218,7 @@ func UploadCarFiles(c *fiber.Ctx, db *gorm.DB) error {
 
 // GetCarFiles retrieves all files (photos or PDFs) associated with a specific car
 func GetCarFiles(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
 
 	// Get the  car ID from the route parameters
 	CarID := c.Params("id")
@@ -270,6 +273,7 @@ func GetCarFiles(c *fiber.Ctx, db *gorm.DB) error {
 }
 
 func GetFile(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
 
 	// Get the file ID from the route parameters
 	fileID := c.Params("file_id")
@@ -308,6 +312,7 @@ func GetFile(c *fiber.Ctx, db *gorm.DB) error {
 
 // UpdateCarFiles handles deleting old files and uploading new ones for a Car
 func UpdateCarFiles(c *fiber.Ctx, db *gorm.DB) error {
+	db = db.WithContext(c.UserContext())
 
 	// Get the Car ID from the request form
 	CarID := c.FormValue("car_id")
@@ -2,12 +2,12 @@ package controllers
 
 import (
 	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/password"
 	"car-bond/internals/repository"
 	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -19,13 +19,6 @@ func NewUserController(repo repository.UserRepository) *UserController {
 	return &UserController{repo: repo}
 }
 
-// ============================================
-
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
-}
-
 // ======================
 
 func (h *UserController) CreateUser(c *fiber.Ctx) error {
@@ -45,8 +38,16 @@ func (h *UserController) CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := password.PolicyFromConfig().Validate(user.Password, user.Username); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The password does not meet the policy",
+			"data":    err.Error(),
+		})
+	}
+
 	// Hash the user's password
-	hash, err := hashPassword(user.Password)
+	hash, err := password.Hash(user.Password)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -57,7 +58,7 @@ func (h *UserController) CreateUser(c *fiber.Ctx) error {
 	user.Password = hash
 
 	// Create the user in the database
-	if err := h.repo.CreateUser(user); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).CreateUser(user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Couldn't create user",
@@ -81,7 +82,7 @@ func (h *UserController) CreateUser(c *fiber.Ctx) error {
 // =====================
 
 func (h *UserController) GetAllUsers(c *fiber.Ctx) error {
-	pagination, users, err := h.repo.GetPaginatedUsers(c)
+	pagination, users, err := h.repo.WithContext(c.UserContext()).GetPaginatedUsers(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -112,7 +113,7 @@ func (h *UserController) GetUserByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Fetch the user by ID
-	user, err := h.repo.GetUserByID(id)
+	user, err := h.repo.WithContext(c.UserContext()).GetUserByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -171,7 +172,7 @@ func (h *UserController) UpdateUser(c *fiber.Ctx) error {
 	}
 
 	// Fetch the user from the repository
-	user, err := h.repo.GetUserByID(id)
+	user, err := h.repo.WithContext(c.UserContext()).GetUserByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -198,7 +199,7 @@ func (h *UserController) UpdateUser(c *fiber.Ctx) error {
 	user.UpdatedBy = input.UpdatedBy
 
 	// Save the updated user
-	if err := h.repo.UpdateUser(user); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).UpdateUser(user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to update user",
@@ -229,7 +230,7 @@ func (h *UserController) DeleteUserByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Find the user in the database
-	user, err := h.repo.GetUserByID(id)
+	user, err := h.repo.WithContext(c.UserContext()).GetUserByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(fiber.Map{
@@ -245,7 +246,7 @@ func (h *UserController) DeleteUserByID(c *fiber.Ctx) error {
 	}
 
 	// Delete the user
-	if err := h.repo.DeleteUserByID(id); err != nil {
+	if err := h.repo.WithContext(c.UserContext()).DeleteUserByID(id); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to delete user",
@@ -277,7 +278,7 @@ func (h *UserController) GetUsersByCompany(c *fiber.Ctx) error {
 	}
 
 	// Fetch paginated users by company ID
-	pagination, users, err := h.repo.GetPaginatedUsersByCompanyId(c, uint(companyId))
+	pagination, users, err := h.repo.WithContext(c.UserContext()).GetPaginatedUsersByCompanyId(c, uint(companyId))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
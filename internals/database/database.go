@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 
+	"car-bond/internals/audit"
 	"car-bond/internals/config"
 	"car-bond/internals/models/alertRegistration"
 	"car-bond/internals/models/carRegistration"
@@ -14,7 +15,9 @@ import (
 	"car-bond/internals/models/metaData"
 	"car-bond/internals/models/saleRegistration"
 	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/rbac"
 	"car-bond/internals/seeder"
+	"car-bond/internals/tenant"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -65,6 +68,19 @@ func (d *DBInstance) Connect() {
 		os.Exit(2)
 	}
 	log.Println("Connected to database")
+
+	// Record every write in the audit log
+	if err := audit.Register(db); err != nil {
+		log.Fatal("Failed to register audit callbacks. \n", err)
+	}
+	// Keep each request inside the company of its user
+	if err := tenant.Register(db); err != nil {
+		log.Fatal("Failed to register company scoping callbacks. \n", err)
+	}
+	// Forget cached permission decisions when a permission changes
+	if err := rbac.Register(db); err != nil {
+		log.Fatal("Failed to register permission callbacks. \n", err)
+	}
 	d.Db = db
 }
 
@@ -85,12 +101,16 @@ func (d *DBInstance) Migrate() {
 		&carRegistration.CarExpense{},
 		&carRegistration.CarScan{},
 		&carRegistration.CarPhoto{},
+		&carRegistration.ShippingContainer{},
+		&carRegistration.VoyageMilestone{},
+		&carRegistration.CarStatusHistory{},
 		// --- Sale --- //
 		&saleRegistration.Sale{},
 		&saleRegistration.SaleAuction{},
 		&saleRegistration.SalePayment{},
 		&saleRegistration.SalePaymentMode{},
 		&saleRegistration.SalePaymentDeposit{},
+		&saleRegistration.SaleInstallment{},
 		// --- User --- //
 		&userRegistration.User{},
 		&userRegistration.Role{},
@@ -98,14 +118,22 @@ func (d *DBInstance) Migrate() {
 		&userRegistration.Resource{},
 		&userRegistration.RoleResourcePermission{},
 		&userRegistration.RoleWildCardPermission{},
+		&userRegistration.RefreshToken{},
+		&userRegistration.RevokedToken{},
+		&userRegistration.PasswordResetToken{},
 		// --- Alerts-- //
 		&alertRegistration.Transaction{},
+		&alertRegistration.NotificationLog{},
+		&alertRegistration.AuditLog{},
 		// --- Metadata-- //
 		&metaData.VehicleEvaluation{},
+		&metaData.VehicleEvaluationVersion{},
 		&metaData.WeightUnit{},
 		&metaData.LeightUnit{},
 		&metaData.ExpenseCategory{},
 		&metaData.Currency{},
+		&metaData.ExchangeRate{},
+		&metaData.DutyRate{},
 		&metaData.Port{},
 		&metaData.PaymentMode{},
 	)
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"car-bond/internals/audit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Audit puts the request ID on the user context, so the writes a request makes are tied to it in the
+// audit log. Protected adds the user once the token is verified.
+func Audit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(audit.WithActor(c.UserContext(), audit.ActorFromCtx(c)))
+		return c.Next()
+	}
+}
@@ -1,14 +1,18 @@
 package middleware
 
 import (
+	"car-bond/internals/audit"
 	"car-bond/internals/config"
 	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/rbac"
 	"fmt"
 	"strings"
+	"time"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
@@ -36,9 +40,71 @@ func Protected() fiber.Handler {
 		AuthScheme: "Bearer",
 
 		ErrorHandler: jwtError,
+
+		// Refuse revoked tokens and make the user known to handlers as c.Locals("username"), and to the
+		// audit log and the company scope through c.UserContext()
+		SuccessHandler: func(c *fiber.Ctx) error {
+			if refused, err := refuseRevoked(c); refused {
+				return err
+			}
+			actor := audit.ActorFromCtx(c)
+			if actor.Username != "" {
+				c.Locals("username", actor.Username)
+			}
+			c.SetUserContext(audit.WithActor(c.UserContext(), actor))
+			return c.Next()
+		},
 	})
 }
 
+// RevocationChecker tells whether an access token was revoked before it expired, by its jti or by
+// revoking every session of its user
+type RevocationChecker interface {
+	IsRevoked(jti string, userID uint, issuedAt time.Time) (bool, error)
+}
+
+var revocations RevocationChecker
+
+// UseRevocations makes Protected refuse the tokens the checker says were revoked
+func UseRevocations(checker RevocationChecker) {
+	revocations = checker
+}
+
+// refuseRevoked answers the request when its token was revoked, or when that cannot be told
+func refuseRevoked(c *fiber.Ctx) (bool, error) {
+	if revocations == nil {
+		return false, nil
+	}
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return false, nil
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false, nil
+	}
+	jti, _ := claims["jti"].(string)
+	userID := uint(0)
+	if id, ok := claims["user_id"].(float64); ok {
+		userID = uint(id)
+	}
+	var issuedAt time.Time // tokens from before jti and iat count as issued at the epoch
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+
+	revoked, err := revocations.IsRevoked(jti, userID, issuedAt)
+	if err != nil {
+		return true, c.Status(fiber.StatusServiceUnavailable).
+			JSON(fiber.Map{"status": "error", "message": "Cannot check the token", "data": nil})
+	}
+	if revoked {
+		return true, c.Status(fiber.StatusUnauthorized).
+			JSON(fiber.Map{"status": "error", "message": "Token has been revoked", "data": nil})
+	}
+	return false, nil
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 	if err.Error() == "Missing or malformed JWT" {
 		return c.Status(fiber.StatusBadRequest).
@@ -56,63 +122,19 @@ func NewDatabaseService(db *gorm.DB) *DatabaseService {
 	return &DatabaseService{db: db}
 }
 
-// CheckPermissions checks the permissions for a given role and resource.
+// CheckPermissions decides what the roles may do on the resource: Allow holds the permissions granted
+// and Deny those a rule refuses (see rbac.Evaluate).
 func (s *DatabaseService) CheckPermissions(roleCodes []string, resourceCode string) (userRegistration.Permissions, error) {
-	var allPermissions []userRegistration.Permissions // Slice to hold permissions from all roles
-	var aggregatedPermissions userRegistration.Permissions
-
-	// Iterate over all role codes to accumulate permissions
-	for _, roleCode := range roleCodes {
-		var roleResourcePermission userRegistration.RoleResourcePermission
-
-		// Query to get the explicit permissions
-		if err := s.db.Raw(
-			`SELECT permissions
-            FROM role_resource_permissions
-            WHERE role_code = ? AND resource_code = ?`, roleCode, resourceCode).Scan(&roleResourcePermission).Error; err != nil {
-			return aggregatedPermissions, err
-		}
-
-		// Append explicit permissions to the slice
-		allPermissions = append(allPermissions, roleResourcePermission.Permissions)
-
-		// Query to get the wildcard permissions
-		var wildCardResourcePermissions userRegistration.RoleWildCardPermission
-		if err := s.db.Raw(
-			`SELECT permissions
-            FROM role_wild_card_permissions
-            WHERE role_code = ? AND resource_code = ?`, roleCode, resourceCode).Scan(&wildCardResourcePermissions).Error; err != nil {
-			return aggregatedPermissions, err
-		}
-
-		// Append wildcard permissions to the slice
-		allPermissions = append(allPermissions, wildCardResourcePermissions.Permissions)
+	decision, err := rbac.Decide(s.db, roleCodes, resourceCode)
+	if err != nil {
+		return userRegistration.Permissions{}, err
 	}
-
-	// Aggregate the permissions across all roles (using OR logic to combine)
-	for _, permissions := range allPermissions {
-		aggregatedPermissions.Allow.R = aggregatedPermissions.Allow.R || permissions.Allow.R
-		aggregatedPermissions.Allow.W = aggregatedPermissions.Allow.W || permissions.Allow.W
-		aggregatedPermissions.Allow.X = aggregatedPermissions.Allow.X || permissions.Allow.X
-		aggregatedPermissions.Allow.D = aggregatedPermissions.Allow.D || permissions.Allow.D
-
-		// Aggregate Deny permissions if needed
-		aggregatedPermissions.Deny.R = aggregatedPermissions.Deny.R || permissions.Deny.R
-		aggregatedPermissions.Deny.W = aggregatedPermissions.Deny.W || permissions.Deny.W
-		aggregatedPermissions.Deny.X = aggregatedPermissions.Deny.X || permissions.Deny.X
-		aggregatedPermissions.Deny.D = aggregatedPermissions.Deny.D || permissions.Deny.D
-	}
-
-	// Print the final aggregated permissions
-	fmt.Printf("Aggregated Permissions: %+v\n", aggregatedPermissions)
-
-	// Return the aggregated permissions
-	return aggregatedPermissions, nil
+	return decision.Permissions, nil
 }
 
 func PermissionMiddleware(service *DatabaseService, resourceCode string, requestedPerms []string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		roles := getRolesFromRequest(c)
+		roles := RolesFromRequest(c)
 
 		// Check if requested permissions are empty
 		if len(requestedPerms) == 0 {
@@ -171,7 +193,7 @@ func RequireGroupMembership(allowedGroups ...string) fiber.Handler {
 	}
 
 	return func(c *fiber.Ctx) error {
-		userRoles := getRolesFromRequest(c)
+		userRoles := RolesFromRequest(c)
 		if len(userRoles) == 0 {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "No roles found in session",
@@ -194,28 +216,46 @@ func RequireGroupMembership(allowedGroups ...string) fiber.Handler {
 	}
 }
 
-func getRolesFromRequest(c *fiber.Ctx) []string {
-	// Get the session object from Locals (assuming it's stored there)
-	session, ok := c.Locals("session").(*session.Session)
-	if !ok || session == nil {
-		return nil // No session available
+// RolesFromRequest reads the roles claim of the JWT Protected verified and left in c.Locals("user").
+// The session is not used: API clients send the bearer token without the session cookie, and the
+// token cannot be altered by the client.
+func RolesFromRequest(c *fiber.Ctx) []string {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok || !token.Valid {
+		return nil
 	}
-
-	// Get the roles from the session, assuming roles are stored as a slice in the session
-	rolesInterface := session.Get("roles")
-	if rolesInterface == nil {
-		return nil // No roles available
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
 	}
-
-	// If roles are stored as a slice of strings
-	roles, ok := rolesInterface.([]string)
+	list, ok := claims["roles"].([]interface{})
 	if !ok {
-		return nil // Roles aren't in the expected format
+		return nil
+	}
+	roles := make([]string, 0, len(list))
+	for _, role := range list {
+		if code, ok := role.(string); ok {
+			roles = append(roles, code)
+		}
 	}
-
 	return roles
 }
 
+// MustChangePassword reports whether the JWT Protected verified was issued to a user who has to change
+// their password first
+func MustChangePassword(c *fiber.Ctx) bool {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok || !token.Valid {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	must, _ := claims["must_change_password"].(bool)
+	return must
+}
+
 // func GetUserAndCompanyFromSession(c *fiber.Ctx) (uint, uint, error) {
 // 	// Get user from JWT claims (Fiber's JWT middleware usually sets this in Locals)
 // 	userClaims := c.Locals("user")
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"car-bond/internals/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Export serves list endpoints as a file when ?export=xlsx|csv is given. The endpoint runs as usual,
+// with the same filters, while utils.Paginate writes all matching rows (no page limit) to the file;
+// ?columns=chasis_number,make,bid_price picks the columns.
+func Export() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet || c.Query("export") == "" {
+			return c.Next()
+		}
+
+		export, err := utils.NewExport(c.Query("export"), c.Query("columns"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+		defer export.Close()
+		c.Locals(utils.ExportLocalsKey, export)
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if errors.Is(export.Err(), utils.ErrExportColumns) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": export.Err().Error(), "data": nil})
+		}
+		if c.Response().StatusCode() >= fiber.StatusBadRequest {
+			return nil // the handler already answered with an error
+		}
+		if !export.Used() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "This endpoint cannot be exported", "data": nil})
+		}
+
+		file, size, err := export.Finish()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to build export", "data": err.Error()})
+		}
+
+		name := strings.ReplaceAll(strings.Trim(strings.TrimPrefix(c.Path(), "/api"), "/"), "/", "-")
+		c.Response().ResetBody()
+		c.Status(fiber.StatusOK)
+		c.Set(fiber.HeaderContentType, export.ContentType())
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("20060102"), export.Format))
+		c.Response().SetBodyStream(file, int(size))
+		return nil
+	}
+}
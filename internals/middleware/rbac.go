@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RoutePermission is what a route needs: a permission (R, W, X or D) on a resource. Perm defaults to
+// the one of the HTTP method; a Public route needs no token at all and an Authenticated one any valid
+// token, whatever its roles.
+type RoutePermission struct {
+	Method        string
+	Path          string
+	Resource      string
+	Perm          string
+	Public        bool
+	Authenticated bool
+}
+
+// open reports whether the route needs no permission
+func (p RoutePermission) open() bool {
+	return p.Public || p.Authenticated
+}
+
+// MethodPermission is the permission an HTTP method needs when the route does not say otherwise
+func MethodPermission(method string) string {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return "R"
+	case fiber.MethodDelete:
+		return "D"
+	}
+	return "W"
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// PermissionTable looks routes up by method and path, as registered
+type PermissionTable map[string]RoutePermission
+
+// NewPermissionTable indexes the route permissions and fills in the permission of each method
+func NewPermissionTable(entries []RoutePermission) (PermissionTable, error) {
+	table := make(PermissionTable, len(entries))
+	for _, entry := range entries {
+		key := routeKey(entry.Method, entry.Path)
+		if _, ok := table[key]; ok {
+			return nil, fmt.Errorf("route %s has two permission entries", key)
+		}
+		if !entry.open() {
+			if entry.Resource == "" {
+				return nil, fmt.Errorf("route %s has no resource", key)
+			}
+			if entry.Perm == "" {
+				entry.Perm = MethodPermission(entry.Method)
+			}
+			if !strings.Contains("RWXD", entry.Perm) || len(entry.Perm) != 1 {
+				return nil, fmt.Errorf("route %s asks for unknown permission %q", key, entry.Perm)
+			}
+		}
+		table[key] = entry
+	}
+	return table, nil
+}
+
+// Resources lists the resources the table refers to
+func (t PermissionTable) Resources() []string {
+	seen := make(map[string]bool)
+	var resources []string
+	for _, entry := range t {
+		if !entry.open() && !seen[entry.Resource] {
+			seen[entry.Resource] = true
+			resources = append(resources, entry.Resource)
+		}
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// Check makes sure every route of the app has an entry and every entry a route, so a new route cannot
+// go live without a permission
+func (t PermissionTable) Check(routes []fiber.Route) error {
+	registered := make(map[string]bool)
+	var missing []string
+	for _, route := range routes {
+		if route.Method == fiber.MethodHead {
+			continue // added with every GET
+		}
+		key := routeKey(route.Method, route.Path)
+		if registered[key] {
+			continue
+		}
+		registered[key] = true
+		if _, ok := t[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+
+	var stale []string
+	for key := range t {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+
+	if len(missing) == 0 && len(stale) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "routes without a permission entry: "+strings.Join(missing, ", "))
+	}
+	if len(stale) > 0 {
+		problems = append(problems, "permission entries without a route: "+strings.Join(stale, ", "))
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
+
+// Authorize checks the roles of the token Protected verified against the permission the matched route
+// needs in the table. It goes after Protected on each route. A token that must change its password is
+// limited to the Public and Authenticated routes.
+func Authorize(service *DatabaseService, table PermissionTable) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		route := c.Route()
+		entry, ok := table[routeKey(route.Method, route.Path)]
+		if !ok {
+			// The startup check makes this unreachable; refuse rather than let a route through unchecked
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": "No permission is defined for this route",
+			})
+		}
+		if entry.open() {
+			return c.Next()
+		}
+		// A user who must change their password only gets the routes any token may use until they do
+		if MustChangePassword(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Password change required: set a new password with PUT /api/user/me/password",
+			})
+		}
+
+		roles := RolesFromRequest(c)
+		if len(roles) == 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Access denied: the token carries no roles",
+			})
+		}
+
+		permissions, err := service.CheckPermissions(roles, entry.Resource)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Cannot check permissions",
+				"data":    err.Error(),
+			})
+		}
+
+		allowed := false
+		switch entry.Perm {
+		case "R":
+			allowed = permissions.Allow.R
+		case "W":
+			allowed = permissions.Allow.W
+		case "X":
+			allowed = permissions.Allow.X
+		case "D":
+			allowed = permissions.Allow.D
+		}
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Access denied: %s permission on %s is required", entry.Perm, entry.Resource),
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"car-bond/internals/tenant"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Tenant answers 403 Forbidden when a request failed because a write would have touched another
+// company. Handlers report that like any database error, so the refusal is read back from the context.
+func Tenant() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(tenant.TrackRefusals(c.UserContext()))
+		err := c.Next()
+		failed := err != nil || c.Response().StatusCode() >= fiber.StatusInternalServerError
+		if errors.Is(err, tenant.ErrOtherCompany) || (failed && tenant.Refused(c.UserContext())) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": tenant.ErrOtherCompany.Error(),
+				"data":    nil,
+			})
+		}
+		return err
+	}
+}
@@ -0,0 +1,26 @@
+package alertRegistration
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditLog records one write to one record: the values created, the fields changed (with their old
+// and new values) or the values deleted. Rows are never updated or deleted.
+type AuditLog struct {
+	ID        uint            `gorm:"primarykey" json:"id"`
+	Table     string          `gorm:"column:table_name;size:100;not null;index:idx_audit_table_record" json:"table"`
+	RecordID  string          `gorm:"size:100;index:idx_audit_table_record" json:"record_id"`
+	Operation string          `gorm:"size:10;not null" json:"operation"` // create, update, delete
+	Changes   json.RawMessage `gorm:"type:jsonb" json:"changes"`
+	UserID    uint            `gorm:"index" json:"user_id"`
+	Username  string          `gorm:"size:100;index" json:"username"`
+	RequestID string          `gorm:"size:64;index" json:"request_id"`
+	CreatedAt time.Time       `gorm:"index" json:"created_at"`
+}
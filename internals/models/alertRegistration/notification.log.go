@@ -0,0 +1,29 @@
+package alertRegistration
+
+import (
+	"car-bond/internals/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	NotificationStatusSent   = "Sent"
+	NotificationStatusFailed = "Failed"
+)
+
+// NotificationLog records every payment reminder dispatched, one row per sale, due date and channel
+type NotificationLog struct {
+	gorm.Model
+	SaleID        uint        `gorm:"not null;uniqueIndex:idx_notification_sale_due_channel" json:"sale_id"`
+	DueDate       string      `gorm:"type:date;not null;uniqueIndex:idx_notification_sale_due_channel" json:"due_date"`
+	Channel       string      `gorm:"size:20;not null;uniqueIndex:idx_notification_sale_due_channel" json:"channel"`
+	InstallmentNo *int        `json:"installment_no"`
+	Recipient     string      `gorm:"size:255" json:"recipient"`
+	Message       string      `gorm:"type:text" json:"message"`
+	AmountDue     money.Money `gorm:"type:numeric(18,2)" json:"amount_due"`
+	Status        string      `gorm:"size:20;not null" json:"status"` // Sent, Failed
+	Error         string      `gorm:"type:text" json:"error"`
+	Attempts      int         `gorm:"not null;default:0" json:"attempts"`
+	SentAt        time.Time   `json:"sent_at"`
+}
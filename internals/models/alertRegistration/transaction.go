@@ -27,6 +27,13 @@ func (t *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
 		t.Description = fmt.Sprintf("Car %s is stored at the facility.", t.CarChasisNumber)
 	case "Sold":
 		t.Description = fmt.Sprintf("Car %s has been sold.", t.CarChasisNumber)
+	case "FullyPaid":
+		t.Description = fmt.Sprintf("Car %s has been fully paid.", t.CarChasisNumber)
+	case "Voyage":
+		// Voyage milestones describe where the car is themselves
+		if t.Description == "" {
+			t.Description = fmt.Sprintf("Car %s has a new voyage milestone.", t.CarChasisNumber)
+		}
 	default:
 		t.Description = "Transaction type not recognized."
 	}
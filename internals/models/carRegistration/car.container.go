@@ -0,0 +1,52 @@
+package carRegistration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Container types, by ISO size/type code
+const (
+	ContainerType20GP = "20GP"
+	ContainerType40GP = "40GP"
+	ContainerType40HC = "40HC"
+	ContainerTypeRoRo = "RoRo" // driven on board, no box
+)
+
+// Voyage milestones, in the order a shipment normally reaches them
+const (
+	MilestoneLoaded        = "loaded"
+	MilestoneDeparted      = "departed"
+	MilestoneTransshipment = "transshipment"
+	MilestoneArrivedPort   = "arrived_port" // Mombasa or Dar es Salaam, in Location
+	MilestoneReleased      = "released"
+	MilestoneArrivedYard   = "arrived_yard"
+)
+
+// ShippingContainer is a container booked on a shipping invoice; cars are assigned to it
+type ShippingContainer struct {
+	gorm.Model
+	CarShippingInvoiceID uint   `gorm:"not null;index" json:"car_shipping_invoice_id"`
+	ContainerNo          string `gorm:"size:20;not null;index" json:"container_no"`
+	SealNo               string `gorm:"size:50" json:"seal_no"`
+	Type                 string `gorm:"size:10" json:"type"`
+	CreatedBy            string `gorm:"size:100" json:"created_by"`
+	UpdatedBy            string `gorm:"size:100" json:"updated_by"`
+
+	Cars []Car `gorm:"foreignKey:ContainerID;constraint:OnDelete:SET NULL" json:"cars,omitempty"`
+}
+
+// VoyageMilestone records where a shipment (or one of its containers) was at a point in time
+type VoyageMilestone struct {
+	gorm.Model
+	CarShippingInvoiceID uint      `gorm:"not null;index" json:"car_shipping_invoice_id"`
+	ContainerID          *uint     `gorm:"index" json:"container_id"` // nil for the whole shipment
+	Milestone            string    `gorm:"size:30;not null" json:"milestone"`
+	Location             string    `gorm:"size:100" json:"location"`
+	OccurredAt           time.Time `gorm:"not null;index" json:"occurred_at"`
+	ETA                  *string   `gorm:"type:date" json:"eta"` // arrival expected at the time of the milestone
+	Remarks              string    `json:"remarks"`
+	CreatedBy            string    `gorm:"size:100" json:"created_by"`
+	UpdatedBy            string    `gorm:"size:100" json:"updated_by"`
+}
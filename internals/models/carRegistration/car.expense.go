@@ -1,22 +1,26 @@
 package carRegistration
 
 import (
+	"car-bond/internals/money"
+
 	"gorm.io/gorm"
 )
 
 type CarExpense struct {
 	gorm.Model
-	CarID         uint    `json:"car_id"`
-	Description   string  `json:"description"`
-	Currency      string  `json:"currency"`
-	Amount        float64 `json:"amount"`
-	DollarRate    float64 `json:"dollar_rate"`
-	ExpenseDate   string  `gorm:"type:date" json:"expense_date"`
-	Destination   string  `json:"destination"`
-	CompanyName   string  `json:"company_name"`
-	ExpenseVAT    float64 `json:"expense_vat"`
-	ExpenseRemark string  `json:"expense_remark"`
-	CreatedBy     string  `json:"created_by"`
-	UpdatedBy     string  `json:"updated_by"`
-	Car           Car     `gorm:"foreignKey:CarID;references:ID;constraint:OnDelete:CASCADE" json:"car"`
+	CarID         uint        `json:"car_id"`
+	Description   string      `json:"description"`
+	Currency      string      `json:"currency"`
+	Amount        money.Money `gorm:"type:numeric(18,2)" json:"amount"`
+	DollarRate    money.Money `gorm:"type:numeric(18,6)" json:"dollar_rate"`
+	ExpenseDate   string      `gorm:"type:date" json:"expense_date"`
+	Destination   string      `json:"destination"`
+	CompanyName   string      `json:"company_name"`
+	ExpenseVAT    money.Money `gorm:"type:numeric(18,6)" json:"expense_vat"`
+	ExpenseRemark string      `json:"expense_remark"`
+	// Set on the rows generated by shipping cost allocation
+	CarShippingInvoiceID *uint  `gorm:"index" json:"car_shipping_invoice_id"`
+	CreatedBy            string `json:"created_by"`
+	UpdatedBy            string `json:"updated_by"`
+	Car                  Car    `gorm:"foreignKey:CarID;references:ID;constraint:OnDelete:CASCADE" json:"car"`
 }
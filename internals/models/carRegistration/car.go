@@ -3,6 +3,7 @@ package carRegistration
 import (
 	"car-bond/internals/models/companyRegistration"
 	"car-bond/internals/models/customerRegistration"
+	"car-bond/internals/money"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -43,8 +44,8 @@ type Car struct {
 	SimpleWheel           bool                         `gorm:"default:false" json:"simple_wheel"`
 	Navigation            bool                         `gorm:"default:false" json:"navigation"`
 	AC                    bool                         `gorm:"default:false" json:"ac"`
-	BidPrice              float64                      `gorm:"type:numeric;" json:"bid_price"`
-	VATTax                float64                      `gorm:"type:numeric;" json:"vat_tax"`
+	BidPrice              money.Money                  `gorm:"type:numeric(18,2);" json:"bid_price"`
+	VATTax                money.Money                  `gorm:"type:numeric(18,6);" json:"vat_tax"`
 	PurchaseDate          string                       `gorm:"type:date;not null" json:"purchase_date"`
 	FromCompanyID         *uint                        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"from_company_id"`
 	FromCompany           *companyRegistration.Company `gorm:"foreignKey:FromCompanyID;references:ID" json:"from_company"`
@@ -55,6 +56,7 @@ type Car struct {
 	Port                  string                       `json:"port"`
 	CarShippingInvoiceID  *uint                        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"car_shipping_invoice_id"`
 	CarShippingInvoice    *CarShippingInvoice          `gorm:"foreignKey:CarShippingInvoiceID" json:"car_shipping_invoice"`
+	ContainerID           *uint                        `gorm:"index;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"container_id"`
 	CarStatusJapan        string                       `json:"car_status_japan"` // InStock, Sold, Exported
 	// Uganda Edits
 	BrokerName       string                         `json:"broker_name"`
@@ -83,10 +85,10 @@ func (car *Car) BeforeCreate(tx *gorm.DB) (err error) {
 	car.CarUUID = uuid.New()
 	// If ToCompanyID is not nil and not zero, mark as Exported; otherwise, InStock.
 	if car.ToCompanyID != nil && *car.ToCompanyID > 0 {
-		car.CarStatusJapan = "Exported"
-		car.CarStatus = "InTransit"
+		car.CarStatusJapan = JapanExported
+		car.CarStatus = StatusInTransit
 	} else {
-		car.CarStatusJapan = "InStock"
+		car.CarStatusJapan = JapanInStock
 	}
 
 	// Set OtherEntity to ToCompany.Name if it's empty and ToCompanyID is valid
@@ -1,6 +1,17 @@
 package carRegistration
 
-import "gorm.io/gorm"
+import (
+	"car-bond/internals/money"
+
+	"gorm.io/gorm"
+)
+
+// How the costs of a shipping invoice are split across its cars
+const (
+	AllocationEqual  = "equal"
+	AllocationWeight = "weight"
+	AllocationVolume = "volume" // Length x Width x Height
+)
 
 // CustomerScan represents a scan or photo associated with a car
 type CarShippingInvoice struct {
@@ -13,7 +24,18 @@ type CarShippingInvoice struct {
 	CreatedBy    string `gorm:"size:100" json:"created_by"`
 	UpdatedBy    string `gorm:"size:100" json:"updated_by"`
 
+	// Costs split across the cars as CarExpense rows
+	Currency         string      `gorm:"size:10;default:USD" json:"currency"`
+	FreightCost      money.Money `gorm:"type:numeric(18,2);default:0" json:"freight_cost"`
+	InsuranceCost    money.Money `gorm:"type:numeric(18,2);default:0" json:"insurance_cost"`
+	PortCharges      money.Money `gorm:"type:numeric(18,2);default:0" json:"port_charges"`
+	AllocationMethod string      `gorm:"size:20" json:"allocation_method"` // equal, weight, volume; empty until allocated
+
 	Locked bool `gorm:"default:false" json:"locked"` // ← Add this
 
+	// Tracking, kept up to date by the voyage milestones
+	ETA      *string `gorm:"type:date" json:"eta"`
+	Position string  `gorm:"size:150" json:"position"` // latest milestone and location
+
 	Cars []Car `gorm:"foreignKey:CarShippingInvoiceID" json:"cars"`
 }
@@ -0,0 +1,209 @@
+package carRegistration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The three status columns of a car
+const (
+	StatusFieldJapan   = "car_status_japan"
+	StatusFieldCar     = "car_status"
+	StatusFieldPayment = "car_payment_status"
+)
+
+const (
+	// car_status_japan
+	JapanInStock  = "InStock"
+	JapanSold     = "Sold"
+	JapanExported = "Exported"
+
+	// car_status
+	StatusInTransit = "InTransit"
+	StatusInStock   = "InStock"
+	StatusSold      = "Sold"
+
+	// car_payment_status
+	PaymentBooked        = "Booked"
+	PaymentPartiallyPaid = "Partially Paid"
+	PaymentFullyPaid     = "Fully Payed"
+)
+
+var (
+	ErrUnknownStatusField = errors.New("unknown car status field")
+	ErrUnknownStatus      = errors.New("unknown car status")
+	ErrIllegalTransition  = errors.New("illegal car status transition")
+)
+
+// carTransitions lists, per status column, the states a car may move to from each state. "" is a car
+// without a status yet (or with a value from before the states were enforced).
+var carTransitions = map[string]map[string][]string{
+	StatusFieldJapan: {
+		"":            {JapanInStock, JapanExported, JapanSold},
+		JapanInStock:  {JapanExported, JapanSold},
+		JapanExported: {JapanInStock}, // export cancelled
+		JapanSold:     {JapanInStock}, // auction sale reversed
+	},
+	StatusFieldCar: {
+		"":              {StatusInTransit, StatusInStock, StatusSold},
+		StatusInTransit: {StatusInStock, StatusSold}, // selling in transit needs AllowInTransitSale
+		StatusInStock:   {StatusSold},
+		StatusSold:      {StatusInStock}, // sale deleted
+	},
+	StatusFieldPayment: {
+		"":                   {PaymentBooked, PaymentPartiallyPaid, PaymentFullyPaid},
+		PaymentBooked:        {PaymentPartiallyPaid, PaymentFullyPaid, ""},
+		PaymentPartiallyPaid: {PaymentBooked, PaymentFullyPaid, ""},
+		PaymentFullyPaid:     {PaymentBooked, PaymentPartiallyPaid, ""}, // payment removed or sale deleted
+	},
+}
+
+// CarStatusHistory records every status change of a car
+type CarStatusHistory struct {
+	gorm.Model
+	CarID      uint      `gorm:"not null;index" json:"car_id"`
+	Field      string    `gorm:"size:30;not null" json:"field"`
+	FromStatus string    `gorm:"size:30" json:"from_status"`
+	ToStatus   string    `gorm:"size:30" json:"to_status"`
+	Reason     string    `gorm:"size:255" json:"reason"`
+	ChangedBy  string    `gorm:"size:100" json:"changed_by"`
+	ChangedAt  time.Time `gorm:"not null;index" json:"changed_at"`
+}
+
+// StatusChange asks for a car to move to a new state
+type StatusChange struct {
+	Field              string `json:"field"`
+	To                 string `json:"to"`
+	Reason             string `json:"reason"`
+	By                 string `json:"by"`
+	AllowInTransitSale bool   `json:"allow_in_transit_sale"`
+}
+
+// StatusTransitions returns the allowed transitions of every status column
+func StatusTransitions() map[string]map[string][]string {
+	return carTransitions
+}
+
+// CanonicalStatus matches a stored status ignoring case and spaces ("In stock" is InStock); values
+// outside the machine count as ""
+func CanonicalStatus(field, status string) string {
+	status = strings.ReplaceAll(status, " ", "")
+	for state := range carTransitions[field] {
+		if strings.EqualFold(strings.ReplaceAll(state, " ", ""), status) {
+			return state
+		}
+	}
+	return ""
+}
+
+// CheckTransition tells whether a car may move from one state to another
+func CheckTransition(field, from, to string, allowInTransitSale bool) error {
+	transitions, ok := carTransitions[field]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownStatusField, field)
+	}
+	target := CanonicalStatus(field, to)
+	if target == "" && strings.TrimSpace(to) != "" {
+		return fmt.Errorf("%w %q for %s", ErrUnknownStatus, to, field)
+	}
+
+	current := CanonicalStatus(field, from)
+	if current == target {
+		return nil
+	}
+	if field == StatusFieldCar && current == StatusInTransit && target == StatusSold && !allowInTransitSale {
+		return fmt.Errorf("%w: car is still in transit; set allow_in_transit_sale to sell it", ErrIllegalTransition)
+	}
+	for _, allowed := range transitions[current] {
+		if allowed == target {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s cannot go from %q to %q", ErrIllegalTransition, field, from, to)
+}
+
+func statusValue(car *Car, field string) string {
+	switch field {
+	case StatusFieldJapan:
+		return car.CarStatusJapan
+	case StatusFieldCar:
+		return car.CarStatus
+	case StatusFieldPayment:
+		return car.CarPaymentStatus
+	}
+	return ""
+}
+
+func setStatusValue(car *Car, field, value string) {
+	switch field {
+	case StatusFieldJapan:
+		car.CarStatusJapan = value
+	case StatusFieldCar:
+		car.CarStatus = value
+	case StatusFieldPayment:
+		car.CarPaymentStatus = value
+	}
+}
+
+// ChangeCarStatus moves a car to a new state inside tx: it locks the car, checks the transition,
+// updates the column and records the change. Moving to the current state does nothing.
+func ChangeCarStatus(tx *gorm.DB, carID uint, change StatusChange) (*Car, error) {
+	var car Car
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&car, carID).Error; err != nil {
+		return nil, err
+	}
+	return &car, applyStatusChange(tx, &car, change)
+}
+
+func applyStatusChange(tx *gorm.DB, car *Car, change StatusChange) error {
+	from := statusValue(car, change.Field)
+	if err := CheckTransition(change.Field, from, change.To, change.AllowInTransitSale); err != nil {
+		return err
+	}
+	to := CanonicalStatus(change.Field, change.To)
+	if from == to {
+		return nil
+	}
+
+	if err := tx.Model(&Car{}).Where("id = ?", car.ID).
+		Updates(map[string]interface{}{change.Field: to, "updated_by": change.By}).Error; err != nil {
+		return fmt.Errorf("failed to update %s: %w", change.Field, err)
+	}
+	setStatusValue(car, change.Field, to)
+	car.UpdatedBy = change.By
+
+	return recordStatusChange(tx, car.ID, change.Field, from, to, change.Reason, change.By)
+}
+
+func recordStatusChange(tx *gorm.DB, carID uint, field, from, to, reason, by string) error {
+	history := CarStatusHistory{
+		CarID:      carID,
+		Field:      field,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		ChangedBy:  by,
+		ChangedAt:  time.Now(),
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return fmt.Errorf("failed to record status history: %w", err)
+	}
+	return nil
+}
+
+// AfterCreate records the states a car starts in
+func (car *Car) AfterCreate(tx *gorm.DB) (err error) {
+	for _, field := range []string{StatusFieldJapan, StatusFieldCar, StatusFieldPayment} {
+		if status := statusValue(car, field); status != "" {
+			if err := recordStatusChange(tx, car.ID, field, "", status, "Car registered", car.CreatedBy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,15 +1,16 @@
 package companyRegistration
 
 import (
+	"car-bond/internals/money"
 	"gorm.io/gorm"
 )
 
 type CompanyExpense struct {
 	gorm.Model
-	CompanyID   uint    `json:"company_id"`
-	Description string  `json:"description"`
-	Currency    string  `json:"currency"`
-	Amount      float64 `json:"amount"`
+	CompanyID   uint        `json:"company_id"`
+	Description string      `json:"description"`
+	Currency    string      `json:"currency"`
+	Amount      money.Money `gorm:"type:numeric(18,2)" json:"amount"`
 	// DollarRate  float64 `json:"dollar_rate"`
 	ExpenseDate string  `gorm:"type:date" json:"expense_date"`
 	CreatedBy   string  `json:"created_by"`
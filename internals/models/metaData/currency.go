@@ -6,6 +6,7 @@ type Currency struct {
 	gorm.Model
 	Name      string `json:"name"`
 	Symbol    string `json:"symbol"`
+	Code      string `gorm:"size:3;index" json:"code"` // ISO 4217 code used by exchange rates
 	CreatedBy string `json:"created_by"`
 	UpdatedBy string `json:"updated_by"`
 }
@@ -0,0 +1,47 @@
+package metaData
+
+import (
+	"car-bond/internals/money"
+
+	"gorm.io/gorm"
+)
+
+// Tax lines of the import duty estimator
+const (
+	DutyTaxImportDuty         = "import_duty"
+	DutyTaxVAT                = "vat"
+	DutyTaxWithholding        = "withholding_tax"
+	DutyTaxEnvironmentalLevy  = "environmental_levy"
+	DutyTaxInfrastructureLevy = "infrastructure_levy"
+	DutyTaxRegistration       = "registration_fee"
+)
+
+// What a percentage rate is applied to
+const (
+	DutyBasisCIF     = "cif"      // customs value
+	DutyBasisCIFDuty = "cif_duty" // customs value plus import duty, the VAT base
+)
+
+// DutyRate is one line of the rate tables used by the duty estimator. Percentage lines apply Rate
+// to their Basis, fixed lines (registration fees) charge Amount in UGX. MinAge and MaxAge limit a
+// line to vehicles of that age in years; a MaxAge of 0 means no upper limit.
+type DutyRate struct {
+	gorm.Model
+	Tax         string      `gorm:"size:50;not null;index" json:"tax"`
+	Description string      `gorm:"size:100;not null" json:"description"`
+	Basis       string      `gorm:"size:20" json:"basis"`
+	Rate        money.Money `gorm:"type:numeric(18,6);default:0" json:"rate"`   // percent
+	Amount      money.Money `gorm:"type:numeric(18,2);default:0" json:"amount"` // fixed fee in UGX
+	MinAge      int         `gorm:"default:0" json:"min_age"`
+	MaxAge      int         `gorm:"default:0" json:"max_age"`
+	CreatedBy   string      `gorm:"size:100" json:"created_by"`
+	UpdatedBy   string      `gorm:"size:100" json:"updated_by"`
+}
+
+// AppliesToAge reports whether the line is charged on a vehicle of the given age
+func (r *DutyRate) AppliesToAge(age int) bool {
+	if age < r.MinAge {
+		return false
+	}
+	return r.MaxAge == 0 || age <= r.MaxAge
+}
@@ -0,0 +1,20 @@
+package metaData
+
+import (
+	"car-bond/internals/money"
+
+	"gorm.io/gorm"
+)
+
+// ExchangeRate says that on RateDate one unit of BaseCurrency was worth Rate units of QuoteCurrency.
+// A pair has one live rate per date; a deleted rate can be entered again.
+type ExchangeRate struct {
+	gorm.Model
+	BaseCurrency  string      `gorm:"size:3;not null;uniqueIndex:idx_exchange_rate_pair_date,where:deleted_at IS NULL" json:"base_currency"`
+	QuoteCurrency string      `gorm:"size:3;not null;uniqueIndex:idx_exchange_rate_pair_date" json:"quote_currency"`
+	RateDate      string      `gorm:"type:date;not null;uniqueIndex:idx_exchange_rate_pair_date" json:"rate_date"`
+	Rate          money.Money `gorm:"type:numeric(20,10);not null" json:"rate"`
+	Source        string      `gorm:"size:100" json:"source"`
+	CreatedBy     string      `gorm:"size:100" json:"created_by"`
+	UpdatedBy     string      `gorm:"size:100" json:"updated_by"`
+}
@@ -1,16 +1,33 @@
 package metaData
 
 import (
+	"car-bond/internals/money"
+
 	"gorm.io/gorm"
 )
 
 type VehicleEvaluation struct {
 	gorm.Model
-	HSCCode     string  `json:"hsc_code"`
-	COO         string  `json:"coo"`
-	Description string  `gorm:"size:100;not null" json:"description"`
-	CC          string  `gorm:"size:50" json:"cc"`
-	CIF         float64 `gorm:"not null" json:"cif"`
-	CreatedBy   string  `json:"created_by"`
-	UpdatedBy   string  `json:"updated_by"`
+	VersionID   *uint       `gorm:"index" json:"version_id"`
+	HSCCode     string      `json:"hsc_code"`
+	COO         string      `json:"coo"`
+	Description string      `gorm:"size:100;not null" json:"description"`
+	CC          string      `gorm:"size:50" json:"cc"`
+	CIF         money.Money `gorm:"type:numeric(18,2);not null" json:"cif"`
+	CreatedBy   string      `json:"created_by"`
+	UpdatedBy   string      `json:"updated_by"`
+}
+
+// VehicleEvaluationVersion is one upload of the URA valuation sheet. The rows of a version apply
+// from its EffectiveDate until the next version takes effect.
+type VehicleEvaluationVersion struct {
+	gorm.Model
+	VersionNo     int    `gorm:"not null;uniqueIndex" json:"version_no"`
+	FileName      string `gorm:"size:255" json:"file_name"`
+	Checksum      string `gorm:"size:64;index" json:"checksum"` // SHA-256 of the uploaded file
+	EffectiveDate string `gorm:"type:date;not null;index" json:"effective_date"`
+	RowCount      int    `json:"row_count"`
+	UploadedBy    string `gorm:"size:100" json:"uploaded_by"`
+	CreatedBy     string `gorm:"size:100" json:"created_by"`
+	UpdatedBy     string `gorm:"size:100" json:"updated_by"`
 }
@@ -3,6 +3,8 @@ package saleRegistration
 import (
 	"car-bond/internals/models/carRegistration"
 	"car-bond/internals/models/companyRegistration"
+	"car-bond/internals/money"
+	"fmt"
 
 	"gorm.io/gorm"
 )
@@ -15,17 +17,20 @@ type SaleAuction struct {
 	Company            companyRegistration.Company `gorm:"foreignKey:CompanyID"`
 	AuctionUserCompany string                      `gorm:"size:100" json:"auction_user_company"`
 	SaleDate           string                      `gorm:"type:date" json:"sale_date"`
-	Price              float64                     `json:"price"`
-	VATTax             float64                     `json:"vat_tax"`
-	RecycleFee         float64                     `json:"recycle_fee"`
+	Price              money.Money                 `gorm:"type:numeric(18,2)" json:"price"`
+	VATTax             money.Money                 `gorm:"type:numeric(18,6)" json:"vat_tax"`
+	RecycleFee         money.Money                 `gorm:"type:numeric(18,2)" json:"recycle_fee"`
 	CreatedBy          string                      `gorm:"size:100" json:"created_by"`
 	UpdatedBy          string                      `gorm:"size:100" json:"updated_by"`
 }
 
 func (s *SaleAuction) AfterCreate(tx *gorm.DB) (err error) {
 	// Update the associated Car record: set CarStatusJapan to "Sold"
-	err = tx.Model(&carRegistration.Car{}).
-		Where("id = ?", s.CarID).
-		Update("car_status_japan", "Sold").Error
+	_, err = carRegistration.ChangeCarStatus(tx, uint(s.CarID), carRegistration.StatusChange{
+		Field:  carRegistration.StatusFieldJapan,
+		To:     carRegistration.JapanSold,
+		Reason: fmt.Sprintf("Sold at auction (auction sale %d)", s.ID),
+		By:     s.CreatedBy,
+	})
 	return
 }
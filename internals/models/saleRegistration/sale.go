@@ -4,14 +4,16 @@ import (
 	"car-bond/internals/models/carRegistration"
 	"car-bond/internals/models/companyRegistration"
 	"car-bond/internals/models/customerRegistration"
+	"car-bond/internals/money"
 
 	"gorm.io/gorm"
 )
 
 type Sale struct {
 	gorm.Model
-	TotalPrice    float64                       `gorm:"type:numeric;not null" json:"total_price"`
-	DollarRate    float64                       `json:"dollar_rate"`
+	TotalPrice    money.Money                   `gorm:"type:numeric(18,2);not null" json:"total_price"`
+	Currency      string                        `gorm:"size:10;default:UGX" json:"currency"`
+	DollarRate    money.Money                   `gorm:"type:numeric(18,6)" json:"dollar_rate"`
 	SaleDate      string                        `gorm:"type:date;not null" json:"sale_date"`
 	CarID         uint                          `gorm:"references:ID" json:"car_id"`
 	Car           carRegistration.Car           `gorm:"foreignKey:CarID"`
@@ -20,8 +22,11 @@ type Sale struct {
 	CustomerID    *uint                         `json:"customer_id"`
 	Customer      customerRegistration.Customer `gorm:"foreignKey:CustomerID"`
 	IsFullPayment bool                          `json:"is_full_payment"`
-	InitalPayment float64                       `json:"initial_payment"`
+	InitalPayment money.Money                   `gorm:"type:numeric(18,2)" json:"initial_payment"`
 	PaymentPeriod int                           `json:"payment_period"`
 	CreatedBy     string                        `gorm:"size:100" json:"created_by"`
 	UpdatedBy     string                        `gorm:"size:100" json:"updated_by"`
+
+	// AllowInTransitSale lets a car that is still in transit be sold; it is not stored
+	AllowInTransitSale bool `gorm:"-" json:"allow_in_transit_sale"`
 }
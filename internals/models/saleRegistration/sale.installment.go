@@ -0,0 +1,41 @@
+package saleRegistration
+
+import (
+	"car-bond/internals/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	InstallmentStatusPending = "Pending"
+	InstallmentStatusPartial = "Partial"
+	InstallmentStatusPaid    = "Paid"
+)
+
+type SaleInstallment struct {
+	gorm.Model
+	SaleID          uint        `gorm:"not null;index" json:"sale_id"`
+	Sale            Sale        `gorm:"foreignKey:SaleID;references:ID" json:"-"`
+	InstallmentNo   int         `gorm:"not null" json:"installment_no"` // 0 is the initial payment
+	DueDate         string      `gorm:"type:date;not null" json:"due_date"`
+	ExpectedAmount  money.Money `gorm:"type:numeric(18,2);not null" json:"expected_amount"`
+	AmountAllocated money.Money `gorm:"type:numeric(18,2);not null;default:0" json:"amount_allocated"`
+	Status          string      `gorm:"size:20;not null;default:Pending" json:"status"` // Pending, Partial, Paid
+	PaidDate        *string     `gorm:"type:date" json:"paid_date"`
+	IsOverdue       bool        `gorm:"-" json:"is_overdue"`
+	CreatedBy       string      `gorm:"size:100" json:"created_by"`
+	UpdatedBy       string      `gorm:"size:100" json:"updated_by"`
+}
+
+// Balance returns the amount still expected on this installment
+func (i *SaleInstallment) Balance() money.Money {
+	return money.Max(i.ExpectedAmount.Sub(i.AmountAllocated), money.Zero)
+}
+
+// AfterFind flags open installments whose due date has already passed
+func (i *SaleInstallment) AfterFind(tx *gorm.DB) (err error) {
+	i.IsOverdue = i.Status != InstallmentStatusPaid && len(i.DueDate) >= 10 &&
+		i.DueDate[:10] < time.Now().Format("2006-01-02")
+	return nil
+}
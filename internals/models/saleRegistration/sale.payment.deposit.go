@@ -1,6 +1,7 @@
 package saleRegistration
 
 import (
+	"car-bond/internals/money"
 	"gorm.io/gorm"
 )
 
@@ -9,7 +10,7 @@ type SalePaymentDeposit struct {
 	BankName        string      `json:"bank_name"`
 	BankAccount     string      `json:"bank_account"`
 	BankBranch      string      `json:"bank_branch"`
-	AmountDeposited float64     `json:"amount_deposited"`
+	AmountDeposited money.Money `gorm:"type:numeric(18,2)" json:"amount_deposited"`
 	DateDeposited   string      `gorm:"type:date" json:"date_deposited"`
 	DepositScan     string      `json:"deposit_scan"`
 	SalePaymentID   uint        `gorm:"references:ID" json:"sale_payment_id"`
@@ -0,0 +1,45 @@
+package userRegistration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is one refresh token handed out at login or refresh. Only the SHA-256 of the token is
+// kept. A token is used once: refreshing marks it used and issues the next one of the same family, so
+// a used token showing up again means it was stolen and the whole family is revoked.
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	FamilyID  string     `gorm:"size:36;not null;index" json:"family_id"`
+	AccessJTI string     `gorm:"size:36" json:"access_jti"` // the access token issued with it
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// RevokedToken denies access tokens before they expire: the one with JTI, or when JTI is empty every
+// token of the user issued before RevokedBefore. Rows are only needed until ExpiresAt, when the tokens
+// they deny have expired anyway.
+type RevokedToken struct {
+	gorm.Model
+	JTI           string    `gorm:"size:36;index" json:"jti"`
+	UserID        uint      `gorm:"not null;index" json:"user_id"`
+	RevokedBefore time.Time `json:"revoked_before"`
+	ExpiresAt     time.Time `gorm:"not null;index" json:"expires_at"`
+	Reason        string    `gorm:"size:100" json:"reason"`
+}
+
+// PasswordResetToken lets a user set a new password without the old one. Only the SHA-256 of the token
+// is kept; it works once and until ExpiresAt. RequestedBy is "self" for a forgotten password, else the
+// username of the administrator who triggered the reset.
+type PasswordResetToken struct {
+	gorm.Model
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+	RequestedBy string     `gorm:"size:100" json:"requested_by"`
+}
@@ -2,6 +2,7 @@ package userRegistration
 
 import (
 	"car-bond/internals/models/companyRegistration"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -24,6 +25,10 @@ type User struct {
 	UpdatedBy string                      `gorm:"size:100" json:"updated_by"`
 	GroupID   uint                        `json:"group_id"`
 	Group     Group                       `gorm:"foreignKey:GroupID;references:ID" json:"group"`
+
+	// MustChangePassword limits the user to changing their password until they do, as for seeded accounts
+	MustChangePassword bool       `gorm:"not null;default:false" json:"must_change_password"`
+	PasswordChangedAt  *time.Time `json:"password_changed_at"`
 }
 
 func (user *User) BeforeCreate(tx *gorm.DB) (err error) {
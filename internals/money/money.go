@@ -0,0 +1,230 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Scale is the number of decimal places amounts are rounded to
+const Scale = 2
+
+// divisionPrecision is the number of decimal places kept by Div before rounding
+const divisionPrecision = 16
+
+// Money is an exact decimal value stored as Postgres numeric. It is used for prices, expenses,
+// payments and the rates applied to them (dollar rates, VAT percentages).
+//
+// Rounding rules: arithmetic is exact, Div keeps 16 places, and Round rounds half away from
+// zero to Scale places. Amounts are rounded when they are persisted as derived values
+// (installments, allocations, VAT) and when they are reported, never in between.
+type Money struct {
+	d decimal.Decimal
+}
+
+// Zero is the zero amount
+var Zero = Money{}
+
+// New builds a Money from a float64, using the shortest decimal that represents it
+func New(value float64) Money {
+	return Money{d: decimal.NewFromFloat(value)}
+}
+
+// NewFromInt builds a Money from an integer
+func NewFromInt(value int64) Money {
+	return Money{d: decimal.NewFromInt(value)}
+}
+
+// NewFromDecimal wraps a decimal.Decimal
+func NewFromDecimal(value decimal.Decimal) Money {
+	return Money{d: value}
+}
+
+// Parse reads a decimal string such as "1234.50" or "1,234.50"
+func Parse(value string) (Money, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+	if value == "" {
+		return Zero, nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return Zero, fmt.Errorf("invalid amount %q: %w", value, err)
+	}
+	return Money{d: d}, nil
+}
+
+// Sum adds up a list of amounts
+func Sum(values ...Money) Money {
+	total := Zero
+	for _, v := range values {
+		total = total.Add(v)
+	}
+	return total
+}
+
+// Min returns the smaller of two amounts
+func Min(a, b Money) Money {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of two amounts
+func Max(a, b Money) Money {
+	if a.GreaterThan(b) {
+		return a
+	}
+	return b
+}
+
+// ====================
+
+func (m Money) Decimal() decimal.Decimal { return m.d }
+
+func (m Money) Add(other Money) Money { return Money{d: m.d.Add(other.d)} }
+
+func (m Money) Sub(other Money) Money { return Money{d: m.d.Sub(other.d)} }
+
+func (m Money) Mul(other Money) Money { return Money{d: m.d.Mul(other.d)} }
+
+func (m Money) MulInt(n int64) Money { return Money{d: m.d.Mul(decimal.NewFromInt(n))} }
+
+// Div divides by other, keeping 16 decimal places. Dividing by zero returns Zero.
+func (m Money) Div(other Money) Money {
+	if other.d.IsZero() {
+		return Zero
+	}
+	return Money{d: m.d.DivRound(other.d, divisionPrecision)}
+}
+
+// DivInt divides by n, keeping 16 decimal places. Dividing by zero returns Zero.
+func (m Money) DivInt(n int64) Money {
+	return m.Div(NewFromInt(n))
+}
+
+// Percent returns rate percent of the amount, e.g. the VAT on a price
+func (m Money) Percent(rate Money) Money {
+	return Money{d: m.d.Mul(rate.d).DivRound(decimal.NewFromInt(100), divisionPrecision)}
+}
+
+// Round rounds half away from zero to Scale places
+func (m Money) Round() Money { return Money{d: m.d.Round(Scale)} }
+
+// Split divides the amount into n parts rounded to Scale places, putting the rounding
+// remainder on the last part so the parts always add up to the rounded amount
+func (m Money) Split(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+	total := m.Round()
+	part := total.DivInt(int64(n)).Round()
+	parts := make([]Money, n)
+	for i := 0; i < n-1; i++ {
+		parts[i] = part
+	}
+	parts[n-1] = total.Sub(part.MulInt(int64(n - 1)))
+	return parts
+}
+
+// Allocate splits the amount in proportion to weights, rounded to Scale places, with the
+// rounding remainder on the last part. It returns nil when the weights add up to zero.
+func (m Money) Allocate(weights []Money) []Money {
+	totalWeight := Sum(weights...)
+	if len(weights) == 0 || totalWeight.IsZero() {
+		return nil
+	}
+	total := m.Round()
+	remaining := total
+	parts := make([]Money, len(weights))
+	for i := 0; i < len(weights)-1; i++ {
+		parts[i] = total.Mul(weights[i]).Div(totalWeight).Round()
+		remaining = remaining.Sub(parts[i])
+	}
+	parts[len(weights)-1] = remaining
+	return parts
+}
+
+func (m Money) Neg() Money { return Money{d: m.d.Neg()} }
+
+func (m Money) Abs() Money { return Money{d: m.d.Abs()} }
+
+func (m Money) Cmp(other Money) int { return m.d.Cmp(other.d) }
+
+func (m Money) Equal(other Money) bool { return m.d.Equal(other.d) }
+
+func (m Money) LessThan(other Money) bool { return m.d.LessThan(other.d) }
+
+func (m Money) LessThanOrEqual(other Money) bool { return m.d.LessThanOrEqual(other.d) }
+
+func (m Money) GreaterThan(other Money) bool { return m.d.GreaterThan(other.d) }
+
+func (m Money) GreaterThanOrEqual(other Money) bool { return m.d.GreaterThanOrEqual(other.d) }
+
+func (m Money) IsZero() bool { return m.d.IsZero() }
+
+func (m Money) IsPositive() bool { return m.d.IsPositive() }
+
+func (m Money) IsNegative() bool { return m.d.IsNegative() }
+
+// Float64 returns the nearest float64, for charts, spreadsheets and PDFs only
+func (m Money) Float64() float64 { return m.d.InexactFloat64() }
+
+func (m Money) String() string { return m.d.String() }
+
+// StringFixed formats the amount rounded to Scale places, e.g. "1234.50"
+func (m Money) StringFixed() string { return m.d.StringFixed(Scale) }
+
+// ====================
+
+// GormDataType maps Money to Postgres numeric when no explicit type is set on the field
+func (Money) GormDataType() string { return "numeric" }
+
+// Value implements driver.Valuer
+func (m Money) Value() (driver.Value, error) { return m.d.String(), nil }
+
+// Scan implements sql.Scanner; NULL reads as Zero
+func (m *Money) Scan(value interface{}) error {
+	if value == nil {
+		*m = Zero
+		return nil
+	}
+	var d decimal.Decimal
+	if err := d.Scan(value); err != nil {
+		return err
+	}
+	*m = Money{d: d}
+	return nil
+}
+
+// MarshalJSON writes the amount as a JSON number so clients keep receiving numbers
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number, a numeric string or null
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" || value == "" {
+		*m = Zero
+		return nil
+	}
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalText lets form and query parsers decode Money fields
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
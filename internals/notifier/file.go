@@ -0,0 +1,46 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileNotifier appends messages to a local file instead of sending them.
+// Useful in development and for checking what the scheduler would send.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Channel() string {
+	return ChannelFile
+}
+
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(n.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line := fmt.Sprintf("%s\tto=%s\tsubject=%s\t%s\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, strings.ReplaceAll(msg.Body, "\n", " "))
+	_, err = f.WriteString(line)
+	return err
+}
@@ -0,0 +1,91 @@
+package notifier
+
+import (
+	"car-bond/internals/config"
+	"context"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelFile  = "file"
+)
+
+// Message is a single reminder addressed to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages over one channel (email, sms, ...)
+type Notifier interface {
+	Channel() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromConfig builds the notifiers listed in NOTIFIER_CHANNELS (comma separated: email, sms, file).
+// When nothing is configured the file notifier is used so reminders can still be inspected.
+func NewFromConfig() []Notifier {
+	channels := config.Config("NOTIFIER_CHANNELS")
+	if strings.TrimSpace(channels) == "" {
+		channels = ChannelFile
+	}
+
+	var notifiers []Notifier
+	for _, channel := range strings.Split(channels, ",") {
+		switch strings.ToLower(strings.TrimSpace(channel)) {
+		case ChannelEmail:
+			notifiers = append(notifiers, smtpFromConfig())
+		case ChannelSMS:
+			notifiers = append(notifiers, NewHTTPSMSNotifier(
+				config.Config("SMS_API_URL"),
+				config.Config("SMS_API_KEY"),
+				config.Config("SMS_SENDER"),
+			))
+		case ChannelFile:
+			path := config.Config("NOTIFIER_FILE_PATH")
+			if path == "" {
+				path = "./logs/notifications.log"
+			}
+			notifiers = append(notifiers, NewFileNotifier(path))
+		case "":
+		default:
+			log.Printf("Unknown notifier channel %q ignored", channel)
+		}
+	}
+	return notifiers
+}
+
+// NewMailerFromConfig builds the sender of account emails such as password resets: SMTP when
+// MAIL_SENDER is "email", otherwise a file at MAIL_FILE_PATH (./logs/mail.log by default) where the
+// messages can be read during development and tests.
+func NewMailerFromConfig() Notifier {
+	if strings.EqualFold(strings.TrimSpace(config.Config("MAIL_SENDER")), ChannelEmail) {
+		return smtpFromConfig()
+	}
+	path := config.Config("MAIL_FILE_PATH")
+	if path == "" {
+		path = "./logs/mail.log"
+	}
+	return NewFileNotifier(path)
+}
+
+// smtpFromConfig is the SMTP relay of SMTP_HOST, SMTP_PORT (587 by default), SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM
+func smtpFromConfig() *SMTPNotifier {
+	port, err := strconv.Atoi(config.Config("SMTP_PORT"))
+	if err != nil {
+		port = 587
+	}
+	return NewSMTPNotifier(
+		config.Config("SMTP_HOST"),
+		port,
+		config.Config("SMTP_USERNAME"),
+		config.Config("SMTP_PASSWORD"),
+		config.Config("SMTP_FROM"),
+	)
+}
@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPSMSNotifier posts messages as JSON to a generic SMS gateway:
+// {"from": "...", "to": "...", "message": "..."} with a bearer API key
+type HTTPSMSNotifier struct {
+	url    string
+	apiKey string
+	sender string
+	client *http.Client
+}
+
+func NewHTTPSMSNotifier(url, apiKey, sender string) *HTTPSMSNotifier {
+	return &HTTPSMSNotifier{
+		url:    url,
+		apiKey: apiKey,
+		sender: sender,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (n *HTTPSMSNotifier) Channel() string {
+	return ChannelSMS
+}
+
+func (n *HTTPSMSNotifier) Send(ctx context.Context, msg Message) error {
+	if n.url == "" {
+		return fmt.Errorf("sms gateway url is not configured")
+	}
+	if msg.To == "" {
+		return fmt.Errorf("recipient phone number is missing")
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"from":    n.sender,
+		"to":      msg.To,
+		"message": msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+n.apiKey)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send sms to %s: %w", msg.To, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPNotifier sends plain text emails through an SMTP relay
+type SMTPNotifier struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPNotifier(host string, port int, username, password, from string) *SMTPNotifier {
+	return &SMTPNotifier{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (n *SMTPNotifier) Channel() string {
+	return ChannelEmail
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if n.host == "" {
+		return fmt.Errorf("smtp host is not configured")
+	}
+	if msg.To == "" {
+		return fmt.Errorf("recipient email is missing")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+
+	body := strings.Join([]string{
+		"From: " + n.from,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	addr := fmt.Sprintf("%s:%d", n.host, n.port)
+	if err := smtp.SendMail(addr, auth, n.from, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package password
+
+import (
+	"car-bond/internals/config"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cost is the bcrypt cost the users' passwords have always been hashed with
+const cost = 14
+
+// maxBytes is the longest password bcrypt hashes; Hash fails on longer ones
+const maxBytes = 72
+
+// Policy is what a new password must satisfy
+type Policy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	RejectUsername bool // refuse passwords containing the username
+}
+
+// DefaultPolicy applies when nothing is configured
+var DefaultPolicy = Policy{
+	MinLength:      8,
+	RequireUpper:   true,
+	RequireLower:   true,
+	RequireDigit:   true,
+	RejectUsername: true,
+}
+
+// PolicyFromConfig starts from DefaultPolicy and applies PASSWORD_MIN_LENGTH, PASSWORD_REQUIRE_UPPER,
+// PASSWORD_REQUIRE_LOWER, PASSWORD_REQUIRE_DIGIT, PASSWORD_REQUIRE_SYMBOL and
+// PASSWORD_REJECT_USERNAME. Unparsable values are ignored.
+func PolicyFromConfig() Policy {
+	policy := DefaultPolicy
+	if length, err := strconv.Atoi(config.Config("PASSWORD_MIN_LENGTH")); err == nil && length > 0 {
+		policy.MinLength = length
+	}
+	flags := map[string]*bool{
+		"PASSWORD_REQUIRE_UPPER":   &policy.RequireUpper,
+		"PASSWORD_REQUIRE_LOWER":   &policy.RequireLower,
+		"PASSWORD_REQUIRE_DIGIT":   &policy.RequireDigit,
+		"PASSWORD_REQUIRE_SYMBOL":  &policy.RequireSymbol,
+		"PASSWORD_REJECT_USERNAME": &policy.RejectUsername,
+	}
+	for key, flag := range flags {
+		if value, err := strconv.ParseBool(config.Config(key)); err == nil {
+			*flag = value
+		}
+	}
+	return policy
+}
+
+// Validate returns every rule the password breaks, joined in one error, or nil. Passwords too long to
+// hash are refused first.
+func (p Policy) Validate(password, username string) error {
+	if len(password) > maxBytes {
+		return fmt.Errorf("the password must not be longer than %d bytes", maxBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	var problems []string
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "a symbol")
+	}
+	if len(problems) > 0 {
+		return errors.New("the password needs " + strings.Join(problems, ", "))
+	}
+	if p.RejectUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("the password must not contain the username")
+	}
+	return nil
+}
+
+// Hash hashes a password for storing
+func Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	return string(bytes), err
+}
+
+// Matches compares a password with its hash
+func Matches(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,139 @@
+package rbac
+
+import (
+	"car-bond/internals/models/userRegistration"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// cacheTTL bounds how long a decision is trusted. Changes made through GORM in this process clear the
+// cache at once; the TTL covers other instances of the API and changes made with raw SQL.
+const cacheTTL = 5 * time.Minute
+
+type cacheEntry struct {
+	decision Decision
+	expires  time.Time
+}
+
+var cache = struct {
+	sync.RWMutex
+	generation uint64
+	entries    map[string]cacheEntry
+}{entries: make(map[string]cacheEntry)}
+
+// permissionTables are the tables whose changes invalidate the cache
+var permissionTables = map[string]bool{
+	"role_resource_permissions":  true,
+	"role_wild_card_permissions": true,
+}
+
+// cacheKey identifies a role set on a resource, whatever the order of the roles
+func cacheKey(roles []string, resource string) string {
+	sorted := append([]string(nil), roles...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",") + "|" + resource
+}
+
+// Invalidate forgets every cached decision
+func Invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.generation++
+	cache.entries = make(map[string]cacheEntry)
+}
+
+// Register clears the decision cache whenever a permission row is created, updated or deleted through
+// GORM: once before the write, so decisions being read meanwhile are not cached, and again after GORM
+// commits it. Inside an explicit db.Transaction the second clear comes before the outer commit, so the
+// repository methods that write permissions in a transaction clear the cache once more when it returns.
+func Register(db *gorm.DB) error {
+	for _, model := range []interface{}{&userRegistration.RoleResourcePermission{}, &userRegistration.RoleWildCardPermission{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		permissionTables[stmt.Schema.Table] = true
+	}
+
+	invalidate := func(db *gorm.DB) {
+		if permissionTables[db.Statement.Table] {
+			Invalidate()
+		}
+	}
+	create := db.Callback().Create()
+	if err := create.Before("gorm:create").Register("rbac:invalidate_before_create", invalidate); err != nil {
+		return err
+	}
+	if err := create.After("gorm:commit_or_rollback_transaction").Register("rbac:invalidate_create", invalidate); err != nil {
+		return err
+	}
+	update := db.Callback().Update()
+	if err := update.Before("gorm:update").Register("rbac:invalidate_before_update", invalidate); err != nil {
+		return err
+	}
+	if err := update.After("gorm:commit_or_rollback_transaction").Register("rbac:invalidate_update", invalidate); err != nil {
+		return err
+	}
+	remove := db.Callback().Delete()
+	if err := remove.Before("gorm:delete").Register("rbac:invalidate_before_delete", invalidate); err != nil {
+		return err
+	}
+	return remove.After("gorm:commit_or_rollback_transaction").Register("rbac:invalidate_delete", invalidate)
+}
+
+// Decide evaluates the rules of the roles on the resource, from the cache while the rules are unchanged
+func Decide(db *gorm.DB, roles []string, resource string) (Decision, error) {
+	key := cacheKey(roles, resource)
+
+	cache.RLock()
+	entry, ok := cache.entries[key]
+	generation := cache.generation
+	cache.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.decision, nil
+	}
+
+	rules, err := LoadRules(db, roles)
+	if err != nil {
+		return Decision{}, err
+	}
+	decision := Evaluate(roles, resource, rules)
+
+	cache.Lock()
+	// A change committed while the rules were read would make this decision stale
+	if cache.generation == generation {
+		cache.entries[key] = cacheEntry{decision: decision, expires: time.Now().Add(cacheTTL)}
+	}
+	cache.Unlock()
+	return decision, nil
+}
+
+// LoadRules reads the explicit and wildcard permission rows of the roles. Either table may hold
+// patterns; a code without "*" only matches itself.
+func LoadRules(db *gorm.DB, roles []string) ([]Rule, error) {
+	if len(roles) == 0 {
+		return nil, nil
+	}
+
+	var explicit []userRegistration.RoleResourcePermission
+	if err := db.Where("role_code IN ?", roles).Order("id").Find(&explicit).Error; err != nil {
+		return nil, err
+	}
+	var wildCards []userRegistration.RoleWildCardPermission
+	if err := db.Where("role_code IN ?", roles).Order("id").Find(&wildCards).Error; err != nil {
+		return nil, err
+	}
+
+	rules := make([]Rule, 0, len(explicit)+len(wildCards))
+	for _, row := range explicit {
+		rules = append(rules, Rule{Source: SourceExplicit, ID: row.ID, RoleCode: row.RoleCode, Pattern: row.ResourceCode, Permissions: row.Permissions})
+	}
+	for _, row := range wildCards {
+		rules = append(rules, Rule{Source: SourceWildCard, ID: row.ID, RoleCode: row.RoleCode, Pattern: row.ResourceCode, Permissions: row.Permissions})
+	}
+	return rules, nil
+}
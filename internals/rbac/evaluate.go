@@ -0,0 +1,136 @@
+package rbac
+
+import (
+	"car-bond/internals/models/userRegistration"
+	"sort"
+)
+
+// Where a rule comes from
+const (
+	SourceExplicit = "explicit" // role_resource_permissions
+	SourceWildCard = "wildcard" // role_wild_card_permissions
+)
+
+// Perms are the permissions a rule can allow or deny, in the order they are reported
+var Perms = []string{"R", "W", "X", "D"}
+
+// Rule is one permission row of a role, with how specific it is for the resource being evaluated
+type Rule struct {
+	Source      string                       `json:"source"`
+	ID          uint                         `json:"id"`
+	RoleCode    string                       `json:"role_code"`
+	Pattern     string                       `json:"resource_code"`
+	Specificity int                          `json:"specificity"`
+	Permissions userRegistration.Permissions `json:"permissions"`
+}
+
+// Verdict is the outcome for one permission and the rule that decided it; Rule is nil when no rule of
+// the roles says anything about the permission, which denies it
+type Verdict struct {
+	Perm    string `json:"perm"`
+	Allowed bool   `json:"allowed"`
+	Rule    *Rule  `json:"rule"`
+	Reason  string `json:"reason"`
+}
+
+// Decision is what a set of roles may do on a resource. Permissions.Allow holds the permissions
+// granted and Permissions.Deny those refused by a rule, as opposed to simply not granted.
+type Decision struct {
+	Resource    string                       `json:"resource"`
+	Roles       []string                     `json:"roles"`
+	Permissions userRegistration.Permissions `json:"permissions"`
+	Verdicts    []Verdict                    `json:"verdicts"`
+	Rules       []Rule                       `json:"rules"` // the rules that match, most specific first
+}
+
+// Allowed reports whether the decision grants a permission (R, W, X or D)
+func (d Decision) Allowed(perm string) bool {
+	return flag(d.Permissions.Allow, perm)
+}
+
+// Verdict returns the outcome for one permission
+func (d Decision) Verdict(perm string) (Verdict, bool) {
+	for _, verdict := range d.Verdicts {
+		if verdict.Perm == perm {
+			return verdict, true
+		}
+	}
+	return Verdict{}, false
+}
+
+func flag(set userRegistration.RWXD, perm string) bool {
+	switch perm {
+	case "R":
+		return set.R
+	case "W":
+		return set.W
+	case "X":
+		return set.X
+	case "D":
+		return set.D
+	}
+	return false
+}
+
+func setFlag(set *userRegistration.RWXD, perm string) {
+	switch perm {
+	case "R":
+		set.R = true
+	case "W":
+		set.W = true
+	case "X":
+		set.X = true
+	case "D":
+		set.D = true
+	}
+}
+
+// Evaluate decides each permission on the resource separately. Of the rules that match the resource
+// and allow or deny the permission, the most specific win; among those a deny overrides any allow,
+// whichever role it comes from. A permission no rule mentions is not granted.
+func Evaluate(roles []string, resource string, rules []Rule) Decision {
+	decision := Decision{Resource: resource, Roles: roles, Rules: []Rule{}}
+	for _, rule := range rules {
+		specificity, ok := Match(rule.Pattern, resource)
+		if !ok {
+			continue
+		}
+		rule.Specificity = specificity
+		decision.Rules = append(decision.Rules, rule)
+	}
+	sort.SliceStable(decision.Rules, func(i, j int) bool {
+		return decision.Rules[i].Specificity > decision.Rules[j].Specificity
+	})
+
+	for _, perm := range Perms {
+		verdict := Verdict{Perm: perm, Reason: "no rule of the roles grants it"}
+		for i := range decision.Rules {
+			rule := &decision.Rules[i]
+			allows, denies := flag(rule.Permissions.Allow, perm), flag(rule.Permissions.Deny, perm)
+			if !allows && !denies {
+				continue
+			}
+			if verdict.Rule != nil && rule.Specificity < verdict.Rule.Specificity {
+				break // only less specific rules are left
+			}
+			if denies {
+				verdict.Allowed = false
+				verdict.Rule = rule
+				verdict.Reason = "denied by the most specific rule"
+				break
+			}
+			if verdict.Rule == nil {
+				verdict.Allowed = true
+				verdict.Rule = rule
+				verdict.Reason = "allowed by the most specific rule"
+			}
+		}
+		if verdict.Allowed {
+			setFlag(&decision.Permissions.Allow, perm)
+		} else if verdict.Rule != nil {
+			setFlag(&decision.Permissions.Deny, perm)
+		}
+		decision.Verdicts = append(decision.Verdicts, verdict)
+	}
+	return decision
+}
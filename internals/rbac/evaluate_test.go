@@ -0,0 +1,126 @@
+package rbac
+
+import (
+	"car-bond/internals/models/userRegistration"
+	"testing"
+)
+
+func allow(rwxd userRegistration.RWXD) userRegistration.Permissions {
+	return userRegistration.Permissions{Allow: rwxd}
+}
+
+func deny(rwxd userRegistration.RWXD) userRegistration.Permissions {
+	return userRegistration.Permissions{Deny: rwxd}
+}
+
+var read = userRegistration.RWXD{R: true}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		rules    []Rule
+		allowed  bool
+		ruleID   uint // the rule that decides R, 0 when none does
+	}{
+		{
+			name:     "no rule",
+			resource: "resource.car",
+			allowed:  false,
+		},
+		{
+			name:     "star allows",
+			resource: "resource.car",
+			rules:    []Rule{{ID: 1, RoleCode: "a", Pattern: "*", Permissions: allow(read)}},
+			allowed:  true,
+			ruleID:   1,
+		},
+		{
+			name:     "trailing star does not cover its prefix",
+			resource: "resource",
+			rules:    []Rule{{ID: 1, RoleCode: "a", Pattern: "resource.*", Permissions: allow(read)}},
+			allowed:  false,
+		},
+		{
+			name:     "most specific allow wins over a broader deny",
+			resource: "resource.car",
+			rules: []Rule{
+				{ID: 1, RoleCode: "a", Pattern: "resource.*", Permissions: deny(read)},
+				{ID: 2, RoleCode: "a", Pattern: "resource.car", Permissions: allow(read)},
+			},
+			allowed: true,
+			ruleID:  2,
+		},
+		{
+			name:     "most specific deny wins over a broader allow",
+			resource: "resource.car",
+			rules: []Rule{
+				{ID: 1, RoleCode: "a", Pattern: "*", Permissions: allow(read)},
+				{ID: 2, RoleCode: "a", Pattern: "resource.car", Permissions: deny(read)},
+			},
+			allowed: false,
+			ruleID:  2,
+		},
+		{
+			name:     "deny at the same specificity overrides an allow",
+			resource: "resource.car",
+			rules: []Rule{
+				{ID: 1, RoleCode: "a", Pattern: "resource.car", Permissions: allow(read)},
+				{ID: 2, RoleCode: "b", Pattern: "resource.car", Permissions: deny(read)},
+			},
+			allowed: false,
+			ruleID:  2,
+		},
+		{
+			name:     "less specific deny is ignored",
+			resource: "resource.car.expense",
+			rules: []Rule{
+				{ID: 1, RoleCode: "a", Pattern: "resource.*", Permissions: deny(read)},
+				{ID: 2, RoleCode: "b", Pattern: "resource.*.expense", Permissions: allow(read)},
+			},
+			allowed: true,
+			ruleID:  2,
+		},
+		{
+			name:     "middle star is more specific than a trailing star",
+			resource: "resource.car.expense",
+			rules: []Rule{
+				{ID: 1, RoleCode: "a", Pattern: "resource.car.*", Permissions: allow(read)},
+				{ID: 2, RoleCode: "a", Pattern: "resource.*.expense", Permissions: deny(read)},
+			},
+			allowed: false,
+			ruleID:  2,
+		},
+		{
+			name:     "rules that do not mention the permission are skipped",
+			resource: "resource.car",
+			rules: []Rule{
+				{ID: 1, RoleCode: "a", Pattern: "resource.car", Permissions: allow(userRegistration.RWXD{W: true})},
+				{ID: 2, RoleCode: "a", Pattern: "resource.*", Permissions: allow(read)},
+			},
+			allowed: true,
+			ruleID:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := Evaluate([]string{"a", "b"}, tt.resource, tt.rules)
+			if got := decision.Allowed("R"); got != tt.allowed {
+				t.Fatalf("Allowed(R) = %v, want %v", got, tt.allowed)
+			}
+			verdict, ok := decision.Verdict("R")
+			if !ok {
+				t.Fatal("no verdict for R")
+			}
+			switch {
+			case tt.ruleID == 0 && verdict.Rule != nil:
+				t.Errorf("R decided by rule %d, want no rule", verdict.Rule.ID)
+			case tt.ruleID != 0 && (verdict.Rule == nil || verdict.Rule.ID != tt.ruleID):
+				t.Errorf("R decided by %+v, want rule %d", verdict.Rule, tt.ruleID)
+			}
+			if denied := flag(decision.Permissions.Deny, "R"); denied != (!tt.allowed && tt.ruleID != 0) {
+				t.Errorf("Deny.R = %v", denied)
+			}
+		})
+	}
+}
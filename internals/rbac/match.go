@@ -0,0 +1,42 @@
+package rbac
+
+import "strings"
+
+// Match reports whether a resource pattern covers a resource code, and how specific the pattern is.
+// Codes are dot-separated segments. A "*" segment stands for exactly one segment, except at the end of
+// the pattern where it stands for one or more: "resource.*" covers "resource.car" and
+// "resource.car.expense" but not "resource" itself, and "*" alone covers everything.
+//
+// The more segments a pattern spells out, the more specific it is; a pattern that also fixes the number
+// of segments is more specific than one ending in "*". An exact code is therefore always the most
+// specific match.
+func Match(pattern, resource string) (specificity int, ok bool) {
+	if pattern == "" || resource == "" {
+		return 0, false
+	}
+	patternSegments := strings.Split(pattern, ".")
+	resourceSegments := strings.Split(resource, ".")
+
+	literals := 0
+	for i, segment := range patternSegments {
+		last := i == len(patternSegments)-1
+		if i >= len(resourceSegments) {
+			return 0, false
+		}
+		if segment == "*" {
+			if last {
+				// Open-ended: the rest of the resource, at any depth
+				return 2 * literals, true
+			}
+			continue
+		}
+		if segment != resourceSegments[i] {
+			return 0, false
+		}
+		literals++
+	}
+	if len(patternSegments) != len(resourceSegments) {
+		return 0, false
+	}
+	return 2*literals + 1, true
+}
@@ -0,0 +1,55 @@
+package rbac
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		resource    string
+		ok          bool
+		specificity int
+	}{
+		{"star covers a single segment", "*", "resource", true, 0},
+		{"star covers any depth", "*", "resource.car.expense", true, 0},
+		{"exact code", "resource.car", "resource.car", true, 5},
+		{"other code", "resource.car", "resource.sale", false, 0},
+		{"trailing star covers one segment", "resource.*", "resource.car", true, 2},
+		{"trailing star covers deeper segments", "resource.*", "resource.car.expense", true, 2},
+		{"trailing star does not cover the prefix itself", "resource.*", "resource", false, 0},
+		{"middle star stands for one segment", "resource.*.expense", "resource.car.expense", true, 5},
+		{"middle star does not stand for two segments", "resource.*.expense", "resource.car.sale.expense", false, 0},
+		{"middle star needs the segments after it", "resource.*.expense", "resource.car", false, 0},
+		{"middle star needs the same last segment", "resource.*.expense", "resource.car.photo", false, 0},
+		{"exact code is not a prefix match", "resource", "resource.car", false, 0},
+		{"empty pattern", "", "resource", false, 0},
+		{"empty resource", "*", "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specificity, ok := Match(tt.pattern, tt.resource)
+			if ok != tt.ok {
+				t.Fatalf("Match(%q, %q) ok = %v, want %v", tt.pattern, tt.resource, ok, tt.ok)
+			}
+			if ok && specificity != tt.specificity {
+				t.Errorf("Match(%q, %q) specificity = %d, want %d", tt.pattern, tt.resource, specificity, tt.specificity)
+			}
+		})
+	}
+}
+
+func TestMatchSpecificityOrder(t *testing.T) {
+	// From most to least specific for resource.car.expense
+	patterns := []string{"resource.car.expense", "resource.*.expense", "resource.car.*", "resource.*", "*"}
+	previous := -1
+	for i, pattern := range patterns {
+		specificity, ok := Match(pattern, "resource.car.expense")
+		if !ok {
+			t.Fatalf("Match(%q) did not match", pattern)
+		}
+		if i > 0 && specificity >= previous {
+			t.Errorf("%q (specificity %d) should be less specific than %q (%d)", pattern, specificity, patterns[i-1], previous)
+		}
+		previous = specificity
+	}
+}
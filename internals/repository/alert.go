@@ -3,6 +3,7 @@ package repository
 import (
 	"car-bond/internals/models/alertRegistration"
 	"car-bond/internals/utils"
+	"context"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,6 +11,7 @@ import (
 )
 
 type AlertRepository interface {
+	WithContext(ctx context.Context) AlertRepository
 	CreateAlert(alert *alertRegistration.Transaction) error
 	SearchPaginatedAlerts(c *fiber.Ctx) (*utils.Pagination, []alertRegistration.Transaction, error)
 	GetAlertByID(id string) (alertRegistration.Transaction, error)
@@ -24,6 +26,10 @@ func NewAlertRepository(db *gorm.DB) AlertRepository {
 	return &AlertRepositoryImpl{db: db}
 }
 
+func (r *AlertRepositoryImpl) WithContext(ctx context.Context) AlertRepository {
+	return NewAlertRepository(r.db.WithContext(ctx))
+}
+
 func (r *AlertRepositoryImpl) CreateAlert(alert *alertRegistration.Transaction) error {
 	return r.db.Create(alert).Error
 }
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/utils"
+	"context"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AuditLogRepository interface {
+	WithContext(ctx context.Context) AuditLogRepository
+	GetPaginatedAuditLogs(c *fiber.Ctx) (*utils.Pagination, []alertRegistration.AuditLog, error)
+}
+
+type AuditLogRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAuditLogRepository(db *gorm.DB) AuditLogRepository {
+	return &AuditLogRepositoryImpl{db: db}
+}
+
+func (r *AuditLogRepositoryImpl) WithContext(ctx context.Context) AuditLogRepository {
+	return NewAuditLogRepository(r.db.WithContext(ctx))
+}
+
+// GetPaginatedAuditLogs lists audit entries, newest first. user matches the user ID or the username.
+func (r *AuditLogRepositoryImpl) GetPaginatedAuditLogs(c *fiber.Ctx) (*utils.Pagination, []alertRegistration.AuditLog, error) {
+	table := c.Query("table")
+	recordID := c.Query("record_id")
+	user := c.Query("user")
+	operation := c.Query("operation")
+	requestID := c.Query("request_id")
+	from := c.Query("from")
+	to := c.Query("to")
+
+	query := r.db.Model(&alertRegistration.AuditLog{}).Order("id DESC")
+
+	if table != "" {
+		query = query.Where("table_name = ?", table)
+	}
+	if recordID != "" {
+		query = query.Where("record_id = ?", recordID)
+	}
+	if user != "" {
+		if id, err := strconv.ParseUint(user, 10, 64); err == nil {
+			query = query.Where("user_id = ? OR username = ?", id, user)
+		} else {
+			query = query.Where("username = ?", user)
+		}
+	}
+	if operation != "" {
+		query = query.Where("operation = ?", operation)
+	}
+	if requestID != "" {
+		query = query.Where("request_id = ?", requestID)
+	}
+	if from != "" {
+		query = query.Where("created_at >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("created_at < (?::date + 1)", to)
+	}
+
+	pagination, logs, err := utils.Paginate(c, query, alertRegistration.AuditLog{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pagination, logs, nil
+}
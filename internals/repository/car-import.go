@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/companyRegistration"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// FindExistingChasisNumbers returns which of the chassis numbers are already registered
+func (r *CarRepositoryImpl) FindExistingChasisNumbers(chasisNumbers []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(chasisNumbers) == 0 {
+		return existing, nil
+	}
+
+	var found []string
+	if err := r.db.Unscoped().Model(&carRegistration.Car{}).
+		Where("chasis_number IN ?", chasisNumbers).
+		Pluck("chasis_number", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, chasis := range found {
+		existing[chasis] = true
+	}
+	return existing, nil
+}
+
+// FindExistingCompanyIDs returns which of the company IDs exist
+func (r *CarRepositoryImpl) FindExistingCompanyIDs(ids []uint) (map[uint]bool, error) {
+	existing := make(map[uint]bool)
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	var found []uint
+	if err := r.db.Model(&companyRegistration.Company{}).
+		Where("id IN ?", ids).
+		Pluck("id", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+// ImportCars inserts the cars with their transaction records in one transaction; nothing is saved
+// if any insert fails. The transaction of a car is built once the car is inserted, so it reflects what
+// BeforeCreate set.
+func (r *CarRepositoryImpl) ImportCars(cars []carRegistration.Car, toTransaction func(*carRegistration.Car) *alertRegistration.Transaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i := range cars {
+			if err := tx.Create(&cars[i]).Error; err != nil {
+				return fmt.Errorf("failed to save car %s: %w", cars[i].ChasisNumber, err)
+			}
+			if err := tx.Create(toTransaction(&cars[i])).Error; err != nil {
+				return fmt.Errorf("failed to save transaction for car %s: %w", cars[i].ChasisNumber, err)
+			}
+		}
+		return nil
+	})
+}
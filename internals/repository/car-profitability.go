@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Profitability sort keys accepted by GetCompanyProfitability
+const (
+	ProfitSortMargin        = "margin"
+	ProfitSortMarginPercent = "margin_percent"
+	ProfitSortLandedCost    = "landed_cost"
+	ProfitSortSalePrice     = "sale_price"
+)
+
+// shippingExpenseKeywords identify the expense lines that make up the shipping share of a car
+var shippingExpenseKeywords = []string{"freight", "shipping"}
+
+type CarProfitability struct {
+	CarID           uint        `json:"car_id"`
+	ChasisNumber    string      `json:"chasis_number"`
+	Make            string      `json:"make"`
+	CarModel        string      `json:"car_model"`
+	ManufactureYear int         `json:"manufacture_year"`
+	CarStatus       string      `json:"car_status"`
+	Currency        string      `json:"currency"` // reporting currency of every amount below
+	PurchasePrice   money.Money `json:"purchase_price"`
+	PurchaseVAT     money.Money `json:"purchase_vat"`
+	JapanExpenses   money.Money `json:"japan_expenses"`
+	ShippingCost    money.Money `json:"shipping_cost"`
+	LocalExpenses   money.Money `json:"local_expenses"`
+	LandedCost      money.Money `json:"landed_cost"`
+	IsSold          bool        `json:"is_sold"`
+	SaleID          *uint       `json:"sale_id"`
+	SalePrice       money.Money `json:"sale_price"`
+	GrossMargin     money.Money `json:"gross_margin"`
+	MarginPercent   money.Money `json:"margin_percent"`
+	Unconverted     []string    `json:"unconverted"` // lines left out because no exchange rate was found
+}
+
+type ModelProfitability struct {
+	Make          string      `json:"make"`
+	CarModel      string      `json:"car_model"`
+	Cars          int         `json:"cars"`
+	SoldCars      int         `json:"sold_cars"`
+	LandedCost    money.Money `json:"landed_cost"` // sold cars only
+	SalePrice     money.Money `json:"sale_price"`
+	GrossMargin   money.Money `json:"gross_margin"`
+	MarginPercent money.Money `json:"margin_percent"`
+}
+
+type CompanyProfitability struct {
+	CompanyID     uint                 `json:"company_id"`
+	Currency      string               `json:"currency"`
+	SoldCars      int                  `json:"sold_cars"`
+	LandedCost    money.Money          `json:"landed_cost"` // sold cars only
+	SalePrice     money.Money          `json:"sale_price"`
+	GrossMargin   money.Money          `json:"gross_margin"`
+	MarginPercent money.Money          `json:"margin_percent"`
+	Cars          []CarProfitability   `json:"cars"`
+	Models        []ModelProfitability `json:"models"`
+}
+
+type CarProfitabilityRepository interface {
+	WithContext(ctx context.Context) CarProfitabilityRepository
+	GetCarProfitability(carID uint, currency string) (*CarProfitability, error)
+	GetCompanyProfitability(companyID uint, currency, sortBy string, ascending, soldOnly bool) (*CompanyProfitability, error)
+}
+
+type CarProfitabilityRepositoryImpl struct {
+	db    *gorm.DB
+	rates ExchangeRateRepository
+}
+
+func NewCarProfitabilityRepository(db *gorm.DB) CarProfitabilityRepository {
+	return &CarProfitabilityRepositoryImpl{db: db, rates: NewExchangeRateRepository(db)}
+}
+
+func (r *CarProfitabilityRepositoryImpl) WithContext(ctx context.Context) CarProfitabilityRepository {
+	return NewCarProfitabilityRepository(r.db.WithContext(ctx))
+}
+
+// isShippingExpense reports whether an expense line is part of the shipping share
+func isShippingExpense(description string) bool {
+	description = strings.ToLower(description)
+	for _, keyword := range shippingExpenseKeywords {
+		if strings.Contains(description, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// marginPercent is the gross margin as a percentage of the sale price
+func marginPercent(margin, salePrice money.Money) money.Money {
+	if salePrice.IsZero() {
+		return money.Zero
+	}
+	return margin.Mul(money.NewFromInt(100)).Div(salePrice).Round()
+}
+
+func (r *CarProfitabilityRepositoryImpl) GetCarProfitability(carID uint, currency string) (*CarProfitability, error) {
+	currency, err := r.rates.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var car carRegistration.Car
+	if err := r.db.First(&car, carID).Error; err != nil {
+		return nil, err
+	}
+
+	var expenses []carRegistration.CarExpense
+	if err := r.db.Where("car_id = ?", carID).Find(&expenses).Error; err != nil {
+		return nil, err
+	}
+
+	var sale saleRegistration.Sale
+	result := r.db.Where("car_id = ?", carID).Order("sale_date DESC, id DESC").Limit(1).Find(&sale)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var salePtr *saleRegistration.Sale
+	if result.RowsAffected > 0 {
+		salePtr = &sale
+	}
+	return r.buildCarProfitability(&car, expenses, salePtr, currency), nil
+}
+
+// buildCarProfitability converts every line at the rate of its own date and works out the margin
+func (r *CarProfitabilityRepositoryImpl) buildCarProfitability(car *carRegistration.Car, expenses []carRegistration.CarExpense, sale *saleRegistration.Sale, currency string) *CarProfitability {
+	p := &CarProfitability{
+		CarID:           car.ID,
+		ChasisNumber:    car.ChasisNumber,
+		Make:            car.Make,
+		CarModel:        car.CarModel,
+		ManufactureYear: car.ManufactureYear,
+		CarStatus:       car.CarStatus,
+		Currency:        currency,
+		Unconverted:     []string{},
+	}
+
+	convert := func(description string, amount money.Money, from, date string) money.Money {
+		if amount.IsZero() {
+			return money.Zero
+		}
+		on, err := parseSaleDate(date)
+		if err != nil {
+			on = time.Now()
+		}
+		converted, err := r.rates.Convert(amount, from, currency, on)
+		if err != nil {
+			p.Unconverted = append(p.Unconverted, fmt.Sprintf("%s: %v", description, err))
+			return money.Zero
+		}
+		return converted
+	}
+
+	p.PurchasePrice = convert("Bid price", car.BidPrice, car.Currency, car.PurchaseDate)
+	p.PurchaseVAT = convert("VAT", car.BidPrice.Percent(car.VATTax), car.Currency, car.PurchaseDate)
+
+	for _, expense := range expenses {
+		amount := convert(expense.Description, expense.Amount.Add(expense.Amount.Percent(expense.ExpenseVAT)),
+			expense.Currency, expense.ExpenseDate)
+		switch {
+		case expense.CarShippingInvoiceID != nil || isShippingExpense(expense.Description):
+			p.ShippingCost = p.ShippingCost.Add(amount)
+		case strings.EqualFold(expense.Currency, "JPY"):
+			p.JapanExpenses = p.JapanExpenses.Add(amount)
+		default:
+			p.LocalExpenses = p.LocalExpenses.Add(amount)
+		}
+	}
+
+	p.PurchasePrice = p.PurchasePrice.Round()
+	p.PurchaseVAT = p.PurchaseVAT.Round()
+	p.JapanExpenses = p.JapanExpenses.Round()
+	p.ShippingCost = p.ShippingCost.Round()
+	p.LocalExpenses = p.LocalExpenses.Round()
+	p.LandedCost = money.Sum(p.PurchasePrice, p.PurchaseVAT, p.JapanExpenses, p.ShippingCost, p.LocalExpenses)
+
+	if sale != nil {
+		saleID := sale.ID
+		p.IsSold = true
+		p.SaleID = &saleID
+		p.SalePrice = convert(fmt.Sprintf("Sale #%d", sale.ID), sale.TotalPrice, sale.Currency, sale.SaleDate).Round()
+		p.GrossMargin = p.SalePrice.Sub(p.LandedCost)
+		p.MarginPercent = marginPercent(p.GrossMargin, p.SalePrice)
+	}
+
+	return p
+}
+
+// GetCompanyProfitability lists the profitability of every car bought by a company, sorted by
+// sortBy, with totals per make and model. Margins only count sold cars.
+func (r *CarProfitabilityRepositoryImpl) GetCompanyProfitability(companyID uint, currency, sortBy string, ascending, soldOnly bool) (*CompanyProfitability, error) {
+	currency, err := r.rates.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var cars []carRegistration.Car
+	if err := r.db.Where("to_company_id = ?", companyID).Find(&cars).Error; err != nil {
+		return nil, err
+	}
+
+	carIDs := make([]uint, 0, len(cars))
+	for _, car := range cars {
+		carIDs = append(carIDs, car.ID)
+	}
+
+	expensesByCar := make(map[uint][]carRegistration.CarExpense)
+	salesByCar := make(map[uint]*saleRegistration.Sale)
+	if len(carIDs) > 0 {
+		var expenses []carRegistration.CarExpense
+		if err := r.db.Where("car_id IN ?", carIDs).Find(&expenses).Error; err != nil {
+			return nil, err
+		}
+		for _, expense := range expenses {
+			expensesByCar[expense.CarID] = append(expensesByCar[expense.CarID], expense)
+		}
+
+		var sales []saleRegistration.Sale
+		if err := r.db.Where("car_id IN ?", carIDs).Order("sale_date ASC, id ASC").Find(&sales).Error; err != nil {
+			return nil, err
+		}
+		for i := range sales {
+			salesByCar[sales[i].CarID] = &sales[i] // latest sale wins
+		}
+	}
+
+	report := &CompanyProfitability{CompanyID: companyID, Currency: currency, Cars: []CarProfitability{}}
+	models := make(map[string]*ModelProfitability)
+
+	for i := range cars {
+		p := r.buildCarProfitability(&cars[i], expensesByCar[cars[i].ID], salesByCar[cars[i].ID], currency)
+		if soldOnly && !p.IsSold {
+			continue
+		}
+		report.Cars = append(report.Cars, *p)
+
+		key := strings.ToUpper(strings.TrimSpace(p.Make)) + "|" + strings.ToUpper(strings.TrimSpace(p.CarModel))
+		model, ok := models[key]
+		if !ok {
+			model = &ModelProfitability{Make: p.Make, CarModel: p.CarModel}
+			models[key] = model
+		}
+		model.Cars++
+		if p.IsSold {
+			model.SoldCars++
+			model.LandedCost = model.LandedCost.Add(p.LandedCost)
+			model.SalePrice = model.SalePrice.Add(p.SalePrice)
+			model.GrossMargin = model.GrossMargin.Add(p.GrossMargin)
+
+			report.SoldCars++
+			report.LandedCost = report.LandedCost.Add(p.LandedCost)
+			report.SalePrice = report.SalePrice.Add(p.SalePrice)
+			report.GrossMargin = report.GrossMargin.Add(p.GrossMargin)
+		}
+	}
+	report.MarginPercent = marginPercent(report.GrossMargin, report.SalePrice)
+
+	for _, model := range models {
+		model.MarginPercent = marginPercent(model.GrossMargin, model.SalePrice)
+		report.Models = append(report.Models, *model)
+	}
+
+	less := profitabilityLess(sortBy)
+	sort.SliceStable(report.Cars, func(i, j int) bool {
+		if ascending {
+			return less(report.Cars[i], report.Cars[j])
+		}
+		return less(report.Cars[j], report.Cars[i])
+	})
+	// Best earning models first
+	sort.SliceStable(report.Models, func(i, j int) bool {
+		return report.Models[i].GrossMargin.GreaterThan(report.Models[j].GrossMargin)
+	})
+
+	return report, nil
+}
+
+// profitabilityLess orders cars by the given key (margin_percent by default); unsold cars have no margin
+func profitabilityLess(sortBy string) func(a, b CarProfitability) bool {
+	switch sortBy {
+	case ProfitSortMargin:
+		return func(a, b CarProfitability) bool { return a.GrossMargin.LessThan(b.GrossMargin) }
+	case ProfitSortLandedCost:
+		return func(a, b CarProfitability) bool { return a.LandedCost.LessThan(b.LandedCost) }
+	case ProfitSortSalePrice:
+		return func(a, b CarProfitability) bool { return a.SalePrice.LessThan(b.SalePrice) }
+	default:
+		return func(a, b CarProfitability) bool { return a.MarginPercent.LessThan(b.MarginPercent) }
+	}
+}
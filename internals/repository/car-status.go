@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"car-bond/internals/models/carRegistration"
+
+	"gorm.io/gorm"
+)
+
+// statusColumns are written only through carRegistration.ChangeCarStatus
+var statusColumns = []string{
+	carRegistration.StatusFieldJapan,
+	carRegistration.StatusFieldCar,
+	carRegistration.StatusFieldPayment,
+}
+
+// ChangeCarStatus moves a car to a new state and records the change in its status history
+func (r *CarRepositoryImpl) ChangeCarStatus(carID uint, change carRegistration.StatusChange) (*carRegistration.Car, error) {
+	var car *carRegistration.Car
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		car, err = carRegistration.ChangeCarStatus(tx, carID, change)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+// UpdateCarWithStatus saves a car, leaving its status columns alone, then applies the status changes.
+// Either everything is saved or nothing is.
+func (r *CarRepositoryImpl) UpdateCarWithStatus(car *carRegistration.Car, changes []carRegistration.StatusChange) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(statusColumns...).Save(car).Error; err != nil {
+			return err
+		}
+		return applyStatusChanges(tx, car, changes)
+	})
+}
+
+// applyStatusChanges runs the changes in order and copies the resulting states onto car
+func applyStatusChanges(tx *gorm.DB, car *carRegistration.Car, changes []carRegistration.StatusChange) error {
+	for _, change := range changes {
+		updated, err := carRegistration.ChangeCarStatus(tx, car.ID, change)
+		if err != nil {
+			return err
+		}
+		car.CarStatusJapan = updated.CarStatusJapan
+		car.CarStatus = updated.CarStatus
+		car.CarPaymentStatus = updated.CarPaymentStatus
+	}
+	return nil
+}
+
+// GetCarStatusHistory lists the status changes of a car, oldest first, optionally for one status column
+func (r *CarRepositoryImpl) GetCarStatusHistory(carID uint, field string) ([]carRegistration.CarStatusHistory, error) {
+	var car carRegistration.Car
+	if err := r.db.Select("id").First(&car, carID).Error; err != nil {
+		return nil, err
+	}
+
+	query := r.db.Where("car_id = ?", carID)
+	if field != "" {
+		query = query.Where("field = ?", field)
+	}
+
+	var history []carRegistration.CarStatusHistory
+	if err := query.Order("changed_at ASC, id ASC").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -5,8 +5,9 @@ import (
 	"car-bond/internals/models/alertRegistration"
 	"car-bond/internals/models/carRegistration"
 	"car-bond/internals/models/companyRegistration"
+	"car-bond/internals/money"
 	"car-bond/internals/utils"
-	"database/sql"
+	"context"
 	"fmt"
 	"os"
 	"strconv"
@@ -17,6 +18,7 @@ import (
 )
 
 type CarRepository interface {
+	WithContext(ctx context.Context) CarRepository
 	CreateCar(car *carRegistration.Car) error
 	GetPaginatedCars(c *fiber.Ctx) (*utils.Pagination, []carRegistration.Car, error)
 	// GetCarExpenses(carID uint) ([]carRegistration.CarExpense, error)
@@ -30,8 +32,6 @@ type CarRepository interface {
 	CountCarsByInvoiceExcludingID(invoiceID uint, excludeCarID uint) (int64, error)
 	GetCompanyNameByID(id uint) (string, error)
 	GetInvoiceByID(id uint) (carRegistration.CarShippingInvoice, error)
-	UpdateCarStatusByID(carID uint, status string) error
-	UpdateCarStatus(carID uint, status string) error
 
 	// Expense
 	CreateCarExpense(expense *carRegistration.CarExpense) error
@@ -62,17 +62,27 @@ type CarRepository interface {
 
 	CreateAlert(alert *alertRegistration.Transaction) error
 
+	// Status
+	ChangeCarStatus(carID uint, change carRegistration.StatusChange) (*carRegistration.Car, error)
+	UpdateCarWithStatus(car *carRegistration.Car, changes []carRegistration.StatusChange) error
+	GetCarStatusHistory(carID uint, field string) ([]carRegistration.CarStatusHistory, error)
+
+	// Import
+	FindExistingChasisNumbers(chasisNumbers []string) (map[string]bool, error)
+	FindExistingCompanyIDs(ids []uint) (map[uint]bool, error)
+	ImportCars(cars []carRegistration.Car, toTransaction func(*carRegistration.Car) *alertRegistration.Transaction) error
+
 	GetTotalCars() (int64, error)
 	GetDisbandedCars() (int64, error)
 	GetCarsInStock() (int64, error)
-	GetTotalMoneySpent() (float64, error)
-	GetTotalCarsExpenses() (map[string]float64, error)
+	GetTotalMoneySpent() (money.Money, error)
+	GetTotalCarsExpenses() (map[string]money.Money, error)
 
 	GetComTotalCars(companyID uint) (int64, error)
 	GetComCarsInStock(companyID uint) (int64, error)
 	GetComCarsSold(companyID uint) (int64, error)
-	GetComTotalMoneySpent(companyID uint) (float64, error)
-	GetComTotalCarsExpenses(companyID uint) (map[string]float64, error)
+	GetComTotalMoneySpent(companyID uint) (money.Money, error)
+	GetComTotalCarsExpenses(companyID uint) (map[string]money.Money, error)
 }
 
 type CarRepositoryImpl struct {
@@ -83,6 +93,10 @@ func NewCarRepository(db *gorm.DB) CarRepository {
 	return &CarRepositoryImpl{db: db}
 }
 
+func (r *CarRepositoryImpl) WithContext(ctx context.Context) CarRepository {
+	return NewCarRepository(r.db.WithContext(ctx))
+}
+
 func (r *CarRepositoryImpl) CountCarsByInvoiceExcludingID(invoiceID uint, excludeCarID uint) (int64, error) {
 	var count int64
 	err := r.db.Model(&carRegistration.Car{}).
@@ -206,22 +220,6 @@ func (r *CarRepositoryImpl) UpdateCarJapan(id string, updates map[string]interfa
 	return r.db.Model(&carRegistration.Car{}).Where("id = ?", id).Updates(updates).Error
 }
 
-// Update car status to "Sold"
-func (r *CarRepositoryImpl) UpdateCarStatus(carID uint, status string) error {
-	result := r.db.Model(&carRegistration.Car{}).
-		Where("id = ?", carID).
-		Update("car_status", status)
-
-	if result.Error != nil {
-		return fmt.Errorf("failed to update car status: %w", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("no rows updated, possible invalid car ID or status already set")
-	}
-
-	return nil
-}
-
 func (r *CarRepositoryImpl) GetCompanyNameByID(id uint) (string, error) {
 	var company companyRegistration.Company
 	if err := r.db.Select("name").First(&company, id).Error; err != nil {
@@ -236,12 +234,11 @@ func (r *CarRepositoryImpl) GetInvoiceByID(id uint) (carRegistration.CarShipping
 	return invoice, err
 }
 
-// DeleteByID deletes a car by ID
+// DeleteByID deletes a car by ID, with its expenses, photos and scans
 func (r *CarRepositoryImpl) DeleteByID(id string) error {
-	if err := r.db.Delete(&carRegistration.Car{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return deleteWithDependants(tx, "cars", id)
+	})
 }
 
 // CreateCarExpense creates a new car expense in the database
@@ -377,30 +374,30 @@ func (r *CarRepositoryImpl) GetCarExpensesByFour(carId, expenseDate, expenseDesc
 }
 
 type TotalCarExpense struct {
-	Currency   string  `json:"currency"`
-	DollarRate float64 `json:"dollar_rate"`
-	Total      float64 `json:"total"`
+	Currency   string      `json:"currency"`
+	DollarRate money.Money `json:"dollar_rate"`
+	Total      money.Money `json:"total"`
 }
 
 // CarExpenseResponse represents the response structure for car expenses
 type CarExpenseResponse struct {
-	TotalCarPriceJapan            float64           `json:"total_car_price_japan"`              // Total car price in dollars
-	BidPrice                      float64           `json:"bid_price"`                          // Bid price in dollars
-	VATPrice                      float64           `json:"vat_tax"`                            // VAT price in dollars
-	TotalExpenseJapan             float64           `json:"total_expense_japan"`                // Total expenses in dollars
+	TotalCarPriceJapan            money.Money       `json:"total_car_price_japan"`              // Total car price in dollars
+	BidPrice                      money.Money       `json:"bid_price"`                          // Bid price in dollars
+	VATPrice                      money.Money       `json:"vat_tax"`                            // VAT price in dollars
+	TotalExpenseJapan             money.Money       `json:"total_expense_japan"`                // Total expenses in dollars
 	Expenses                      []TotalCarExpense `json:"expenses"`                           // List of expenses
-	TotalCarPriceAndExpensesJapan float64           `json:"total_car_price_and_expenses_japan"` // Total car price and expenses
-	TotalExpenseOther             float64           `json:"total_expense_other"`                // Total expenses in dollars
+	TotalCarPriceAndExpensesJapan money.Money       `json:"total_car_price_and_expenses_japan"` // Total car price and expenses
+	TotalExpenseOther             money.Money       `json:"total_expense_other"`                // Total expenses in dollars
 }
 
 // GetTotalCarExpenses calculates the total expenses for a given car by its ID
 func (r *CarRepositoryImpl) GetTotalCarExpenses(carID uint) (CarExpenseResponse, error) {
 	var expenses []TotalCarExpense
 	var carDetails struct {
-		Currency   string  `json:"currency"`
-		DollarRate float64 `json:"dollar_rate"`
-		VATTax     float64 `json:"vat_tax"`
-		BidPrice   float64 `json:"bid_price"`
+		Currency   string      `json:"currency"`
+		DollarRate money.Money `json:"dollar_rate"`
+		VATTax     money.Money `json:"vat_tax"`
+		BidPrice   money.Money `json:"bid_price"`
 	}
 
 	// Fetch car details
@@ -439,29 +436,30 @@ func (r *CarRepositoryImpl) GetTotalCarExpenses(carID uint) (CarExpenseResponse,
 		return CarExpenseResponse{}, err
 	}
 
-	totalExpenseYen := 0.0
-	totalExpenseOther := 0.0
+	totalExpenseYen := money.Zero
+	totalExpenseOther := money.Zero
 
-	for _, expense := range expenses {
+	for i, expense := range expenses {
 		if expense.Currency == "JPY" {
-			totalExpenseYen += expense.Total // Sum Yen separately
+			totalExpenseYen = totalExpenseYen.Add(expense.Total) // Sum Yen separately
 		} else {
-			totalExpenseOther += expense.Total // Sum other currencies converted to dollars
+			totalExpenseOther = totalExpenseOther.Add(expense.Total) // Sum other currencies converted to dollars
 		}
+		expenses[i].Total = expense.Total.Round()
 	}
 
 	// Calculate VAT price in dollars
-	vatPrice := (carDetails.BidPrice * carDetails.VATTax / 100) // / carDetails.DollarRate
+	vatPrice := carDetails.BidPrice.Percent(carDetails.VATTax) // / carDetails.DollarRate
 
 	// Prepare the response
 	response := CarExpenseResponse{
-		TotalCarPriceJapan:            (carDetails.BidPrice) + vatPrice,                   // / carDetails.DollarRate // Total car price in dollars
-		BidPrice:                      carDetails.BidPrice,                                // / carDetails.DollarRate,                                      // Bid price in dollars
-		VATPrice:                      vatPrice,                                           // VAT price in dollars
-		TotalExpenseJapan:             totalExpenseYen,                                    // Total expenses in dollars
-		Expenses:                      expenses,                                           // List of expenses
-		TotalCarPriceAndExpensesJapan: (carDetails.BidPrice) + vatPrice + totalExpenseYen, // Total car price and expenses / carDetails.DollarRate
-		TotalExpenseOther:             totalExpenseOther,
+		TotalCarPriceJapan:            carDetails.BidPrice.Add(vatPrice).Round(),                      // / carDetails.DollarRate // Total car price in dollars
+		BidPrice:                      carDetails.BidPrice,                                            // / carDetails.DollarRate,                                      // Bid price in dollars
+		VATPrice:                      vatPrice.Round(),                                               // VAT price in dollars
+		TotalExpenseJapan:             totalExpenseYen.Round(),                                        // Total expenses in dollars
+		Expenses:                      expenses,                                                       // List of expenses
+		TotalCarPriceAndExpensesJapan: carDetails.BidPrice.Add(vatPrice).Add(totalExpenseYen).Round(), // Total car price and expenses / carDetails.DollarRate
+		TotalExpenseOther:             totalExpenseOther.Round(),
 	}
 
 	// If there are no expenses, set expenses to an empty slice
@@ -543,6 +541,10 @@ func (r *CarRepositoryImpl) SearchPaginatedCars(c *fiber.Ctx) (*utils.Pagination
 		query = query.Where("broker_name ILIKE ?", "%"+broker_name+"%")
 	}
 	if car_status != "" {
+		// Statuses are stored in their canonical form ("In stock" is InStock)
+		if status := carRegistration.CanonicalStatus(carRegistration.StatusFieldCar, car_status); status != "" {
+			car_status = status
+		}
 		query = query.Where("car_status = ?", car_status)
 	}
 	if car_payment_status != "" {
@@ -633,17 +635,17 @@ func (r *CarRepositoryImpl) GetCarsInStock() (int64, error) {
 	return count, err
 }
 
-func (r *CarRepositoryImpl) GetTotalMoneySpent() (float64, error) {
-	var total float64
+func (r *CarRepositoryImpl) GetTotalMoneySpent() (money.Money, error) {
+	var total money.Money
 	err := r.db.Model(&carRegistration.Car{}).Select("SUM(bid_price + ((vat_tax * bid_price)/100))").Scan(&total).Error
-	return total, err
+	return total.Round(), err
 }
 
-func (r *CarRepositoryImpl) GetTotalCarsExpenses() (map[string]float64, error) {
+func (r *CarRepositoryImpl) GetTotalCarsExpenses() (map[string]money.Money, error) {
 	var results []struct {
 		Currency   string
-		DollarRate float64
-		Total      float64
+		DollarRate money.Money
+		Total      money.Money
 	}
 
 	err := r.db.Model(&carRegistration.CarExpense{}).
@@ -656,27 +658,31 @@ func (r *CarRepositoryImpl) GetTotalCarsExpenses() (map[string]float64, error) {
 
 	// 🔎 Print raw query results
 	for _, summary := range results {
-		fmt.Printf("Currency: %s | Dollar Rate: %.4f | Total: %.2f\n",
-			summary.Currency, summary.DollarRate, summary.Total)
+		fmt.Printf("Currency: %s | Dollar Rate: %s | Total: %s\n",
+			summary.Currency, summary.DollarRate, summary.Total.StringFixed())
 	}
 
 	// Dynamically build totals
-	totalExpenses := make(map[string]float64)
+	totalExpenses := make(map[string]money.Money)
 
 	for _, res := range results {
 		// Always add original currency
-		totalExpenses[res.Currency] += res.Total
+		totalExpenses[res.Currency] = totalExpenses[res.Currency].Add(res.Total)
 
 		// Convert to USD only if a valid dollar rate exists (> 0)
-		if res.DollarRate > 0 {
+		if res.DollarRate.IsPositive() {
 			if res.Currency == "USD" {
-				totalExpenses["USD"] += res.Total
+				totalExpenses["USD"] = totalExpenses["USD"].Add(res.Total)
 			} else {
-				totalExpenses["USD"] += res.Total / res.DollarRate
+				totalExpenses["USD"] = totalExpenses["USD"].Add(res.Total.Div(res.DollarRate))
 			}
 		}
 	}
 
+	for currency, total := range totalExpenses {
+		totalExpenses[currency] = total.Round()
+	}
+
 	return totalExpenses, nil
 }
 
@@ -693,7 +699,7 @@ func (r *CarRepositoryImpl) GetComTotalCars(companyID uint) (int64, error) {
 func (r *CarRepositoryImpl) GetComCarsInStock(companyID uint) (int64, error) {
 	var count int64
 	err := r.db.Model(&carRegistration.Car{}).
-		Where("to_company_id = ? AND LOWER(car_status) = LOWER(?)", companyID, "In stock").
+		Where("to_company_id = ? AND car_status = ?", companyID, carRegistration.StatusInStock).
 		Count(&count).Error
 	return count, err
 }
@@ -701,13 +707,13 @@ func (r *CarRepositoryImpl) GetComCarsInStock(companyID uint) (int64, error) {
 func (r *CarRepositoryImpl) GetComCarsSold(companyID uint) (int64, error) {
 	var count int64
 	err := r.db.Model(&carRegistration.Car{}).
-		Where("to_company_id = ? AND LOWER(car_status) = LOWER(?)", companyID, "Sold").
+		Where("to_company_id = ? AND car_status = ?", companyID, carRegistration.StatusSold).
 		Count(&count).Error
 	return count, err
 }
 
-func (r *CarRepositoryImpl) GetComTotalMoneySpent(companyID uint) (float64, error) {
-	var total sql.NullFloat64 // Use sql.NullFloat64 to handle NULL
+func (r *CarRepositoryImpl) GetComTotalMoneySpent(companyID uint) (money.Money, error) {
+	var total money.Money // NULL (no cars) scans as zero
 	err := r.db.Model(&carRegistration.Car{}).
 		Where("to_company_id = ?", companyID).
 		Where("cars.deleted_at IS NULL").
@@ -715,21 +721,17 @@ func (r *CarRepositoryImpl) GetComTotalMoneySpent(companyID uint) (float64, erro
 		Scan(&total).Error
 
 	if err != nil {
-		return 0, err
-	}
-
-	if !total.Valid {
-		return 0, nil // Return 0 if there's no data to sum
+		return money.Zero, err
 	}
 
-	return total.Float64, nil // Return the actual value
+	return total.Round(), nil // Return the actual value
 }
 
-func (r *CarRepositoryImpl) GetComTotalCarsExpenses(companyID uint) (map[string]float64, error) {
+func (r *CarRepositoryImpl) GetComTotalCarsExpenses(companyID uint) (map[string]money.Money, error) {
 	var results []struct {
 		Currency   string
-		DollarRate float64
-		Total      float64
+		DollarRate money.Money
+		Total      money.Money
 	}
 
 	err := r.db.Model(&carRegistration.CarExpense{}).
@@ -748,26 +750,30 @@ func (r *CarRepositoryImpl) GetComTotalCarsExpenses(companyID uint) (map[string]
 	// 🔎 Debug print of raw results
 	fmt.Println("Raw results from DB:")
 	for _, res := range results {
-		fmt.Printf("Currency: %s | DollarRate: %.4f | Total: %.2f\n", res.Currency, res.DollarRate, res.Total)
+		fmt.Printf("Currency: %s | DollarRate: %s | Total: %s\n", res.Currency, res.DollarRate, res.Total.StringFixed())
 	}
 
 	// Build totals dynamically for all currencies
-	totalExpenses := make(map[string]float64)
+	totalExpenses := make(map[string]money.Money)
 	for _, res := range results {
 		// If it's USD, no conversion needed
 		if res.Currency == "USD" {
-			totalExpenses["USD"] += res.Total
+			totalExpenses["USD"] = totalExpenses["USD"].Add(res.Total)
 			continue
 		}
 
 		// If no dollar rate provided, skip to avoid division by zero
-		if res.DollarRate == 100 {
+		if res.DollarRate.Equal(money.NewFromInt(100)) {
 			continue
 		}
 
 		// Always convert to USD equivalent and store original currency too
-		totalExpenses[res.Currency] += res.Total
-		totalExpenses["USD"] += res.Total / res.DollarRate
+		totalExpenses[res.Currency] = totalExpenses[res.Currency].Add(res.Total)
+		totalExpenses["USD"] = totalExpenses["USD"].Add(res.Total.Div(res.DollarRate))
+	}
+
+	for currency, total := range totalExpenses {
+		totalExpenses[currency] = total.Round()
 	}
 
 	return totalExpenses, nil
@@ -824,17 +830,39 @@ func (r *CarRepositoryImpl) CreateCarExpenses(expenses []carRegistration.CarExpe
 // }
 
 func (r *CarRepositoryImpl) UpdateCarWithExpenses(car *carRegistration.Car, expenses []carRegistration.CarExpense) error {
+	// Status columns go through the state machine, only when a new status was given
+	var changes []carRegistration.StatusChange
+	for _, field := range statusColumns {
+		var to string
+		switch field {
+		case carRegistration.StatusFieldJapan:
+			to = car.CarStatusJapan
+		case carRegistration.StatusFieldCar:
+			to = car.CarStatus
+		case carRegistration.StatusFieldPayment:
+			to = car.CarPaymentStatus
+		}
+		if to != "" {
+			changes = append(changes, carRegistration.StatusChange{Field: field, To: to, Reason: "Car details updated", By: car.UpdatedBy})
+		}
+	}
+
 	tx := r.db.Begin()
 
 	// 1. Omit currency (and any other sensitive fields you don't want to update)
 	if err := tx.Model(&carRegistration.Car{}).
 		Where("id = ?", car.ID).
-		Omit("currency"). // <---- currency will NOT be updated
+		Omit(append([]string{"currency"}, statusColumns...)...). // <---- currency will NOT be updated
 		Updates(car).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	if err := applyStatusChanges(tx, car, changes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Determine the currency for expense replacements
 	// (Assumes all passed expenses use the same currency)
 	var expenseCurrency string
@@ -889,9 +917,3 @@ func (r *CarRepositoryImpl) DeleteCarPhotos(carID uint) error {
 	// Delete from DB
 	return r.db.Where("car_id = ?", carID).Delete(&carRegistration.CarPhoto{}).Error
 }
-
-func (r *CarRepositoryImpl) UpdateCarStatusByID(carID uint, status string) error {
-	return r.db.Model(&carRegistration.Car{}).
-		Where("id = ?", carID).
-		Update("car_status", status).Error
-}
@@ -3,12 +3,14 @@ package repository
 import (
 	"car-bond/internals/models/companyRegistration"
 	"car-bond/internals/utils"
+	"context"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type CompanyRepository interface {
+	WithContext(ctx context.Context) CompanyRepository
 	CreateCompany(company *companyRegistration.Company) error
 	GetPaginatedCompanies(c *fiber.Ctx) (*utils.Pagination, []companyRegistration.Company, error)
 	GetCompanyByID(id string) (companyRegistration.Company, error)
@@ -48,6 +50,10 @@ func NewCompanyRepository(db *gorm.DB) CompanyRepository {
 	return &CompanyRepositoryImpl{db: db}
 }
 
+func (r *CompanyRepositoryImpl) WithContext(ctx context.Context) CompanyRepository {
+	return NewCompanyRepository(r.db.WithContext(ctx))
+}
+
 func (r *CompanyRepositoryImpl) CreateCompany(company *companyRegistration.Company) error {
 	return r.db.Create(company).Error
 }
@@ -76,12 +82,11 @@ func (r *CompanyRepositoryImpl) UpdateCompany(company *companyRegistration.Compa
 	return r.db.Save(company).Error
 }
 
-// DeleteByID deletes a company by ID
+// DeleteByID deletes a company by ID, with its expenses and locations
 func (r *CompanyRepositoryImpl) DeleteByID(id string) error {
-	if err := r.db.Delete(&companyRegistration.Company{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return deleteWithDependants(tx, "companies", id)
+	})
 }
 
 // CreateCompanyExpense creates a new company expense in the database
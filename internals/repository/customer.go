@@ -4,12 +4,14 @@ import (
 	"car-bond/internals/middleware"
 	"car-bond/internals/models/customerRegistration"
 	"car-bond/internals/utils"
+	"context"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type CustomerRepository interface {
+	WithContext(ctx context.Context) CustomerRepository
 	CreateCustomer(customer *customerRegistration.Customer) error
 	GetPaginatedCustomers(c *fiber.Ctx) (*utils.Pagination, []customerRegistration.Customer, error)
 	GetCustomerAddresses(customerID uint) ([]customerRegistration.CustomerAddress, error)
@@ -47,6 +49,10 @@ func NewCustomerRepository(db *gorm.DB) CustomerRepository {
 	return &CustomerRepositoryImpl{db: db}
 }
 
+func (r *CustomerRepositoryImpl) WithContext(ctx context.Context) CustomerRepository {
+	return NewCustomerRepository(r.db.WithContext(ctx))
+}
+
 func (r *CustomerRepositoryImpl) CreateCustomer(customer *customerRegistration.Customer) error {
 	return r.db.Create(customer).Error
 }
@@ -94,12 +100,11 @@ func (r *CustomerRepositoryImpl) UpdateCustomer(id string, updates map[string]in
 	return r.db.Model(&customerRegistration.Customer{}).Where("id = ?", id).Updates(updates).Error
 }
 
-// DeleteByID deletes a customer by ID
+// DeleteByID deletes a customer by ID, with their contacts and addresses
 func (r *CustomerRepositoryImpl) DeleteByID(id string) error {
-	if err := r.db.Delete(&customerRegistration.Customer{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return deleteWithDependants(tx, "customers", id)
+	})
 }
 
 // CreateCustomerContact creates a new customer contact in the database
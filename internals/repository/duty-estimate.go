@@ -0,0 +1,375 @@
+package repository
+
+import (
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/metaData"
+	"car-bond/internals/money"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoEvaluationMatch  = errors.New("no vehicle evaluation matches the car")
+	ErrDutyVehicleDetails = errors.New("make and manufacture year are required")
+	ErrInvalidAsOfDate    = errors.New("invalid as_of date (expected YYYY-MM-DD)")
+)
+
+// DutyCurrency is the currency duty is assessed and paid in
+const DutyCurrency = "UGX"
+
+// DutyEstimateRemark marks the car expenses written by SaveDutyEstimate so a new estimate replaces them
+const DutyEstimateRemark = "URA duty estimate"
+
+// DutyEstimateRequest describes the vehicle to estimate. When CarID is set the other fields default
+// to the values on the car.
+type DutyEstimateRequest struct {
+	CarID             *uint  `json:"car_id"`
+	Make              string `json:"make"`
+	CarModel          string `json:"car_model"`
+	CC                string `json:"cc"`
+	Year              int    `json:"year"`
+	AsOf              string `json:"as_of"` // YYYY-MM-DD; the valuation and exchange rate of that date are used (default today)
+	ValuationCurrency string `json:"-"`     // currency of the CIF values on the valuation sheet
+}
+
+type DutyLine struct {
+	Tax         string      `json:"tax"`
+	Description string      `json:"description"`
+	Basis       string      `json:"basis"`
+	BaseAmount  money.Money `json:"base_amount"`
+	Rate        money.Money `json:"rate"`
+	Amount      money.Money `json:"amount"`
+}
+
+type DutyEstimate struct {
+	CarID             *uint                        `json:"car_id"`
+	Make              string                       `json:"make"`
+	CarModel          string                       `json:"car_model"`
+	CC                string                       `json:"cc"`
+	Year              int                          `json:"year"`
+	VehicleAge        int                          `json:"vehicle_age"`
+	AsOf              string                       `json:"as_of"`
+	Evaluation        metaData.VehicleEvaluation   `json:"evaluation"`
+	MatchScore        int                          `json:"match_score"`
+	ValuationCurrency string                       `json:"valuation_currency"`
+	CIF               money.Money                  `json:"cif"`
+	Currency          string                       `json:"currency"`
+	CustomsValue      money.Money                  `json:"customs_value"` // CIF in Currency
+	Lines             []DutyLine                   `json:"lines"`
+	Total             money.Money                  `json:"total"`
+	Expenses          []carRegistration.CarExpense `json:"expenses,omitempty"`
+}
+
+type DutyEstimateRepository interface {
+	WithContext(ctx context.Context) DutyEstimateRepository
+	// Rate tables
+	GetDutyRates() ([]metaData.DutyRate, error)
+	GetDutyRateByID(id string) (metaData.DutyRate, error)
+	CreateDutyRate(rate *metaData.DutyRate) error
+	UpdateDutyRate(rate *metaData.DutyRate) error
+	DeleteDutyRateByID(id string) error
+
+	// Estimation
+	FindBestEvaluation(carMake, carModel, cc string, asOf time.Time) (*metaData.VehicleEvaluation, int, error)
+	EstimateDuty(req DutyEstimateRequest) (*DutyEstimate, error)
+	SaveDutyEstimate(estimate *DutyEstimate, updatedBy string) ([]carRegistration.CarExpense, error)
+}
+
+type DutyEstimateRepositoryImpl struct {
+	db    *gorm.DB
+	rates ExchangeRateRepository
+}
+
+func NewDutyEstimateRepository(db *gorm.DB) DutyEstimateRepository {
+	return &DutyEstimateRepositoryImpl{db: db, rates: NewExchangeRateRepository(db)}
+}
+
+func (r *DutyEstimateRepositoryImpl) WithContext(ctx context.Context) DutyEstimateRepository {
+	return NewDutyEstimateRepository(r.db.WithContext(ctx))
+}
+
+func (r *DutyEstimateRepositoryImpl) GetDutyRates() ([]metaData.DutyRate, error) {
+	var rates []metaData.DutyRate
+	err := r.db.Order("tax ASC, min_age ASC, id ASC").Find(&rates).Error
+	return rates, err
+}
+
+func (r *DutyEstimateRepositoryImpl) GetDutyRateByID(id string) (metaData.DutyRate, error) {
+	var rate metaData.DutyRate
+	err := r.db.First(&rate, "id = ?", id).Error
+	return rate, err
+}
+
+func (r *DutyEstimateRepositoryImpl) CreateDutyRate(rate *metaData.DutyRate) error {
+	return r.db.Create(rate).Error
+}
+
+func (r *DutyEstimateRepositoryImpl) UpdateDutyRate(rate *metaData.DutyRate) error {
+	return r.db.Save(rate).Error
+}
+
+func (r *DutyEstimateRepositoryImpl) DeleteDutyRateByID(id string) error {
+	return r.db.Delete(&metaData.DutyRate{}, "id = ?", id).Error
+}
+
+// ====================
+
+// parseCC reads an engine capacity such as "1,500", "1500cc" or "1.5" (litres) as cubic centimetres
+func parseCC(value string) int {
+	value = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(value), ",", ""))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "CC"), "L")
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || f <= 0 {
+		return 0
+	}
+	if f < 20 {
+		f *= 1000 // litres
+	}
+	return int(f + 0.5)
+}
+
+// ccInRange checks a capacity against a sheet value that is either a single figure or a "from-to" band
+func ccInRange(cc int, sheet string) (bool, int) {
+	if from, to, ok := strings.Cut(sheet, "-"); ok {
+		low, high := parseCC(from), parseCC(to)
+		if low > 0 && high > 0 {
+			return cc >= low && cc <= high, 0
+		}
+	}
+	sheetCC := parseCC(sheet)
+	if sheetCC == 0 {
+		return false, -1
+	}
+	diff := cc - sheetCC
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff == 0, diff
+}
+
+// scoreEvaluation rates how well a valuation row describes the vehicle: make and model words found
+// in the description, then the engine capacity (exact or within 10%)
+func scoreEvaluation(evaluation *metaData.VehicleEvaluation, carMake string, modelWords []string, cc int) (int, int) {
+	description := " " + strings.ToUpper(evaluation.Description) + " "
+	score := 0
+	if carMake != "" && strings.Contains(description, carMake) {
+		score += 2
+	}
+	for _, word := range modelWords {
+		if strings.Contains(description, " "+word+" ") {
+			score += 3
+		} else if strings.Contains(description, word) {
+			score++
+		}
+	}
+
+	ccDiff := -1
+	if cc > 0 {
+		exact, diff := ccInRange(cc, evaluation.CC)
+		ccDiff = diff
+		switch {
+		case exact:
+			score += 3
+		case diff >= 0 && diff*10 <= cc:
+			score++
+		}
+	}
+	return score, ccDiff
+}
+
+// FindBestEvaluation picks the valuation row that best matches a make, model and engine capacity,
+// returning it with its match score. Only the valuation in effect on asOf is searched, narrowed by
+// make, or by model when the make is unknown.
+func (r *DutyEstimateRepositoryImpl) FindBestEvaluation(carMake, carModel, cc string, asOf time.Time) (*metaData.VehicleEvaluation, int, error) {
+	carMake = strings.ToUpper(strings.TrimSpace(carMake))
+	modelWords := strings.FieldsFunc(strings.ToUpper(carModel), func(c rune) bool {
+		return c == ' ' || c == '-' || c == '/'
+	})
+
+	evaluations, _, err := evaluationsAsOf(r.db, asOf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var candidates []metaData.VehicleEvaluation
+	if carMake != "" {
+		if err := evaluations.Session(&gorm.Session{}).Where("UPPER(description) LIKE ?", "%"+carMake+"%").Find(&candidates).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(candidates) == 0 && len(modelWords) > 0 {
+		if err := evaluations.Session(&gorm.Session{}).Where("UPPER(description) LIKE ?", "%"+modelWords[0]+"%").Find(&candidates).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+
+	capacity := parseCC(cc)
+	best, bestScore, bestDiff := -1, 0, -1
+	for i := range candidates {
+		score, diff := scoreEvaluation(&candidates[i], carMake, modelWords, capacity)
+		better := score > bestScore ||
+			(score == bestScore && best >= 0 && diff >= 0 && (bestDiff < 0 || diff < bestDiff))
+		if score > 0 && better {
+			best, bestScore, bestDiff = i, score, diff
+		}
+	}
+
+	if best < 0 {
+		return nil, 0, fmt.Errorf("%w: %s %s %s", ErrNoEvaluationMatch, carMake, carModel, cc)
+	}
+	return &candidates[best], bestScore, nil
+}
+
+// EstimateDuty values the vehicle from the best matching valuation row and applies the duty rate
+// tables to it. Percentage lines on the CIF are worked out first so the VAT base can include import duty.
+func (r *DutyEstimateRepositoryImpl) EstimateDuty(req DutyEstimateRequest) (*DutyEstimate, error) {
+	if req.CarID != nil {
+		var car carRegistration.Car
+		if err := r.db.First(&car, *req.CarID).Error; err != nil {
+			return nil, err
+		}
+		if req.Make == "" {
+			req.Make = car.Make
+		}
+		if req.CarModel == "" {
+			req.CarModel = car.CarModel
+		}
+		if req.CC == "" {
+			req.CC = car.EngineCapacity
+		}
+		if req.Year == 0 {
+			req.Year = car.ManufactureYear
+		}
+	}
+	if strings.TrimSpace(req.Make) == "" || req.Year <= 0 {
+		return nil, ErrDutyVehicleDetails
+	}
+
+	asOf := time.Now()
+	if req.AsOf != "" {
+		parsed, err := parseSaleDate(req.AsOf)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAsOfDate, err)
+		}
+		asOf = parsed
+	}
+
+	evaluation, score, err := r.FindBestEvaluation(req.Make, req.CarModel, req.CC, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	age := asOf.Year() - req.Year
+	if age < 0 {
+		age = 0
+	}
+
+	estimate := &DutyEstimate{
+		CarID:             req.CarID,
+		Make:              req.Make,
+		CarModel:          req.CarModel,
+		CC:                req.CC,
+		Year:              req.Year,
+		VehicleAge:        age,
+		AsOf:              asOf.Format("2006-01-02"),
+		Evaluation:        *evaluation,
+		MatchScore:        score,
+		ValuationCurrency: req.ValuationCurrency,
+		CIF:               evaluation.CIF,
+		Currency:          DutyCurrency,
+		Lines:             []DutyLine{},
+	}
+
+	estimate.CustomsValue, err = r.rates.Convert(estimate.CIF, req.ValuationCurrency, DutyCurrency, asOf)
+	if err != nil {
+		return nil, err
+	}
+	estimate.CustomsValue = estimate.CustomsValue.Round()
+
+	var rates []metaData.DutyRate
+	if err := r.db.Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	// CIF based lines first, then the lines whose base includes import duty
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].Basis != metaData.DutyBasisCIFDuty && rates[j].Basis == metaData.DutyBasisCIFDuty
+	})
+
+	importDuty := money.Zero
+	for i := range rates {
+		rate := &rates[i]
+		if !rate.AppliesToAge(age) {
+			continue
+		}
+
+		line := DutyLine{Tax: rate.Tax, Description: rate.Description, Basis: rate.Basis, Rate: rate.Rate}
+		switch {
+		case rate.Rate.IsPositive() && rate.Basis == metaData.DutyBasisCIFDuty:
+			line.BaseAmount = estimate.CustomsValue.Add(importDuty)
+			line.Amount = line.BaseAmount.Percent(rate.Rate).Round()
+		case rate.Rate.IsPositive():
+			line.BaseAmount = estimate.CustomsValue
+			line.Amount = line.BaseAmount.Percent(rate.Rate).Round()
+		default:
+			line.Amount = rate.Amount.Round()
+		}
+		if line.Amount.IsZero() {
+			continue
+		}
+
+		if rate.Tax == metaData.DutyTaxImportDuty {
+			importDuty = importDuty.Add(line.Amount)
+		}
+		estimate.Lines = append(estimate.Lines, line)
+		estimate.Total = estimate.Total.Add(line.Amount)
+	}
+
+	return estimate, nil
+}
+
+// SaveDutyEstimate records the estimate lines as expenses on its car, replacing the expenses of any
+// earlier estimate
+func (r *DutyEstimateRepositoryImpl) SaveDutyEstimate(estimate *DutyEstimate, updatedBy string) ([]carRegistration.CarExpense, error) {
+	if estimate.CarID == nil {
+		return nil, errors.New("a car is required to save the estimate")
+	}
+
+	expenseDate := time.Now().Format("2006-01-02")
+	expenses := make([]carRegistration.CarExpense, 0, len(estimate.Lines))
+	for _, line := range estimate.Lines {
+		expenses = append(expenses, carRegistration.CarExpense{
+			CarID:         *estimate.CarID,
+			Description:   line.Description,
+			Currency:      estimate.Currency,
+			Amount:        line.Amount,
+			ExpenseDate:   expenseDate,
+			Destination:   "Uganda",
+			CompanyName:   "Uganda Revenue Authority",
+			ExpenseRemark: DutyEstimateRemark,
+			CreatedBy:     updatedBy,
+			UpdatedBy:     updatedBy,
+		})
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("car_id = ? AND expense_remark = ?", *estimate.CarID, DutyEstimateRemark).
+			Delete(&carRegistration.CarExpense{}).Error; err != nil {
+			return fmt.Errorf("failed to clear previous estimate: %w", err)
+		}
+		if len(expenses) == 0 {
+			return nil
+		}
+		return tx.Create(&expenses).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/metaData"
+	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
+	"car-bond/internals/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrRateNotFound    = errors.New("exchange rate not found")
+)
+
+// PivotCurrency is used for cross rates when no direct rate between two currencies exists
+const PivotCurrency = "USD"
+
+// ReportCurrencies are the currencies car and sale totals are reported in
+var ReportCurrencies = []string{"JPY", "USD", "UGX"}
+
+type ExchangeRateRepository interface {
+	WithContext(ctx context.Context) ExchangeRateRepository
+	CreateExchangeRate(rate *metaData.ExchangeRate) error
+	GetPaginatedExchangeRates(c *fiber.Ctx) (*utils.Pagination, []metaData.ExchangeRate, error)
+	GetExchangeRateByID(id string) (metaData.ExchangeRate, error)
+	UpdateExchangeRate(rate *metaData.ExchangeRate) error
+	DeleteExchangeRateByID(id string) error
+
+	// Conversion
+	NormalizeCurrency(currency string) (string, error)
+	FindRate(base, quote string, on time.Time) (money.Money, error)
+	Convert(amount money.Money, from, to string, on time.Time) (money.Money, error)
+	GetCarCurrencyTotals(carID uint) (*CurrencyTotals, error)
+	GetSaleCurrencyTotals(saleID uint) (*CurrencyTotals, error)
+}
+
+type ExchangeRateRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewExchangeRateRepository(db *gorm.DB) ExchangeRateRepository {
+	return &ExchangeRateRepositoryImpl{db: db}
+}
+
+func (r *ExchangeRateRepositoryImpl) WithContext(ctx context.Context) ExchangeRateRepository {
+	return NewExchangeRateRepository(r.db.WithContext(ctx))
+}
+
+func (r *ExchangeRateRepositoryImpl) CreateExchangeRate(rate *metaData.ExchangeRate) error {
+	return r.db.Create(rate).Error
+}
+
+func (r *ExchangeRateRepositoryImpl) GetPaginatedExchangeRates(c *fiber.Ctx) (*utils.Pagination, []metaData.ExchangeRate, error) {
+	base := strings.ToUpper(c.Query("base_currency"))
+	quote := strings.ToUpper(c.Query("quote_currency"))
+	from := c.Query("from")
+	to := c.Query("to")
+
+	query := r.db.Model(&metaData.ExchangeRate{}).Order("rate_date DESC")
+
+	if base != "" {
+		query = query.Where("base_currency = ?", base)
+	}
+	if quote != "" {
+		query = query.Where("quote_currency = ?", quote)
+	}
+	if from != "" {
+		query = query.Where("rate_date >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("rate_date <= ?", to)
+	}
+
+	pagination, rates, err := utils.Paginate(c, query, metaData.ExchangeRate{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pagination, rates, nil
+}
+
+func (r *ExchangeRateRepositoryImpl) GetExchangeRateByID(id string) (metaData.ExchangeRate, error) {
+	var rate metaData.ExchangeRate
+	err := r.db.First(&rate, "id = ?", id).Error
+	return rate, err
+}
+
+func (r *ExchangeRateRepositoryImpl) UpdateExchangeRate(rate *metaData.ExchangeRate) error {
+	return r.db.Save(rate).Error
+}
+
+func (r *ExchangeRateRepositoryImpl) DeleteExchangeRateByID(id string) error {
+	return r.db.Delete(&metaData.ExchangeRate{}, "id = ?", id).Error
+}
+
+// ====================
+
+// NormalizeCurrency maps a currency code, symbol or name from the currencies table to its ISO code
+func (r *ExchangeRateRepositoryImpl) NormalizeCurrency(currency string) (string, error) {
+	value := strings.ToUpper(strings.TrimSpace(currency))
+	if value == "" {
+		return "", fmt.Errorf("%w: empty", ErrUnknownCurrency)
+	}
+
+	var found metaData.Currency
+	result := r.db.
+		Where("UPPER(code) = ? OR UPPER(symbol) = ? OR UPPER(name) = ?", value, value, value).
+		Limit(1).
+		Find(&found)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnknownCurrency, currency)
+	}
+	if found.Code != "" {
+		return strings.ToUpper(found.Code), nil
+	}
+	return strings.ToUpper(found.Symbol), nil
+}
+
+// FindRate returns how many units of quote one unit of base was worth on the given date, using the
+// latest rate on or before that date. Inverse rates and cross rates through USD are used when no
+// direct rate is stored.
+func (r *ExchangeRateRepositoryImpl) FindRate(base, quote string, on time.Time) (money.Money, error) {
+	base, err := r.NormalizeCurrency(base)
+	if err != nil {
+		return money.Zero, err
+	}
+	quote, err = r.NormalizeCurrency(quote)
+	if err != nil {
+		return money.Zero, err
+	}
+	if base == quote {
+		return money.NewFromInt(1), nil
+	}
+
+	rate, found, err := r.findPairRate(base, quote, on)
+	if err != nil || found {
+		return rate, err
+	}
+
+	if base != PivotCurrency && quote != PivotCurrency {
+		toPivot, foundBase, err := r.findPairRate(base, PivotCurrency, on)
+		if err != nil {
+			return money.Zero, err
+		}
+		fromPivot, foundQuote, err := r.findPairRate(PivotCurrency, quote, on)
+		if err != nil {
+			return money.Zero, err
+		}
+		if foundBase && foundQuote {
+			return toPivot.Mul(fromPivot), nil
+		}
+	}
+
+	return money.Zero, fmt.Errorf("%w: %s/%s on %s", ErrRateNotFound, base, quote, on.Format("2006-01-02"))
+}
+
+// findPairRate looks for a stored base/quote rate, falling back to the inverse quote/base rate
+func (r *ExchangeRateRepositoryImpl) findPairRate(base, quote string, on time.Time) (money.Money, bool, error) {
+	date := on.Format("2006-01-02")
+
+	var rate metaData.ExchangeRate
+	result := r.db.
+		Where("base_currency = ? AND quote_currency = ? AND rate_date <= ?", base, quote, date).
+		Order("rate_date DESC").
+		Limit(1).
+		Find(&rate)
+	if result.Error != nil {
+		return money.Zero, false, result.Error
+	}
+	if result.RowsAffected > 0 && !rate.Rate.IsZero() {
+		return rate.Rate, true, nil
+	}
+
+	result = r.db.
+		Where("base_currency = ? AND quote_currency = ? AND rate_date <= ?", quote, base, date).
+		Order("rate_date DESC").
+		Limit(1).
+		Find(&rate)
+	if result.Error != nil {
+		return money.Zero, false, result.Error
+	}
+	if result.RowsAffected > 0 && !rate.Rate.IsZero() {
+		return money.NewFromInt(1).Div(rate.Rate), true, nil
+	}
+
+	return money.Zero, false, nil
+}
+
+// Convert converts an amount between two currencies at the rate of the given date
+func (r *ExchangeRateRepositoryImpl) Convert(amount money.Money, from, to string, on time.Time) (money.Money, error) {
+	rate, err := r.FindRate(from, to, on)
+	if err != nil {
+		return money.Zero, err
+	}
+	return amount.Mul(rate), nil
+}
+
+// ====================
+
+type CurrencyTotalLine struct {
+	Description string                 `json:"description"`
+	Currency    string                 `json:"currency"`
+	Date        string                 `json:"date"`
+	Amount      money.Money            `json:"amount"`
+	Converted   map[string]money.Money `json:"converted"`
+}
+
+// CurrencyTotals reports amounts in every ReportCurrencies entry, each line converted at the
+// rate of its own transaction date. Lines that could not be converted are listed in Unconverted.
+type CurrencyTotals struct {
+	Totals      map[string]money.Money `json:"totals"`
+	Lines       []CurrencyTotalLine    `json:"lines"`
+	Unconverted []string               `json:"unconverted"`
+}
+
+func (r *ExchangeRateRepositoryImpl) buildCurrencyTotals(lines []CurrencyTotalLine) *CurrencyTotals {
+	totals := &CurrencyTotals{Totals: make(map[string]money.Money), Unconverted: []string{}}
+	for _, currency := range ReportCurrencies {
+		totals.Totals[currency] = money.Zero
+	}
+
+	for _, line := range lines {
+		line.Converted = make(map[string]money.Money)
+		on, err := parseSaleDate(line.Date)
+		if err != nil {
+			on = time.Now()
+		}
+
+		for _, currency := range ReportCurrencies {
+			converted, err := r.Convert(line.Amount, line.Currency, currency, on)
+			if err != nil {
+				totals.Unconverted = append(totals.Unconverted, fmt.Sprintf("%s: %v", line.Description, err))
+				continue
+			}
+			line.Converted[currency] = converted.Round()
+			totals.Totals[currency] = totals.Totals[currency].Add(converted)
+		}
+		totals.Lines = append(totals.Lines, line)
+	}
+
+	for currency, total := range totals.Totals {
+		totals.Totals[currency] = total.Round()
+	}
+	return totals
+}
+
+// GetCarCurrencyTotals reports the bid price, VAT and every expense of a car in JPY, USD and UGX
+func (r *ExchangeRateRepositoryImpl) GetCarCurrencyTotals(carID uint) (*CurrencyTotals, error) {
+	var car carRegistration.Car
+	if err := r.db.First(&car, carID).Error; err != nil {
+		return nil, err
+	}
+
+	var expenses []carRegistration.CarExpense
+	if err := r.db.Where("car_id = ?", carID).Order("expense_date ASC").Find(&expenses).Error; err != nil {
+		return nil, err
+	}
+
+	lines := []CurrencyTotalLine{
+		{Description: "Bid price", Currency: car.Currency, Date: car.PurchaseDate, Amount: car.BidPrice},
+	}
+	if !car.VATTax.IsZero() {
+		lines = append(lines, CurrencyTotalLine{
+			Description: "VAT", Currency: car.Currency, Date: car.PurchaseDate,
+			Amount: car.BidPrice.Percent(car.VATTax),
+		})
+	}
+	for _, expense := range expenses {
+		lines = append(lines, CurrencyTotalLine{
+			Description: expense.Description,
+			Currency:    expense.Currency,
+			Date:        expense.ExpenseDate,
+			Amount:      expense.Amount.Add(expense.Amount.Percent(expense.ExpenseVAT)),
+		})
+	}
+
+	return r.buildCurrencyTotals(lines), nil
+}
+
+// GetSaleCurrencyTotals reports the balance of a sale in JPY, USD and UGX: the price at the sale
+// date rate minus each payment at the rate of its payment date
+func (r *ExchangeRateRepositoryImpl) GetSaleCurrencyTotals(saleID uint) (*CurrencyTotals, error) {
+	var sale saleRegistration.Sale
+	if err := r.db.First(&sale, saleID).Error; err != nil {
+		return nil, err
+	}
+
+	var payments []saleRegistration.SalePayment
+	if err := r.db.Where("sale_id = ?", saleID).Order("payment_date ASC").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	lines := []CurrencyTotalLine{
+		{Description: "Sale price", Currency: sale.Currency, Date: sale.SaleDate, Amount: sale.TotalPrice},
+	}
+	for _, payment := range payments {
+		lines = append(lines, CurrencyTotalLine{
+			Description: fmt.Sprintf("Payment #%d", payment.ID),
+			Currency:    sale.Currency,
+			Date:        payment.PaymentDate,
+			Amount:      payment.AmountPayed.Neg(),
+		})
+	}
+
+	return r.buildCurrencyTotals(lines), nil
+}
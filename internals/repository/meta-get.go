@@ -2,13 +2,16 @@ package repository
 
 import (
 	"car-bond/internals/models/metaData"
+	"context"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type MetaGetRepository interface {
-	FindEvaluationsByDescription(description string) ([]metaData.VehicleEvaluation, error)
+	WithContext(ctx context.Context) MetaGetRepository
+	FindEvaluationsByDescription(description string, asOf time.Time) ([]metaData.VehicleEvaluation, error)
 	GetAllWeightUnits(c *fiber.Ctx) ([]metaData.WeightUnit, error)
 	GetAllLeightUnits(c *fiber.Ctx) ([]metaData.LeightUnit, error)
 	GetAllCurrencies(c *fiber.Ctx) ([]metaData.Currency, error)
@@ -26,9 +29,19 @@ func NewMetaGetRepository(db *gorm.DB) MetaGetRepository {
 	return &MetaGetRepositoryImpl{db: db}
 }
 
-func (m *MetaGetRepositoryImpl) FindEvaluationsByDescription(description string) ([]metaData.VehicleEvaluation, error) {
+func (m *MetaGetRepositoryImpl) WithContext(ctx context.Context) MetaGetRepository {
+	return NewMetaGetRepository(m.db.WithContext(ctx))
+}
+
+// FindEvaluationsByDescription searches the valuation that was in effect on asOf
+func (m *MetaGetRepositoryImpl) FindEvaluationsByDescription(description string, asOf time.Time) ([]metaData.VehicleEvaluation, error) {
+	query, _, err := evaluationsAsOf(m.db, asOf)
+	if err != nil {
+		return nil, err
+	}
+
 	var evaluations []metaData.VehicleEvaluation
-	if err := m.db.Where("description LIKE ?", "%"+description+"%").Find(&evaluations).Error; err != nil {
+	if err := query.Where("description LIKE ?", "%"+description+"%").Find(&evaluations).Error; err != nil {
 		return nil, err
 	}
 	return evaluations, nil
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/utils"
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NotificationLogRepository interface {
+	WithContext(ctx context.Context) NotificationLogRepository
+	FindNotificationLog(saleID uint, dueDate, channel string) (*alertRegistration.NotificationLog, error)
+	SaveNotificationLog(entry *alertRegistration.NotificationLog) error
+	GetPaginatedNotificationLogs(c *fiber.Ctx) (*utils.Pagination, []alertRegistration.NotificationLog, error)
+}
+
+type NotificationLogRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewNotificationLogRepository(db *gorm.DB) NotificationLogRepository {
+	return &NotificationLogRepositoryImpl{db: db}
+}
+
+func (r *NotificationLogRepositoryImpl) WithContext(ctx context.Context) NotificationLogRepository {
+	return NewNotificationLogRepository(r.db.WithContext(ctx))
+}
+
+// FindNotificationLog returns the reminder already recorded for a sale, due date and channel, or nil
+func (r *NotificationLogRepositoryImpl) FindNotificationLog(saleID uint, dueDate, channel string) (*alertRegistration.NotificationLog, error) {
+	var entry alertRegistration.NotificationLog
+	err := r.db.Where("sale_id = ? AND due_date = ? AND channel = ?", saleID, dueDate, channel).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// SaveNotificationLog inserts the entry or, on a retry, overwrites the previous attempt
+func (r *NotificationLogRepositoryImpl) SaveNotificationLog(entry *alertRegistration.NotificationLog) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sale_id"}, {Name: "due_date"}, {Name: "channel"}},
+		DoUpdates: clause.AssignmentColumns([]string{"recipient", "message", "amount_due", "status", "error", "attempts", "sent_at", "updated_at"}),
+	}).Create(entry).Error
+}
+
+func (r *NotificationLogRepositoryImpl) GetPaginatedNotificationLogs(c *fiber.Ctx) (*utils.Pagination, []alertRegistration.NotificationLog, error) {
+	saleID := c.Query("sale_id")
+	channel := c.Query("channel")
+	status := c.Query("status")
+	from := c.Query("from")
+	to := c.Query("to")
+
+	query := r.db.Model(&alertRegistration.NotificationLog{}).Order("sent_at DESC")
+
+	if saleID != "" {
+		if _, err := strconv.Atoi(saleID); err == nil {
+			query = query.Where("sale_id = ?", saleID)
+		}
+	}
+	if channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if from != "" {
+		query = query.Where("due_date >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("due_date <= ?", to)
+	}
+
+	pagination, logs, err := utils.Paginate(c, query, alertRegistration.NotificationLog{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pagination, logs, nil
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"car-bond/internals/config"
+	"car-bond/internals/models/userRegistration"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultPasswordResetTTL is how long a reset token works when PASSWORD_RESET_TTL_MINUTES is not set
+const defaultPasswordResetTTL = time.Hour
+
+// ErrInvalidResetToken covers unknown, expired and already used reset tokens alike
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+type PasswordRepository interface {
+	WithContext(ctx context.Context) PasswordRepository
+	CreateResetToken(userID uint, requestedBy string) (string, time.Time, error)
+	FindResetTokenUser(raw string) (*userRegistration.User, error)
+	ResetPassword(raw, hash string) error
+	ChangePassword(userID uint, hash string) error
+}
+
+type PasswordRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewPasswordRepository(db *gorm.DB) PasswordRepository {
+	return &PasswordRepositoryImpl{db: db}
+}
+
+func (r *PasswordRepositoryImpl) WithContext(ctx context.Context) PasswordRepository {
+	return NewPasswordRepository(r.db.WithContext(ctx))
+}
+
+// PasswordResetTTL is how long a reset token works (PASSWORD_RESET_TTL_MINUTES, an hour by default)
+func PasswordResetTTL() time.Duration {
+	if minutes, err := strconv.Atoi(config.Config("PASSWORD_RESET_TTL_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultPasswordResetTTL
+}
+
+// CreateResetToken hands out a reset token for the user and returns it with its expiry; only its hash is
+// stored. Tokens issued before stop working, so only the latest email counts.
+func (r *PasswordRepositoryImpl) CreateResetToken(userID uint, requestedBy string) (string, time.Time, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(secret)
+	now := time.Now()
+	token := userRegistration.PasswordResetToken{
+		UserID:      userID,
+		TokenHash:   hashToken(raw),
+		ExpiresAt:   now.Add(PasswordResetTTL()),
+		RequestedBy: requestedBy,
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&userRegistration.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&token).Error
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return raw, token.ExpiresAt, nil
+}
+
+// FindResetTokenUser returns the user of a reset token that can still be used
+func (r *PasswordRepositoryImpl) FindResetTokenUser(raw string) (*userRegistration.User, error) {
+	var token userRegistration.PasswordResetToken
+	err := r.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(raw), time.Now()).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	var user userRegistration.User
+	if err := r.db.First(&user, token.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ResetPassword uses up a reset token, sets the password hash of its user and revokes every session of
+// the user
+func (r *PasswordRepositoryImpl) ResetPassword(raw, hash string) error {
+	var token userRegistration.PasswordResetToken
+	if err := r.db.Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Only one request can use the token, even when two race with it
+		result := tx.Model(&userRegistration.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", token.ID, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		if err := setPassword(tx, token.UserID, hash, now); err != nil {
+			return err
+		}
+		return NewTokenRepository(tx).RevokeAllSessions(token.UserID, "password reset")
+	})
+}
+
+// ChangePassword sets the password hash of the user and revokes every session of the user
+func (r *PasswordRepositoryImpl) ChangePassword(userID uint, hash string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, userID, hash, time.Now()); err != nil {
+			return err
+		}
+		return NewTokenRepository(tx).RevokeAllSessions(userID, "password changed")
+	})
+}
+
+// setPassword stores a new password hash and lifts any forced change
+func setPassword(db *gorm.DB, userID uint, hash string, at time.Time) error {
+	result := db.Model(&userRegistration.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":             hash,
+		"must_change_password": false,
+		"password_changed_at":  at,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+package repository
+
+import (
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/companyRegistration"
+	"car-bond/internals/models/customerRegistration"
+	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownBinEntity = errors.New("unknown recycle bin entity")
+	ErrNotDeleted       = errors.New("record is not in the recycle bin")
+	ErrRestoreConflict  = errors.New("record cannot be restored")
+)
+
+// restoreWindow is how far apart a record and its dependants may have been deleted to count as
+// one delete; rows of a dependant deleted on their own earlier stay deleted
+const restoreWindow = time.Minute
+
+// orphanGrace keeps files younger than this, which may belong to an upload still in progress
+const orphanGrace = time.Hour
+
+// uploadDirs hold the files the purge looks for orphans in
+var uploadDirs = []string{"uploads/car_files", "uploads/customer_files", "uploads/deposit_scans"}
+
+// binDependant is a table whose rows are deleted and restored with their parent
+type binDependant struct {
+	Model interface{}
+	Where string // selects the rows of one parent; ? is the parent ID
+}
+
+// binEntity is a kind of record the recycle bin lists and restores
+type binEntity struct {
+	Model      interface{}
+	Dependants []binDependant
+	// BeforeRestore refuses a restore that would leave the data inconsistent
+	BeforeRestore func(tx *gorm.DB, id uint) error
+	// AfterRestore brings derived state back in line with the restored rows
+	AfterRestore func(tx *gorm.DB, id uint, by string) error
+}
+
+// recycleBin lists the entities of the recycle bin by the name used in the URL
+var recycleBin = map[string]binEntity{
+	"sales": {
+		Model: &saleRegistration.Sale{},
+		Dependants: []binDependant{
+			{&saleRegistration.SalePaymentMode{}, "sale_payment_id IN (SELECT id FROM sale_payments WHERE sale_id = ?)"},
+			{&saleRegistration.SalePaymentDeposit{}, "sale_payment_id IN (SELECT id FROM sale_payments WHERE sale_id = ?)"},
+			{&saleRegistration.SalePayment{}, "sale_id = ?"},
+			{&saleRegistration.SaleInstallment{}, "sale_id = ?"},
+		},
+		BeforeRestore: beforeSaleRestore,
+		AfterRestore:  afterSaleRestore,
+	},
+	"cars": {
+		Model: &carRegistration.Car{},
+		Dependants: []binDependant{
+			{&carRegistration.CarExpense{}, "car_id = ?"},
+			{&carRegistration.CarPhoto{}, "car_id = ?"},
+			{&carRegistration.CarScan{}, "car_id = ?"},
+		},
+	},
+	"customers": {
+		Model: &customerRegistration.Customer{},
+		Dependants: []binDependant{
+			{&customerRegistration.CustomerContact{}, "customer_id = ?"},
+			{&customerRegistration.CustomerAddress{}, "customer_id = ?"},
+		},
+	},
+	"shipping-invoices": {
+		Model: &carRegistration.CarShippingInvoice{},
+		Dependants: []binDependant{
+			{&carRegistration.VoyageMilestone{}, "car_shipping_invoice_id = ?"},
+			{&carRegistration.ShippingContainer{}, "car_shipping_invoice_id = ?"},
+		},
+	},
+	"users": {
+		Model: &userRegistration.User{},
+	},
+	"companies": {
+		Model: &companyRegistration.Company{},
+		Dependants: []binDependant{
+			{&companyRegistration.CompanyExpense{}, "company_id = ?"},
+			{&companyRegistration.CompanyLocation{}, "company_id = ?"},
+		},
+	},
+}
+
+// purgeOrder deletes what references other records before what it references
+var purgeOrder = []string{"sales", "cars", "customers", "shipping-invoices", "users", "companies"}
+
+func binEntityOf(name string) (binEntity, error) {
+	entity, ok := recycleBin[name]
+	if !ok {
+		return binEntity{}, fmt.Errorf("%w %q (one of %s)", ErrUnknownBinEntity, name, strings.Join(purgeOrder, ", "))
+	}
+	return entity, nil
+}
+
+func tableOf(db *gorm.DB, model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+// newModel returns a fresh value of the model type, so the shared registry values are never written to
+func newModel(model interface{}) interface{} {
+	return reflect.New(reflect.TypeOf(model).Elem()).Interface()
+}
+
+// deleteWithDependants soft-deletes a record and the rows of its dependants in tx
+func deleteWithDependants(tx *gorm.DB, name string, id interface{}) error {
+	entity, err := binEntityOf(name)
+	if err != nil {
+		return err
+	}
+	for _, dependant := range entity.Dependants {
+		if err := tx.Where(dependant.Where, id).Delete(newModel(dependant.Model)).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(newModel(entity.Model), "id = ?", id).Error
+}
+
+// ====================
+
+func beforeSaleRestore(tx *gorm.DB, id uint) error {
+	var sale saleRegistration.Sale
+	if err := tx.Unscoped().First(&sale, id).Error; err != nil {
+		return err
+	}
+	var car carRegistration.Car
+	if err := tx.Select("id").First(&car, sale.CarID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: car %d of the sale is deleted; restore it first", ErrRestoreConflict, sale.CarID)
+		}
+		return err
+	}
+	var other int64
+	if err := tx.Model(&saleRegistration.Sale{}).Where("car_id = ? AND id <> ?", sale.CarID, id).Count(&other).Error; err != nil {
+		return err
+	}
+	if other > 0 {
+		return fmt.Errorf("%w: car %d has been sold again", ErrRestoreConflict, sale.CarID)
+	}
+	return nil
+}
+
+// afterSaleRestore marks the car sold again and recomputes its payment status from the restored payments
+func afterSaleRestore(tx *gorm.DB, id uint, by string) error {
+	var sale saleRegistration.Sale
+	if err := tx.First(&sale, id).Error; err != nil {
+		return err
+	}
+	if _, err := carRegistration.ChangeCarStatus(tx, sale.CarID, carRegistration.StatusChange{
+		Field:              carRegistration.StatusFieldCar,
+		To:                 carRegistration.StatusSold,
+		Reason:             fmt.Sprintf("Sale %d restored", id),
+		By:                 by,
+		AllowInTransitSale: true, // it was sold before
+	}); err != nil {
+		return err
+	}
+	return SyncCarPaymentStatus(tx, id, by)
+}
+
+// ====================
+
+// RecycleBinItem is a soft-deleted record with who deleted it and when
+type RecycleBinItem struct {
+	Entity    string                 `json:"entity"`
+	ID        interface{}            `json:"id"`
+	DeletedAt interface{}            `json:"deleted_at"`
+	DeletedBy string                 `json:"deleted_by"` // empty when the delete predates the audit log
+	RequestID string                 `json:"request_id"`
+	Record    map[string]interface{} `json:"record"`
+}
+
+// RestoreResult tells how many rows of each table came back
+type RestoreResult struct {
+	Entity   string         `json:"entity"`
+	ID       uint           `json:"id"`
+	Restored map[string]int `json:"restored"`
+}
+
+// PurgeResult tells what a purge removed
+type PurgeResult struct {
+	DeletedBefore time.Time      `json:"deleted_before"`
+	Purged        map[string]int `json:"purged"`
+	Kept          map[string]int `json:"kept"` // expired rows live rows still reference
+	FilesRemoved  []string       `json:"files_removed"`
+}
+
+type RecycleBinRepository interface {
+	WithContext(ctx context.Context) RecycleBinRepository
+	CountDeleted() (map[string]int64, error)
+	GetPaginatedDeleted(c *fiber.Ctx, entity string) (*utils.Pagination, []RecycleBinItem, error)
+	Restore(entity string, id uint, by string) (*RestoreResult, error)
+	Purge(retention time.Duration) (*PurgeResult, error)
+}
+
+type RecycleBinRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRecycleBinRepository(db *gorm.DB) RecycleBinRepository {
+	return &RecycleBinRepositoryImpl{db: db}
+}
+
+func (r *RecycleBinRepositoryImpl) WithContext(ctx context.Context) RecycleBinRepository {
+	return NewRecycleBinRepository(r.db.WithContext(ctx))
+}
+
+// CountDeleted counts the records in the recycle bin per entity
+func (r *RecycleBinRepositoryImpl) CountDeleted() (map[string]int64, error) {
+	counts := make(map[string]int64, len(recycleBin))
+	for name, entity := range recycleBin {
+		var count int64
+		if err := r.db.Unscoped().Model(newModel(entity.Model)).Where("deleted_at IS NOT NULL").Count(&count).Error; err != nil {
+			return nil, err
+		}
+		counts[name] = count
+	}
+	return counts, nil
+}
+
+// GetPaginatedDeleted lists the deleted records of an entity, most recently deleted first
+func (r *RecycleBinRepositoryImpl) GetPaginatedDeleted(c *fiber.Ctx, name string) (*utils.Pagination, []RecycleBinItem, error) {
+	entity, err := binEntityOf(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	table, err := tableOf(r.db, entity.Model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit < 1 {
+		limit = 10
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	query := r.db.Table(table).Where("deleted_at IS NOT NULL")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count deleted %s: %w", name, err)
+	}
+	var rows []map[string]interface{}
+	if err := query.Order("deleted_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve deleted %s: %w", name, err)
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, fmt.Sprint(row["id"]))
+	}
+	deletes := make(map[string]alertRegistration.AuditLog, len(ids))
+	if len(ids) > 0 {
+		var logs []alertRegistration.AuditLog
+		if err := r.db.Select("record_id, username, request_id").
+			Where("table_name = ? AND operation = ? AND record_id IN ?", table, alertRegistration.AuditDelete, ids).
+			Order("id DESC").Find(&logs).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to find who deleted the %s: %w", name, err)
+		}
+		for _, log := range logs {
+			if _, seen := deletes[log.RecordID]; !seen {
+				deletes[log.RecordID] = log // the latest delete, should the record have been restored before
+			}
+		}
+	}
+
+	items := make([]RecycleBinItem, 0, len(rows))
+	for _, row := range rows {
+		deleted := deletes[fmt.Sprint(row["id"])]
+		items = append(items, RecycleBinItem{
+			Entity:    name,
+			ID:        row["id"],
+			DeletedAt: row["deleted_at"],
+			DeletedBy: deleted.Username,
+			RequestID: deleted.RequestID,
+			Record:    row,
+		})
+	}
+
+	pagination := utils.Pagination{
+		Page:         page,
+		Limit:        limit,
+		TotalItems:   total,
+		TotalPages:   int((total + int64(limit) - 1) / int64(limit)),
+		CurrentPage:  page,
+		ItemsPerPage: limit,
+	}
+	return &pagination, items, nil
+}
+
+// Restore undeletes a record together with the dependant rows deleted with it
+func (r *RecycleBinRepositoryImpl) Restore(name string, id uint, by string) (*RestoreResult, error) {
+	entity, err := binEntityOf(name)
+	if err != nil {
+		return nil, err
+	}
+	result := &RestoreResult{Entity: name, ID: id, Restored: make(map[string]int)}
+
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		var record struct {
+			DeletedAt gorm.DeletedAt
+		}
+		if err := tx.Unscoped().Model(newModel(entity.Model)).Select("deleted_at").Where("id = ?", id).Take(&record).Error; err != nil {
+			return err
+		}
+		if !record.DeletedAt.Valid {
+			return fmt.Errorf("%w: %s %d", ErrNotDeleted, name, id)
+		}
+		if entity.BeforeRestore != nil {
+			if err := entity.BeforeRestore(tx, id); err != nil {
+				return err
+			}
+		}
+
+		restored := tx.Unscoped().Model(newModel(entity.Model)).Where("id = ?", id).Update("deleted_at", nil)
+		if restored.Error != nil {
+			return restored.Error
+		}
+		table, err := tableOf(tx, entity.Model)
+		if err != nil {
+			return err
+		}
+		result.Restored[table] = int(restored.RowsAffected)
+
+		deletedAt := record.DeletedAt.Time
+		for _, dependant := range entity.Dependants {
+			rows := tx.Unscoped().Model(newModel(dependant.Model)).
+				Where(dependant.Where, id).
+				Where("deleted_at BETWEEN ? AND ?", deletedAt.Add(-restoreWindow), deletedAt.Add(restoreWindow)).
+				Update("deleted_at", nil)
+			if rows.Error != nil {
+				return rows.Error
+			}
+			if table, err := tableOf(tx, dependant.Model); err == nil && rows.RowsAffected > 0 {
+				result.Restored[table] = int(rows.RowsAffected)
+			}
+		}
+
+		if entity.AfterRestore != nil {
+			return entity.AfterRestore(tx, id, by)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Purge hard-deletes every record and dependant row deleted more than retention ago, one row at a time
+// so a row live data still points to is kept rather than failing the purge, then removes the uploaded
+// files no row refers to any more
+func (r *RecycleBinRepositoryImpl) Purge(retention time.Duration) (*PurgeResult, error) {
+	result := &PurgeResult{
+		DeletedBefore: time.Now().Add(-retention),
+		Purged:        make(map[string]int),
+		Kept:          make(map[string]int),
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range purgeOrder {
+		entity := recycleBin[name]
+		models := make([]interface{}, 0, len(entity.Dependants)+1)
+		for _, dependant := range entity.Dependants {
+			models = append(models, dependant.Model)
+		}
+		for _, model := range append(models, entity.Model) {
+			table, err := tableOf(r.db, model)
+			if err != nil {
+				return nil, err
+			}
+			if seen[table] {
+				continue
+			}
+			seen[table] = true
+
+			var ids []uint
+			if err := r.db.Unscoped().Model(newModel(model)).
+				Where("deleted_at IS NOT NULL AND deleted_at < ?", result.DeletedBefore).
+				Pluck("id", &ids).Error; err != nil {
+				return nil, fmt.Errorf("failed to find expired %s: %w", table, err)
+			}
+			for _, id := range ids {
+				if err := r.db.Unscoped().Delete(newModel(model), id).Error; err != nil {
+					result.Kept[table]++
+					continue
+				}
+				result.Purged[table]++
+			}
+		}
+	}
+
+	files, err := r.removeOrphanFiles()
+	if err != nil {
+		return nil, err
+	}
+	result.FilesRemoved = files
+	return result, nil
+}
+
+// removeOrphanFiles deletes the uploaded files no row, deleted or not, refers to
+func (r *RecycleBinRepositoryImpl) removeOrphanFiles() ([]string, error) {
+	referenced := make(map[string]bool)
+	for _, ref := range []struct {
+		model  interface{}
+		column string
+	}{
+		{&carRegistration.CarPhoto{}, "url"},
+		{&carRegistration.CarScan{}, "scan"},
+		{&customerRegistration.Customer{}, "upload_file"},
+		{&saleRegistration.SalePaymentDeposit{}, "deposit_scan"},
+	} {
+		var paths []string
+		if err := r.db.Unscoped().Model(newModel(ref.model)).Where(ref.column+" <> ''").Pluck(ref.column, &paths).Error; err != nil {
+			return nil, fmt.Errorf("failed to list referenced files: %w", err)
+		}
+		for _, path := range paths {
+			referenced[filepath.Clean(path)] = true
+		}
+	}
+
+	var removed []string
+	cutoff := time.Now().Add(-orphanGrace)
+	for _, dir := range uploadDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || referenced[filepath.Clean(path)] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed = append(removed, path)
+			return nil
+		})
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove orphaned files in %s: %w", dir, err)
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
@@ -2,14 +2,18 @@ package repository
 
 import (
 	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/rbac"
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 
 	"gorm.io/gorm"
 )
 
 // GroupService defines the interface for group operations
 type GroupService interface {
+	WithContext(ctx context.Context) *DatabaseService
 	CreateGroup(group *userRegistration.Group) error
 	GetGroupByCode(code string) (*userRegistration.Group, error)
 	GetAllGroups() ([]userRegistration.Group, error)
@@ -27,6 +31,10 @@ func NewDatabaseService(db *gorm.DB) *DatabaseService {
 	return &DatabaseService{db: db}
 }
 
+func (s *DatabaseService) WithContext(ctx context.Context) *DatabaseService {
+	return NewDatabaseService(s.db.WithContext(ctx))
+}
+
 // CreateGroup creates a new group in the database
 func (s *DatabaseService) CreateGroup(group *userRegistration.Group) error {
 	return s.db.Create(group).Error
@@ -81,6 +89,7 @@ func (s *DatabaseService) DeleteGroup(code string) error {
 
 // RoleService defines the interface for role operations
 type RoleService interface {
+	WithContext(ctx context.Context) *DatabaseService
 	CreateRole(role *userRegistration.Role) error
 	GetRoleByCode(code string) (*userRegistration.Role, error)
 	GetAllRoles() ([]userRegistration.Role, error)
@@ -133,6 +142,7 @@ func (s *DatabaseService) GetRolesForGroups(groupCodes []string) ([]userRegistra
 
 // ResourceService defines the interface for resource operations
 type ResourceService interface {
+	WithContext(ctx context.Context) *DatabaseService
 	CreateResource(resource *userRegistration.Resource) error
 	GetResourceByCode(code string) (*userRegistration.Resource, error)
 	GetAllResources() ([]userRegistration.Resource, error)
@@ -165,6 +175,7 @@ func (s *DatabaseService) GetAllResources() ([]userRegistration.Resource, error)
 
 // PermissionService defines the interface for permission operations
 type PermissionService interface {
+	WithContext(ctx context.Context) *DatabaseService
 	CreatePermission(permission *userRegistration.RoleResourcePermission) (*userRegistration.RoleResourcePermission, error)
 	CreateWildCardPermission(permission *userRegistration.RoleWildCardPermission) (*userRegistration.RoleWildCardPermission, error)
 	GetGrantedPermissions(roleCode, resourceCode string) (*userRegistration.Permissions, error)
@@ -174,6 +185,8 @@ type PermissionService interface {
 	ResourceExplicitPermissionsExists(resourceCode string) (bool, error)
 	GroupsWithRoleExists(roleCode string) (bool, error)
 	GetPermissions(roleCodes []string, resourceCode string) ([]userRegistration.RoleResourcePermission, error)
+	ExplainPermissions(roleCodes []string, resourceCode string) (rbac.Decision, error)
+	EnsureResources(resources []userRegistration.Resource, grants []userRegistration.RoleResourcePermission) error
 }
 
 // CreatePermission creates a new role-resource permission
@@ -210,17 +223,18 @@ func (s *DatabaseService) GetGrantedPermissions(roleCode, resourceCode string) (
 	return &roleResourcePermission.Permissions, nil
 }
 
-// Check checks the permissions for a given role and resource
+// Check checks the permissions for a given role and resource, wildcards and denies included
 func (s *DatabaseService) CheckPermissions(roleCode, resourceCode string, requestedPerms userRegistration.Permissions) (userRegistration.Permissions, error) {
-	var permissions userRegistration.Permissions
-	if err := s.db.Raw(`
-        SELECT permissions
-        FROM role_resource_permissions
-        WHERE role_code = ? AND resource_code = ?
-    `, roleCode, resourceCode).Scan(&permissions.Allow).Error; err != nil {
-		return permissions, err
+	decision, err := rbac.Decide(s.db, []string{roleCode}, resourceCode)
+	if err != nil {
+		return userRegistration.Permissions{}, err
 	}
-	return permissions, nil
+	return decision.Permissions, nil
+}
+
+// ExplainPermissions tells what the roles may do on a resource and which rule decided each permission
+func (s *DatabaseService) ExplainPermissions(roleCodes []string, resourceCode string) (rbac.Decision, error) {
+	return rbac.Decide(s.db, roleCodes, resourceCode)
 }
 
 // Get retrieves explicitly defined permissions for a role on a resource
@@ -236,12 +250,27 @@ func (s *DatabaseService) GetExplicitPermissions(roleCode, resourceCode string)
 	return permissions, nil // Return the permissions and no error
 }
 
-// Get retrieves wildcard permissions for a role based on a resource pattern
+// Get retrieves the wildcard permissions of a role whose pattern covers the resource, most specific first
 func (s *DatabaseService) GetWildCardPermissions(roleCode, resourceCode string) ([]userRegistration.RoleWildCardPermission, error) {
-	var permissions []userRegistration.RoleWildCardPermission
-	if err := s.db.Where("role_code = ? AND resource_code = ?", roleCode, resourceCode).Find(&permissions).Error; err != nil {
+	var rows []userRegistration.RoleWildCardPermission
+	if err := s.db.Where("role_code = ?", roleCode).Order("id").Find(&rows).Error; err != nil {
 		return nil, err
 	}
+
+	specificity := make(map[uint]int, len(rows))
+	permissions := make([]userRegistration.RoleWildCardPermission, 0, len(rows))
+	for _, row := range rows {
+		// Asking for a pattern itself ("resource.*") still finds it: "*" matches any segment
+		score, ok := rbac.Match(row.ResourceCode, resourceCode)
+		if !ok {
+			continue
+		}
+		specificity[row.ID] = score
+		permissions = append(permissions, row)
+	}
+	sort.SliceStable(permissions, func(i, j int) bool {
+		return specificity[permissions[i].ID] > specificity[permissions[j].ID]
+	})
 	return permissions, nil
 }
 
@@ -296,3 +325,33 @@ func (s *DatabaseService) GetPermissions(roleCodes []string, resourceCode string
 
 	return permissions, nil
 }
+
+// EnsureResources registers the resources that do not exist yet, together with their grants. Grants of
+// resources already registered are left alone, so permissions changed by an admin are kept.
+func (s *DatabaseService) EnsureResources(resources []userRegistration.Resource, grants []userRegistration.RoleResourcePermission) error {
+	// Decisions cached while the grants were written are dropped once they are committed
+	defer rbac.Invalidate()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, resource := range resources {
+			var count int64
+			if err := tx.Model(&userRegistration.Resource{}).Where("code = ?", resource.Code).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := tx.Create(&resource).Error; err != nil {
+				return fmt.Errorf("failed to register resource %s: %w", resource.Code, err)
+			}
+			for _, grant := range grants {
+				if grant.ResourceCode != resource.Code {
+					continue
+				}
+				if err := tx.Create(&grant).Error; err != nil {
+					return fmt.Errorf("failed to grant %s on %s: %w", grant.RoleCode, grant.ResourceCode, err)
+				}
+			}
+		}
+		return nil
+	})
+}
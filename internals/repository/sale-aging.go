@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
+	"sort"
+	"strings"
+	"time"
+)
+
+type AgingBuckets struct {
+	Current    money.Money `json:"current"`
+	Days1To30  money.Money `json:"days_1_30"`
+	Days31To60 money.Money `json:"days_31_60"`
+	Days61To90 money.Money `json:"days_61_90"`
+	Days90Plus money.Money `json:"days_90_plus"`
+	Total      money.Money `json:"total"`
+}
+
+// add places an amount in the bucket matching the number of days it is overdue
+func (b *AgingBuckets) add(daysOverdue int, amount money.Money) {
+	switch {
+	case daysOverdue <= 0:
+		b.Current = b.Current.Add(amount)
+	case daysOverdue <= 30:
+		b.Days1To30 = b.Days1To30.Add(amount)
+	case daysOverdue <= 60:
+		b.Days31To60 = b.Days31To60.Add(amount)
+	case daysOverdue <= 90:
+		b.Days61To90 = b.Days61To90.Add(amount)
+	default:
+		b.Days90Plus = b.Days90Plus.Add(amount)
+	}
+	b.Total = b.Total.Add(amount)
+}
+
+func (b *AgingBuckets) merge(other AgingBuckets) {
+	b.Current = b.Current.Add(other.Current)
+	b.Days1To30 = b.Days1To30.Add(other.Days1To30)
+	b.Days31To60 = b.Days31To60.Add(other.Days31To60)
+	b.Days61To90 = b.Days61To90.Add(other.Days61To90)
+	b.Days90Plus = b.Days90Plus.Add(other.Days90Plus)
+	b.Total = b.Total.Add(other.Total)
+}
+
+func (b *AgingBuckets) round() {
+	b.Current = b.Current.Round()
+	b.Days1To30 = b.Days1To30.Round()
+	b.Days31To60 = b.Days31To60.Round()
+	b.Days61To90 = b.Days61To90.Round()
+	b.Days90Plus = b.Days90Plus.Round()
+	b.Total = b.Total.Round()
+}
+
+type SaleAging struct {
+	SaleID        uint         `json:"sale_id"`
+	SaleDate      string       `json:"sale_date"`
+	CarID         uint         `json:"car_id"`
+	ChasisNumber  string       `json:"chasis_number"`
+	CarModel      string       `json:"car_model"`
+	CustomerID    *uint        `json:"customer_id"`
+	CustomerName  string       `json:"customer_name"`
+	Telephone     string       `json:"telephone"`
+	TotalPrice    money.Money  `json:"total_price"`
+	TotalPaid     money.Money  `json:"total_paid"`
+	Outstanding   money.Money  `json:"outstanding"`
+	OldestDueDate string       `json:"oldest_due_date"`
+	DaysOverdue   int          `json:"days_overdue"`
+	Buckets       AgingBuckets `json:"buckets"`
+}
+
+type CompanyAging struct {
+	CompanyID   int          `json:"company_id"`
+	CompanyName string       `json:"company_name"`
+	Totals      AgingBuckets `json:"totals"`
+	Sales       []SaleAging  `json:"sales"`
+}
+
+type AgingReport struct {
+	AsOf      string         `json:"as_of"`
+	Totals    AgingBuckets   `json:"totals"`
+	Companies []CompanyAging `json:"companies"`
+}
+
+// GetReceivablesAging buckets the open installments of every outstanding sale by how many days
+// they are past due at asOf. Zero filters are ignored.
+func (r *SaleRepositoryImpl) GetReceivablesAging(companyID, customerID uint, asOf time.Time) (*AgingReport, error) {
+	query := r.db.
+		Preload("Customer").
+		Preload("Car").
+		Preload("Company")
+
+	if companyID != 0 {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if customerID != 0 {
+		query = query.Where("customer_id = ?", customerID)
+	}
+
+	var sales []saleRegistration.Sale
+	if err := query.Order("sale_date ASC").Find(&sales).Error; err != nil {
+		return nil, err
+	}
+
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	report := &AgingReport{AsOf: asOf.Format("2006-01-02")}
+	companies := make(map[int]*CompanyAging)
+
+	for _, sale := range sales {
+		installments, totalPaid, err := r.saleScheduleWithPayments(&sale)
+		if err != nil {
+			return nil, err
+		}
+
+		outstanding := sale.TotalPrice.Sub(totalPaid).Round()
+		if !outstanding.IsPositive() {
+			continue
+		}
+
+		saleAging := SaleAging{
+			SaleID:       sale.ID,
+			SaleDate:     sale.SaleDate,
+			CarID:        sale.CarID,
+			ChasisNumber: sale.Car.ChasisNumber,
+			CarModel:     sale.Car.CarModel,
+			CustomerID:   sale.CustomerID,
+			CustomerName: strings.TrimSpace(sale.Customer.Surname + " " + sale.Customer.Firstname),
+			Telephone:    sale.Customer.Telephone,
+			TotalPrice:   sale.TotalPrice,
+			TotalPaid:    totalPaid.Round(),
+			Outstanding:  outstanding,
+		}
+		if len(saleAging.SaleDate) > 10 {
+			saleAging.SaleDate = saleAging.SaleDate[:10]
+		}
+
+		for _, inst := range installments {
+			balance := inst.Balance()
+			if !balance.IsPositive() {
+				continue
+			}
+			dueDate, err := parseSaleDate(inst.DueDate)
+			if err != nil {
+				continue
+			}
+
+			daysOverdue := int(asOf.Sub(dueDate).Hours() / 24)
+			if saleAging.OldestDueDate == "" {
+				saleAging.OldestDueDate = dueDate.Format("2006-01-02")
+				if daysOverdue > 0 {
+					saleAging.DaysOverdue = daysOverdue
+				}
+			}
+			saleAging.Buckets.add(daysOverdue, balance)
+		}
+		saleAging.Buckets.round()
+
+		company, ok := companies[sale.CompanyID]
+		if !ok {
+			company = &CompanyAging{CompanyID: sale.CompanyID, CompanyName: sale.Company.Name}
+			companies[sale.CompanyID] = company
+		}
+		company.Sales = append(company.Sales, saleAging)
+		company.Totals.merge(saleAging.Buckets)
+	}
+
+	for _, company := range companies {
+		// Most overdue first so collections know who to call
+		sort.SliceStable(company.Sales, func(i, j int) bool {
+			return company.Sales[i].DaysOverdue > company.Sales[j].DaysOverdue
+		})
+		company.Totals.round()
+		report.Totals.merge(company.Totals)
+		report.Companies = append(report.Companies, *company)
+	}
+	sort.Slice(report.Companies, func(i, j int) bool {
+		return report.Companies[i].CompanyID < report.Companies[j].CompanyID
+	})
+	report.Totals.round()
+
+	return report, nil
+}
+
+// saleScheduleWithPayments returns the allocated installments of a sale and its total paid.
+// Sales without a stored schedule get one computed in memory.
+func (r *SaleRepositoryImpl) saleScheduleWithPayments(sale *saleRegistration.Sale) ([]saleRegistration.SaleInstallment, money.Money, error) {
+	var payments []saleRegistration.SalePayment
+	if err := r.db.Where("sale_id = ?", sale.ID).
+		Order("payment_date ASC, id ASC").
+		Find(&payments).Error; err != nil {
+		return nil, money.Zero, err
+	}
+
+	totalPaid := money.Zero
+	for _, p := range payments {
+		totalPaid = totalPaid.Add(p.AmountPayed)
+	}
+
+	installments, err := r.GetSaleInstallments(sale.ID)
+	if err != nil {
+		return nil, money.Zero, err
+	}
+	if len(installments) == 0 {
+		installments, err = BuildInstallmentSchedule(sale)
+		if err != nil {
+			return nil, money.Zero, err
+		}
+		applyPaymentsToInstallments(installments, payments)
+	}
+
+	return installments, totalPaid, nil
+}
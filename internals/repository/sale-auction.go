@@ -3,12 +3,14 @@ package repository
 import (
 	"car-bond/internals/models/saleRegistration"
 	"car-bond/internals/utils"
+	"context"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type SaleAuctionRepository interface {
+	WithContext(ctx context.Context) SaleAuctionRepository
 	CreateSale(sale *saleRegistration.SaleAuction) error
 	GetPaginatedSales(c *fiber.Ctx) (*utils.Pagination, []saleRegistration.SaleAuction, error)
 	GetSaleByID(id string) (saleRegistration.SaleAuction, error)
@@ -24,6 +26,10 @@ func NewSaleAuctionRepository(db *gorm.DB) SaleAuctionRepository {
 	return &SaleAuctionRepositoryImpl{db: db}
 }
 
+func (r *SaleAuctionRepositoryImpl) WithContext(ctx context.Context) SaleAuctionRepository {
+	return NewSaleAuctionRepository(r.db.WithContext(ctx))
+}
+
 func (r *SaleAuctionRepositoryImpl) CreateSale(sale *saleRegistration.SaleAuction) error {
 	return r.db.Create(sale).Error
 }
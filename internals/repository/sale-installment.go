@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// parseSaleDate accepts both "2006-01-02" and full RFC3339 values as stored by postgres
+func parseSaleDate(value string) (time.Time, error) {
+	if len(value) >= 10 {
+		value = value[:10]
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// addMonthsClamped adds months to a date, keeping the day inside the target month
+// (e.g. 31 Jan + 1 month = 28/29 Feb instead of rolling into March)
+func addMonthsClamped(t time.Time, months int) time.Time {
+	firstOfTarget := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := firstOfTarget.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfTarget.Year(), firstOfTarget.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// BuildInstallmentSchedule works out the installment rows for a sale without touching the database.
+// Full payments (or sales without a period) get a single installment due on the sale date. Otherwise
+// the initial payment is due on the sale date (installment 0) and the balance is split evenly over
+// PaymentPeriod monthly installments, with any rounding remainder on the last one.
+func BuildInstallmentSchedule(sale *saleRegistration.Sale) ([]saleRegistration.SaleInstallment, error) {
+	saleDate, err := parseSaleDate(sale.SaleDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sale date %q: %w", sale.SaleDate, err)
+	}
+
+	newInstallment := func(no int, due time.Time, amount money.Money) saleRegistration.SaleInstallment {
+		return saleRegistration.SaleInstallment{
+			SaleID:         sale.ID,
+			InstallmentNo:  no,
+			DueDate:        due.Format("2006-01-02"),
+			ExpectedAmount: amount.Round(),
+			Status:         saleRegistration.InstallmentStatusPending,
+			CreatedBy:      sale.UpdatedBy,
+			UpdatedBy:      sale.UpdatedBy,
+		}
+	}
+
+	total := sale.TotalPrice.Round()
+	if sale.IsFullPayment || sale.PaymentPeriod <= 0 {
+		return []saleRegistration.SaleInstallment{newInstallment(1, saleDate, total)}, nil
+	}
+
+	var schedule []saleRegistration.SaleInstallment
+
+	initial := money.Min(sale.InitalPayment.Round(), total)
+	if initial.IsPositive() {
+		schedule = append(schedule, newInstallment(0, saleDate, initial))
+	}
+
+	remaining := total.Sub(initial)
+	if !remaining.IsPositive() {
+		return schedule, nil
+	}
+
+	for i, amount := range remaining.Split(sale.PaymentPeriod) {
+		schedule = append(schedule, newInstallment(i+1, addMonthsClamped(saleDate, i+1), amount))
+	}
+
+	return schedule, nil
+}
+
+// SaleTermsChanged reports whether an update affects the installment schedule
+func SaleTermsChanged(before, after *saleRegistration.Sale) bool {
+	beforeDate, _ := parseSaleDate(before.SaleDate)
+	afterDate, _ := parseSaleDate(after.SaleDate)
+	return !before.TotalPrice.Equal(after.TotalPrice) ||
+		before.PaymentPeriod != after.PaymentPeriod ||
+		!before.InitalPayment.Equal(after.InitalPayment) ||
+		before.IsFullPayment != after.IsFullPayment ||
+		!beforeDate.Equal(afterDate)
+}
+
+// RegenerateSaleInstallments replaces the schedule of a sale and re-applies its payments.
+// It is meant to be called inside the transaction that created or changed the sale.
+func RegenerateSaleInstallments(tx *gorm.DB, sale *saleRegistration.Sale) error {
+	schedule, err := BuildInstallmentSchedule(sale)
+	if err != nil {
+		return err
+	}
+
+	// The schedule is derived data, so old rows are removed for good
+	if err := tx.Unscoped().Where("sale_id = ?", sale.ID).
+		Delete(&saleRegistration.SaleInstallment{}).Error; err != nil {
+		return fmt.Errorf("failed to clear installments: %w", err)
+	}
+
+	if len(schedule) > 0 {
+		if err := tx.Create(&schedule).Error; err != nil {
+			return fmt.Errorf("failed to create installments: %w", err)
+		}
+	}
+
+	return allocateInstallments(tx, sale.ID, schedule)
+}
+
+// AllocateSalePayments spreads all payments of a sale over its installments, oldest first.
+// Sales created before schedules existed get one generated on the fly.
+func AllocateSalePayments(tx *gorm.DB, saleID uint) error {
+	var installments []saleRegistration.SaleInstallment
+	if err := tx.Where("sale_id = ?", saleID).
+		Order("installment_no ASC").
+		Find(&installments).Error; err != nil {
+		return fmt.Errorf("failed to fetch installments: %w", err)
+	}
+
+	if len(installments) == 0 {
+		var sale saleRegistration.Sale
+		if err := tx.First(&sale, saleID).Error; err != nil {
+			return fmt.Errorf("failed to fetch sale %d: %w", saleID, err)
+		}
+		return RegenerateSaleInstallments(tx, &sale)
+	}
+
+	return allocateInstallments(tx, saleID, installments)
+}
+
+func allocateInstallments(tx *gorm.DB, saleID uint, installments []saleRegistration.SaleInstallment) error {
+	var payments []saleRegistration.SalePayment
+	if err := tx.Where("sale_id = ?", saleID).
+		Order("payment_date ASC, id ASC").
+		Find(&payments).Error; err != nil {
+		return fmt.Errorf("failed to fetch sale payments: %w", err)
+	}
+
+	applyPaymentsToInstallments(installments, payments)
+
+	for i := range installments {
+		if err := tx.Model(&installments[i]).Updates(map[string]interface{}{
+			"amount_allocated": installments[i].AmountAllocated,
+			"status":           installments[i].Status,
+			"paid_date":        installments[i].PaidDate,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update installment %d: %w", installments[i].InstallmentNo, err)
+		}
+	}
+
+	return nil
+}
+
+// applyPaymentsToInstallments resets the allocation and fills installments in order with the
+// payments, which must be sorted by payment date
+func applyPaymentsToInstallments(installments []saleRegistration.SaleInstallment, payments []saleRegistration.SalePayment) {
+	for i := range installments {
+		installments[i].AmountAllocated = money.Zero
+		installments[i].Status = saleRegistration.InstallmentStatusPending
+		installments[i].PaidDate = nil
+	}
+
+	// Oldest open installment first
+	next := 0
+	for _, payment := range payments {
+		available := payment.AmountPayed
+		paymentDate := payment.PaymentDate
+		if len(paymentDate) >= 10 {
+			paymentDate = paymentDate[:10]
+		}
+
+		for available.IsPositive() && next < len(installments) {
+			inst := &installments[next]
+			applied := money.Min(available, inst.Balance())
+			inst.AmountAllocated = inst.AmountAllocated.Add(applied)
+			available = available.Sub(applied)
+
+			if inst.Balance().IsZero() {
+				inst.Status = saleRegistration.InstallmentStatusPaid
+				inst.PaidDate = &paymentDate
+				next++
+			} else {
+				inst.Status = saleRegistration.InstallmentStatusPartial
+			}
+		}
+	}
+}
+
+// ====================
+
+func (r *SaleRepositoryImpl) GetSaleInstallments(saleID uint) ([]saleRegistration.SaleInstallment, error) {
+	var installments []saleRegistration.SaleInstallment
+	err := r.db.Where("sale_id = ?", saleID).
+		Order("installment_no ASC").
+		Find(&installments).Error
+	return installments, err
+}
+
+func (r *SaleRepositoryImpl) RebuildSaleInstallments(saleID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var sale saleRegistration.Sale
+		if err := tx.First(&sale, saleID).Error; err != nil {
+			return err
+		}
+		return RegenerateSaleInstallments(tx, &sale)
+	})
+}
+
+// GetOldestOpenInstallment returns the earliest installment that is not fully paid, or nil
+func (r *SaleRepositoryImpl) GetOldestOpenInstallment(saleID uint) (*saleRegistration.SaleInstallment, error) {
+	var installment saleRegistration.SaleInstallment
+	result := r.db.Where("sale_id = ? AND status <> ?", saleID, saleRegistration.InstallmentStatusPaid).
+		Order("installment_no ASC").
+		Limit(1).
+		Find(&installment)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &installment, nil
+}
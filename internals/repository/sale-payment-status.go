@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const TransactionTypeFullyPaid = "FullyPaid"
+
+// SalePaymentStatus derives a car's payment status from its sale: Booked until something is paid,
+// then Partially Paid until the payments cover the total price
+func SalePaymentStatus(totalPrice, paid money.Money) string {
+	switch {
+	case paid.IsPositive() && paid.GreaterThanOrEqual(totalPrice):
+		return carRegistration.PaymentFullyPaid
+	case paid.IsPositive():
+		return carRegistration.PaymentPartiallyPaid
+	}
+	return carRegistration.PaymentBooked
+}
+
+// SyncCarPaymentStatus recomputes the payment status of the car of a sale from the sale payments and
+// raises an alert when the car becomes fully paid. It must run in the transaction that changed them.
+func SyncCarPaymentStatus(tx *gorm.DB, saleID uint, by string) error {
+	var sale saleRegistration.Sale
+	if err := tx.First(&sale, saleID).Error; err != nil {
+		return fmt.Errorf("failed to fetch sale %d: %w", saleID, err)
+	}
+
+	var car carRegistration.Car
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&car, sale.CarID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // the car is gone; nothing to keep in step
+		}
+		return fmt.Errorf("failed to fetch car %d: %w", sale.CarID, err)
+	}
+
+	var paid money.Money
+	if err := tx.Model(&saleRegistration.SalePayment{}).
+		Where("sale_id = ?", saleID).
+		Select("COALESCE(SUM(amount_payed), 0)").Scan(&paid).Error; err != nil {
+		return fmt.Errorf("failed to total sale payments: %w", err)
+	}
+
+	if by == "" {
+		by = "system"
+	}
+	status := SalePaymentStatus(sale.TotalPrice, paid)
+	previous := car.CarPaymentStatus
+	if _, err := carRegistration.ChangeCarStatus(tx, car.ID, carRegistration.StatusChange{
+		Field:  carRegistration.StatusFieldPayment,
+		To:     status,
+		Reason: fmt.Sprintf("Sale %d: %s of %s %s paid", sale.ID, paid.StringFixed(), sale.TotalPrice.StringFixed(), sale.Currency),
+		By:     by,
+	}); err != nil {
+		return err
+	}
+
+	if status != carRegistration.PaymentFullyPaid || previous == carRegistration.PaymentFullyPaid {
+		return nil
+	}
+	transaction := alertRegistration.Transaction{
+		CarChasisNumber: car.ChasisNumber,
+		TransactionType: TransactionTypeFullyPaid,
+		FromCompanyId:   derefUint(car.FromCompanyID),
+		ToCompanyId:     derefUint(car.ToCompanyID),
+		CreatedBy:       by,
+		UpdatedBy:       by,
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return fmt.Errorf("failed to raise fully paid alert for car %s: %w", car.ChasisNumber, err)
+	}
+	return nil
+}
+
+// syncPaymentStatusForPayment recomputes the payment status of the sale a payment belongs to
+func syncPaymentStatusForPayment(tx *gorm.DB, salePaymentID uint, by string) error {
+	var payment saleRegistration.SalePayment
+	if err := tx.Unscoped().Select("id", "sale_id").First(&payment, salePaymentID).Error; err != nil {
+		return fmt.Errorf("failed to fetch sale payment %d: %w", salePaymentID, err)
+	}
+	return SyncCarPaymentStatus(tx, payment.SaleID, by)
+}
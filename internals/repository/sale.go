@@ -3,11 +3,15 @@ package repository
 import (
 	"car-bond/internals/middleware"
 	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/companyRegistration"
 	"car-bond/internals/models/customerRegistration"
 	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/money"
 	"car-bond/internals/utils"
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +22,7 @@ import (
 )
 
 type SaleRepository interface {
+	WithContext(ctx context.Context) SaleRepository
 	CreateSale(sale *saleRegistration.Sale) error
 	GetPaginatedSales(c *fiber.Ctx) (*utils.Pagination, []saleRegistration.Sale, error)
 	GetSalePayments(saleID uint) ([]saleRegistration.SalePayment, error)
@@ -26,6 +31,11 @@ type SaleRepository interface {
 	UpdateSale(sale *saleRegistration.Sale) error
 	DeleteByID(id string) error
 
+	// Installments
+	GetSaleInstallments(saleID uint) ([]saleRegistration.SaleInstallment, error)
+	RebuildSaleInstallments(saleID uint) error
+	GetOldestOpenInstallment(saleID uint) (*saleRegistration.SaleInstallment, error)
+
 	// Payment
 	CreateInvoice(payment *saleRegistration.SalePayment) error
 	GetPaginatedInvoices(c *fiber.Ctx) (*utils.Pagination, []saleRegistration.SalePayment, error)
@@ -53,9 +63,11 @@ type SaleRepository interface {
 	GetPaymentDeposits(c *fiber.Ctx, name string) (*utils.Pagination, []saleRegistration.SalePaymentDeposit, error)
 
 	// Customer statement
-	GenerateCustomerStatement(customerID uint) (*CustomerStatement, error)
-	GetSalesSummary(companyID uint) (map[string]float64, error)
+	GenerateCustomerStatement(customerID uint, from, to *time.Time) (*CustomerStatement, error)
+	GetSalesSummary(companyID uint) (map[string]money.Money, error)
 	CheckPaymentNotifications(c *fiber.Ctx) ([]Notification, error)
+	FindPaymentNotifications(companyID uint) ([]Notification, error)
+	GetReceivablesAging(companyID, customerID uint, asOf time.Time) (*AgingReport, error)
 }
 
 type SaleRepositoryImpl struct {
@@ -66,11 +78,15 @@ func NewSaleRepository(db *gorm.DB) SaleRepository {
 	return &SaleRepositoryImpl{db: db}
 }
 
-func (r *SaleRepositoryImpl) GetSalesSummary(companyID uint) (map[string]float64, error) {
-	summary := make(map[string]float64)
+func (r *SaleRepositoryImpl) WithContext(ctx context.Context) SaleRepository {
+	return NewSaleRepository(r.db.WithContext(ctx))
+}
+
+func (r *SaleRepositoryImpl) GetSalesSummary(companyID uint) (map[string]money.Money, error) {
+	summary := make(map[string]money.Money)
 
 	// Total sales for the company
-	var totalSales float64
+	var totalSales money.Money
 	if err := r.db.Model(&saleRegistration.Sale{}).
 		Where("company_id = ?", companyID).
 		Select("COALESCE(SUM(total_price), 0)").Scan(&totalSales).Error; err != nil {
@@ -79,7 +95,7 @@ func (r *SaleRepositoryImpl) GetSalesSummary(companyID uint) (map[string]float64
 	summary["total_sales"] = totalSales
 
 	// Total payments for the company
-	var totalPayments float64
+	var totalPayments money.Money
 	if err := r.db.Model(&saleRegistration.SalePayment{}).
 		Joins("JOIN sales ON sales.id = sale_payments.sale_id").
 		Where("sales.company_id = ?", companyID).
@@ -87,10 +103,10 @@ func (r *SaleRepositoryImpl) GetSalesSummary(companyID uint) (map[string]float64
 		return nil, err
 	}
 	summary["total_payments"] = totalPayments
-	summary["money_in_mrkt"] = totalSales - totalPayments
+	summary["money_in_mrkt"] = totalSales.Sub(totalPayments)
 
 	// Total deposits for the company
-	var totalDeposits float64
+	var totalDeposits money.Money
 	if err := r.db.Model(&saleRegistration.SalePaymentDeposit{}).
 		Joins("JOIN sale_payments ON sale_payments.id = sale_payment_deposits.sale_payment_id").
 		Joins("JOIN sales ON sales.id = sale_payments.sale_id").
@@ -105,6 +121,7 @@ func (r *SaleRepositoryImpl) GetSalesSummary(companyID uint) (map[string]float64
 
 const (
 	CarStatusInTransit = "InTransit"
+	CarStatusInStock   = "InStock"
 	CarStatusSold      = "Sold"
 )
 
@@ -121,7 +138,10 @@ func (r *SaleRepositoryImpl) CreateSale(sale *saleRegistration.Sale) error {
 
 		// Check if car is already sold
 		if strings.EqualFold(car.CarStatus, CarStatusSold) {
-			return fmt.Errorf("car with ID %d is already sold", sale.CarID)
+			return fmt.Errorf("%w: car with ID %d", ErrCarAlreadySold, sale.CarID)
+		}
+		if err := carRegistration.CheckTransition(carRegistration.StatusFieldCar, car.CarStatus, CarStatusSold, sale.AllowInTransitSale); err != nil {
+			return err
 		}
 
 		// Create the sale
@@ -130,18 +150,22 @@ func (r *SaleRepositoryImpl) CreateSale(sale *saleRegistration.Sale) error {
 		}
 
 		// Update car status to "Sold"
-		result := tx.Model(&carRegistration.Car{}).
-			Where("id = ?", sale.CarID).
-			Update("car_status", CarStatusSold)
-
-		if result.Error != nil {
-			return fmt.Errorf("failed to update car status: %w", result.Error)
+		if _, err := carRegistration.ChangeCarStatus(tx, sale.CarID, carRegistration.StatusChange{
+			Field:              carRegistration.StatusFieldCar,
+			To:                 CarStatusSold,
+			Reason:             fmt.Sprintf("Sale %d created", sale.ID),
+			By:                 sale.CreatedBy,
+			AllowInTransitSale: sale.AllowInTransitSale,
+		}); err != nil {
+			return fmt.Errorf("failed to update car status: %w", err)
 		}
-		if result.RowsAffected == 0 {
-			return fmt.Errorf("failed to update car status: no rows affected (possible race condition)")
+
+		// Generate the installment schedule
+		if err := RegenerateSaleInstallments(tx, sale); err != nil {
+			return fmt.Errorf("failed to generate installments: %w", err)
 		}
 
-		return nil
+		return SyncCarPaymentStatus(tx, sale.ID, sale.CreatedBy)
 	})
 }
 
@@ -185,32 +209,49 @@ func (r *SaleRepositoryImpl) GetSaleByID(id string) (saleRegistration.Sale, erro
 }
 
 func (r *SaleRepositoryImpl) UpdateSale(sale *saleRegistration.Sale) error {
-	return r.db.Save(sale).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(sale).Error; err != nil {
+			return err
+		}
+		// Price, period or date may have changed, so rebuild the schedule
+		if err := RegenerateSaleInstallments(tx, sale); err != nil {
+			return err
+		}
+		return SyncCarPaymentStatus(tx, sale.ID, sale.UpdatedBy)
+	})
 }
 
 type Notification struct {
-	SaleID       uint
-	CustomerName string
-	PhoneNumber  string
-	Message      string
-	DueDate      time.Time
-	AmountDue    float64
-	CreatedAt    time.Time
+	SaleID        uint
+	CustomerName  string
+	PhoneNumber   string
+	Email         string
+	Message       string
+	DueDate       time.Time
+	AmountDue     money.Money
+	InstallmentNo *int
+	CreatedAt     time.Time
 }
 
 func (r *SaleRepositoryImpl) CheckPaymentNotifications(c *fiber.Ctx) ([]Notification, error) {
+	// Apply company filter if provided
+	var companyID uint
+	if id, err := strconv.Atoi(c.Query("company_id")); err == nil && id > 0 {
+		companyID = uint(id)
+	}
+	return r.FindPaymentNotifications(companyID)
+}
+
+// FindPaymentNotifications lists the unpaid sales with their next due payment, optionally for one company
+func (r *SaleRepositoryImpl) FindPaymentNotifications(companyID uint) ([]Notification, error) {
 	var sales []saleRegistration.Sale
 	query := r.db.
 		Preload("Customer").
 		Preload("Car").
 		Preload("Company")
 
-	// Apply company filter if provided
-	companyID := c.Query("company_id")
-	if companyID != "" {
-		if id, err := strconv.Atoi(companyID); err == nil {
-			query = query.Where("company_id = ?", id)
-		}
+	if companyID != 0 {
+		query = query.Where("company_id = ?", companyID)
 	}
 
 	if err := query.Find(&sales).Error; err != nil {
@@ -222,17 +263,17 @@ func (r *SaleRepositoryImpl) CheckPaymentNotifications(c *fiber.Ctx) ([]Notifica
 
 	for _, sale := range sales {
 		// Calculate total paid
-		var totalPaid float64
+		totalPaid := money.Zero
 		var payments []saleRegistration.SalePayment
 		if err := r.db.Where("sale_id = ?", sale.ID).Find(&payments).Error; err != nil {
 			return nil, err
 		}
 		for _, p := range payments {
-			totalPaid += p.AmountPayed
+			totalPaid = totalPaid.Add(p.AmountPayed)
 		}
 
 		// Skip if fully paid
-		if totalPaid >= sale.TotalPrice {
+		if totalPaid.GreaterThanOrEqual(sale.TotalPrice) {
 			continue
 		}
 
@@ -242,6 +283,28 @@ func (r *SaleRepositoryImpl) CheckPaymentNotifications(c *fiber.Ctx) ([]Notifica
 			carPlate = "N/A"
 		}
 
+		// Use the installment schedule when the sale has one
+		installment, err := r.GetOldestOpenInstallment(sale.ID)
+		if err != nil {
+			return nil, err
+		}
+		if installment != nil {
+			dueDate, _ := parseSaleDate(installment.DueDate)
+			installmentNo := installment.InstallmentNo
+			notifications = append(notifications, Notification{
+				SaleID:        sale.ID,
+				CustomerName:  sale.Customer.Firstname,
+				PhoneNumber:   sale.Customer.Telephone,
+				Email:         sale.Customer.Email,
+				Message:       fmt.Sprintf("Installment %d of sale #%d (Car: %s) due on %s has a balance of %s", installmentNo, sale.ID, carPlate, dueDate.Format("2006-01-02"), installment.Balance().StringFixed()),
+				DueDate:       dueDate,
+				AmountDue:     sale.TotalPrice.Sub(totalPaid),
+				InstallmentNo: &installmentNo,
+				CreatedAt:     now,
+			})
+			continue
+		}
+
 		// Parse sale date
 		saleDate := parseDate(sale.SaleDate)
 		fmt.Println("Parsed sale date:", saleDate)
@@ -276,9 +339,10 @@ func (r *SaleRepositoryImpl) CheckPaymentNotifications(c *fiber.Ctx) ([]Notifica
 			SaleID:       sale.ID,
 			CustomerName: sale.Customer.Firstname,
 			PhoneNumber:  sale.Customer.Telephone,
+			Email:        sale.Customer.Email,
 			Message:      message,
 			DueDate:      dueDate,
-			AmountDue:    sale.TotalPrice - totalPaid,
+			AmountDue:    sale.TotalPrice.Sub(totalPaid),
 			CreatedAt:    now,
 		})
 	}
@@ -303,47 +367,29 @@ func (r *SaleRepositoryImpl) DeleteByID(id string) error {
 			return fmt.Errorf("failed to fetch sale to delete: %w", err)
 		}
 
-		// Get all payments for this sale
-		var payments []saleRegistration.SalePayment
-		if err := tx.Where("sale_id = ?", id).Find(&payments).Error; err != nil {
-			return fmt.Errorf("failed to fetch sale payments: %w", err)
-		}
-
-		// Collect payment IDs
-		var paymentIDs []uint
-		for _, p := range payments {
-			paymentIDs = append(paymentIDs, p.ID)
-		}
-
-		// Delete deposits tied to those payments
-		if len(paymentIDs) > 0 {
-			if err := tx.Where("sale_payment_id IN ?", paymentIDs).
-				Delete(&saleRegistration.SalePaymentDeposit{}).Error; err != nil {
-				return fmt.Errorf("failed to delete sale payment deposits: %w", err)
-			}
-		}
-
-		// Delete the payments
-		if err := tx.Where("sale_id = ?", id).
-			Delete(&saleRegistration.SalePayment{}).Error; err != nil {
-			return fmt.Errorf("failed to delete sale payments: %w", err)
-		}
-
-		// Delete the sale
-		if err := tx.Delete(&saleRegistration.Sale{}, "id = ?", id).Error; err != nil {
+		// Delete the sale with its payments, payment modes, deposits and installment schedule
+		if err := deleteWithDependants(tx, "sales", id); err != nil {
 			return fmt.Errorf("failed to delete sale: %w", err)
 		}
 
-		// Update the car status back to "InTransit"
-		result := tx.Model(&carRegistration.Car{}).
-			Where("id = ?", saleRecord.CarID).
-			Update("car_status", "InStock")
-
-		if result.Error != nil {
-			return fmt.Errorf("failed to update car status back to InTransit: %w", result.Error)
+		// Put the car back in stock
+		if _, err := carRegistration.ChangeCarStatus(tx, saleRecord.CarID, carRegistration.StatusChange{
+			Field:  carRegistration.StatusFieldCar,
+			To:     CarStatusInStock,
+			Reason: fmt.Sprintf("Sale %s deleted", id),
+			By:     saleRecord.UpdatedBy,
+		}); err != nil {
+			return fmt.Errorf("failed to update car status back to InStock: %w", err)
 		}
-		if result.RowsAffected == 0 {
-			return fmt.Errorf("failed to update car status: no rows affected (possible race condition)")
+
+		// The car is no longer sold, so it has no payment status either
+		if _, err := carRegistration.ChangeCarStatus(tx, saleRecord.CarID, carRegistration.StatusChange{
+			Field:  carRegistration.StatusFieldPayment,
+			To:     "",
+			Reason: fmt.Sprintf("Sale %s deleted", id),
+			By:     saleRecord.UpdatedBy,
+		}); err != nil {
+			return fmt.Errorf("failed to clear car payment status: %w", err)
 		}
 
 		return nil
@@ -352,7 +398,15 @@ func (r *SaleRepositoryImpl) DeleteByID(id string) error {
 
 // CreateCustomerContact creates a new payment deposit in the database
 func (r *SaleRepositoryImpl) CreateInvoice(payment *saleRegistration.SalePayment) error {
-	return r.db.Create(payment).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		if err := AllocateSalePayments(tx, payment.SaleID); err != nil {
+			return err
+		}
+		return SyncCarPaymentStatus(tx, payment.SaleID, payment.CreatedBy)
+	})
 }
 
 func (r *SaleRepositoryImpl) GetPaginatedInvoices(c *fiber.Ctx) (*utils.Pagination, []saleRegistration.SalePayment, error) {
@@ -381,20 +435,59 @@ func (r *SaleRepositoryImpl) FindSalePaymentById(id string) (*saleRegistration.S
 }
 
 func (r *SaleRepositoryImpl) UpdateSalePayment(payment *saleRegistration.SalePayment) error {
-	return r.db.Save(payment).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Remember the previous sale in case the payment was moved
+		var previous saleRegistration.SalePayment
+		if err := tx.First(&previous, payment.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+
+		if previous.SaleID != payment.SaleID {
+			if err := AllocateSalePayments(tx, previous.SaleID); err != nil {
+				return err
+			}
+			if err := SyncCarPaymentStatus(tx, previous.SaleID, payment.UpdatedBy); err != nil {
+				return err
+			}
+		}
+		if err := AllocateSalePayments(tx, payment.SaleID); err != nil {
+			return err
+		}
+		return SyncCarPaymentStatus(tx, payment.SaleID, payment.UpdatedBy)
+	})
 }
 
 // Delete salePayment by ID
 func (r *SaleRepositoryImpl) DeleteSalePaymentByID(id string) error {
-	if err := r.db.Delete(&saleRegistration.SalePayment{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var payment saleRegistration.SalePayment
+		if err := tx.First(&payment, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&saleRegistration.SalePayment{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		if err := AllocateSalePayments(tx, payment.SaleID); err != nil {
+			return err
+		}
+		return SyncCarPaymentStatus(tx, payment.SaleID, payment.UpdatedBy)
+	})
 }
 
 // CreateCustomerContact creates a new payment mode in the database
 func (r *SaleRepositoryImpl) CreatePaymentMode(payment *saleRegistration.SalePaymentMode) error {
-	return r.db.Create(payment).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return syncPaymentStatusForPayment(tx, payment.SalePaymentID, payment.CreatedBy)
+	})
 }
 
 func (r *SaleRepositoryImpl) GetPaginatedPaymentModes(c *fiber.Ctx) (*utils.Pagination, []saleRegistration.SalePaymentMode, error) {
@@ -431,20 +524,36 @@ func (r *SaleRepositoryImpl) FindSalePaymentModeById(id string) (*saleRegistrati
 }
 
 func (r *SaleRepositoryImpl) UpdateSalePaymentMode(payment *saleRegistration.SalePaymentMode) error {
-	return r.db.Save(payment).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		return syncPaymentStatusForPayment(tx, payment.SalePaymentID, payment.UpdatedBy)
+	})
 }
 
 // Delete salePayment by ID
 func (r *SaleRepositoryImpl) DeleteSalePaymentModeByID(id string) error {
-	if err := r.db.Delete(&saleRegistration.SalePaymentMode{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var mode saleRegistration.SalePaymentMode
+		if err := tx.First(&mode, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&saleRegistration.SalePaymentMode{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return syncPaymentStatusForPayment(tx, mode.SalePaymentID, mode.UpdatedBy)
+	})
 }
 
 // CreateCustomerContact creates a new payment deposit in the database
 func (r *SaleRepositoryImpl) CreatePaymentDeposit(deposit *saleRegistration.SalePaymentDeposit) error {
-	return r.db.Create(deposit).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(deposit).Error; err != nil {
+			return err
+		}
+		return syncPaymentStatusForPayment(tx, deposit.SalePaymentID, deposit.CreatedBy)
+	})
 }
 
 func (r *SaleRepositoryImpl) GetPaginatedPaymentDeposits(c *fiber.Ctx) (*utils.Pagination, []saleRegistration.SalePaymentDeposit, error) {
@@ -481,51 +590,62 @@ func (r *SaleRepositoryImpl) FindSalePaymentDepositById(id string) (*saleRegistr
 }
 
 func (r *SaleRepositoryImpl) UpdateSalePaymentDeposit(deposit *saleRegistration.SalePaymentDeposit) error {
-	return r.db.Save(deposit).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(deposit).Error; err != nil {
+			return err
+		}
+		return syncPaymentStatusForPayment(tx, deposit.SalePaymentID, deposit.UpdatedBy)
+	})
 }
 
 // Delete salePayment by ID
 func (r *SaleRepositoryImpl) DeleteSalePaymentDepositByID(id string) error {
-	if err := r.db.Delete(&saleRegistration.SalePaymentDeposit{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var deposit saleRegistration.SalePaymentDeposit
+		if err := tx.First(&deposit, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&saleRegistration.SalePaymentDeposit{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return syncPaymentStatusForPayment(tx, deposit.SalePaymentID, deposit.UpdatedBy)
+	})
 }
 
-func (r *SaleRepositoryImpl) GetOutstandingBalanceByCustomerID(customerID uint) (float64, error) {
+func (r *SaleRepositoryImpl) GetOutstandingBalanceByCustomerID(customerID uint) (money.Money, error) {
 	var sales []saleRegistration.Sale
-	var totalPaid float64
-	var totalOutstanding float64
+	var totalPaid money.Money
+	totalOutstanding := money.Zero
 
 	// Fetch all sales linked to cars owned by the customer
 	if err := r.db.
 		Joins("JOIN cars ON sales.car_id = cars.id").
 		Where("cars.customer_id = ?", customerID).
 		Find(&sales).Error; err != nil {
-		return 0, err
+		return money.Zero, err
 	}
 
 	// If no sales found, return zero balance
 	if len(sales) == 0 {
-		return 0, fmt.Errorf("no sales found for this customer")
+		return money.Zero, fmt.Errorf("no sales found for this customer")
 	}
 
 	// Iterate over each sale to compute outstanding balances
 	for _, sale := range sales {
-		totalPaid = 0
+		totalPaid = money.Zero
 
 		// Sum all payments for the sale
 		if err := r.db.Model(&saleRegistration.SalePayment{}).
 			Where("sale_id = ?", sale.ID).
 			Select("COALESCE(SUM(amount_payed), 0)").
 			Scan(&totalPaid).Error; err != nil {
-			return 0, err
+			return money.Zero, err
 		}
 
 		// Calculate outstanding balance for this sale
-		outstandingBalance := sale.TotalPrice - totalPaid
-		if outstandingBalance > 0 {
-			totalOutstanding += outstandingBalance
+		outstandingBalance := sale.TotalPrice.Sub(totalPaid)
+		if outstandingBalance.IsPositive() {
+			totalOutstanding = totalOutstanding.Add(outstandingBalance)
 		}
 	}
 
@@ -535,27 +655,65 @@ func (r *SaleRepositoryImpl) GetOutstandingBalanceByCustomerID(customerID uint)
 // =========================
 
 type PaymentRecord struct {
-	PaymentDate time.Time `json:"payment_date"`
-	Amount      float64   `json:"amount"`
+	PaymentDate time.Time   `json:"payment_date"`
+	Amount      money.Money `json:"amount"`
 }
 
 type SaleStatement struct {
+	SaleID            uint            `json:"sale_id"`
+	SaleDate          string          `json:"sale_date"`
 	CarID             uint            `json:"car_id"`
 	CarModel          string          `json:"car_model"`
 	ChasisNumber      string          `json:"chasis_number"`
-	TotalSaleAmount   float64         `json:"total_sale_amount"`
-	TotalPaid         float64         `json:"total_paid"`
-	OutstandingAmount float64         `json:"outstanding_amount"`
+	TotalSaleAmount   money.Money     `json:"total_sale_amount"`
+	TotalPaid         money.Money     `json:"total_paid"`
+	OutstandingAmount money.Money     `json:"outstanding_amount"`
 	Payments          []PaymentRecord `json:"payments"`
 }
 
+// StatementCompany is the letterhead printed on statements
+type StatementCompany struct {
+	CompanyID uint   `json:"company_id"`
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Telephone string `json:"telephone"`
+	Country   string `json:"country"`
+}
+
+const (
+	StatementEntryOpening = "opening"
+	StatementEntrySale    = "sale"
+	StatementEntryPayment = "payment"
+)
+
+// StatementEntry is one line of the statement ledger, in date order with a running balance
+type StatementEntry struct {
+	Date        string      `json:"date"`
+	Type        string      `json:"type"` // opening, sale, payment
+	SaleID      uint        `json:"sale_id"`
+	Description string      `json:"description"`
+	Debit       money.Money `json:"debit"`
+	Credit      money.Money `json:"credit"`
+	Balance     money.Money `json:"balance"`
+}
+
+// CustomerStatement covers the window [From, To]; activity before From is rolled up
+// into OpeningBalance. TotalSales and TotalPaid only count activity inside the window.
 type CustomerStatement struct {
-	CustomerID       uint            `json:"customer_id"`
-	CustomerName     string          `json:"customer_name"`
-	TotalSales       float64         `json:"total_sales"`
-	TotalPaid        float64         `json:"total_paid"`
-	TotalOutstanding float64         `json:"total_outstanding"`
-	Sales            []SaleStatement `json:"sales"`
+	CustomerID       uint              `json:"customer_id"`
+	CustomerName     string            `json:"customer_name"`
+	CustomerPhone    string            `json:"customer_phone"`
+	CustomerEmail    string            `json:"customer_email"`
+	Company          *StatementCompany `json:"company"`
+	From             string            `json:"from"`
+	To               string            `json:"to"`
+	OpeningBalance   money.Money       `json:"opening_balance"`
+	ClosingBalance   money.Money       `json:"closing_balance"`
+	TotalSales       money.Money       `json:"total_sales"`
+	TotalPaid        money.Money       `json:"total_paid"`
+	TotalOutstanding money.Money       `json:"total_outstanding"`
+	Entries          []StatementEntry  `json:"entries"`
+	Sales            []SaleStatement   `json:"sales"`
 }
 
 // Helper function to extract car IDs from []Car
@@ -587,11 +745,12 @@ func getChasisNumberByID(cars []carRegistration.Car, carID uint) string {
 	return ""
 }
 
-func (r *SaleRepositoryImpl) GenerateCustomerStatement(customerID uint) (*CustomerStatement, error) {
+// GenerateCustomerStatement builds the statement of a customer. from and to are optional: sales and
+// payments before from make up the opening balance, anything after to is left out.
+func (r *SaleRepositoryImpl) GenerateCustomerStatement(customerID uint, from, to *time.Time) (*CustomerStatement, error) {
 	var customer customerRegistration.Customer
 	var cars []carRegistration.Car
 	var sales []saleRegistration.Sale
-	var totalSales, totalPaid, totalOutstanding float64
 
 	// Fetch Customer details
 	if err := r.db.First(&customer, customerID).Error; err != nil {
@@ -603,65 +762,165 @@ func (r *SaleRepositoryImpl) GenerateCustomerStatement(customerID uint) (*Custom
 		return nil, err
 	}
 
-	// Fetch all sales linked to the customer’s cars
-	if err := r.db.Where("car_id IN (?)", getCarIDs(cars)).Find(&sales).Error; err != nil {
+	// Fetch all sales linked to the customer’s cars, up to the end of the window
+	salesQuery := r.db.Where("car_id IN (?)", getCarIDs(cars))
+	if to != nil {
+		salesQuery = salesQuery.Where("sale_date <= ?", to.Format("2006-01-02"))
+	}
+	if err := salesQuery.Order("sale_date ASC, id ASC").Find(&sales).Error; err != nil {
 		return nil, err
 	}
 
-	var saleStatements []SaleStatement
+	statement := &CustomerStatement{
+		CustomerID:    customerID,
+		CustomerName:  customer.Surname + " " + customer.Firstname + " " + customer.Othername,
+		CustomerPhone: customer.Telephone,
+		CustomerEmail: customer.Email,
+	}
+	if from != nil {
+		statement.From = from.Format("2006-01-02")
+	}
+	if to != nil {
+		statement.To = to.Format("2006-01-02")
+	}
+
+	var entries []StatementEntry
 
 	// Process each sale
 	for _, sale := range sales {
-		var payments []PaymentRecord
-		var totalSalePaid float64
-
-		// Fetch all payments for this sale
-		rows, err := r.db.Raw(`
-			SELECT amount_payed, payment_date 
-			FROM sale_payments 
-			WHERE sale_id = ? 
-			ORDER BY payment_date ASC`, sale.ID).Rows()
-		if err != nil {
+		var payments []saleRegistration.SalePayment
+		paymentsQuery := r.db.Where("sale_id = ?", sale.ID)
+		if to != nil {
+			paymentsQuery = paymentsQuery.Where("payment_date <= ?", to.Format("2006-01-02"))
+		}
+		if err := paymentsQuery.Order("payment_date ASC, id ASC").Find(&payments).Error; err != nil {
 			return nil, err
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var payment PaymentRecord
-			if err := rows.Scan(&payment.Amount, &payment.PaymentDate); err != nil {
-				return nil, err
-			}
-			payments = append(payments, payment)
-			totalSalePaid += payment.Amount
+		saleDate := sale.SaleDate
+		if len(saleDate) > 10 {
+			saleDate = saleDate[:10]
 		}
+		carModel := getCarModelByID(cars, sale.CarID)
+		chasisNumber := getChasisNumberByID(cars, sale.CarID)
+
+		entries = append(entries, StatementEntry{
+			Date:        saleDate,
+			Type:        StatementEntrySale,
+			SaleID:      sale.ID,
+			Description: strings.TrimSpace(fmt.Sprintf("Sale #%d %s %s", sale.ID, carModel, chasisNumber)),
+			Debit:       sale.TotalPrice,
+		})
 
-		// Calculate outstanding balance
-		outstanding := sale.TotalPrice - totalSalePaid
+		var records []PaymentRecord
+		totalSalePaid := money.Zero
+		for _, p := range payments {
+			paymentDate, _ := parseSaleDate(p.PaymentDate)
+			records = append(records, PaymentRecord{PaymentDate: paymentDate, Amount: p.AmountPayed})
+			totalSalePaid = totalSalePaid.Add(p.AmountPayed)
+
+			entries = append(entries, StatementEntry{
+				Date:        paymentDate.Format("2006-01-02"),
+				Type:        StatementEntryPayment,
+				SaleID:      sale.ID,
+				Description: fmt.Sprintf("Payment for sale #%d", sale.ID),
+				Credit:      p.AmountPayed,
+			})
+		}
 
-		// Create Sale Statement
-		saleStatements = append(saleStatements, SaleStatement{
+		// Create Sale Statement, as at the end of the window
+		statement.Sales = append(statement.Sales, SaleStatement{
+			SaleID:            sale.ID,
+			SaleDate:          saleDate,
 			CarID:             sale.CarID,
-			CarModel:          getCarModelByID(cars, sale.CarID),
-			ChasisNumber:      getChasisNumberByID(cars, sale.CarID),
+			CarModel:          carModel,
+			ChasisNumber:      chasisNumber,
 			TotalSaleAmount:   sale.TotalPrice,
 			TotalPaid:         totalSalePaid,
-			OutstandingAmount: outstanding,
-			Payments:          payments,
+			OutstandingAmount: sale.TotalPrice.Sub(totalSalePaid),
+			Payments:          records,
 		})
+	}
+
+	// Date order; on the same day the sale comes before its payments
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].Type == StatementEntrySale && entries[j].Type != StatementEntrySale
+	})
+
+	// Roll everything before the window into the opening balance
+	balance := money.Zero
+	var window []StatementEntry
+	for _, entry := range entries {
+		if statement.From != "" && entry.Date < statement.From {
+			balance = balance.Add(entry.Debit).Sub(entry.Credit)
+			continue
+		}
+		window = append(window, entry)
+	}
+	statement.OpeningBalance = balance.Round()
+	statement.Entries = append(statement.Entries, StatementEntry{
+		Date:        statement.From,
+		Type:        StatementEntryOpening,
+		Description: "Opening balance",
+		Balance:     statement.OpeningBalance,
+	})
+
+	// Activity inside the window with a running balance
+	for _, entry := range window {
+		balance = balance.Add(entry.Debit).Sub(entry.Credit)
+		entry.Balance = balance.Round()
+		statement.TotalSales = statement.TotalSales.Add(entry.Debit)
+		statement.TotalPaid = statement.TotalPaid.Add(entry.Credit)
+		statement.Entries = append(statement.Entries, entry)
+	}
+	statement.ClosingBalance = balance.Round()
+	statement.TotalOutstanding = statement.ClosingBalance
+
+	// Letterhead: the customer's company, else the company that made the first sale
+	var companyID uint
+	if customer.CompanyID != nil {
+		companyID = *customer.CompanyID
+	} else if len(sales) > 0 {
+		companyID = uint(sales[0].CompanyID)
+	}
+	company, err := r.getStatementCompany(companyID)
+	if err != nil {
+		return nil, err
+	}
+	statement.Company = company
+
+	return statement, nil
+}
+
+// getStatementCompany loads the company and its first location for a statement header
+func (r *SaleRepositoryImpl) getStatementCompany(companyID uint) (*StatementCompany, error) {
+	if companyID == 0 {
+		return nil, nil
+	}
+
+	var company companyRegistration.Company
+	if err := r.db.First(&company, companyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	header := &StatementCompany{CompanyID: company.ID, Name: company.Name}
+
+	var location companyRegistration.CompanyLocation
+	result := r.db.Where("company_id = ?", companyID).Order("id ASC").Limit(1).Find(&location)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		header.Address = location.Address
+		header.Telephone = location.Telephone
+		header.Country = location.Country
+	}
 
-		// Update totals
-		totalSales += sale.TotalPrice
-		totalPaid += totalSalePaid
-		totalOutstanding += outstanding
-	}
-
-	// Create and return the full statement
-	return &CustomerStatement{
-		CustomerID:       customerID,
-		CustomerName:     customer.Surname + " " + customer.Firstname + " " + customer.Othername,
-		TotalSales:       totalSales,
-		TotalPaid:        totalPaid,
-		TotalOutstanding: totalOutstanding,
-		Sales:            saleStatements,
-	}, nil
+	return header, nil
 }
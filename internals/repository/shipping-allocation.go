@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/money"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvoiceLocked             = errors.New("invoice is locked")
+	ErrInvalidAllocationMethod   = errors.New("invalid allocation method (expected equal, weight or volume)")
+	ErrNoCarsOnInvoice           = errors.New("invoice has no cars")
+	ErrMissingAllocationMeasures = errors.New("cars are missing the measurements needed for this allocation method")
+)
+
+// shippingCostLines are the invoice costs written to each car, keyed by the expense description
+func shippingCostLines(invoice *carRegistration.CarShippingInvoice) []struct {
+	Description string
+	Amount      money.Money
+} {
+	return []struct {
+		Description string
+		Amount      money.Money
+	}{
+		{"Freight Cost", invoice.FreightCost},
+		{"Shipping Insurance", invoice.InsuranceCost},
+		{"Port Fee", invoice.PortCharges},
+	}
+}
+
+// allocationWeights returns the share basis of every car for the given method
+func allocationWeights(cars []carRegistration.Car, method string) ([]money.Money, error) {
+	weights := make([]money.Money, len(cars))
+	var missing []string
+
+	for i, car := range cars {
+		switch method {
+		case carRegistration.AllocationEqual:
+			weights[i] = money.NewFromInt(1)
+		case carRegistration.AllocationWeight:
+			weights[i] = money.New(car.Weight)
+		case carRegistration.AllocationVolume:
+			weights[i] = money.New(car.Length).Mul(money.New(car.Width)).Mul(money.New(car.Height))
+		default:
+			return nil, ErrInvalidAllocationMethod
+		}
+		if !weights[i].IsPositive() {
+			missing = append(missing, car.ChasisNumber)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingAllocationMeasures, strings.Join(missing, ", "))
+	}
+	return weights, nil
+}
+
+// allocateShippingCosts replaces the allocated expense rows of an invoice. It does not check the
+// lock, so LockInvoice can take a final allocation inside its own transaction.
+func allocateShippingCosts(tx *gorm.DB, invoice *carRegistration.CarShippingInvoice, method, updatedBy string) ([]carRegistration.CarExpense, error) {
+	var cars []carRegistration.Car
+	if err := tx.Where("car_shipping_invoice_id = ?", invoice.ID).Order("id ASC").Find(&cars).Error; err != nil {
+		return nil, err
+	}
+	if len(cars) == 0 {
+		return nil, ErrNoCarsOnInvoice
+	}
+
+	weights, err := allocationWeights(cars, method)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allocated rows are derived data, so previous ones are removed for good
+	if err := tx.Unscoped().Where("car_shipping_invoice_id = ?", invoice.ID).
+		Delete(&carRegistration.CarExpense{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to clear allocated expenses: %w", err)
+	}
+
+	expenseDate := invoice.ShipDate
+	if len(expenseDate) > 10 {
+		expenseDate = expenseDate[:10]
+	}
+	invoiceID := invoice.ID
+
+	var expenses []carRegistration.CarExpense
+	for _, line := range shippingCostLines(invoice) {
+		if !line.Amount.IsPositive() {
+			continue
+		}
+		for i, share := range line.Amount.Allocate(weights) {
+			expenses = append(expenses, carRegistration.CarExpense{
+				CarID:                cars[i].ID,
+				Description:          line.Description,
+				Currency:             invoice.Currency,
+				Amount:               share,
+				ExpenseDate:          expenseDate,
+				Destination:          invoice.ToLocation,
+				CompanyName:          invoice.VesselName,
+				ExpenseRemark:        fmt.Sprintf("Shipping invoice %s (%s allocation)", invoice.InvoiceNo, method),
+				CarShippingInvoiceID: &invoiceID,
+				CreatedBy:            updatedBy,
+				UpdatedBy:            updatedBy,
+			})
+		}
+	}
+
+	if len(expenses) > 0 {
+		if err := tx.Create(&expenses).Error; err != nil {
+			return nil, fmt.Errorf("failed to create allocated expenses: %w", err)
+		}
+	}
+
+	if err := tx.Model(invoice).Updates(map[string]interface{}{
+		"allocation_method": method,
+		"updated_by":        updatedBy,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return expenses, nil
+}
+
+// AllocateShippingCosts splits freight, insurance and port charges of an unlocked invoice across
+// its cars and writes the shares as car expenses, replacing any earlier allocation
+func (r *ShippingRepositoryImpl) AllocateShippingCosts(invoiceID uint, method, updatedBy string) ([]carRegistration.CarExpense, error) {
+	var expenses []carRegistration.CarExpense
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var invoice carRegistration.CarShippingInvoice
+		if err := tx.First(&invoice, invoiceID).Error; err != nil {
+			return err
+		}
+		if invoice.Locked {
+			return ErrInvoiceLocked
+		}
+
+		var err error
+		expenses, err = allocateShippingCosts(tx, &invoice, method, updatedBy)
+		return err
+	})
+	return expenses, err
+}
+
+func (r *ShippingRepositoryImpl) GetInvoiceAllocations(invoiceID uint) ([]carRegistration.CarExpense, error) {
+	var expenses []carRegistration.CarExpense
+	err := r.db.Where("car_shipping_invoice_id = ?", invoiceID).
+		Order("car_id ASC, id ASC").
+		Find(&expenses).Error
+	return expenses, err
+}
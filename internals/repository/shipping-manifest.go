@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"car-bond/internals/models/carRegistration"
+	"sort"
+)
+
+// ManifestConsigneeUnassigned labels the cars of an invoice without a consignee (OtherEntity)
+const ManifestConsigneeUnassigned = "Unassigned"
+
+type ManifestGroup struct {
+	Consignee   string                `json:"consignee"`
+	Cars        []carRegistration.Car `json:"cars"`
+	Units       int                   `json:"units"`
+	Weight      float64               `json:"weight"`
+	GrossWeight float64               `json:"gross_weight"`
+}
+
+// ShippingManifest is the packing list of a shipping invoice, with the cars grouped by consignee
+type ShippingManifest struct {
+	Invoice          carRegistration.CarShippingInvoice `json:"invoice"`
+	Groups           []ManifestGroup                    `json:"groups"`
+	TotalUnits       int                                `json:"total_units"`
+	TotalWeight      float64                            `json:"total_weight"`
+	TotalGrossWeight float64                            `json:"total_gross_weight"`
+}
+
+// GetShippingManifest groups the cars of an invoice by consignee the way GetCarsByInvoiceId does,
+// in consignee then chassis order, with unit and weight totals per group and for the shipment
+func (r *ShippingRepositoryImpl) GetShippingManifest(invoiceID uint) (*ShippingManifest, error) {
+	var invoice carRegistration.CarShippingInvoice
+	if err := r.db.First(&invoice, invoiceID).Error; err != nil {
+		return nil, err
+	}
+
+	grouped, err := r.GetCarsByInvoiceId(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ShippingManifest{Invoice: invoice, Groups: []ManifestGroup{}}
+	for consignee, cars := range grouped {
+		sort.Slice(cars, func(i, j int) bool { return cars[i].ChasisNumber < cars[j].ChasisNumber })
+		if consignee == "" {
+			consignee = ManifestConsigneeUnassigned
+		}
+
+		group := ManifestGroup{Consignee: consignee, Cars: cars, Units: len(cars)}
+		for _, car := range cars {
+			group.Weight += car.Weight
+			group.GrossWeight += car.GrossWeight
+		}
+		manifest.Groups = append(manifest.Groups, group)
+		manifest.TotalUnits += group.Units
+		manifest.TotalWeight += group.Weight
+		manifest.TotalGrossWeight += group.GrossWeight
+	}
+
+	// Named consignees alphabetically, unassigned cars last
+	sort.Slice(manifest.Groups, func(i, j int) bool {
+		a, b := manifest.Groups[i].Consignee, manifest.Groups[j].Consignee
+		if (a == ManifestConsigneeUnassigned) != (b == ManifestConsigneeUnassigned) {
+			return b == ManifestConsigneeUnassigned
+		}
+		return a < b
+	})
+	return manifest, nil
+}
@@ -0,0 +1,352 @@
+package repository
+
+import (
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/models/carRegistration"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownMilestone      = errors.New("unknown voyage milestone")
+	ErrUnknownContainerType  = errors.New("unknown container type")
+	ErrDuplicateContainer    = errors.New("container is already on this invoice")
+	ErrContainerNotOnInvoice = errors.New("container does not belong to this invoice")
+	ErrCarNotOnInvoice       = errors.New("car is not on this invoice")
+)
+
+// TransactionTypeVoyage marks the alerts raised by voyage milestones
+const TransactionTypeVoyage = "Voyage"
+
+// MilestoneOrder lists the voyage milestones in the order a shipment reaches them
+var MilestoneOrder = []string{
+	carRegistration.MilestoneLoaded,
+	carRegistration.MilestoneDeparted,
+	carRegistration.MilestoneTransshipment,
+	carRegistration.MilestoneArrivedPort,
+	carRegistration.MilestoneReleased,
+	carRegistration.MilestoneArrivedYard,
+}
+
+var milestoneLabels = map[string]string{
+	carRegistration.MilestoneLoaded:        "loaded",
+	carRegistration.MilestoneDeparted:      "departed",
+	carRegistration.MilestoneTransshipment: "transshipped",
+	carRegistration.MilestoneArrivedPort:   "arrived at port",
+	carRegistration.MilestoneReleased:      "released",
+	carRegistration.MilestoneArrivedYard:   "arrived at the yard",
+}
+
+// milestoneCarStatus is the car status a milestone moves a car to
+var milestoneCarStatus = map[string]string{
+	carRegistration.MilestoneLoaded:        CarStatusInTransit,
+	carRegistration.MilestoneDeparted:      CarStatusInTransit,
+	carRegistration.MilestoneTransshipment: CarStatusInTransit,
+	carRegistration.MilestoneArrivedPort:   CarStatusInTransit,
+	carRegistration.MilestoneReleased:      CarStatusInTransit,
+	carRegistration.MilestoneArrivedYard:   CarStatusInStock,
+}
+
+var containerTypes = map[string]bool{
+	carRegistration.ContainerType20GP: true,
+	carRegistration.ContainerType40GP: true,
+	carRegistration.ContainerType40HC: true,
+	carRegistration.ContainerTypeRoRo: true,
+}
+
+func IsMilestone(milestone string) bool {
+	_, ok := milestoneLabels[milestone]
+	return ok
+}
+
+// ShipmentTracking is what the receiving side needs to follow a shipment
+type ShipmentTracking struct {
+	Invoice    carRegistration.CarShippingInvoice  `json:"invoice"`
+	Position   string                              `json:"position"`
+	ETA        *string                             `json:"eta"`
+	Latest     *carRegistration.VoyageMilestone    `json:"latest_milestone"`
+	Containers []carRegistration.ShippingContainer `json:"containers"`
+	Unpacked   []carRegistration.Car               `json:"cars_without_container"`
+	Milestones []carRegistration.VoyageMilestone   `json:"milestones"`
+}
+
+// MilestoneResult is what recording a milestone changed
+type MilestoneResult struct {
+	Milestone    carRegistration.VoyageMilestone `json:"milestone"`
+	CarsUpdated  int                             `json:"cars_updated"`
+	Transactions []alertRegistration.Transaction `json:"transactions"`
+}
+
+func milestonePosition(milestone *carRegistration.VoyageMilestone) string {
+	position := milestoneLabels[milestone.Milestone]
+	if milestone.Location != "" {
+		position += " - " + milestone.Location
+	}
+	return strings.ToUpper(position[:1]) + position[1:]
+}
+
+// ================================
+
+// checkCarsOnInvoice makes sure every car belongs to the invoice
+func checkCarsOnInvoice(tx *gorm.DB, invoiceID uint, carIDs []uint) error {
+	if len(carIDs) == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&carRegistration.Car{}).
+		Where("id IN ? AND car_shipping_invoice_id = ?", carIDs, invoiceID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(uniqueIDs(carIDs)) {
+		return ErrCarNotOnInvoice
+	}
+	return nil
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
+
+func (r *ShippingRepositoryImpl) CreateContainer(container *carRegistration.ShippingContainer, carIDs []uint) error {
+	if !containerTypes[container.Type] {
+		return fmt.Errorf("%w %q", ErrUnknownContainerType, container.Type)
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var invoice carRegistration.CarShippingInvoice
+		if err := tx.First(&invoice, container.CarShippingInvoiceID).Error; err != nil {
+			return err
+		}
+
+		var existing int64
+		if err := tx.Model(&carRegistration.ShippingContainer{}).
+			Where("car_shipping_invoice_id = ? AND container_no = ?", container.CarShippingInvoiceID, container.ContainerNo).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrDuplicateContainer
+		}
+
+		if err := tx.Create(container).Error; err != nil {
+			return err
+		}
+		return assignContainerCars(tx, container, carIDs)
+	})
+}
+
+// assignContainerCars makes carIDs the cars of the container
+func assignContainerCars(tx *gorm.DB, container *carRegistration.ShippingContainer, carIDs []uint) error {
+	if err := checkCarsOnInvoice(tx, container.CarShippingInvoiceID, carIDs); err != nil {
+		return err
+	}
+	if err := tx.Model(&carRegistration.Car{}).
+		Where("container_id = ?", container.ID).
+		Update("container_id", nil).Error; err != nil {
+		return err
+	}
+	if len(carIDs) > 0 {
+		if err := tx.Model(&carRegistration.Car{}).
+			Where("id IN ?", carIDs).
+			Update("container_id", container.ID).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("container_id = ?", container.ID).Find(&container.Cars).Error
+}
+
+func (r *ShippingRepositoryImpl) GetContainerByID(id uint) (carRegistration.ShippingContainer, error) {
+	var container carRegistration.ShippingContainer
+	err := r.db.Preload("Cars").First(&container, id).Error
+	return container, err
+}
+
+func (r *ShippingRepositoryImpl) UpdateContainer(container *carRegistration.ShippingContainer) error {
+	if !containerTypes[container.Type] {
+		return fmt.Errorf("%w %q", ErrUnknownContainerType, container.Type)
+	}
+	var existing int64
+	if err := r.db.Model(&carRegistration.ShippingContainer{}).
+		Where("car_shipping_invoice_id = ? AND container_no = ? AND id <> ?", container.CarShippingInvoiceID, container.ContainerNo, container.ID).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return ErrDuplicateContainer
+	}
+	return r.db.Omit("Cars").Save(container).Error
+}
+
+func (r *ShippingRepositoryImpl) AssignContainerCars(containerID uint, carIDs []uint) (carRegistration.ShippingContainer, error) {
+	var container carRegistration.ShippingContainer
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&container, containerID).Error; err != nil {
+			return err
+		}
+		return assignContainerCars(tx, &container, carIDs)
+	})
+	return container, err
+}
+
+// DeleteContainer removes a container; its cars stay on the invoice without a container
+func (r *ShippingRepositoryImpl) DeleteContainer(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&carRegistration.Car{}).
+			Where("container_id = ?", id).
+			Update("container_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&carRegistration.ShippingContainer{}, id).Error
+	})
+}
+
+// ================================
+
+// RecordMilestone stores a milestone of the shipment (or of one container), moves the status of the
+// cars concerned forward and raises a transaction alert for each of them
+func (r *ShippingRepositoryImpl) RecordMilestone(milestone *carRegistration.VoyageMilestone) (*MilestoneResult, error) {
+	if !IsMilestone(milestone.Milestone) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownMilestone, milestone.Milestone)
+	}
+
+	result := &MilestoneResult{Transactions: []alertRegistration.Transaction{}}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var invoice carRegistration.CarShippingInvoice
+		if err := tx.First(&invoice, milestone.CarShippingInvoiceID).Error; err != nil {
+			return err
+		}
+
+		cars := tx.Where("car_shipping_invoice_id = ?", invoice.ID)
+		if milestone.ContainerID != nil {
+			var container carRegistration.ShippingContainer
+			if err := tx.First(&container, *milestone.ContainerID).Error; err != nil {
+				return err
+			}
+			if container.CarShippingInvoiceID != invoice.ID {
+				return ErrContainerNotOnInvoice
+			}
+			cars = cars.Where("container_id = ?", container.ID)
+		}
+
+		if err := tx.Create(milestone).Error; err != nil {
+			return fmt.Errorf("failed to record milestone: %w", err)
+		}
+
+		// The invoice shows the latest milestone of the shipment
+		var latest carRegistration.VoyageMilestone
+		if err := tx.Where("car_shipping_invoice_id = ?", invoice.ID).
+			Order("occurred_at DESC, id DESC").
+			First(&latest).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"position":   milestonePosition(&latest),
+			"updated_by": milestone.CreatedBy,
+		}
+		if milestone.ETA != nil {
+			updates["eta"] = *milestone.ETA
+		}
+		if err := tx.Model(&invoice).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		var affected []carRegistration.Car
+		if err := cars.Find(&affected).Error; err != nil {
+			return err
+		}
+
+		status := milestoneCarStatus[milestone.Milestone]
+		description := fmt.Sprintf("%s %s", milestonePosition(milestone), milestone.OccurredAt.Format("2006-01-02"))
+		if milestone.ETA != nil {
+			description += ", ETA " + *milestone.ETA
+		}
+
+		for _, car := range affected {
+			// Milestones only move a car forward: a car already in stock or sold keeps its status
+			if car.CarStatus != status && carRegistration.CheckTransition(carRegistration.StatusFieldCar, car.CarStatus, status, false) == nil {
+				if _, err := carRegistration.ChangeCarStatus(tx, car.ID, carRegistration.StatusChange{
+					Field:  carRegistration.StatusFieldCar,
+					To:     status,
+					Reason: truncate("Voyage: "+description, 255),
+					By:     milestone.CreatedBy,
+				}); err != nil {
+					return fmt.Errorf("failed to update status of car %s: %w", car.ChasisNumber, err)
+				}
+				result.CarsUpdated++
+			}
+
+			transaction := alertRegistration.Transaction{
+				CarChasisNumber: car.ChasisNumber,
+				TransactionType: TransactionTypeVoyage,
+				Description:     truncate("Car "+car.ChasisNumber+": "+description, 100),
+				FromCompanyId:   derefUint(car.FromCompanyID),
+				ToCompanyId:     derefUint(car.ToCompanyID),
+				CreatedBy:       milestone.CreatedBy,
+				UpdatedBy:       milestone.CreatedBy,
+			}
+			if err := tx.Create(&transaction).Error; err != nil {
+				return fmt.Errorf("failed to raise alert for car %s: %w", car.ChasisNumber, err)
+			}
+			result.Transactions = append(result.Transactions, transaction)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Milestone = *milestone
+	return result, nil
+}
+
+func derefUint(v *uint) uint {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// GetShipmentTracking returns the containers, their cars and the milestones of an invoice
+func (r *ShippingRepositoryImpl) GetShipmentTracking(invoiceID uint) (*ShipmentTracking, error) {
+	var invoice carRegistration.CarShippingInvoice
+	if err := r.db.First(&invoice, invoiceID).Error; err != nil {
+		return nil, err
+	}
+
+	tracking := &ShipmentTracking{Invoice: invoice, Position: invoice.Position, ETA: invoice.ETA}
+	if err := r.db.Preload("Cars").
+		Where("car_shipping_invoice_id = ?", invoiceID).
+		Order("container_no ASC").
+		Find(&tracking.Containers).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Where("car_shipping_invoice_id = ? AND container_id IS NULL", invoiceID).
+		Order("chasis_number ASC").
+		Find(&tracking.Unpacked).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Where("car_shipping_invoice_id = ?", invoiceID).
+		Order("occurred_at ASC, id ASC").
+		Find(&tracking.Milestones).Error; err != nil {
+		return nil, err
+	}
+	if n := len(tracking.Milestones); n > 0 {
+		latest := tracking.Milestones[n-1]
+		tracking.Latest = &latest
+	}
+	return tracking, nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"car-bond/internals/models/carRegistration"
 	"car-bond/internals/utils"
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 )
 
 type ShippingRepository interface {
+	WithContext(ctx context.Context) ShippingRepository
 	CreateShippingInvoice(invoice *carRegistration.CarShippingInvoice) error
 	GetPaginatedShippingInvoices(c *fiber.Ctx) (*utils.Pagination, []carRegistration.CarShippingInvoice, error)
 	// GetCarsByInvoiceId(invoiceID uint) ([]carRegistration.Car, error)
@@ -24,6 +26,20 @@ type ShippingRepository interface {
 
 	UnlockInvoice(id uint, updatedBy string) error
 	LockInvoice(id uint, updatedBy string) error
+
+	AllocateShippingCosts(invoiceID uint, method, updatedBy string) ([]carRegistration.CarExpense, error)
+	GetInvoiceAllocations(invoiceID uint) ([]carRegistration.CarExpense, error)
+
+	GetShippingManifest(invoiceID uint) (*ShippingManifest, error)
+
+	// Containers and voyage tracking
+	CreateContainer(container *carRegistration.ShippingContainer, carIDs []uint) error
+	GetContainerByID(id uint) (carRegistration.ShippingContainer, error)
+	UpdateContainer(container *carRegistration.ShippingContainer) error
+	AssignContainerCars(containerID uint, carIDs []uint) (carRegistration.ShippingContainer, error)
+	DeleteContainer(id uint) error
+	RecordMilestone(milestone *carRegistration.VoyageMilestone) (*MilestoneResult, error)
+	GetShipmentTracking(invoiceID uint) (*ShipmentTracking, error)
 }
 
 type ShippingRepositoryImpl struct {
@@ -34,6 +50,10 @@ func NewShippingRepository(db *gorm.DB) ShippingRepository {
 	return &ShippingRepositoryImpl{db: db}
 }
 
+func (r *ShippingRepositoryImpl) WithContext(ctx context.Context) ShippingRepository {
+	return NewShippingRepository(r.db.WithContext(ctx))
+}
+
 func (r *ShippingRepositoryImpl) CreateShippingInvoice(invoice *carRegistration.CarShippingInvoice) error {
 	return r.db.Create(invoice).Error
 }
@@ -103,36 +123,48 @@ func (r *ShippingRepositoryImpl) UpdateShippingInvoice(invoice *carRegistration.
 	return r.db.Save(invoice).Error
 }
 
-// DeleteByID deletes a Invoice by ID
+// DeleteByID deletes a Invoice by ID, with its containers and voyage milestones
 func (r *ShippingRepositoryImpl) DeleteShippingInvoiceByID(id string) error {
-	if err := r.db.Delete(&carRegistration.CarShippingInvoice{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return deleteWithDependants(tx, "shipping-invoices", id)
+	})
 }
 
 var ErrAlreadyLocked = errors.New("invoice already locked")
 
+// LockInvoice locks an invoice and, when its costs were allocated, recomputes the allocation one
+// last time so the car expenses match the invoice as it was locked
 func (r *ShippingRepositoryImpl) LockInvoice(id uint, updatedBy string) error {
-	tx := r.db.Model(&carRegistration.CarShippingInvoice{}).
-		Where("id = ? AND locked = ?", id, false).
-		Updates(map[string]interface{}{
-			"locked":     true,
-			"updated_by": updatedBy,
-		})
+	return r.db.Transaction(func(db *gorm.DB) error {
+		tx := db.Model(&carRegistration.CarShippingInvoice{}).
+			Where("id = ? AND locked = ?", id, false).
+			Updates(map[string]interface{}{
+				"locked":     true,
+				"updated_by": updatedBy,
+			})
+
+		if tx.Error != nil {
+			return tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			// Either not found or already locked; check which.
+			var tmp carRegistration.CarShippingInvoice
+			if err := db.Select("id", "locked").First(&tmp, id).Error; err != nil {
+				return err // not found
+			}
+			return ErrAlreadyLocked
+		}
 
-	if tx.Error != nil {
-		return tx.Error
-	}
-	if tx.RowsAffected == 0 {
-		// Either not found or already locked; check which.
-		var tmp carRegistration.CarShippingInvoice
-		if err := r.db.Select("id", "locked").First(&tmp, id).Error; err != nil {
-			return err // not found
+		var invoice carRegistration.CarShippingInvoice
+		if err := db.First(&invoice, id).Error; err != nil {
+			return err
 		}
-		return ErrAlreadyLocked
-	}
-	return nil
+		if invoice.AllocationMethod == "" {
+			return nil
+		}
+		_, err := allocateShippingCosts(db, &invoice, invoice.AllocationMethod, updatedBy)
+		return err
+	})
 }
 
 func (r *ShippingRepositoryImpl) UnlockInvoice(id uint, updatedBy string) error {
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"car-bond/internals/models/userRegistration"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Lifetimes of the tokens handed out at login and refresh
+const (
+	AccessTokenTTL  = 72 * time.Hour
+	RefreshTokenTTL = 72 * 7 * time.Hour
+)
+
+var (
+	// ErrInvalidRefreshToken covers unknown, expired and revoked refresh tokens alike
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused means a used refresh token came back; its family has been revoked
+	ErrRefreshTokenReused = errors.New("refresh token already used; all sessions started with it have been revoked")
+)
+
+type TokenRepository interface {
+	WithContext(ctx context.Context) TokenRepository
+	IssueRefreshToken(userID uint, familyID, accessJTI string) (string, error)
+	RotateRefreshToken(raw string) (*userRegistration.RefreshToken, error)
+	RevokeRefreshToken(raw string, userID uint) error
+	RevokeAccessToken(jti string, userID uint, expiresAt time.Time, reason string) error
+	RevokeAllSessions(userID uint, reason string) error
+	IsRevoked(jti string, userID uint, issuedAt time.Time) (bool, error)
+}
+
+type TokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) TokenRepository {
+	return &TokenRepositoryImpl{db: db}
+}
+
+func (r *TokenRepositoryImpl) WithContext(ctx context.Context) TokenRepository {
+	return NewTokenRepository(r.db.WithContext(ctx))
+}
+
+// hashToken is what is stored of a refresh or password reset token
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueRefreshToken creates a refresh token, in a new family when familyID is empty, and returns the
+// token itself; only its hash is stored
+func (r *TokenRepositoryImpl) IssueRefreshToken(userID uint, familyID, accessJTI string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(secret)
+	if familyID == "" {
+		familyID = uuid.NewString()
+	}
+
+	token := userRegistration.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(raw),
+		FamilyID:  familyID,
+		AccessJTI: accessJTI,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := r.db.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// RotateRefreshToken uses up a refresh token and returns it, for the caller to issue the next one of its
+// family. A token used before revokes its family and the access tokens issued with it.
+func (r *TokenRepositoryImpl) RotateRefreshToken(raw string) (*userRegistration.RefreshToken, error) {
+	var token userRegistration.RefreshToken
+	if err := r.db.Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if token.RevokedAt != nil || now.After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Only one request can mark the token used, even when two race with it
+	result := r.db.Model(&userRegistration.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", token.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := r.revokeFamily(token.FamilyID, "refresh token reused"); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	token.UsedAt = &now
+	return &token, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token of the user, as at logout
+func (r *TokenRepositoryImpl) RevokeRefreshToken(raw string, userID uint) error {
+	var token userRegistration.RefreshToken
+	if err := r.db.Where("token_hash = ? AND user_id = ?", hashToken(raw), userID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return r.revokeFamily(token.FamilyID, "logout")
+}
+
+// revokeFamily revokes the refresh tokens of a family and denies the access tokens issued with them
+func (r *TokenRepositoryImpl) revokeFamily(familyID, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var tokens []userRegistration.RefreshToken
+		if err := tx.Where("family_id = ?", familyID).Find(&tokens).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&userRegistration.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			// An access token lives at most AccessTokenTTL from the refresh that issued it
+			issued := token.CreatedAt
+			if token.AccessJTI == "" || now.After(issued.Add(AccessTokenTTL)) {
+				continue
+			}
+			if err := denyAccessToken(tx, token.AccessJTI, token.UserID, issued.Add(AccessTokenTTL), reason); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RevokeAccessToken denies one access token until it expires
+func (r *TokenRepositoryImpl) RevokeAccessToken(jti string, userID uint, expiresAt time.Time, reason string) error {
+	return denyAccessToken(r.db, jti, userID, expiresAt, reason)
+}
+
+func denyAccessToken(db *gorm.DB, jti string, userID uint, expiresAt time.Time, reason string) error {
+	if jti == "" {
+		return nil
+	}
+	if err := purgeRevokedTokens(db); err != nil {
+		return err
+	}
+	return db.Create(&userRegistration.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		Reason:    reason,
+	}).Error
+}
+
+// RevokeAllSessions signs the user out everywhere: every refresh token is revoked and every access token
+// issued so far is denied
+func (r *TokenRepositoryImpl) RevokeAllSessions(userID uint, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&userRegistration.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if err := purgeRevokedTokens(tx); err != nil {
+			return err
+		}
+		return tx.Create(&userRegistration.RevokedToken{
+			UserID:        userID,
+			RevokedBefore: now,
+			ExpiresAt:     now.Add(AccessTokenTTL),
+			Reason:        reason,
+		}).Error
+	})
+}
+
+// IsRevoked reports whether an access token was revoked, by its jti or by revoking every session of its
+// user after it was issued. Token times have whole seconds, so a token issued less than a second before
+// the sessions were revoked may stay valid.
+func (r *TokenRepositoryImpl) IsRevoked(jti string, userID uint, issuedAt time.Time) (bool, error) {
+	var count int64
+	query := r.db.Model(&userRegistration.RevokedToken{}).Where("expires_at > ?", time.Now())
+	if jti != "" {
+		query = query.Where("jti = ? OR (user_id = ? AND jti = '' AND revoked_before > ?)", jti, userID, issuedAt.Add(time.Second))
+	} else {
+		query = query.Where("user_id = ? AND jti = '' AND revoked_before > ?", userID, issuedAt.Add(time.Second))
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// purgeRevokedTokens drops the denials of tokens that have expired anyway
+func purgeRevokedTokens(db *gorm.DB) error {
+	return db.Unscoped().Where("expires_at <= ?", time.Now()).Delete(&userRegistration.RevokedToken{}).Error
+}
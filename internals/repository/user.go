@@ -3,6 +3,7 @@ package repository
 import (
 	"car-bond/internals/models/userRegistration"
 	"car-bond/internals/utils"
+	"context"
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,6 +11,7 @@ import (
 )
 
 type UserRepository interface {
+	WithContext(ctx context.Context) UserRepository
 	CreateUser(user *userRegistration.User) error
 	GetPaginatedUsers(c *fiber.Ctx) (*utils.Pagination, []userRegistration.User, error)
 	GetUserByID(id string) (*userRegistration.User, error)
@@ -26,6 +28,10 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &UserRepositoryImpl{db: db}
 }
 
+func (r *UserRepositoryImpl) WithContext(ctx context.Context) UserRepository {
+	return NewUserRepository(r.db.WithContext(ctx))
+}
+
 func (r *UserRepositoryImpl) CreateUser(user *userRegistration.User) error {
 	return r.db.Create(user).Error
 }
@@ -51,10 +57,13 @@ func (r *UserRepositoryImpl) UpdateUser(user *userRegistration.User) error {
 }
 
 func (r *UserRepositoryImpl) DeleteUserByID(id string) error {
-	if err := r.db.Delete(&userRegistration.User{}, "id = ?", id).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&userRegistration.User{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		// A deleted user's tokens stop working at once rather than when they expire
+		return NewTokenRepository(tx).RevokeAllSessions(utils.StrToUint(id), "user deleted")
+	})
 }
 
 // GetPaginatedUsersByCompanyId retrieves paginated users by company ID
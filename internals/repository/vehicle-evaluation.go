@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"car-bond/internals/models/metaData"
+	"car-bond/internals/money"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDuplicateEvaluationUpload = errors.New("this valuation file was already uploaded")
+	ErrNoEvaluationVersion       = errors.New("no vehicle evaluation version in effect on that date")
+)
+
+type EvaluationChange struct {
+	HSCCode     string      `json:"hsc_code"`
+	Description string      `json:"description"`
+	CC          string      `json:"cc"`
+	COO         string      `json:"coo"`
+	OldCIF      money.Money `json:"old_cif"`
+	NewCIF      money.Money `json:"new_cif"`
+	Difference  money.Money `json:"difference"`
+}
+
+// EvaluationDiff lists what changed between two uploads. Rows are matched on HSC code, description
+// and CC.
+type EvaluationDiff struct {
+	From    metaData.VehicleEvaluationVersion `json:"from"`
+	To      metaData.VehicleEvaluationVersion `json:"to"`
+	Added   []metaData.VehicleEvaluation      `json:"added"`
+	Removed []metaData.VehicleEvaluation      `json:"removed"`
+	Changed []EvaluationChange                `json:"changed"`
+}
+
+type VehicleEvaluationRepository interface {
+	WithContext(ctx context.Context) VehicleEvaluationRepository
+	ImportEvaluationVersion(version *metaData.VehicleEvaluationVersion, rows []metaData.VehicleEvaluation) error
+	GetEvaluationVersions() ([]metaData.VehicleEvaluationVersion, error)
+	GetEvaluationVersionByNo(versionNo int) (metaData.VehicleEvaluationVersion, error)
+	GetLatestEvaluationVersion() (metaData.VehicleEvaluationVersion, error)
+	DiffEvaluationVersions(fromNo, toNo int) (*EvaluationDiff, error)
+}
+
+type VehicleEvaluationRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewVehicleEvaluationRepository(db *gorm.DB) VehicleEvaluationRepository {
+	return &VehicleEvaluationRepositoryImpl{db: db}
+}
+
+func (r *VehicleEvaluationRepositoryImpl) WithContext(ctx context.Context) VehicleEvaluationRepository {
+	return NewVehicleEvaluationRepository(r.db.WithContext(ctx))
+}
+
+// evaluationVersionAsOf returns the version in effect on a date. It returns nil without an error
+// when nothing has been versioned yet, so lookups keep working on data loaded before versioning.
+func evaluationVersionAsOf(db *gorm.DB, asOf time.Time) (*metaData.VehicleEvaluationVersion, error) {
+	var count int64
+	if err := db.Model(&metaData.VehicleEvaluationVersion{}).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	var version metaData.VehicleEvaluationVersion
+	result := db.Where("effective_date <= ?", asOf.Format("2006-01-02")).
+		Order("effective_date DESC, version_no DESC").
+		Limit(1).
+		Find(&version)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoEvaluationVersion, asOf.Format("2006-01-02"))
+	}
+	return &version, nil
+}
+
+// evaluationsAsOf scopes a vehicle_evaluations query to the version in effect on a date
+func evaluationsAsOf(db *gorm.DB, asOf time.Time) (*gorm.DB, *metaData.VehicleEvaluationVersion, error) {
+	version, err := evaluationVersionAsOf(db, asOf)
+	if err != nil {
+		return nil, nil, err
+	}
+	query := db.Model(&metaData.VehicleEvaluation{})
+	if version != nil {
+		query = query.Where("version_id = ?", version.ID)
+	}
+	return query, version, nil
+}
+
+// ImportEvaluationVersion stores an upload as the next version. Rows loaded before versioning are
+// first kept as a version of their own so they stay available for older dates.
+func (r *VehicleEvaluationRepositoryImpl) ImportEvaluationVersion(version *metaData.VehicleEvaluationVersion, rows []metaData.VehicleEvaluation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&metaData.VehicleEvaluationVersion{}).
+			Where("checksum = ?", version.Checksum).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrDuplicateEvaluationUpload
+		}
+
+		var lastNo int
+		if err := tx.Model(&metaData.VehicleEvaluationVersion{}).
+			Select("COALESCE(MAX(version_no), 0)").
+			Scan(&lastNo).Error; err != nil {
+			return err
+		}
+
+		if err := adoptUnversionedEvaluations(tx, &lastNo, version.UploadedBy); err != nil {
+			return err
+		}
+
+		version.VersionNo = lastNo + 1
+		version.RowCount = len(rows)
+		if err := tx.Create(version).Error; err != nil {
+			return fmt.Errorf("failed to create version: %w", err)
+		}
+
+		for i := range rows {
+			rows[i].VersionID = &version.ID
+		}
+		if len(rows) > 0 {
+			if err := tx.CreateInBatches(&rows, 500).Error; err != nil {
+				return fmt.Errorf("failed to insert evaluations: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// adoptUnversionedEvaluations groups rows uploaded before versioning into a version effective from
+// the day they were loaded
+func adoptUnversionedEvaluations(tx *gorm.DB, lastNo *int, uploadedBy string) error {
+	var legacy struct {
+		RowCount  int
+		FirstDate *time.Time
+	}
+	if err := tx.Model(&metaData.VehicleEvaluation{}).
+		Select("COUNT(*) AS row_count, MIN(created_at) AS first_date").
+		Where("version_id IS NULL").
+		Scan(&legacy).Error; err != nil {
+		return err
+	}
+	if legacy.RowCount == 0 {
+		return nil
+	}
+
+	effective := time.Now()
+	if legacy.FirstDate != nil {
+		effective = *legacy.FirstDate
+	}
+	*lastNo++
+	version := metaData.VehicleEvaluationVersion{
+		VersionNo:     *lastNo,
+		FileName:      "Uploaded before versioning",
+		EffectiveDate: effective.Format("2006-01-02"),
+		RowCount:      legacy.RowCount,
+		UploadedBy:    uploadedBy,
+		CreatedBy:     uploadedBy,
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return fmt.Errorf("failed to version existing evaluations: %w", err)
+	}
+	return tx.Model(&metaData.VehicleEvaluation{}).
+		Where("version_id IS NULL").
+		Update("version_id", version.ID).Error
+}
+
+func (r *VehicleEvaluationRepositoryImpl) GetEvaluationVersions() ([]metaData.VehicleEvaluationVersion, error) {
+	var versions []metaData.VehicleEvaluationVersion
+	err := r.db.Order("version_no DESC").Find(&versions).Error
+	return versions, err
+}
+
+func (r *VehicleEvaluationRepositoryImpl) GetEvaluationVersionByNo(versionNo int) (metaData.VehicleEvaluationVersion, error) {
+	var version metaData.VehicleEvaluationVersion
+	err := r.db.First(&version, "version_no = ?", versionNo).Error
+	return version, err
+}
+
+func (r *VehicleEvaluationRepositoryImpl) GetLatestEvaluationVersion() (metaData.VehicleEvaluationVersion, error) {
+	var version metaData.VehicleEvaluationVersion
+	err := r.db.Order("version_no DESC").First(&version).Error
+	return version, err
+}
+
+func evaluationKey(e *metaData.VehicleEvaluation) string {
+	return strings.ToUpper(strings.TrimSpace(e.HSCCode)) + "|" +
+		strings.ToUpper(strings.TrimSpace(e.Description)) + "|" +
+		strings.ToUpper(strings.TrimSpace(e.CC))
+}
+
+// DiffEvaluationVersions compares two versions row by row
+func (r *VehicleEvaluationRepositoryImpl) DiffEvaluationVersions(fromNo, toNo int) (*EvaluationDiff, error) {
+	from, err := r.GetEvaluationVersionByNo(fromNo)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.GetEvaluationVersionByNo(toNo)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldRows, newRows []metaData.VehicleEvaluation
+	if err := r.db.Where("version_id = ?", from.ID).Order("id ASC").Find(&oldRows).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Where("version_id = ?", to.ID).Order("id ASC").Find(&newRows).Error; err != nil {
+		return nil, err
+	}
+
+	diff := &EvaluationDiff{
+		From:    from,
+		To:      to,
+		Added:   []metaData.VehicleEvaluation{},
+		Removed: []metaData.VehicleEvaluation{},
+		Changed: []EvaluationChange{},
+	}
+
+	oldByKey := make(map[string]*metaData.VehicleEvaluation, len(oldRows))
+	for i := range oldRows {
+		oldByKey[evaluationKey(&oldRows[i])] = &oldRows[i]
+	}
+	seen := make(map[string]bool, len(newRows))
+	for i := range newRows {
+		row := &newRows[i]
+		key := evaluationKey(row)
+		seen[key] = true
+
+		old, ok := oldByKey[key]
+		if !ok {
+			diff.Added = append(diff.Added, *row)
+			continue
+		}
+		oldCIF, newCIF := old.CIF, row.CIF
+		if !oldCIF.Equal(newCIF) {
+			diff.Changed = append(diff.Changed, EvaluationChange{
+				HSCCode:     row.HSCCode,
+				Description: row.Description,
+				CC:          row.CC,
+				COO:         row.COO,
+				OldCIF:      oldCIF,
+				NewCIF:      newCIF,
+				Difference:  newCIF.Sub(oldCIF),
+			})
+		}
+	}
+	for i := range oldRows {
+		if !seen[evaluationKey(&oldRows[i])] {
+			diff.Removed = append(diff.Removed, oldRows[i])
+		}
+	}
+
+	// Biggest movements first
+	sort.SliceStable(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Difference.Abs().GreaterThan(diff.Changed[j].Difference.Abs())
+	})
+	return diff, nil
+}
@@ -0,0 +1,296 @@
+package routes
+
+import (
+	"car-bond/internals/middleware"
+	"car-bond/internals/models/userRegistration"
+	"strings"
+)
+
+// Resources the routes are checked against. Those of the resource.* family are granted to the seeded
+// resource.admin (RWXD), resource.write (RWX) and resource.read (R) roles when first registered, and
+// likewise for users.*; adminOnly resources only to the admin role.
+var routeResources = []struct {
+	Code      string
+	Name      string
+	AdminOnly bool
+}{
+	{"resource.car", "Cars", false},
+	{"resource.car.expense", "Car expenses", false},
+	{"resource.car.file", "Car files and photos", false},
+	{"resource.shipping", "Shipping invoices, containers and tracking", false},
+	{"resource.company", "Companies", false},
+	{"resource.company.expense", "Company expenses", false},
+	{"resource.company.location", "Company locations", false},
+	{"resource.customer", "Customers", false},
+	{"resource.customer.contact", "Customer contacts", false},
+	{"resource.customer.address", "Customer addresses", false},
+	{"resource.sale", "Sales and installments", false},
+	{"resource.sale.invoice", "Sale payments", false},
+	{"resource.sale.payment", "Sale payment modes", false},
+	{"resource.sale.deposit", "Sale payment deposits", false},
+	{"resource.auction", "Auction sales", false},
+	{"resource.alert", "Alerts", false},
+	{"resource.notification", "Payment reminders", false},
+	{"resource.meta", "Meta data, exchange and duty rates", false},
+	{"resource.audit", "Audit trail", true},
+	{"resource.recycle-bin", "Recycle bin", true},
+	{"users.user", "Users", false},
+	{"users.my", "Own profile", false},
+	{"users.rbac", "Groups, roles, resources and permissions", true},
+}
+
+// routePermissions says what every route needs. Perm is left out when the HTTP method says it
+// (GET R, POST/PUT/PATCH W, DELETE D); X marks actions that run a process rather than edit a record.
+var routePermissions = []middleware.RoutePermission{
+	// Auth
+	{Method: "POST", Path: "/api/auth/login", Public: true},
+	{Method: "POST", Path: "/api/auth/login_", Public: true},
+	{Method: "POST", Path: "/api/auth/refresh", Public: true}, // the refresh token is the credential
+	{Method: "POST", Path: "/api/auth/logout", Authenticated: true},
+	{Method: "POST", Path: "/api/auth/revoke-all", Authenticated: true},
+	{Method: "POST", Path: "/api/auth/password/forgot", Public: true},
+	{Method: "POST", Path: "/api/auth/password/reset", Public: true}, // the reset token is the credential
+
+	// Groups, roles, resources and permissions
+	{Method: "GET", Path: "/api/groups", Resource: "users.rbac"},
+	{Method: "POST", Path: "/api/group/", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/group/:code", Resource: "users.rbac"},
+	{Method: "PUT", Path: "/api/group/:code", Resource: "users.rbac"},
+	{Method: "DELETE", Path: "/api/group/:code", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/roles", Resource: "users.rbac"},
+	{Method: "POST", Path: "/role/", Resource: "users.rbac"},
+	{Method: "GET", Path: "/role/:code", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/resources", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/resources/:code", Resource: "users.rbac"},
+	{Method: "POST", Path: "/api/resourse/", Resource: "users.rbac"},
+	{Method: "POST", Path: "/api/permissions", Resource: "users.rbac"},
+	{Method: "POST", Path: "/api/wildcard-permissions", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/permissions", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/check-permissions", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/permissions/explain", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/explict-permissions", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/wildcard-permissions", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/exist-permissions", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/group-role-exist", Resource: "users.rbac"},
+	{Method: "GET", Path: "/api/roles-resource-permisions", Resource: "users.rbac"},
+
+	// Car
+	{Method: "GET", Path: "/api/cars", Resource: "resource.car"},
+	{Method: "POST", Path: "/api/cars/import", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/cars/search", Resource: "resource.car"},
+	{Method: "POST", Path: "/api/car/all-details", Resource: "resource.car"},
+	{Method: "PUT", Path: "/api/car/all-details/:id", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/id/:id", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/vin/:ChasisNumber", Resource: "resource.car"},
+	{Method: "PUT", Path: "/api/car/:id/sale", Resource: "resource.car"},
+	{Method: "PUT", Path: "/api/car/:id/status", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/:id/status-history", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/status-transitions", Resource: "resource.car"},
+	{Method: "PUT", Path: "/api/car/:id/shipping-invoice", Resource: "resource.car"},
+	{Method: "DELETE", Path: "/api/car/:id", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/dash", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/dash/:companyId", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/:id/totals", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/:id/profitability", Resource: "resource.car"},
+	{Method: "GET", Path: "/api/car/:id/duty-estimate", Resource: "resource.car"},
+	// Car expense
+	{Method: "GET", Path: "/api/carExpenses", Resource: "resource.car.expense"},
+	{Method: "GET", Path: "/api/car/:carId/expenses", Resource: "resource.car.expense"},
+	{Method: "GET", Path: "/api/car/:carId/expense/:id", Resource: "resource.car.expense"},
+	{Method: "POST", Path: "/api/car/expense", Resource: "resource.car.expense"},
+	{Method: "PUT", Path: "/api/car/expense/:id", Resource: "resource.car.expense"},
+	{Method: "DELETE", Path: "/api/car/:carId/expense/:id", Resource: "resource.car.expense"},
+	{Method: "GET", Path: "/api/total-car-expense/:id", Resource: "resource.car.expense"},
+	// Car files
+	{Method: "GET", Path: "/api/car/uploads", Resource: "resource.car.file"},
+	{Method: "POST", Path: "/api/car/upload", Resource: "resource.car.file"},
+	{Method: "GET", Path: "/api/car/:id/files", Resource: "resource.car.file"},
+	{Method: "GET", Path: "/api/car/files/:file_id", Resource: "resource.car.file"},
+
+	// Shipping
+	{Method: "GET", Path: "/api/shipping/invoices", Resource: "resource.shipping"},
+	{Method: "POST", Path: "/api/shipping/invoices", Resource: "resource.shipping"},
+	{Method: "GET", Path: "/api/shipping/invoice/:id", Resource: "resource.shipping"},
+	{Method: "GET", Path: "/api/shipping/invoice/no/:no", Resource: "resource.shipping"},
+	{Method: "PUT", Path: "/api/shipping/invoice/:id", Resource: "resource.shipping"},
+	{Method: "DELETE", Path: "/api/shipping/invoice/:id", Resource: "resource.shipping"},
+	{Method: "PATCH", Path: "/api/shipping/invoice/:id/lock", Resource: "resource.shipping", Perm: "X"},
+	{Method: "POST", Path: "/api/shipping/invoice/:id/allocate", Resource: "resource.shipping", Perm: "X"},
+	{Method: "GET", Path: "/api/shipping/invoice/:id/manifest", Resource: "resource.shipping"},
+	{Method: "POST", Path: "/api/shipping/invoice/:id/containers", Resource: "resource.shipping"},
+	{Method: "PUT", Path: "/api/shipping/container/:id", Resource: "resource.shipping"},
+	{Method: "PUT", Path: "/api/shipping/container/:id/cars", Resource: "resource.shipping"},
+	{Method: "DELETE", Path: "/api/shipping/container/:id", Resource: "resource.shipping"},
+	{Method: "POST", Path: "/api/shipping/invoice/:id/milestones", Resource: "resource.shipping"},
+	{Method: "GET", Path: "/api/shipping/invoice/:id/tracking", Resource: "resource.shipping"},
+
+	// Company
+	{Method: "GET", Path: "/api/companies", Resource: "resource.company"},
+	{Method: "GET", Path: "/api/company/:id", Resource: "resource.company"},
+	{Method: "POST", Path: "/api/company/", Resource: "resource.company"},
+	{Method: "PATCH", Path: "/api/company/:id", Resource: "resource.company"},
+	{Method: "DELETE", Path: "/api/company/:id", Resource: "resource.company"},
+	{Method: "GET", Path: "/api/company/:companyId/profitability", Resource: "resource.company"},
+	// Company expense
+	{Method: "GET", Path: "/api/expenses", Resource: "resource.company.expense"},
+	{Method: "GET", Path: "/api/company/expenses/:companyId", Resource: "resource.company.expense"},
+	{Method: "GET", Path: "/api/company/:companyId/expense/:id", Resource: "resource.company.expense"},
+	{Method: "POST", Path: "/api/company/expense", Resource: "resource.company.expense"},
+	{Method: "PUT", Path: "/api/company/expense/:id", Resource: "resource.company.expense"},
+	{Method: "DELETE", Path: "/api/company/expense/:id", Resource: "resource.company.expense"},
+	// Company location
+	{Method: "GET", Path: "/api/company/locations/:companyId", Resource: "resource.company.location"},
+	{Method: "GET", Path: "/api/company/:companyId/location/:id", Resource: "resource.company.location"},
+	{Method: "POST", Path: "/api/company/location", Resource: "resource.company.location"},
+	{Method: "PUT", Path: "/api/company/location/:id", Resource: "resource.company.location"},
+	{Method: "DELETE", Path: "/api/company/location/:id", Resource: "resource.company.location"},
+
+	// Customer
+	{Method: "GET", Path: "/api/customers", Resource: "resource.customer"},
+	{Method: "GET", Path: "/api/customers/search", Resource: "resource.customer"},
+	{Method: "GET", Path: "/api/customer/:id", Resource: "resource.customer"},
+	{Method: "POST", Path: "/api/customer/", Resource: "resource.customer"},
+	{Method: "PUT", Path: "/api/customer/:id", Resource: "resource.customer"},
+	{Method: "DELETE", Path: "/api/customer/:id", Resource: "resource.customer"},
+	{Method: "GET", Path: "/api/customer/:id/upload", Resource: "resource.customer"},
+	// Customer contact
+	{Method: "GET", Path: "/api/:companyId/contacts", Resource: "resource.customer.contact"},
+	{Method: "GET", Path: "/api/customer/contacts/:customerId", Resource: "resource.customer.contact"},
+	{Method: "GET", Path: "/api/customer/:customerId/contact/:id", Resource: "resource.customer.contact"},
+	{Method: "POST", Path: "/api/customer/contact", Resource: "resource.customer.contact"},
+	{Method: "PUT", Path: "/api/customer/contact/:id", Resource: "resource.customer.contact"},
+	{Method: "DELETE", Path: "/api/customer/:customerId/contact/:id", Resource: "resource.customer.contact"},
+	// Customer address
+	{Method: "GET", Path: "/api/:companyId/addresses", Resource: "resource.customer.address"},
+	{Method: "GET", Path: "/api/customer/addresses/:customerId", Resource: "resource.customer.address"},
+	{Method: "GET", Path: "/api/customer/:customerId/address/:id", Resource: "resource.customer.address"},
+	{Method: "POST", Path: "/api/customer/address", Resource: "resource.customer.address"},
+	{Method: "PUT", Path: "/api/customer/address/:id", Resource: "resource.customer.address"},
+	{Method: "DELETE", Path: "/api/customer/:customerId/address/:id", Resource: "resource.customer.address"},
+
+	// User
+	{Method: "GET", Path: "/api/users", Resource: "users.user"},
+	{Method: "GET", Path: "/api/users/:companyId", Resource: "users.user"},
+	{Method: "GET", Path: "/api/user/profile", Resource: "users.my"},
+	{Method: "PUT", Path: "/api/user/me/password", Authenticated: true}, // also open to users who must change it
+	{Method: "GET", Path: "/api/user/:id", Resource: "users.user"},
+	{Method: "POST", Path: "/api/user/", Resource: "users.user"},
+	{Method: "PATCH", Path: "/api/user/:id", Resource: "users.user"},
+	{Method: "DELETE", Path: "/api/user/:id", Resource: "users.user"},
+	{Method: "POST", Path: "/api/user/:id/revoke-sessions", Resource: "users.user", Perm: "X"},
+	{Method: "POST", Path: "/api/user/:id/password-reset", Resource: "users.user", Perm: "X"},
+
+	// Sale
+	{Method: "GET", Path: "/api/sales", Resource: "resource.sale"},
+	{Method: "GET", Path: "/api/sales/aging", Resource: "resource.sale"},
+	{Method: "GET", Path: "/api/sale/:id", Resource: "resource.sale"},
+	{Method: "POST", Path: "/api/sale/", Resource: "resource.sale"},
+	{Method: "PUT", Path: "/api/sale/:id", Resource: "resource.sale"},
+	{Method: "DELETE", Path: "/api/sale/:id", Resource: "resource.sale"},
+	{Method: "GET", Path: "/api/sale/statement/:customerId", Resource: "resource.sale"},
+	{Method: "POST", Path: "/api/sale/all-details", Resource: "resource.sale"},
+	{Method: "PUT", Path: "/api/sale/:id/all-details", Resource: "resource.sale"},
+	{Method: "GET", Path: "/api/sale/:id/installments", Resource: "resource.sale"},
+	{Method: "POST", Path: "/api/sale/:id/installments/rebuild", Resource: "resource.sale", Perm: "X"},
+	{Method: "GET", Path: "/api/sale/:id/totals", Resource: "resource.sale"},
+	// Sale payment (invoice)
+	{Method: "GET", Path: "/api/invoices", Resource: "resource.sale.invoice"},
+	{Method: "GET", Path: "/api/invoice/:saleId/:id", Resource: "resource.sale.invoice"},
+	{Method: "POST", Path: "/api/invoice/", Resource: "resource.sale.invoice"},
+	{Method: "PUT", Path: "/api/invoice/:id", Resource: "resource.sale.invoice"},
+	{Method: "DELETE", Path: "/api/invoice/:id", Resource: "resource.sale.invoice"},
+	// Sale payment mode
+	{Method: "GET", Path: "/api/payments", Resource: "resource.sale.payment"},
+	{Method: "GET", Path: "/api/payment/:salePaymentId/:id", Resource: "resource.sale.payment"},
+	{Method: "POST", Path: "/api/payment/", Resource: "resource.sale.payment"},
+	{Method: "GET", Path: "/api/payment/:mode", Resource: "resource.sale.payment"},
+	{Method: "DELETE", Path: "/api/payment/:id", Resource: "resource.sale.payment"},
+	{Method: "PUT", Path: "/api/payment/:id", Resource: "resource.sale.payment"},
+	// Sale payment deposit
+	{Method: "GET", Path: "/api/deposits", Resource: "resource.sale.deposit"},
+	{Method: "GET", Path: "/api/deposit/:salePaymentId/:id", Resource: "resource.sale.deposit"},
+	{Method: "POST", Path: "/api/deposit/", Resource: "resource.sale.deposit"},
+	{Method: "GET", Path: "/api/deposit/:name", Resource: "resource.sale.deposit"},
+	{Method: "DELETE", Path: "/api/deposit/:id", Resource: "resource.sale.deposit"},
+	{Method: "PUT", Path: "/api/deposit/:id", Resource: "resource.sale.deposit"},
+
+	// Auction sale
+	{Method: "GET", Path: "/api/auction-sales", Resource: "resource.auction"},
+	{Method: "GET", Path: "/api/auction-sale/:id", Resource: "resource.auction"},
+	{Method: "POST", Path: "/api/auction-sale/", Resource: "resource.auction"},
+	{Method: "PUT", Path: "/api/auction-sale/:id", Resource: "resource.auction"},
+	{Method: "DELETE", Path: "/api/auction-sale/:id", Resource: "resource.auction"},
+
+	// Alerts, audit trail, recycle bin and reminders
+	{Method: "GET", Path: "/api/alerts/search", Resource: "resource.alert"},
+	{Method: "PUT", Path: "/api/alert/:id", Resource: "resource.alert"},
+	{Method: "GET", Path: "/api/audit", Resource: "resource.audit"},
+	{Method: "GET", Path: "/api/recycle-bin/", Resource: "resource.recycle-bin"},
+	{Method: "GET", Path: "/api/recycle-bin/:entity", Resource: "resource.recycle-bin"},
+	{Method: "POST", Path: "/api/recycle-bin/:entity/:id/restore", Resource: "resource.recycle-bin"},
+	{Method: "DELETE", Path: "/api/recycle-bin/purge", Resource: "resource.recycle-bin"},
+	{Method: "GET", Path: "/api/notifications/logs", Resource: "resource.notification"},
+	{Method: "POST", Path: "/api/notifications/run", Resource: "resource.notification", Perm: "X"},
+
+	// Meta data
+	{Method: "POST", Path: "/api/meta/vehicle-evaluation", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/vehicle-evaluation", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/vehicle-evaluation/versions", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/vehicle-evaluation/versions/diff", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/weights", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/lengths", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/currency", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/expenses", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/ports", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/payment-modes", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/exchange-rates", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/exchange-rates/convert", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/exchange-rates/:id", Resource: "resource.meta"},
+	{Method: "POST", Path: "/api/meta/exchange-rates", Resource: "resource.meta"},
+	{Method: "PUT", Path: "/api/meta/exchange-rates/:id", Resource: "resource.meta"},
+	{Method: "DELETE", Path: "/api/meta/exchange-rates/:id", Resource: "resource.meta"},
+	{Method: "GET", Path: "/api/meta/duty-rates", Resource: "resource.meta"},
+	{Method: "POST", Path: "/api/meta/duty-rates", Resource: "resource.meta"},
+	{Method: "PUT", Path: "/api/meta/duty-rates/:id", Resource: "resource.meta"},
+	{Method: "DELETE", Path: "/api/meta/duty-rates/:id", Resource: "resource.meta"},
+	{Method: "POST", Path: "/api/meta/duty-estimate", Resource: "resource.meta", Perm: "R"}, // computes, stores nothing
+}
+
+// defaultGrants are the permissions the seeded roles get on the route resources
+func defaultGrants() ([]userRegistration.Resource, []userRegistration.RoleResourcePermission) {
+	full := userRegistration.RWXD{R: true, W: true, X: true, D: true}
+	levels := []struct {
+		suffix    string
+		allow     userRegistration.RWXD
+		adminOnly bool
+	}{
+		{"admin", full, true},
+		{"write", userRegistration.RWXD{R: true, W: true, X: true}, false},
+		{"read", userRegistration.RWXD{R: true}, false},
+	}
+
+	var resources []userRegistration.Resource
+	var grants []userRegistration.RoleResourcePermission
+	for _, resource := range routeResources {
+		resources = append(resources, userRegistration.Resource{
+			Code:        resource.Code,
+			Name:        resource.Name,
+			Description: resource.Name,
+			Internal:    resource.AdminOnly,
+			CreatedBy:   "Seeder",
+		})
+		family := resource.Code[:strings.Index(resource.Code, ".")]
+		for _, level := range levels {
+			if resource.AdminOnly && !level.adminOnly {
+				continue
+			}
+			grants = append(grants, userRegistration.RoleResourcePermission{
+				RoleCode:     family + "." + level.suffix,
+				ResourceCode: resource.Code,
+				Permissions:  userRegistration.Permissions{Allow: level.allow},
+				CreatedBy:    "Seeder",
+			})
+		}
+	}
+	return resources, grants
+}
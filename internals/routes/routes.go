@@ -3,14 +3,17 @@ package routes
 import (
 	"car-bond/internals/controllers"
 	"car-bond/internals/middleware"
+	"car-bond/internals/notifier"
 	"car-bond/internals/repository"
+	"car-bond/internals/scheduler"
+	"log"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 // SetupRoutes initializes all routes with their respective controllers
-func SetupRoute(app *fiber.App, db *gorm.DB) {
+func SetupRoute(app *fiber.App, db *gorm.DB, reminders *scheduler.PaymentReminders) {
 
 	// Initialize the dbService and other controllers
 	dbService := repository.NewDatabaseService(db)
@@ -19,41 +22,52 @@ func SetupRoute(app *fiber.App, db *gorm.DB) {
 	resourceController := controllers.NewResourceController(dbService)
 	permissionController := controllers.NewPermissionController(dbService)
 
-	// pdbService := middleware.NewDatabaseService(db)
+	// Every route checks the roles of its token against routePermissions
+	pdbService := middleware.NewDatabaseService(db)
+	permissions, err := middleware.NewPermissionTable(routePermissions)
+	if err != nil {
+		log.Fatalf("Invalid route permissions: %v", err)
+	}
+	authorize := middleware.Authorize(pdbService, permissions)
+	// Protected refuses tokens revoked by logout or by revoking a user's sessions
+	middleware.UseRevocations(repository.NewTokenRepository(db))
 
 	api := app.Group("/api")
+	api.Use(middleware.Export()) // ?export=xlsx|csv on list endpoints
 	// Define routes
-	api.Get("/groups", groupController.GetAllGroups)
+	api.Get("/groups", middleware.Protected(), authorize, groupController.GetAllGroups)
 	groupRoutes := api.Group("/group")
-	groupRoutes.Post("/", groupController.CreateGroup)
-	groupRoutes.Get("/:code", groupController.GetGroup)
-	groupRoutes.Put("/:code", groupController.UpdateGroup)
-	groupRoutes.Delete("/:code", groupController.DeleteGroup)
+	groupRoutes.Post("/", middleware.Protected(), authorize, groupController.CreateGroup)
+	groupRoutes.Get("/:code", middleware.Protected(), authorize, groupController.GetGroup)
+	groupRoutes.Put("/:code", middleware.Protected(), authorize, groupController.UpdateGroup)
+	groupRoutes.Delete("/:code", middleware.Protected(), authorize, groupController.DeleteGroup)
 
-	api.Get("/roles", roleController.GetAllRoles)
+	api.Get("/roles", middleware.Protected(), authorize, roleController.GetAllRoles)
 	roleRoutes := app.Group("/role")
-	roleRoutes.Post("/", roleController.CreateRole)
-	roleRoutes.Get("/:code", roleController.GetRole)
-	api.Get("/roles", roleController.GetRolesForGroups) //roles?group_codes=group1,group2,group3
+	roleRoutes.Post("/", middleware.Protected(), authorize, roleController.CreateRole)
+	roleRoutes.Get("/:code", middleware.Protected(), authorize, roleController.GetRole)
+	api.Get("/roles", middleware.Protected(), authorize, roleController.GetRolesForGroups) //roles?group_codes=group1,group2,group3
 
-	api.Get("/resources", resourceController.GetAllResources)
-	api.Get("/resources/:code", resourceController.GetResource)
+	api.Get("/resources", middleware.Protected(), authorize, resourceController.GetAllResources)
+	api.Get("/resources/:code", middleware.Protected(), authorize, resourceController.GetResource)
 	resourceRoutes := api.Group("/resourse")
-	resourceRoutes.Post("/", resourceController.CreateResource)
-
-	api.Post("/permissions", permissionController.CreatePermission)
-	api.Post("/wildcard-permissions", permissionController.CreateWildCardPermission)
-	api.Get("/permissions", permissionController.GetGrantedPermissions)
-	api.Get("/check-permissions", permissionController.CheckPermissions)
-	api.Get("/explict-permissions", permissionController.GetExplicitPermissions)
-	api.Get("/wildcard-permissions", permissionController.GetWildCardPermissions)
-	api.Get("/exist-permissions", permissionController.ResourceExplicitPermissionsExists)
-	api.Get("/group-role-exist", permissionController.GroupsWithRoleExists)
-	api.Get("/roles-resource-permisions", permissionController.GetPermissions)
+	resourceRoutes.Post("/", middleware.Protected(), authorize, resourceController.CreateResource)
+
+	api.Post("/permissions", middleware.Protected(), authorize, permissionController.CreatePermission)
+	api.Post("/wildcard-permissions", middleware.Protected(), authorize, permissionController.CreateWildCardPermission)
+	api.Get("/permissions", middleware.Protected(), authorize, permissionController.GetGrantedPermissions)
+	api.Get("/check-permissions", middleware.Protected(), authorize, permissionController.CheckPermissions)
+	api.Get("/permissions/explain", middleware.Protected(), authorize, permissionController.ExplainPermissions)
+	api.Get("/explict-permissions", middleware.Protected(), authorize, permissionController.GetExplicitPermissions)
+	api.Get("/wildcard-permissions", middleware.Protected(), authorize, permissionController.GetWildCardPermissions)
+	api.Get("/exist-permissions", middleware.Protected(), authorize, permissionController.ResourceExplicitPermissionsExists)
+	api.Get("/group-role-exist", middleware.Protected(), authorize, permissionController.GroupsWithRoleExists)
+	api.Get("/roles-resource-permisions", middleware.Protected(), authorize, permissionController.GetPermissions)
 
 	carDbService := repository.NewCarRepository(db)
 	saleDbService := repository.NewSaleRepository(db)
-	carController := controllers.NewCarController(carDbService, saleDbService)
+	exchangeRateDbService := repository.NewExchangeRateRepository(db)
+	carController := controllers.NewCarController(carDbService, saleDbService, exchangeRateDbService)
 	// Create a group for authentication routes
 	authGroup := api.Group("/auth")
 
@@ -64,38 +78,59 @@ func SetupRoute(app *fiber.App, db *gorm.DB) {
 	authGroup.Post("/login_", func(c *fiber.Ctx) error {
 		return controllers.Login_(c, db)
 	})
+	authGroup.Post("/refresh", func(c *fiber.Ctx) error {
+		return controllers.Refresh(c, db)
+	})
+	authGroup.Post("/logout", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
+		return controllers.Logout(c, db)
+	})
+	authGroup.Post("/revoke-all", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
+		return controllers.RevokeMySessions(c, db)
+	})
+
+	// Password resets are emailed by the sender MAIL_SENDER configures
+	mailer := notifier.NewMailerFromConfig()
+	authGroup.Post("/password/forgot", func(c *fiber.Ctx) error {
+		return controllers.ForgotPassword(c, db, mailer)
+	})
+	authGroup.Post("/password/reset", func(c *fiber.Ctx) error {
+		return controllers.ResetPassword(c, db)
+	})
 
 	// Car
-	api.Get("/cars", middleware.Protected(), carController.GetAllCars) //middleware.PermissionMiddleware(pdbService, "resource.*", []string{"R", "W"}), middleware.RequireGroupMembership("admin"),
+	api.Get("/cars", middleware.Protected(), authorize, carController.GetAllCars)
+	api.Post("/cars/import", middleware.Protected(), authorize, carController.ImportCars)
 	car := api.Group("/car")
-	car.Post("/all-details", middleware.Protected(), carController.CreateCarWithDetails)
-	car.Put("/all-details/:id", middleware.Protected(), carController.UpdateCarWithDetails)
-	car.Get("/id/:id", middleware.Protected(), carController.GetSingleCar)
-	car.Get("/vin/:ChasisNumber", middleware.Protected(), carController.GetSingleCarByChasisNumber)
-	car.Put("/:id/sale", middleware.Protected(), carController.UpdateCar2)
-	car.Put("/:id/status", middleware.Protected(), carController.UpdateCarStatus)
-	car.Put("/:id/shipping-invoice", middleware.Protected(), carController.UpdateCar3)
-	car.Delete("/:id", middleware.Protected(), carController.DeleteCarByID)
+	car.Post("/all-details", middleware.Protected(), authorize, carController.CreateCarWithDetails)
+	car.Put("/all-details/:id", middleware.Protected(), authorize, carController.UpdateCarWithDetails)
+	car.Get("/id/:id", middleware.Protected(), authorize, carController.GetSingleCar)
+	car.Get("/vin/:ChasisNumber", middleware.Protected(), authorize, carController.GetSingleCarByChasisNumber)
+	car.Put("/:id/sale", middleware.Protected(), authorize, carController.UpdateCar2)
+	car.Put("/:id/status", middleware.Protected(), authorize, carController.UpdateCarStatus)
+	car.Get("/:id/status-history", middleware.Protected(), authorize, carController.GetCarStatusHistory)
+	car.Get("/status-transitions", middleware.Protected(), authorize, carController.GetCarStatusTransitions)
+	car.Put("/:id/shipping-invoice", middleware.Protected(), authorize, carController.UpdateCar3)
+	car.Delete("/:id", middleware.Protected(), authorize, carController.DeleteCarByID)
 	// Car expense
-	api.Get("/carExpenses", middleware.Protected(), carController.GetAllCarExpenses)
-	car.Get("/:carId/expenses", carController.GetCarExpensesByCarId)
-	car.Get("/:carId/expense/:id", carController.GetCarExpenseById)
-	car.Post("/expense", middleware.Protected(), carController.CreateCarExpense)
-	car.Put("/expense/:id", middleware.Protected(), carController.UpdateCarExpense)
-	car.Delete("/:carId/expense/:id", middleware.Protected(), carController.DeleteCarExpenseById)
-	api.Get("/total-car-expense/:id", middleware.Protected(), carController.GetTotalCarExpenses)
-	api.Get("/cars/search", middleware.Protected(), carController.SearchCars)
-	car.Get("uploads", middleware.Protected(), carController.FetchCarUploads)
-	car.Get("dash", middleware.Protected(), carController.GetDashboardData)
-	car.Get("dash/:companyId", middleware.Protected(), carController.GetCompanyDashboardData)
-
-	car.Post("/upload", middleware.Protected(), func(c *fiber.Ctx) error {
+	api.Get("/carExpenses", middleware.Protected(), authorize, carController.GetAllCarExpenses)
+	car.Get("/:carId/expenses", middleware.Protected(), authorize, carController.GetCarExpensesByCarId)
+	car.Get("/:carId/expense/:id", middleware.Protected(), authorize, carController.GetCarExpenseById)
+	car.Post("/expense", middleware.Protected(), authorize, carController.CreateCarExpense)
+	car.Put("/expense/:id", middleware.Protected(), authorize, carController.UpdateCarExpense)
+	car.Delete("/:carId/expense/:id", middleware.Protected(), authorize, carController.DeleteCarExpenseById)
+	api.Get("/total-car-expense/:id", middleware.Protected(), authorize, carController.GetTotalCarExpenses)
+	api.Get("/cars/search", middleware.Protected(), authorize, carController.SearchCars)
+	car.Get("uploads", middleware.Protected(), authorize, carController.FetchCarUploads)
+	car.Get("dash", middleware.Protected(), authorize, carController.GetDashboardData)
+	car.Get("dash/:companyId", middleware.Protected(), authorize, carController.GetCompanyDashboardData)
+
+	car.Post("/upload", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
 		return controllers.UploadCarFile(c, db)
 	})
-	car.Get("/:id/files", middleware.Protected(), func(c *fiber.Ctx) error {
+	car.Get("/:id/files", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
 		return controllers.GetCarFiles(c, db)
 	})
-	car.Get("/files/:file_id", middleware.Protected(), func(c *fiber.Ctx) error {
+	car.Get("/files/:file_id", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
 		return controllers.GetFile(c, db)
 	})
 
@@ -103,154 +138,232 @@ func SetupRoute(app *fiber.App, db *gorm.DB) {
 	shippingController := controllers.NewShippingController(shippingDbService, db)
 
 	shipping := api.Group("/shipping")
-	shipping.Get("/invoices", shippingController.GetAllShippingInvoices) // /shipping/invoices?exclude_locked=true
-	shipping.Post("/invoices", middleware.Protected(), shippingController.CreateShippingInvoice)
-	shipping.Get("/invoice/:id", middleware.Protected(), shippingController.GetSingleInvoice)
-	shipping.Get("/invoice/no/:no", middleware.Protected(), shippingController.GetShippingInvoiceByInvoiceNum)
-	shipping.Put("/invoice/:id", middleware.Protected(), shippingController.UpdateShippingInvoice)
-	shipping.Delete("/invoice/:id", middleware.Protected(), shippingController.DeleteShippingInvoiceByID)
-	shipping.Patch("/invoice/:id/lock", middleware.Protected(), shippingController.LockInvoice)
+	shipping.Get("/invoices", middleware.Protected(), authorize, shippingController.GetAllShippingInvoices) // /shipping/invoices?exclude_locked=true
+	shipping.Post("/invoices", middleware.Protected(), authorize, shippingController.CreateShippingInvoice)
+	shipping.Get("/invoice/:id", middleware.Protected(), authorize, shippingController.GetSingleInvoice)
+	shipping.Get("/invoice/no/:no", middleware.Protected(), authorize, shippingController.GetShippingInvoiceByInvoiceNum)
+	shipping.Put("/invoice/:id", middleware.Protected(), authorize, shippingController.UpdateShippingInvoice)
+	shipping.Delete("/invoice/:id", middleware.Protected(), authorize, shippingController.DeleteShippingInvoiceByID)
+	shipping.Patch("/invoice/:id/lock", middleware.Protected(), authorize, shippingController.LockInvoice)
+	shipping.Post("/invoice/:id/allocate", middleware.Protected(), authorize, shippingController.AllocateShippingCosts)
+	shipping.Get("/invoice/:id/manifest", middleware.Protected(), authorize, shippingController.GetShippingManifest) // ?format=pdf|xlsx
+	shipping.Post("/invoice/:id/containers", middleware.Protected(), authorize, shippingController.CreateContainer)
+	shipping.Put("/container/:id", middleware.Protected(), authorize, shippingController.UpdateContainer)
+	shipping.Put("/container/:id/cars", middleware.Protected(), authorize, shippingController.AssignContainerCars)
+	shipping.Delete("/container/:id", middleware.Protected(), authorize, shippingController.DeleteContainer)
+	shipping.Post("/invoice/:id/milestones", middleware.Protected(), authorize, shippingController.RecordMilestone)
+	shipping.Get("/invoice/:id/tracking", middleware.Protected(), authorize, shippingController.GetShipmentTracking)
 
 	companyDbService := repository.NewCompanyRepository(db)
-	companyController := controllers.NewCompanyController(companyDbService)
+	companyController := controllers.NewCompanyController(companyDbService, exchangeRateDbService)
 
 	// Company
-	api.Get("/companies", middleware.Protected(), companyController.GetAllCompanies)
+	api.Get("/companies", middleware.Protected(), authorize, companyController.GetAllCompanies)
 	company := api.Group("/company")
-	company.Get("/:id", middleware.Protected(), companyController.GetSingleCompany)
-	company.Post("/", middleware.Protected(), companyController.CreateCompany)
-	company.Patch("/:id", middleware.Protected(), companyController.UpdateCompany)
-	company.Delete("/:id", middleware.Protected(), companyController.DeleteCompanyByID)
+	company.Get("/:id", middleware.Protected(), authorize, companyController.GetSingleCompany)
+	company.Post("/", middleware.Protected(), authorize, companyController.CreateCompany)
+	company.Patch("/:id", middleware.Protected(), authorize, companyController.UpdateCompany)
+	company.Delete("/:id", middleware.Protected(), authorize, companyController.DeleteCompanyByID)
 	// Company Expenses
-	api.Get("/expenses", middleware.Protected(), companyController.GetAllExpenses)
-	company.Get("/expenses/:companyId", middleware.Protected(), companyController.GetCompanyExpensesByCompanyId)
-	company.Get("/:companyId/expense/:id", middleware.Protected(), companyController.GetCompanyExpenseById)
-	company.Post("/expense", middleware.Protected(), companyController.CreateCompanyExpense)
-	company.Put("/expense/:id", middleware.Protected(), companyController.UpdateCompanyExpense)
-	company.Delete("/expense/:id", middleware.Protected(), companyController.DeleteCompanyExpenseById)
+	api.Get("/expenses", middleware.Protected(), authorize, companyController.GetAllExpenses)
+	company.Get("/expenses/:companyId", middleware.Protected(), authorize, companyController.GetCompanyExpensesByCompanyId)
+	company.Get("/:companyId/expense/:id", middleware.Protected(), authorize, companyController.GetCompanyExpenseById)
+	company.Post("/expense", middleware.Protected(), authorize, companyController.CreateCompanyExpense)
+	company.Put("/expense/:id", middleware.Protected(), authorize, companyController.UpdateCompanyExpense)
+	company.Delete("/expense/:id", middleware.Protected(), authorize, companyController.DeleteCompanyExpenseById)
 	// Company Locations
-	company.Get("/locations/:companyId", middleware.Protected(), companyController.GetAllCompanyLocations)
-	company.Get("/:companyId/location/:id", middleware.Protected(), companyController.GetLocationByCompanyId)
-	company.Post("/location", middleware.Protected(), companyController.CreateCompanyLocation)
-	company.Put("/location/:id", middleware.Protected(), companyController.UpdateCompanyLocation)
-	company.Delete("/location/:id", middleware.Protected(), companyController.DeleteLocationByID)
+	company.Get("/locations/:companyId", middleware.Protected(), authorize, companyController.GetAllCompanyLocations)
+	company.Get("/:companyId/location/:id", middleware.Protected(), authorize, companyController.GetLocationByCompanyId)
+	company.Post("/location", middleware.Protected(), authorize, companyController.CreateCompanyLocation)
+	company.Put("/location/:id", middleware.Protected(), authorize, companyController.UpdateCompanyLocation)
+	company.Delete("/location/:id", middleware.Protected(), authorize, companyController.DeleteLocationByID)
 
 	customerDbService := repository.NewCustomerRepository(db)
 	customerController := controllers.NewCustomerController(customerDbService)
 
 	// Customer
-	api.Get("/customers", middleware.Protected(), customerController.GetAllCustomers)
+	api.Get("/customers", middleware.Protected(), authorize, customerController.GetAllCustomers)
 	customer := api.Group("/customer")
-	customer.Get("/:id", middleware.Protected(), customerController.GetSingleCustomer)
-	customer.Post("/", middleware.Protected(), customerController.CreateCustomer)
-	customer.Put("/:id", middleware.Protected(), customerController.UpdateCustomer)
-	customer.Delete("/:id", middleware.Protected(), customerController.DeleteCustomerByID)
+	customer.Get("/:id", middleware.Protected(), authorize, customerController.GetSingleCustomer)
+	customer.Post("/", middleware.Protected(), authorize, customerController.CreateCustomer)
+	customer.Put("/:id", middleware.Protected(), authorize, customerController.UpdateCustomer)
+	customer.Delete("/:id", middleware.Protected(), authorize, customerController.DeleteCustomerByID)
 	// Upload
-	customer.Get("/:id/upload", middleware.Protected(), customerController.FetchCustomerUpload)
-	api.Get("/customers/search", middleware.Protected(), customerController.SearchCustomers)
+	customer.Get("/:id/upload", middleware.Protected(), authorize, customerController.FetchCustomerUpload)
+	api.Get("/customers/search", middleware.Protected(), authorize, customerController.SearchCustomers)
 
 	// Customer contact
-	api.Get("/:companyId/contacts", middleware.Protected(), customerController.GetCustomerContactsByCompanyId)
-	customer.Get("/contacts/:customerId", middleware.Protected(), customerController.GetCustomerContactsByCustomerId)
-	customer.Get("/:customerId/contact/:id", middleware.Protected(), customerController.GetCustomerContactById)
-	customer.Post("/contact", middleware.Protected(), customerController.CreateCustomerContact)
-	customer.Put("/contact/:id", middleware.Protected(), customerController.UpdateCustomerContact)
-	customer.Delete("/:customerId/contact/:id", middleware.Protected(), customerController.DeleteCustomerContactById)
+	api.Get("/:companyId/contacts", middleware.Protected(), authorize, customerController.GetCustomerContactsByCompanyId)
+	customer.Get("/contacts/:customerId", middleware.Protected(), authorize, customerController.GetCustomerContactsByCustomerId)
+	customer.Get("/:customerId/contact/:id", middleware.Protected(), authorize, customerController.GetCustomerContactById)
+	customer.Post("/contact", middleware.Protected(), authorize, customerController.CreateCustomerContact)
+	customer.Put("/contact/:id", middleware.Protected(), authorize, customerController.UpdateCustomerContact)
+	customer.Delete("/:customerId/contact/:id", middleware.Protected(), authorize, customerController.DeleteCustomerContactById)
 	// Customer upload
-	customer.Get("/:id/upload", middleware.Protected(), customerController.FetchCustomerUpload)
+	customer.Get("/:id/upload", middleware.Protected(), authorize, customerController.FetchCustomerUpload)
 	// Customer address
-	api.Get("/:companyId/addresses", middleware.Protected(), customerController.GetCustomerAddressesByCompanyId)
-	customer.Get("/addresses/:customerId", middleware.Protected(), customerController.GetCustomerAddressesByCustomerId)
-	customer.Get("/:customerId/address/:id", middleware.Protected(), customerController.GetCustomerAddressById)
-	customer.Post("/address", middleware.Protected(), customerController.CreateCustomerAddress)
-	customer.Put("/address/:id", middleware.Protected(), customerController.UpdateCustomerAddress)
-	customer.Delete("/:customerId/address/:id", middleware.Protected(), customerController.DeleteCustomerAddressById)
+	api.Get("/:companyId/addresses", middleware.Protected(), authorize, customerController.GetCustomerAddressesByCompanyId)
+	customer.Get("/addresses/:customerId", middleware.Protected(), authorize, customerController.GetCustomerAddressesByCustomerId)
+	customer.Get("/:customerId/address/:id", middleware.Protected(), authorize, customerController.GetCustomerAddressById)
+	customer.Post("/address", middleware.Protected(), authorize, customerController.CreateCustomerAddress)
+	customer.Put("/address/:id", middleware.Protected(), authorize, customerController.UpdateCustomerAddress)
+	customer.Delete("/:customerId/address/:id", middleware.Protected(), authorize, customerController.DeleteCustomerAddressById)
 
 	userDbService := repository.NewUserRepository(db)
 	userController := controllers.NewUserController(userDbService)
 
-	api.Get("/users", middleware.Protected(), userController.GetAllUsers)
-	api.Get("/users/:companyId", middleware.Protected(), userController.GetUsersByCompany)
+	api.Get("/users", middleware.Protected(), authorize, userController.GetAllUsers)
+	api.Get("/users/:companyId", middleware.Protected(), authorize, userController.GetUsersByCompany)
 	user := api.Group("/user")
-	user.Get("/profile", middleware.Protected(), func(c *fiber.Ctx) error {
+	user.Get("/profile", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
 		return controllers.Profile(c, db)
 	})
-	user.Get("/:id", middleware.Protected(), userController.GetUserByID)
-	user.Post("/", middleware.Protected(), userController.CreateUser)
-	user.Patch("/:id", middleware.Protected(), userController.UpdateUser)
-	user.Delete("/:id", middleware.Protected(), userController.DeleteUserByID)
+	user.Put("/me/password", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
+		return controllers.ChangeMyPassword(c, db)
+	})
+	user.Get("/:id", middleware.Protected(), authorize, userController.GetUserByID)
+	user.Post("/", middleware.Protected(), authorize, userController.CreateUser)
+	user.Patch("/:id", middleware.Protected(), authorize, userController.UpdateUser)
+	user.Delete("/:id", middleware.Protected(), authorize, userController.DeleteUserByID)
+	user.Post("/:id/revoke-sessions", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
+		return controllers.RevokeUserSessions(c, db)
+	})
+	user.Post("/:id/password-reset", middleware.Protected(), authorize, func(c *fiber.Ctx) error {
+		return controllers.RequestPasswordReset(c, db, mailer)
+	})
 
-	saleController := controllers.NewSaleController(saleDbService, carDbService, db)
+	saleController := controllers.NewSaleController(saleDbService, carDbService, exchangeRateDbService, db)
 
 	// Sale
-	api.Get("/sales", middleware.Protected(), saleController.GetAllCarSales)
+	api.Get("/sales", middleware.Protected(), authorize, saleController.GetAllCarSales)
+	api.Get("/sales/aging", middleware.Protected(), authorize, saleController.GetSalesAging)
 	sale := api.Group("/sale")
-	sale.Get("/:id", middleware.Protected(), saleController.GetCarSale)
-	sale.Post("/", middleware.Protected(), saleController.CreateCarSale)
-	sale.Put("/:id", middleware.Protected(), saleController.UpdateSale)
-	sale.Delete("/:id", middleware.Protected(), saleController.DeleteSaleByID)
-	sale.Get("/statement/:customerId", middleware.Protected(), saleController.GenerateCustomerStatement)
-	sale.Post("/all-details", middleware.Protected(), saleController.CreateSaleWithPayments)
-	sale.Put("/:id/all-details", middleware.Protected(), saleController.UpdateSaleWithPayments)
+	sale.Get("/:id", middleware.Protected(), authorize, saleController.GetCarSale)
+	sale.Post("/", middleware.Protected(), authorize, saleController.CreateCarSale)
+	sale.Put("/:id", middleware.Protected(), authorize, saleController.UpdateSale)
+	sale.Delete("/:id", middleware.Protected(), authorize, saleController.DeleteSaleByID)
+	sale.Get("/statement/:customerId", middleware.Protected(), authorize, saleController.GenerateCustomerStatement)
+	sale.Post("/all-details", middleware.Protected(), authorize, saleController.CreateSaleWithPayments)
+	sale.Put("/:id/all-details", middleware.Protected(), authorize, saleController.UpdateSaleWithPayments)
+	sale.Get("/:id/installments", middleware.Protected(), authorize, saleController.GetSaleInstallments)
+	sale.Post("/:id/installments/rebuild", middleware.Protected(), authorize, saleController.RebuildSaleInstallments)
 
 	// Invoice
-	api.Get("/invoices", middleware.Protected(), saleController.GetSalePayments)
+	api.Get("/invoices", middleware.Protected(), authorize, saleController.GetSalePayments)
 	invoice := api.Group("/invoice")
-	invoice.Get("/:saleId/:id", middleware.Protected(), saleController.FindSalePaymentByIdAndSaleId)
-	invoice.Post("/", middleware.Protected(), saleController.CreateInvoice)
-	invoice.Put("/:id", middleware.Protected(), saleController.UpdateSalePayment)
-	invoice.Delete("/:id", middleware.Protected(), saleController.DeleteSalePaymentByID)
+	invoice.Get("/:saleId/:id", middleware.Protected(), authorize, saleController.FindSalePaymentByIdAndSaleId)
+	invoice.Post("/", middleware.Protected(), authorize, saleController.CreateInvoice)
+	invoice.Put("/:id", middleware.Protected(), authorize, saleController.UpdateSalePayment)
+	invoice.Delete("/:id", middleware.Protected(), authorize, saleController.DeleteSalePaymentByID)
 	// Payment
-	api.Get("/payments", middleware.Protected(), saleController.GetSalePaymentModes)
+	api.Get("/payments", middleware.Protected(), authorize, saleController.GetSalePaymentModes)
 	payment := api.Group("/payment")
-	payment.Get("/:salePaymentId/:id", middleware.Protected(), saleController.FindSalePaymentModeByIdAndSalePaymentId)
-	payment.Post("/", middleware.Protected(), saleController.CreatePaymentMode)
-	payment.Get("/:mode", middleware.Protected(), saleController.GetPaymentModesByMode)
-	payment.Delete("/:id", middleware.Protected(), saleController.DeleteSalePaymentModeByID)
-	payment.Put("/:id", middleware.Protected(), saleController.UpdateSalePaymentMode)
+	payment.Get("/:salePaymentId/:id", middleware.Protected(), authorize, saleController.FindSalePaymentModeByIdAndSalePaymentId)
+	payment.Post("/", middleware.Protected(), authorize, saleController.CreatePaymentMode)
+	payment.Get("/:mode", middleware.Protected(), authorize, saleController.GetPaymentModesByMode)
+	payment.Delete("/:id", middleware.Protected(), authorize, saleController.DeleteSalePaymentModeByID)
+	payment.Put("/:id", middleware.Protected(), authorize, saleController.UpdateSalePaymentMode)
 	// Deposits
-	api.Get("/deposits", middleware.Protected(), saleController.GetSalePaymentDeposits)
+	api.Get("/deposits", middleware.Protected(), authorize, saleController.GetSalePaymentDeposits)
 	deposit := api.Group("/deposit")
-	deposit.Get("/:salePaymentId/:id", middleware.Protected(), saleController.FindSalePaymentDepositByIdAndSalePaymentId)
-	deposit.Post("/", middleware.Protected(), saleController.CreatePaymentDeposit)
-	deposit.Get("/:name", middleware.Protected(), saleController.GetPaymentDepositsByName)
-	deposit.Delete("/:id", middleware.Protected(), saleController.DeleteSalePaymentDepositByID)
-	deposit.Put("/:id", middleware.Protected(), saleController.UpdateSalePaymentDeposit)
+	deposit.Get("/:salePaymentId/:id", middleware.Protected(), authorize, saleController.FindSalePaymentDepositByIdAndSalePaymentId)
+	deposit.Post("/", middleware.Protected(), authorize, saleController.CreatePaymentDeposit)
+	deposit.Get("/:name", middleware.Protected(), authorize, saleController.GetPaymentDepositsByName)
+	deposit.Delete("/:id", middleware.Protected(), authorize, saleController.DeleteSalePaymentDepositByID)
+	deposit.Put("/:id", middleware.Protected(), authorize, saleController.UpdateSalePaymentDeposit)
 
 	// Auction Sale
 	auctionSaleDbService := repository.NewSaleAuctionRepository(db)
 	auctionSaleController := controllers.NewSaleAuctionController(auctionSaleDbService)
 
 	// Sale
-	api.Get("/auction-sales", middleware.Protected(), auctionSaleController.GetAllCarSales)
+	api.Get("/auction-sales", middleware.Protected(), authorize, auctionSaleController.GetAllCarSales)
 	SaleAuction := api.Group("/auction-sale")
-	SaleAuction.Get("/:id", middleware.Protected(), auctionSaleController.GetCarSale)
-	SaleAuction.Post("/", middleware.Protected(), auctionSaleController.CreateCarSale)
-	SaleAuction.Put("/:id", middleware.Protected(), auctionSaleController.UpdateSale)
-	SaleAuction.Delete("/:id", middleware.Protected(), auctionSaleController.DeleteSaleByID)
+	SaleAuction.Get("/:id", middleware.Protected(), authorize, auctionSaleController.GetCarSale)
+	SaleAuction.Post("/", middleware.Protected(), authorize, auctionSaleController.CreateCarSale)
+	SaleAuction.Put("/:id", middleware.Protected(), authorize, auctionSaleController.UpdateSale)
+	SaleAuction.Delete("/:id", middleware.Protected(), authorize, auctionSaleController.DeleteSaleByID)
 
 	// Alert data
 	alertDbService := repository.NewAlertRepository(db)
 	alertController := controllers.NewAlertController(alertDbService, saleDbService)
-	api.Get("/alerts/search", middleware.Protected(), alertController.SearchAlerts)
-	api.Put("/alert/:id", middleware.Protected(), alertController.UpdateAlert)
+	api.Get("/alerts/search", middleware.Protected(), authorize, alertController.SearchAlerts)
+	api.Put("/alert/:id", middleware.Protected(), authorize, alertController.UpdateAlert)
+
+	// Audit trail
+	auditDbService := repository.NewAuditLogRepository(db)
+	auditController := controllers.NewAuditController(auditDbService)
+	api.Get("/audit", middleware.Protected(), authorize, auditController.GetAuditLogs)
+
+	// Recycle bin: soft-deleted records, restore and (admins only) purge
+	recycleBinDbService := repository.NewRecycleBinRepository(db)
+	recycleBinController := controllers.NewRecycleBinController(recycleBinDbService)
+	recycleBin := api.Group("/recycle-bin")
+	recycleBin.Get("/", middleware.Protected(), authorize, recycleBinController.GetRecycleBin)
+	recycleBin.Delete("/purge", middleware.Protected(), authorize, middleware.RequireGroupMembership("admin"), recycleBinController.PurgeRecycleBin)
+	recycleBin.Get("/:entity", middleware.Protected(), authorize, recycleBinController.GetDeletedRecords)
+	recycleBin.Post("/:entity/:id/restore", middleware.Protected(), authorize, recycleBinController.RestoreRecord)
+
+	// Payment reminders
+	notificationDbService := repository.NewNotificationLogRepository(db)
+	notificationController := controllers.NewNotificationController(notificationDbService, reminders)
+	api.Get("/notifications/logs", middleware.Protected(), authorize, notificationController.GetNotificationLogs)
+	api.Post("/notifications/run", middleware.Protected(), authorize, notificationController.RunPaymentReminders)
 
 	// Meta data
-	metaDbService := repository.NewExcecute(db)
+	metaDbService := repository.NewVehicleEvaluationRepository(db)
 	metaController := controllers.NewMetaController(metaDbService)
 
 	// Meta data
 	meta := api.Group("/meta")
-	meta.Post("/vehicle-evaluation", middleware.Protected(), metaController.ProcessExcelAndUploadHandler)
+	meta.Post("/vehicle-evaluation", middleware.Protected(), authorize, metaController.ProcessExcelAndUploadHandler)
+	meta.Get("/vehicle-evaluation/versions", middleware.Protected(), authorize, metaController.GetEvaluationVersions)
+	meta.Get("/vehicle-evaluation/versions/diff", middleware.Protected(), authorize, metaController.DiffEvaluationVersions)
 	metaGDbService := repository.NewMetaGetRepository(db)
 	metaGController := controllers.NewMetaGetController(metaGDbService)
-	meta.Get("/vehicle-evaluation", middleware.Protected(), metaGController.FetchVehicleEvaluationsByDescription)
-	meta.Get("/weights", middleware.Protected(), metaGController.GetAllWeightUnits)
-	meta.Get("/lengths", middleware.Protected(), metaGController.GetAllLeightUnits)
-	meta.Get("/currency", middleware.Protected(), metaGController.GetAllCurrencies)
-	meta.Get("/expenses", middleware.Protected(), metaGController.GetAllExpenseCategories)
-	meta.Get("/ports", middleware.Protected(), metaGController.FindPorts)
-	meta.Get("/payment-modes", middleware.Protected(), metaGController.FindPaymentModeBymode)
+	meta.Get("/vehicle-evaluation", middleware.Protected(), authorize, metaGController.FetchVehicleEvaluationsByDescription)
+	meta.Get("/weights", middleware.Protected(), authorize, metaGController.GetAllWeightUnits)
+	meta.Get("/lengths", middleware.Protected(), authorize, metaGController.GetAllLeightUnits)
+	meta.Get("/currency", middleware.Protected(), authorize, metaGController.GetAllCurrencies)
+	meta.Get("/expenses", middleware.Protected(), authorize, metaGController.GetAllExpenseCategories)
+	meta.Get("/ports", middleware.Protected(), authorize, metaGController.FindPorts)
+	meta.Get("/payment-modes", middleware.Protected(), authorize, metaGController.FindPaymentModeBymode)
+
+	// Exchange rates
+	exchangeRateController := controllers.NewExchangeRateController(exchangeRateDbService)
+	meta.Get("/exchange-rates", middleware.Protected(), authorize, exchangeRateController.GetAllExchangeRates)
+	meta.Get("/exchange-rates/convert", middleware.Protected(), authorize, exchangeRateController.ConvertAmount)
+	meta.Get("/exchange-rates/:id", middleware.Protected(), authorize, exchangeRateController.GetExchangeRate)
+	meta.Post("/exchange-rates", middleware.Protected(), authorize, exchangeRateController.CreateExchangeRate)
+	meta.Put("/exchange-rates/:id", middleware.Protected(), authorize, exchangeRateController.UpdateExchangeRate)
+	meta.Delete("/exchange-rates/:id", middleware.Protected(), authorize, exchangeRateController.DeleteExchangeRateByID)
+	car.Get("/:id/totals", middleware.Protected(), authorize, exchangeRateController.GetCarCurrencyTotals)
+
+	// Profitability
+	carProfitabilityDbService := repository.NewCarProfitabilityRepository(db)
+	carProfitabilityController := controllers.NewCarProfitabilityController(carProfitabilityDbService)
+	car.Get("/:id/profitability", middleware.Protected(), authorize, carProfitabilityController.GetCarProfitability)
+	company.Get("/:companyId/profitability", middleware.Protected(), authorize, carProfitabilityController.GetCompanyProfitability)
+	sale.Get("/:id/totals", middleware.Protected(), authorize, exchangeRateController.GetSaleCurrencyTotals)
+
+	// Import duty estimator
+	dutyEstimateDbService := repository.NewDutyEstimateRepository(db)
+	dutyEstimateController := controllers.NewDutyEstimateController(dutyEstimateDbService)
+	meta.Get("/duty-rates", middleware.Protected(), authorize, dutyEstimateController.GetAllDutyRates)
+	meta.Post("/duty-rates", middleware.Protected(), authorize, dutyEstimateController.CreateDutyRate)
+	meta.Put("/duty-rates/:id", middleware.Protected(), authorize, dutyEstimateController.UpdateDutyRate)
+	meta.Delete("/duty-rates/:id", middleware.Protected(), authorize, dutyEstimateController.DeleteDutyRateByID)
+	meta.Post("/duty-estimate", middleware.Protected(), authorize, dutyEstimateController.EstimateDuty)
+	car.Get("/:id/duty-estimate", middleware.Protected(), authorize, dutyEstimateController.GetCarDutyEstimate)
 	app.Static("/uploads", "./uploads")
+
+	// Refuse to start while a route has no permission entry, and register the resources the table
+	// introduces with default grants for the seeded roles
+	if err := permissions.Check(app.GetRoutes(true)); err != nil {
+		log.Fatalf("Route permissions: %v", err)
+	}
+	if err := dbService.EnsureResources(defaultGrants()); err != nil {
+		log.Fatalf("Failed to register route resources: %v", err)
+	}
 	NotFoundRoute(app)
 }
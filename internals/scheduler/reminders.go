@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"car-bond/internals/config"
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/notifier"
+	"car-bond/internals/repository"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentReminders sends reminders for installments that are due (or about to be) once a day
+type PaymentReminders struct {
+	saleRepo  repository.SaleRepository
+	logRepo   repository.NotificationLogRepository
+	notifiers []notifier.Notifier
+	hour      int        // hour of the day the run starts
+	leadDays  int        // how many days before the due date customers are reminded
+	running   sync.Mutex // one run at a time, whether started by the timer or on demand
+}
+
+func NewPaymentReminders(db *gorm.DB, notifiers []notifier.Notifier) *PaymentReminders {
+	hour, err := strconv.Atoi(config.Config("REMINDER_HOUR"))
+	if err != nil || hour < 0 || hour > 23 {
+		hour = 8
+	}
+	leadDays, err := strconv.Atoi(config.Config("REMINDER_LEAD_DAYS"))
+	if err != nil || leadDays < 0 {
+		leadDays = 3
+	}
+
+	return &PaymentReminders{
+		saleRepo:  repository.NewSaleRepository(db),
+		logRepo:   repository.NewNotificationLogRepository(db),
+		notifiers: notifiers,
+		hour:      hour,
+		leadDays:  leadDays,
+	}
+}
+
+// Start runs the reminders every day at the configured hour until ctx is cancelled
+func (s *PaymentReminders) Start(ctx context.Context) {
+	go func() {
+		for {
+			next := nextRun(time.Now(), s.hour)
+			log.Printf("Payment reminders scheduled for %s", next.Format(time.RFC3339))
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			sent, err := s.Run(ctx)
+			if err != nil {
+				log.Printf("Payment reminders failed: %v", err)
+				continue
+			}
+			log.Printf("Payment reminders done: %d sent", sent)
+		}
+	}()
+}
+
+// nextRun returns the next occurrence of hour:00 after now
+func nextRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Run dispatches one round of reminders. A reminder already sent for a sale, due date and
+// channel is never sent again; failed ones are retried on the next run. A run waits for the
+// one in progress, so it sees the reminders that run logged.
+func (s *PaymentReminders) Run(ctx context.Context) (int, error) {
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	notifications, err := s.saleRepo.FindPaymentNotifications(0)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, s.leadDays).Format("2006-01-02")
+	sent := 0
+
+	for _, n := range notifications {
+		if n.DueDate.IsZero() {
+			continue
+		}
+		dueDate := n.DueDate.Format("2006-01-02")
+		if dueDate > cutoff {
+			continue
+		}
+
+		for _, ntf := range s.notifiers {
+			if ctx.Err() != nil {
+				return sent, ctx.Err()
+			}
+
+			previous, err := s.logRepo.FindNotificationLog(n.SaleID, dueDate, ntf.Channel())
+			if err != nil {
+				return sent, err
+			}
+			if previous != nil && previous.Status == alertRegistration.NotificationStatusSent {
+				continue
+			}
+
+			msg := notifier.Message{
+				To:      recipientFor(ntf.Channel(), n),
+				Subject: fmt.Sprintf("Payment reminder for sale #%d", n.SaleID),
+				Body: fmt.Sprintf("Dear %s, %s. Amount outstanding: %s, due %s.",
+					n.CustomerName, n.Message, n.AmountDue.StringFixed(), dueDate),
+			}
+
+			entry := alertRegistration.NotificationLog{
+				SaleID:        n.SaleID,
+				DueDate:       dueDate,
+				Channel:       ntf.Channel(),
+				InstallmentNo: n.InstallmentNo,
+				Recipient:     msg.To,
+				Message:       msg.Body,
+				AmountDue:     n.AmountDue,
+				Status:        alertRegistration.NotificationStatusSent,
+				Attempts:      1,
+				SentAt:        time.Now(),
+			}
+			if previous != nil {
+				entry.Attempts = previous.Attempts + 1
+			}
+
+			if err := ntf.Send(ctx, msg); err != nil {
+				entry.Status = alertRegistration.NotificationStatusFailed
+				entry.Error = err.Error()
+			} else {
+				sent++
+			}
+
+			if err := s.logRepo.SaveNotificationLog(&entry); err != nil {
+				return sent, err
+			}
+		}
+	}
+
+	return sent, nil
+}
+
+func recipientFor(channel string, n repository.Notification) string {
+	switch channel {
+	case notifier.ChannelEmail:
+		return n.Email
+	case notifier.ChannelSMS:
+		return n.PhoneNumber
+	default:
+		if n.PhoneNumber != "" {
+			return n.PhoneNumber
+		}
+		return n.Email
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"car-bond/internals/models/companyRegistration"
 	"car-bond/internals/models/metaData"
 	"car-bond/internals/models/userRegistration"
+	"car-bond/internals/money"
 	"log"
 
 	"golang.org/x/crypto/bcrypt"
@@ -518,6 +519,8 @@ func SeedDatabase(db *gorm.DB) {
 			GroupID:   1,
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
+			// The seeded password is public, so it has to be changed at first login
+			MustChangePassword: true,
 		},
 	}
 
@@ -533,6 +536,13 @@ func SeedDatabase(db *gorm.DB) {
 		log.Println("Users table already seeded, skipping...")
 	}
 
+	// Accounts seeded before the forced change existed still have the seeded password
+	if err := db.Model(&userRegistration.User{}).
+		Where("created_by = ? AND password_changed_at IS NULL AND must_change_password = ?", "Seeder", false).
+		Update("must_change_password", true).Error; err != nil {
+		log.Printf("Failed to require a password change of seeded users: %v", err)
+	}
+
 	// Expense categories
 	expenses := []metaData.ExpenseCategory{
 		{
@@ -784,60 +794,70 @@ func SeedDatabase(db *gorm.DB) {
 		{
 			Name:      "Kenyan Shilling",
 			Symbol:    "KSh",
+			Code:      "KES",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "Ugandan Shilling",
 			Symbol:    "USh",
+			Code:      "UGX",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "Tanzanian Shilling",
 			Symbol:    "TSh",
+			Code:      "TZS",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "Rwandan Franc",
 			Symbol:    "RWF",
+			Code:      "RWF",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "South Sudanese Pound",
 			Symbol:    "SSP",
+			Code:      "SSP",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "Sudanese Pound",
 			Symbol:    "SDG",
+			Code:      "SDG",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "Japanese Yen",
 			Symbol:    "JPY",
+			Code:      "JPY",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "Pound Sterling",
 			Symbol:    "GBP",
+			Code:      "GBP",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "United States Dollar",
 			Symbol:    "USD",
+			Code:      "USD",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
 		{
 			Name:      "Chinese Yuan (Renminbi)",
 			Symbol:    "CNY",
+			Code:      "CNY",
 			CreatedBy: "Seeder",
 			UpdatedBy: "",
 		},
@@ -856,6 +876,13 @@ func SeedDatabase(db *gorm.DB) {
 		log.Println("Currency table already seeded, skipping...")
 	}
 
+	// Backfill ISO codes on currencies seeded before the code column existed
+	for _, currency := range curruncies {
+		db.Model(&metaData.Currency{}).
+			Where("name = ? AND (code IS NULL OR code = '')", currency.Name).
+			Update("code", currency.Code)
+	}
+
 	ports := []metaData.Port{
 		{
 			Name:      "Port of Tokyo",
@@ -1131,4 +1158,82 @@ func SeedDatabase(db *gorm.DB) {
 		log.Println("Payment modes already seeded, skipping...")
 	}
 
+	// Import duty rate tables. Indicative defaults, adjust them from the URA notices via /meta/duty-rates.
+	dutyRates := []metaData.DutyRate{
+		{
+			Tax:         metaData.DutyTaxImportDuty,
+			Description: "Import Duty",
+			Basis:       metaData.DutyBasisCIF,
+			Rate:        money.NewFromInt(25),
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxVAT,
+			Description: "VAT (Value Added Tax)",
+			Basis:       metaData.DutyBasisCIFDuty,
+			Rate:        money.NewFromInt(18),
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxWithholding,
+			Description: "Withholding Tax",
+			Basis:       metaData.DutyBasisCIF,
+			Rate:        money.NewFromInt(6),
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxInfrastructureLevy,
+			Description: "Infrastructure Levy",
+			Basis:       metaData.DutyBasisCIF,
+			Rate:        money.New(1.5),
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxEnvironmentalLevy,
+			Description: "Environmental Levy (5 to 9 years)",
+			Basis:       metaData.DutyBasisCIF,
+			Rate:        money.NewFromInt(35),
+			MinAge:      5,
+			MaxAge:      9,
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxEnvironmentalLevy,
+			Description: "Environmental Levy (10 years and older)",
+			Basis:       metaData.DutyBasisCIF,
+			Rate:        money.NewFromInt(50),
+			MinAge:      10,
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxRegistration,
+			Description: "Registration Fee",
+			Amount:      money.NewFromInt(1000000),
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxRegistration,
+			Description: "Number Plates",
+			Amount:      money.NewFromInt(714300),
+			CreatedBy:   "Seeder",
+		},
+		{
+			Tax:         metaData.DutyTaxRegistration,
+			Description: "Stamp Duty",
+			Amount:      money.NewFromInt(35000),
+			CreatedBy:   "Seeder",
+		},
+	}
+
+	var dutyRateCount int64
+	db.Model(&metaData.DutyRate{}).Count(&dutyRateCount)
+	if dutyRateCount == 0 {
+		if err := db.Create(&dutyRates).Error; err != nil {
+			log.Fatalf("Failed to seed duty rates: %v", err)
+		} else {
+			log.Println("Duty rate data seeded successfully")
+		}
+	} else {
+		log.Println("Duty rates already seeded, skipping...")
+	}
 }
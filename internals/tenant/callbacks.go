@@ -0,0 +1,390 @@
+package tenant
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const scopedKey = "tenant:scoped"
+
+// Register installs the callbacks that keep a request inside the company of its user: reads, updates
+// and deletes of the owned tables only see that company's rows, and creates and updates cannot put a
+// row in another company. Users of the head-office group are not limited. Raw SQL is not scoped.
+func Register(db *gorm.DB) error {
+	types := make(map[reflect.Type]*ownership, len(owned))
+	for _, o := range owned {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(o.model); err != nil {
+			return err
+		}
+		o.table = stmt.Schema.Table
+		byTable[o.table] = o
+		types[reflect.TypeOf(o.model)] = o
+	}
+	for _, o := range owned {
+		if o.parent != nil {
+			if o.parentScope = types[reflect.TypeOf(o.parent)]; o.parentScope == nil {
+				return fmt.Errorf("tenant: the parent of %s is not scoped", o.table)
+			}
+		}
+	}
+
+	if err := db.Callback().Query().Before("gorm:query").Register("tenant:scope_query", scopeRead); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("tenant:scope_row", scopeRead); err != nil {
+		return err
+	}
+
+	create := db.Callback().Create()
+	if err := create.Before("gorm:create").After("gorm:before_create").Register("tenant:check_create", checkCreate); err != nil {
+		return err
+	}
+
+	update := db.Callback().Update()
+	if err := update.Before("gorm:update").After("gorm:before_update").Register("tenant:scope_update", scopeWrite); err != nil {
+		return err
+	}
+	if err := update.Before("gorm:update").After("tenant:scope_update").Register("tenant:check_update", checkUpdate); err != nil {
+		return err
+	}
+
+	return db.Callback().Delete().Before("gorm:delete").After("gorm:before_delete").Register("tenant:scope_delete", scopeWrite)
+}
+
+// scoping is the tenant the statement is limited to, if any
+func scoping(db *gorm.DB) (Tenant, bool) {
+	if db.Error != nil {
+		return Tenant{}, false
+	}
+	tenant, ok := Current(db.Statement.Context)
+	if !ok || tenant.HeadOffice {
+		return Tenant{}, false
+	}
+	return tenant, true
+}
+
+// refuse fails the statement with ErrOtherCompany
+func refuse(db *gorm.DB) {
+	if refused, ok := db.Statement.Context.Value(refusedKey{}).(*atomic.Bool); ok {
+		refused.Store(true)
+	}
+	db.AddError(ErrOtherCompany)
+}
+
+// qualified names a column of the statement's table, by its alias when it has one
+func qualified(name string) interface{} {
+	return clause.Column{Table: clause.CurrentTable, Name: name}
+}
+
+// restrict adds a condition once, however many times the statement is run
+func restrict(db *gorm.DB, condition clause.Expression) {
+	if _, done := db.InstanceGet(scopedKey); done {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{condition}})
+	db.InstanceSet(scopedKey, true)
+}
+
+func scopeRead(db *gorm.DB) {
+	tenant, ok := scoping(db)
+	if !ok {
+		return
+	}
+	if o := byTable[tableOf(db.Statement)]; o != nil {
+		restrict(db, o.condition(qualified, tenant.CompanyID))
+	}
+}
+
+func scopeWrite(db *gorm.DB) {
+	tenant, ok := scoping(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+	// Leave updates and deletes without conditions to GORM, which refuses them; a tenant condition
+	// would turn them into writes to every row of the company
+	if _, ok := stmt.Clauses["WHERE"]; !ok && !stmt.AllowGlobalUpdate && !hasPrimaryKey(stmt) {
+		return
+	}
+
+	table := tableOf(stmt)
+	if table == companyTable {
+		restrict(db, clause.Eq{Column: qualified("id"), Value: tenant.CompanyID})
+		return
+	}
+	if o := byTable[table]; o != nil {
+		restrict(db, o.condition(qualified, tenant.CompanyID))
+	}
+}
+
+// hasPrimaryKey reports whether the model the statement works on has its primary key set
+func hasPrimaryKey(stmt *gorm.Statement) bool {
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	found := false
+	eachRow(stmt, func(row reflect.Value) {
+		if _, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, row); !zero {
+			found = true
+		}
+	})
+	return found
+}
+
+func eachRow(stmt *gorm.Statement, fn func(row reflect.Value)) {
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			fn(reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		fn(stmt.ReflectValue)
+	}
+}
+
+// ====================
+
+// checkCreate gives new rows the caller's company when they name none and refuses rows of another
+// company, or under a parent the caller cannot see
+func checkCreate(db *gorm.DB) {
+	tenant, ok := scoping(db)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+	stmt := db.Statement
+	table := tableOf(stmt)
+
+	if table == companyTable {
+		// Save falls back to an upsert when its update matched nothing: keep it off other companies
+		eachRow(stmt, func(row reflect.Value) {
+			if id, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, row); !zero && !sameCompany(id, tenant.CompanyID) {
+				refuse(db)
+			}
+		})
+		return
+	}
+	o := byTable[table]
+	if o == nil {
+		return
+	}
+
+	eachRow(stmt, func(row reflect.Value) {
+		if db.Error != nil {
+			return
+		}
+		if o.parent != nil {
+			field := stmt.Schema.LookUpField(o.via)
+			if field == nil {
+				return
+			}
+			if parentID, zero := field.ValueOf(stmt.Context, row); !zero {
+				checkParent(db, o, parentID)
+			}
+			return
+		}
+
+		named := false
+		for _, name := range o.columns {
+			field := stmt.Schema.LookUpField(name)
+			if field == nil {
+				continue
+			}
+			value, zero := field.ValueOf(stmt.Context, row)
+			if zero {
+				continue
+			}
+			if sameCompany(value, tenant.CompanyID) {
+				return
+			}
+			named = true
+		}
+		if named {
+			refuse(db)
+			return
+		}
+		// No company given: the row is the caller's
+		if field := stmt.Schema.LookUpField(o.columns[0]); field != nil {
+			if err := field.Set(stmt.Context, row, tenant.CompanyID); err != nil {
+				db.AddError(err)
+			}
+		}
+	})
+}
+
+// checkUpdate refuses an update that would move rows to another company, or under a parent the caller
+// cannot see
+func checkUpdate(db *gorm.DB) {
+	tenant, ok := scoping(db)
+	if !ok {
+		return
+	}
+	o := byTable[tableOf(db.Statement)]
+	if o == nil {
+		return
+	}
+
+	if o.parent != nil {
+		if parentID, ok := assignedValue(db.Statement, o.via); ok {
+			checkParent(db, o, parentID)
+		}
+		return
+	}
+
+	// A row stays the caller's while one of its company columns holds its company, whether the update
+	// writes that column or leaves it as it is
+	var kept []string
+	for _, name := range o.columns {
+		value, ok := assignedValue(db.Statement, name)
+		if !ok {
+			kept = append(kept, name)
+			continue
+		}
+		if sameCompany(value, tenant.CompanyID) {
+			return
+		}
+	}
+	if len(kept) == len(o.columns) {
+		return // no company column is written
+	}
+	if len(kept) == 0 {
+		refuse(db)
+		return
+	}
+
+	rows, err := rowsToUpdate(db, kept)
+	if err != nil {
+		db.AddError(fmt.Errorf("tenant: failed to read %s before updating: %w", o.table, err))
+		return
+	}
+	for _, row := range rows {
+		held := false
+		for _, name := range kept {
+			if sameCompany(row[name], tenant.CompanyID) {
+				held = true
+				break
+			}
+		}
+		if !held {
+			refuse(db)
+			return
+		}
+	}
+}
+
+// rowsToUpdate reads the columns of the rows an update is about to change, with its conditions and the
+// primary keys of its model
+func rowsToUpdate(db *gorm.DB, columns []string) ([]map[string]interface{}, error) {
+	stmt := db.Statement
+	query := db.Session(&gorm.Session{NewDB: true}).Table(tableOf(stmt)).Select(columns)
+
+	conditions := false
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+		query = query.Clauses(clause.Where{Exprs: append([]clause.Expression(nil), where.Exprs...)})
+		conditions = true
+	}
+	if stmt.Schema != nil && stmt.Schema.PrioritizedPrimaryField != nil {
+		field := stmt.Schema.PrioritizedPrimaryField
+		var ids []interface{}
+		eachRow(stmt, func(row reflect.Value) {
+			if id, zero := field.ValueOf(stmt.Context, row); !zero {
+				ids = append(ids, id)
+			}
+		})
+		if len(ids) > 0 {
+			query = query.Where(clause.IN{Column: clause.Column{Name: field.DBName}, Values: ids})
+			conditions = true
+		}
+	}
+	if !conditions {
+		return nil, nil // GORM refuses updates without conditions
+	}
+	if !stmt.Unscoped && stmt.Schema != nil && stmt.Schema.LookUpField("DeletedAt") != nil {
+		query = query.Where(clause.Eq{Column: clause.Column{Name: "deleted_at"}, Value: nil})
+	}
+
+	var rows []map[string]interface{}
+	err := query.Find(&rows).Error
+	return rows, err
+}
+
+// assignedValue is the value an update writes to a column, from Update/Updates maps or from the struct
+// given to Updates or Save, following Select and Omit
+func assignedValue(stmt *gorm.Statement, column string) (interface{}, bool) {
+	if stmt.Schema == nil {
+		return nil, false
+	}
+	field := stmt.Schema.LookUpField(column)
+	if field == nil {
+		return nil, false
+	}
+	selected, restricted := stmt.SelectAndOmitColumns(false, true)
+	if chosen, ok := selected[field.DBName]; (ok && !chosen) || (restricted && !ok) {
+		return nil, false
+	}
+
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		for key, value := range dest {
+			if key == field.DBName || key == field.Name {
+				return value, true
+			}
+		}
+		return nil, false
+	}
+	value := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if value.Kind() != reflect.Struct || value.Type() != stmt.Schema.ModelType {
+		return nil, false
+	}
+	v, zero := field.ValueOf(stmt.Context, value)
+	if zero && !restricted {
+		return nil, false // Updates skips zero fields unless they are selected
+	}
+	return v, true
+}
+
+// checkParent refuses a row whose parent the caller cannot see. The lookup is scoped like any read.
+func checkParent(db *gorm.DB, o *ownership, parentID interface{}) {
+	if id, ok := toUint(parentID); ok && id == 0 {
+		return
+	}
+	var count int64
+	if err := db.Session(&gorm.Session{NewDB: true}).Table(o.parentScope.table).
+		Where("id = ?", parentID).Count(&count).Error; err != nil {
+		db.AddError(fmt.Errorf("tenant: failed to check %s %v: %w", o.parentScope.table, parentID, err))
+		return
+	}
+	if count == 0 {
+		refuse(db)
+	}
+}
+
+func sameCompany(value interface{}, companyID uint) bool {
+	id, ok := toUint(value)
+	return ok && id == companyID
+}
+
+// toUint reads the integer kinds company and foreign key fields are declared with
+func toUint(value interface{}) (uint, bool) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, true
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return 0, false
+		}
+		return uint(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return uint(v.Uint()), true
+	}
+	return 0, false
+}
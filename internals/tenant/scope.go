@@ -0,0 +1,137 @@
+package tenant
+
+import (
+	"car-bond/internals/audit"
+	"car-bond/internals/config"
+	"car-bond/internals/models/alertRegistration"
+	"car-bond/internals/models/carRegistration"
+	"car-bond/internals/models/companyRegistration"
+	"car-bond/internals/models/customerRegistration"
+	"car-bond/internals/models/saleRegistration"
+	"car-bond/internals/models/userRegistration"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultHeadOfficeGroup is the group that sees every company when HEAD_OFFICE_GROUP is not set
+const defaultHeadOfficeGroup = "admin"
+
+// ErrOtherCompany is returned when a write would put a record in a company the caller does not belong to
+var ErrOtherCompany = errors.New("the record belongs to another company")
+
+type refusedKey struct{}
+
+// TrackRefusals lets Refused tell afterwards whether a write made with the context, or with one derived
+// from it, failed with ErrOtherCompany
+func TrackRefusals(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refusedKey{}, new(atomic.Bool))
+}
+
+// Refused reports whether a write made with the context failed with ErrOtherCompany
+func Refused(ctx context.Context) bool {
+	refused, ok := ctx.Value(refusedKey{}).(*atomic.Bool)
+	return ok && refused.Load()
+}
+
+// ownership says how a table belongs to a company: by its own company columns (a row is the company's
+// when any of them holds it), or through the parent row its foreign key points to
+type ownership struct {
+	model   interface{}
+	columns []string
+	parent  interface{}
+	via     string // foreign key to the parent
+
+	// filled by Register
+	table       string
+	parentScope *ownership
+}
+
+// owned lists the tables scoped to the caller's company. Cars belong to both the company they come
+// from and the one they go to. Companies, shipping invoices and containers are shared: any company
+// reads them, and a company only changes its own company record (see companyTable).
+var owned = []*ownership{
+	{model: &carRegistration.Car{}, columns: []string{"from_company_id", "to_company_id"}},
+	{model: &carRegistration.CarExpense{}, parent: &carRegistration.Car{}, via: "car_id"},
+	{model: &carRegistration.CarScan{}, parent: &carRegistration.Car{}, via: "car_id"},
+	{model: &carRegistration.CarPhoto{}, parent: &carRegistration.Car{}, via: "car_id"},
+	{model: &carRegistration.CarStatusHistory{}, parent: &carRegistration.Car{}, via: "car_id"},
+	{model: &customerRegistration.Customer{}, columns: []string{"company_id"}},
+	{model: &customerRegistration.CustomerContact{}, parent: &customerRegistration.Customer{}, via: "customer_id"},
+	{model: &customerRegistration.CustomerAddress{}, parent: &customerRegistration.Customer{}, via: "customer_id"},
+	{model: &companyRegistration.CompanyExpense{}, columns: []string{"company_id"}},
+	{model: &companyRegistration.CompanyLocation{}, columns: []string{"company_id"}},
+	{model: &saleRegistration.Sale{}, columns: []string{"company_id"}},
+	{model: &saleRegistration.SaleAuction{}, columns: []string{"company_id"}},
+	{model: &saleRegistration.SalePayment{}, parent: &saleRegistration.Sale{}, via: "sale_id"},
+	{model: &saleRegistration.SaleInstallment{}, parent: &saleRegistration.Sale{}, via: "sale_id"},
+	{model: &saleRegistration.SalePaymentMode{}, parent: &saleRegistration.SalePayment{}, via: "sale_payment_id"},
+	{model: &saleRegistration.SalePaymentDeposit{}, parent: &saleRegistration.SalePayment{}, via: "sale_payment_id"},
+	{model: &alertRegistration.Transaction{}, columns: []string{"from_company_id", "to_company_id"}},
+	{model: &alertRegistration.NotificationLog{}, parent: &saleRegistration.Sale{}, via: "sale_id"},
+	{model: &userRegistration.User{}, columns: []string{"company_id"}},
+}
+
+// companyTable is read by every company but written only by its own
+var companyTable = "companies"
+
+// byTable is filled by Register
+var byTable = map[string]*ownership{}
+
+// Tenant is the company a request works for. A head-office tenant is not limited to it.
+type Tenant struct {
+	CompanyID  uint
+	HeadOffice bool
+}
+
+// Current is the tenant of the authenticated user the context carries. Without one nothing is scoped:
+// logins, the scheduler and the seeder work across companies.
+func Current(ctx context.Context) (Tenant, bool) {
+	actor, ok := audit.CurrentActor(ctx)
+	if !ok || !actor.Authenticated() {
+		return Tenant{}, false
+	}
+	return Tenant{CompanyID: actor.CompanyID, HeadOffice: IsHeadOffice(actor.Group)}, true
+}
+
+// IsHeadOffice reports whether a group sees every company (HEAD_OFFICE_GROUP, "admin" by default)
+func IsHeadOffice(group string) bool {
+	headOffice := config.Config("HEAD_OFFICE_GROUP")
+	if headOffice == "" {
+		headOffice = defaultHeadOfficeGroup
+	}
+	return group != "" && strings.EqualFold(group, headOffice)
+}
+
+// condition limits the rows of a table to those of the company. column names a column of the table in
+// the statement being built, which may be aliased.
+func (o *ownership) condition(column func(name string) interface{}, companyID uint) clause.Expr {
+	if o.parent == nil {
+		parts := make([]string, len(o.columns))
+		vars := make([]interface{}, 0, 2*len(o.columns))
+		for i, name := range o.columns {
+			parts[i] = "? = ?"
+			vars = append(vars, column(name), companyID)
+		}
+		return clause.Expr{SQL: "(" + strings.Join(parts, " OR ") + ")", Vars: vars}
+	}
+
+	parent := o.parentScope
+	inner := parent.condition(func(name string) interface{} { return clause.Column{Name: name} }, companyID)
+	return clause.Expr{
+		SQL:  "? IN (SELECT id FROM ? WHERE ?)",
+		Vars: []interface{}{column(o.via), clause.Table{Name: parent.table}, inner},
+	}
+}
+
+// tableOf is the real table a statement works on, whatever alias it goes by
+func tableOf(stmt *gorm.Statement) string {
+	if stmt.Schema != nil {
+		return stmt.Schema.Table
+	}
+	return stmt.Table
+}
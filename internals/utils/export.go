@@ -0,0 +1,312 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExportLocalsKey is where the Export middleware leaves the export for Paginate
+const ExportLocalsKey = "export"
+
+// exportBatchSize is how many rows are read from the database at a time while exporting
+const exportBatchSize = 500
+
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+)
+
+var (
+	ErrExportFormat  = errors.New("export must be xlsx or csv")
+	ErrExportColumns = errors.New("unknown export column")
+)
+
+// Export collects every row a list endpoint matches into a CSV or XLSX file instead of a JSON page.
+// Rows are read in batches and written straight to a temporary file.
+type Export struct {
+	Format  string
+	Columns []string // JSON field names, nested fields as car.make; empty for all plain fields
+
+	file   *os.File
+	csv    *csv.Writer
+	xlsx   *excelize.File
+	stream *excelize.StreamWriter
+	rows   int
+	used   bool
+	err    error
+}
+
+// NewExport prepares an export; columns is the comma separated ?columns= list
+func NewExport(format, columns string) (*Export, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != ExportCSV && format != ExportXLSX {
+		return nil, fmt.Errorf("%w, got %q", ErrExportFormat, format)
+	}
+
+	export := &Export{Format: format}
+	for _, column := range strings.Split(columns, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			export.Columns = append(export.Columns, column)
+		}
+	}
+	return export, nil
+}
+
+// ExportFromCtx returns the export requested for this request, if any
+func ExportFromCtx(c *fiber.Ctx) *Export {
+	export, _ := c.Locals(ExportLocalsKey).(*Export)
+	return export
+}
+
+// Used reports whether a list was written to the export
+func (e *Export) Used() bool { return e.used }
+
+// Err is the error that stopped the export
+func (e *Export) Err() error { return e.err }
+
+// Rows is the number of data rows written
+func (e *Export) Rows() int { return e.rows }
+
+// ContentType of the finished file
+func (e *Export) ContentType() string {
+	if e.Format == ExportXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func (e *Export) open(header []string) error {
+	file, err := os.CreateTemp("", "export-*."+e.Format)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	e.file = file
+
+	if e.Format == ExportCSV {
+		e.csv = csv.NewWriter(file)
+		return e.csv.Write(header)
+	}
+
+	e.xlsx = excelize.NewFile()
+	e.stream, err = e.xlsx.NewStreamWriter("Sheet1")
+	if err != nil {
+		return fmt.Errorf("failed to create export sheet: %w", err)
+	}
+	cells := make([]interface{}, len(header))
+	for i, title := range header {
+		cells[i] = title
+	}
+	return e.stream.SetRow("A1", cells)
+}
+
+func (e *Export) writeRow(values []interface{}) error {
+	e.rows++
+	if e.Format == ExportCSV {
+		// Numbers are written as JSON gave them, so amounts keep every decimal and never turn into
+		// scientific notation
+		record := make([]string, len(values))
+		for i, value := range values {
+			if value != nil {
+				record[i] = fmt.Sprint(value)
+			}
+		}
+		return e.csv.Write(record)
+	}
+
+	// Spreadsheet cells take numbers as numbers
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = value
+		if number, ok := value.(json.Number); ok {
+			if f, err := number.Float64(); err == nil {
+				cells[i] = f
+			}
+		}
+	}
+	cell, err := excelize.CoordinatesToCellName(1, e.rows+1)
+	if err != nil {
+		return err
+	}
+	return e.stream.SetRow(cell, cells)
+}
+
+// Finish flushes the file and reopens it for reading. The file is already unlinked, so it goes away
+// once the reader is closed.
+func (e *Export) Finish() (*os.File, int64, error) {
+	if e.Format == ExportCSV {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		if err := e.stream.Flush(); err != nil {
+			return nil, 0, err
+		}
+		if _, err := e.xlsx.WriteTo(e.file); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	name := e.file.Name()
+	if err := e.file.Close(); err != nil {
+		return nil, 0, err
+	}
+	reader, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := reader.Stat()
+	if err != nil {
+		reader.Close()
+		return nil, 0, err
+	}
+	os.Remove(name)
+	e.file = nil
+	return reader, info.Size(), nil
+}
+
+// Close drops the temporary file of an export that was not finished
+func (e *Export) Close() {
+	if e.xlsx != nil {
+		e.xlsx.Close()
+	}
+	if e.file != nil {
+		e.file.Close()
+		os.Remove(e.file.Name())
+	}
+}
+
+// exportColumns lists the JSON field names of a model. Plain fields come first; with nested set,
+// fields of related structs are listed as relation.field as well.
+func exportColumns(t reflect.Type, prefix string, nested bool) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var columns []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && fieldType.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			columns = append(columns, exportColumns(fieldType, prefix, nested)...)
+			continue
+		}
+
+		marshaler := reflect.PointerTo(fieldType).Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem())
+		switch {
+		case marshaler:
+			columns = append(columns, prefix+name)
+		case fieldType.Kind() == reflect.Struct:
+			if nested {
+				columns = append(columns, exportColumns(fieldType, prefix+name+".", false)...)
+			}
+		case fieldType.Kind() == reflect.Slice, fieldType.Kind() == reflect.Map:
+		default:
+			columns = append(columns, prefix+name)
+		}
+	}
+	return columns
+}
+
+// exportValue looks up a (dotted) column in a row decoded from JSON
+func exportValue(row map[string]interface{}, column string) interface{} {
+	var value interface{} = row
+	for _, key := range strings.Split(column, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+	return value
+}
+
+// exportRows writes every row of the query to the export, in the order the query returns them
+func exportRows[T any](export *Export, db *gorm.DB, model T) error {
+	columns := export.Columns
+	if len(columns) == 0 {
+		columns = exportColumns(reflect.TypeOf(model), "", false)
+	} else {
+		known := make(map[string]bool)
+		for _, column := range exportColumns(reflect.TypeOf(model), "", true) {
+			known[column] = true
+		}
+		for _, column := range columns {
+			if !known[column] {
+				return fmt.Errorf("%w %q", ErrExportColumns, column)
+			}
+		}
+	}
+
+	if err := export.open(columns); err != nil {
+		return err
+	}
+
+	// Batches are read by offset, so the order has to be stable
+	query := db
+	if _, ordered := db.Statement.Clauses["ORDER BY"]; !ordered {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: clause.PrimaryKey}})
+	}
+	query = query.Session(&gorm.Session{})
+	for offset := 0; ; offset += exportBatchSize {
+		var items []T
+		if err := query.Offset(offset).Limit(exportBatchSize).Find(&items).Error; err != nil {
+			return fmt.Errorf("failed to retrieve items: %w", err)
+		}
+
+		for _, item := range items {
+			encoded, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			decoder := json.NewDecoder(bytes.NewReader(encoded))
+			decoder.UseNumber()
+			var row map[string]interface{}
+			if err := decoder.Decode(&row); err != nil {
+				return err
+			}
+
+			values := make([]interface{}, len(columns))
+			for i, column := range columns {
+				values[i] = exportValue(row, column)
+			}
+			if err := export.writeRow(values); err != nil {
+				return fmt.Errorf("failed to write export row: %w", err)
+			}
+		}
+
+		if len(items) < exportBatchSize {
+			return nil
+		}
+	}
+}
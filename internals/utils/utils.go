@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"car-bond/internals/money"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -34,8 +35,19 @@ type Pagination struct {
 	ItemsPerPage int   `json:"items_per_page"`
 }
 
-// Paginate is a helper function to handle pagination
+// Paginate is a helper function to handle pagination. When the request asked for an export
+// (?export=xlsx|csv) every matching row goes to the export file instead and no items are returned.
 func Paginate[T any](c *fiber.Ctx, db *gorm.DB, model T) (Pagination, []T, error) {
+	if export := ExportFromCtx(c); export != nil && !export.used {
+		export.used = true
+		if err := exportRows(export, db, model); err != nil {
+			export.err = err
+			return Pagination{}, nil, err
+		}
+		rows := export.Rows()
+		return Pagination{Page: 1, Limit: rows, TotalItems: int64(rows), TotalPages: 1, CurrentPage: 1, ItemsPerPage: rows}, []T{}, nil
+	}
+
 	// Get pagination parameters from query
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page < 1 {
@@ -118,6 +130,15 @@ func StrToFloat(value string) float64 {
 	return result
 }
 
+func StrToMoney(value string) money.Money {
+	result, err := money.Parse(value)
+	if err != nil {
+		log.Printf("Error converting string to money: %s", err)
+		return money.Zero
+	}
+	return result
+}
+
 func StrToBool(value string) bool {
 	result, err := strconv.ParseBool(value)
 	if err != nil {
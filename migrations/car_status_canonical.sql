@@ -0,0 +1,40 @@
+-- Store car statuses in their canonical form.
+--
+-- The status state machine writes InTransit, InStock, Sold (car_status) and InStock, Sold, Exported
+-- (car_status_japan), and the dashboard counts and the carStatus filter compare with those exactly.
+-- Values written as free text before, such as "In stock" or "sold", are rewritten to the state they
+-- match ignoring case and spaces, in the cars and in their status history. Other values are left alone.
+--
+-- Pre-flight: the values that will change
+-- SELECT 'car_status' AS field, car_status AS value, COUNT(*) FROM cars
+--   WHERE car_status NOT IN ('InTransit', 'InStock', 'Sold') GROUP BY car_status
+-- UNION ALL SELECT 'car_status_japan', car_status_japan, COUNT(*) FROM cars
+--   WHERE car_status_japan NOT IN ('InStock', 'Sold', 'Exported') GROUP BY car_status_japan;
+
+BEGIN;
+
+-- car_status
+UPDATE cars SET car_status = 'InTransit' WHERE LOWER(REPLACE(car_status, ' ', '')) = 'intransit' AND car_status <> 'InTransit';
+UPDATE cars SET car_status = 'InStock' WHERE LOWER(REPLACE(car_status, ' ', '')) = 'instock' AND car_status <> 'InStock';
+UPDATE cars SET car_status = 'Sold' WHERE LOWER(REPLACE(car_status, ' ', '')) = 'sold' AND car_status <> 'Sold';
+UPDATE car_status_histories SET from_status = 'InTransit' WHERE field = 'car_status' AND LOWER(REPLACE(from_status, ' ', '')) = 'intransit' AND from_status <> 'InTransit';
+UPDATE car_status_histories SET to_status = 'InTransit' WHERE field = 'car_status' AND LOWER(REPLACE(to_status, ' ', '')) = 'intransit' AND to_status <> 'InTransit';
+UPDATE car_status_histories SET from_status = 'InStock' WHERE field = 'car_status' AND LOWER(REPLACE(from_status, ' ', '')) = 'instock' AND from_status <> 'InStock';
+UPDATE car_status_histories SET to_status = 'InStock' WHERE field = 'car_status' AND LOWER(REPLACE(to_status, ' ', '')) = 'instock' AND to_status <> 'InStock';
+UPDATE car_status_histories SET from_status = 'Sold' WHERE field = 'car_status' AND LOWER(REPLACE(from_status, ' ', '')) = 'sold' AND from_status <> 'Sold';
+UPDATE car_status_histories SET to_status = 'Sold' WHERE field = 'car_status' AND LOWER(REPLACE(to_status, ' ', '')) = 'sold' AND to_status <> 'Sold';
+
+-- car_status_japan
+UPDATE cars SET car_status_japan = 'InStock' WHERE LOWER(REPLACE(car_status_japan, ' ', '')) = 'instock' AND car_status_japan <> 'InStock';
+UPDATE cars SET car_status_japan = 'Sold' WHERE LOWER(REPLACE(car_status_japan, ' ', '')) = 'sold' AND car_status_japan <> 'Sold';
+UPDATE cars SET car_status_japan = 'Exported' WHERE LOWER(REPLACE(car_status_japan, ' ', '')) = 'exported' AND car_status_japan <> 'Exported';
+UPDATE car_status_histories SET from_status = 'InStock' WHERE field = 'car_status_japan' AND LOWER(REPLACE(from_status, ' ', '')) = 'instock' AND from_status <> 'InStock';
+UPDATE car_status_histories SET to_status = 'InStock' WHERE field = 'car_status_japan' AND LOWER(REPLACE(to_status, ' ', '')) = 'instock' AND to_status <> 'InStock';
+UPDATE car_status_histories SET from_status = 'Sold' WHERE field = 'car_status_japan' AND LOWER(REPLACE(from_status, ' ', '')) = 'sold' AND from_status <> 'Sold';
+UPDATE car_status_histories SET to_status = 'Sold' WHERE field = 'car_status_japan' AND LOWER(REPLACE(to_status, ' ', '')) = 'sold' AND to_status <> 'Sold';
+UPDATE car_status_histories SET from_status = 'Exported' WHERE field = 'car_status_japan' AND LOWER(REPLACE(from_status, ' ', '')) = 'exported' AND from_status <> 'Exported';
+UPDATE car_status_histories SET to_status = 'Exported' WHERE field = 'car_status_japan' AND LOWER(REPLACE(to_status, ' ', '')) = 'exported' AND to_status <> 'Exported';
+
+COMMIT;
+
+-- No rollback: the free-text spellings replaced are not kept.
@@ -0,0 +1,20 @@
+-- Let a deleted exchange rate be entered again.
+--
+-- The unique index on (base_currency, quote_currency, rate_date) also covered soft-deleted rows.
+-- It becomes a partial index over live rows only; AutoMigrate creates it this way on new databases.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_exchange_rate_pair_date;
+
+CREATE UNIQUE INDEX idx_exchange_rate_pair_date
+    ON exchange_rates (base_currency, quote_currency, rate_date)
+    WHERE deleted_at IS NULL;
+
+COMMIT;
+
+-- Rollback (fails while a deleted rate shares its pair and date with a live one):
+-- BEGIN;
+-- DROP INDEX IF EXISTS idx_exchange_rate_pair_date;
+-- CREATE UNIQUE INDEX idx_exchange_rate_pair_date ON exchange_rates (base_currency, quote_currency, rate_date);
+-- COMMIT;
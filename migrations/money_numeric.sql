@@ -0,0 +1,78 @@
+-- Convert money columns to exact numeric.
+--
+-- Amounts become NUMERIC(18,2) and rates (dollar rates, VAT percentages) NUMERIC(18,6).
+-- Exchange rates get NUMERIC(20,10): a rate such as JPY/USD 0.0067 needs the extra places.
+-- float8 values are cast to numeric first (15 significant digits, so no precision is lost
+-- on the way) and then rounded half away from zero, the same rule money.Money.Round uses.
+-- Only sub-cent float noise such as 1499.9999999998 is dropped; a value that does not fit
+-- the new precision makes the ALTER fail and the whole transaction rolls back.
+--
+-- Run the pre-flight query first to see which rows will be rounded.
+
+-- Pre-flight: rows whose stored amount is not a whole number of cents
+-- SELECT 'sales' AS tbl, id, total_price::numeric AS value FROM sales WHERE total_price::numeric <> ROUND(total_price::numeric, 2)
+-- UNION ALL SELECT 'sale_payments', id, amount_payed::numeric FROM sale_payments WHERE amount_payed::numeric <> ROUND(amount_payed::numeric, 2)
+-- UNION ALL SELECT 'car_expenses', id, amount::numeric FROM car_expenses WHERE amount::numeric <> ROUND(amount::numeric, 2)
+-- UNION ALL SELECT 'company_expenses', id, amount::numeric FROM company_expenses WHERE amount::numeric <> ROUND(amount::numeric, 2)
+-- UNION ALL SELECT 'cars', id, bid_price::numeric FROM cars WHERE bid_price::numeric <> ROUND(bid_price::numeric, 2)
+-- UNION ALL SELECT 'vehicle_evaluations', id, cif::numeric FROM vehicle_evaluations WHERE cif::numeric <> ROUND(cif::numeric, 2);
+
+BEGIN;
+
+ALTER TABLE cars
+    ALTER COLUMN bid_price TYPE NUMERIC(18,2) USING ROUND(bid_price::numeric, 2),
+    ALTER COLUMN vat_tax TYPE NUMERIC(18,6) USING ROUND(vat_tax::numeric, 6);
+
+ALTER TABLE car_expenses
+    ALTER COLUMN amount TYPE NUMERIC(18,2) USING ROUND(amount::numeric, 2),
+    ALTER COLUMN dollar_rate TYPE NUMERIC(18,6) USING ROUND(dollar_rate::numeric, 6),
+    ALTER COLUMN expense_vat TYPE NUMERIC(18,6) USING ROUND(expense_vat::numeric, 6);
+
+ALTER TABLE company_expenses
+    ALTER COLUMN amount TYPE NUMERIC(18,2) USING ROUND(amount::numeric, 2);
+
+ALTER TABLE sales
+    ALTER COLUMN total_price TYPE NUMERIC(18,2) USING ROUND(total_price::numeric, 2),
+    ALTER COLUMN dollar_rate TYPE NUMERIC(18,6) USING ROUND(dollar_rate::numeric, 6),
+    ALTER COLUMN inital_payment TYPE NUMERIC(18,2) USING ROUND(inital_payment::numeric, 2);
+
+ALTER TABLE sale_payments
+    ALTER COLUMN amount_payed TYPE NUMERIC(18,2) USING ROUND(amount_payed::numeric, 2);
+
+ALTER TABLE sale_payment_deposits
+    ALTER COLUMN amount_deposited TYPE NUMERIC(18,2) USING ROUND(amount_deposited::numeric, 2);
+
+ALTER TABLE sale_auctions
+    ALTER COLUMN price TYPE NUMERIC(18,2) USING ROUND(price::numeric, 2),
+    ALTER COLUMN vat_tax TYPE NUMERIC(18,6) USING ROUND(vat_tax::numeric, 6),
+    ALTER COLUMN recycle_fee TYPE NUMERIC(18,2) USING ROUND(recycle_fee::numeric, 2);
+
+ALTER TABLE sale_installments
+    ALTER COLUMN expected_amount TYPE NUMERIC(18,2) USING ROUND(expected_amount::numeric, 2),
+    ALTER COLUMN amount_allocated TYPE NUMERIC(18,2) USING ROUND(amount_allocated::numeric, 2);
+
+ALTER TABLE notification_logs
+    ALTER COLUMN amount_due TYPE NUMERIC(18,2) USING ROUND(amount_due::numeric, 2);
+
+ALTER TABLE vehicle_evaluations
+    ALTER COLUMN cif TYPE NUMERIC(18,2) USING ROUND(cif::numeric, 2);
+
+ALTER TABLE exchange_rates
+    ALTER COLUMN rate TYPE NUMERIC(20,10) USING ROUND(rate::numeric, 10);
+
+COMMIT;
+
+-- Rollback (back to float8):
+-- BEGIN;
+-- ALTER TABLE cars ALTER COLUMN bid_price TYPE DOUBLE PRECISION, ALTER COLUMN vat_tax TYPE DOUBLE PRECISION;
+-- ALTER TABLE car_expenses ALTER COLUMN amount TYPE DOUBLE PRECISION, ALTER COLUMN dollar_rate TYPE DOUBLE PRECISION, ALTER COLUMN expense_vat TYPE DOUBLE PRECISION;
+-- ALTER TABLE company_expenses ALTER COLUMN amount TYPE DOUBLE PRECISION;
+-- ALTER TABLE sales ALTER COLUMN total_price TYPE DOUBLE PRECISION, ALTER COLUMN dollar_rate TYPE DOUBLE PRECISION, ALTER COLUMN inital_payment TYPE DOUBLE PRECISION;
+-- ALTER TABLE sale_payments ALTER COLUMN amount_payed TYPE DOUBLE PRECISION;
+-- ALTER TABLE sale_payment_deposits ALTER COLUMN amount_deposited TYPE DOUBLE PRECISION;
+-- ALTER TABLE sale_auctions ALTER COLUMN price TYPE DOUBLE PRECISION, ALTER COLUMN vat_tax TYPE DOUBLE PRECISION, ALTER COLUMN recycle_fee TYPE DOUBLE PRECISION;
+-- ALTER TABLE sale_installments ALTER COLUMN expected_amount TYPE DOUBLE PRECISION, ALTER COLUMN amount_allocated TYPE DOUBLE PRECISION;
+-- ALTER TABLE notification_logs ALTER COLUMN amount_due TYPE DOUBLE PRECISION;
+-- ALTER TABLE vehicle_evaluations ALTER COLUMN cif TYPE DOUBLE PRECISION;
+-- ALTER TABLE exchange_rates ALTER COLUMN rate TYPE NUMERIC;
+-- COMMIT;